@@ -19,6 +19,9 @@ type SentPacketHandler interface {
 	ShouldSendRetransmittablePacket() bool
 	DequeuePacketForRetransmission() (packet *Packet)
 	GetLeastUnacked() protocol.PacketNumber
+	// DequeueMTUProbeResult returns the result of a path MTU probe that was acknowledged or declared lost.
+	// It returns nil if there is none.
+	DequeueMTUProbeResult() *MTUProbeResult
 
 	GetAlarmTimeout() time.Time
 	OnAlarm()
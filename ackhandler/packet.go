@@ -14,11 +14,21 @@ type Packet struct {
 	Frames          []wire.Frame
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
+	// IsMTUProbe is set for padded packets sent for path MTU discovery.
+	// They are not retransmitted, and their loss doesn't cause a congestion response.
+	IsMTUProbe bool
 
 	SendTime time.Time
 }
 
+// An MTUProbeResult says if a path MTU probe packet of a certain size was acknowledged or lost
+type MTUProbeResult struct {
+	Size  protocol.ByteCount
+	Acked bool
+}
+
 // GetFramesForRetransmission gets all the frames for retransmission
+// DATAGRAM frames are never retransmitted.
 func (p *Packet) GetFramesForRetransmission() []wire.Frame {
 	var fs []wire.Frame
 	for _, frame := range p.Frames {
@@ -27,6 +37,8 @@ func (p *Packet) GetFramesForRetransmission() []wire.Frame {
 			continue
 		case *wire.StopWaitingFrame:
 			continue
+		case *wire.DatagramFrame:
+			continue
 		}
 		fs = append(fs, frame)
 	}
@@ -29,6 +29,16 @@ var _ = Describe("Packet", func() {
 			Expect(packet.GetFramesForRetransmission()).To(BeNil())
 		})
 
+		It("doesn't retransmit DATAGRAM frames", func() {
+			packet := &Packet{
+				Frames: []wire.Frame{
+					&wire.DatagramFrame{Data: []byte("foobar")},
+					streamFrame,
+				},
+			}
+			Expect(packet.GetFramesForRetransmission()).To(Equal([]wire.Frame{streamFrame}))
+		})
+
 		It("returns all retransmittable frames", func() {
 			packet := &Packet{
 				Frames: []wire.Frame{
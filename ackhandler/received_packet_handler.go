@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
@@ -26,14 +27,16 @@ type receivedPacketHandler struct {
 	lastAck                                    *wire.AckFrame
 
 	version protocol.VersionNumber
+	clock   utils.Clock
 }
 
 // NewReceivedPacketHandler creates a new receivedPacketHandler
-func NewReceivedPacketHandler(version protocol.VersionNumber) ReceivedPacketHandler {
+func NewReceivedPacketHandler(version protocol.VersionNumber, clock utils.Clock) ReceivedPacketHandler {
 	return &receivedPacketHandler{
 		packetHistory: newReceivedPacketHistory(),
 		ackSendDelay:  protocol.AckSendDelay,
 		version:       version,
+		clock:         clock,
 	}
 }
 
@@ -44,7 +47,7 @@ func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumbe
 
 	if packetNumber > h.largestObserved {
 		h.largestObserved = packetNumber
-		h.largestObservedReceivedTime = time.Now()
+		h.largestObservedReceivedTime = h.clock.Now()
 	}
 
 	if packetNumber <= h.lowerLimit {
@@ -102,7 +105,7 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 			h.ackQueued = true
 		} else {
 			if h.ackAlarm.IsZero() {
-				h.ackAlarm = time.Now().Add(h.ackSendDelay)
+				h.ackAlarm = h.clock.Now().Add(h.ackSendDelay)
 			}
 		}
 	}
@@ -114,15 +117,16 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 }
 
 func (h *receivedPacketHandler) GetAckFrame() *wire.AckFrame {
-	if !h.ackQueued && (h.ackAlarm.IsZero() || h.ackAlarm.After(time.Now())) {
+	now := h.clock.Now()
+	if !h.ackQueued && (h.ackAlarm.IsZero() || h.ackAlarm.After(now)) {
 		return nil
 	}
 
 	ackRanges := h.packetHistory.GetAckRanges()
 	ack := &wire.AckFrame{
-		LargestAcked:       h.largestObserved,
-		LowestAcked:        ackRanges[len(ackRanges)-1].First,
-		PacketReceivedTime: h.largestObservedReceivedTime,
+		LargestAcked: h.largestObserved,
+		LowestAcked:  ackRanges[len(ackRanges)-1].First,
+		DelayTime:    now.Sub(h.largestObservedReceivedTime),
 	}
 
 	if len(ackRanges) > 1 {
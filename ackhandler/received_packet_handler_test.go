@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
 	. "github.com/onsi/ginkgo"
@@ -16,7 +17,7 @@ var _ = Describe("receivedPacketHandler", func() {
 	)
 
 	BeforeEach(func() {
-		handler = NewReceivedPacketHandler(protocol.VersionWhatever).(*receivedPacketHandler)
+		handler = NewReceivedPacketHandler(protocol.VersionWhatever, utils.DefaultClock{}).(*receivedPacketHandler)
 	})
 
 	Context("accepting packets", func() {
@@ -290,6 +291,22 @@ var _ = Describe("receivedPacketHandler", func() {
 				handler.ackAlarm = time.Now().Add(-time.Minute)
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
 			})
+
+			It("uses the clock", func() {
+				start := time.Now().Add(-time.Hour)
+				clock := utils.NewVirtualClock(start)
+				handler = NewReceivedPacketHandler(protocol.VersionWhatever, clock).(*receivedPacketHandler)
+				err := handler.ReceivedPacket(1, true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.largestObservedReceivedTime).To(Equal(start))
+				clock.AdvanceTo(start.Add(10 * time.Millisecond))
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.DelayTime).To(Equal(10 * time.Millisecond))
+				err = handler.ReceivedPacket(2, true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.GetAlarmTimeout()).To(Equal(start.Add(10*time.Millisecond + protocol.AckSendDelay)))
+			})
 		})
 	})
 })
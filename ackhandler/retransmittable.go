@@ -14,6 +14,8 @@ func stripNonRetransmittableFrames(fs []wire.Frame) []wire.Frame {
 }
 
 // IsFrameRetransmittable returns true if the frame should be retransmitted.
+// DATAGRAM frames count as retransmittable, since they have to be acknowledged and are subject to congestion control,
+// but they are never actually retransmitted, see Packet.GetFramesForRetransmission.
 func IsFrameRetransmittable(f wire.Frame) bool {
 	switch f.(type) {
 	case *wire.StopWaitingFrame:
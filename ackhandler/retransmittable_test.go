@@ -14,6 +14,7 @@ var _ = Describe("retransmittable frames", func() {
 		&wire.StopWaitingFrame{}:     false,
 		&wire.BlockedFrame{}:         true,
 		&wire.ConnectionCloseFrame{}: true,
+		&wire.DatagramFrame{}:        true,
 		&wire.GoawayFrame{}:          true,
 		&wire.PingFrame{}:            true,
 		&wire.RstStreamFrame{}:       true,
@@ -55,11 +55,13 @@ type sentPacketHandler struct {
 	stopWaitingManager stopWaitingManager
 
 	retransmissionQueue []*Packet
+	mtuProbeResults     []MTUProbeResult
 
 	bytesInFlight protocol.ByteCount
 
 	congestion congestion.SendAlgorithm
 	rttStats   *congestion.RTTStats
+	clock      utils.Clock
 
 	handshakeComplete bool
 	// The number of times the handshake packets have been retransmitted without receiving an ack.
@@ -76,9 +78,9 @@ type sentPacketHandler struct {
 }
 
 // NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats) SentPacketHandler {
+func NewSentPacketHandler(rttStats *congestion.RTTStats, clock utils.Clock) SentPacketHandler {
 	congestion := congestion.NewCubicSender(
-		congestion.DefaultClock{},
+		clock,
 		rttStats,
 		false, /* don't use reno since chromium doesn't (why?) */
 		protocol.InitialCongestionWindow,
@@ -90,6 +92,7 @@ func NewSentPacketHandler(rttStats *congestion.RTTStats) SentPacketHandler {
 		stopWaitingManager: stopWaitingManager{},
 		rttStats:           rttStats,
 		congestion:         congestion,
+		clock:              clock,
 	}
 }
 
@@ -126,7 +129,7 @@ func (h *sentPacketHandler) SentPacket(packet *Packet) error {
 	}
 
 	h.lastSentPacketNumber = packet.PacketNumber
-	now := time.Now()
+	now := h.clock.Now()
 
 	packet.Frames = stripNonRetransmittableFrames(packet.Frames)
 	isRetransmittable := len(packet.Frames) != 0
@@ -242,7 +245,7 @@ func (h *sentPacketHandler) maybeUpdateRTT(largestAcked protocol.PacketNumber, a
 	for el := h.packetHistory.Front(); el != nil; el = el.Next() {
 		packet := el.Value
 		if packet.PacketNumber == largestAcked {
-			h.rttStats.UpdateRTT(rcvTime.Sub(packet.SendTime), ackDelay, time.Now())
+			h.rttStats.UpdateRTT(rcvTime.Sub(packet.SendTime), ackDelay, h.clock.Now())
 			return true
 		}
 		// Packets are sorted by number, so we can stop searching
@@ -262,19 +265,19 @@ func (h *sentPacketHandler) updateLossDetectionAlarm() {
 
 	// TODO(#497): TLP
 	if !h.handshakeComplete {
-		h.alarm = time.Now().Add(h.computeHandshakeTimeout())
+		h.alarm = h.clock.Now().Add(h.computeHandshakeTimeout())
 	} else if !h.lossTime.IsZero() {
 		// Early retransmit timer or time loss detection.
 		h.alarm = h.lossTime
 	} else {
 		// RTO
-		h.alarm = time.Now().Add(h.computeRTOTimeout())
+		h.alarm = h.clock.Now().Add(h.computeRTOTimeout())
 	}
 }
 
 func (h *sentPacketHandler) detectLostPackets() {
 	h.lossTime = time.Time{}
-	now := time.Now()
+	now := h.clock.Now()
 
 	maxRTT := float64(utils.MaxDuration(h.rttStats.LatestRTT(), h.rttStats.SmoothedRTT()))
 	delayUntilLost := time.Duration((1.0 + timeReorderingFraction) * maxRTT)
@@ -288,7 +291,8 @@ func (h *sentPacketHandler) detectLostPackets() {
 		}
 
 		timeSinceSent := now.Sub(packet.SendTime)
-		if timeSinceSent > delayUntilLost {
+		// the loss time is set to the time when this condition becomes true, so it must be fulfilled when the alarm fires at that time
+		if timeSinceSent >= delayUntilLost {
 			lostPackets = append(lostPackets, el)
 		} else if h.lossTime.IsZero() {
 			// Note: This conditional is only entered once per call
@@ -298,6 +302,10 @@ func (h *sentPacketHandler) detectLostPackets() {
 
 	if len(lostPackets) > 0 {
 		for _, p := range lostPackets {
+			if p.Value.IsMTUProbe {
+				h.onMTUProbeLost(p)
+				continue
+			}
 			h.queuePacketForRetransmission(p)
 			h.congestion.OnPacketLost(p.Value.PacketNumber, p.Value.Length, h.bytesInFlight)
 		}
@@ -325,6 +333,9 @@ func (h *sentPacketHandler) GetAlarmTimeout() time.Time {
 }
 
 func (h *sentPacketHandler) onPacketAcked(packetElement *PacketElement) {
+	if packetElement.Value.IsMTUProbe {
+		h.mtuProbeResults = append(h.mtuProbeResults, MTUProbeResult{Size: packetElement.Value.Length, Acked: true})
+	}
 	h.bytesInFlight -= packetElement.Value.Length
 	h.rtoCount = 0
 	h.handshakeCount = 0
@@ -344,6 +355,15 @@ func (h *sentPacketHandler) DequeuePacketForRetransmission() *Packet {
 	return packet
 }
 
+func (h *sentPacketHandler) DequeueMTUProbeResult() *MTUProbeResult {
+	if len(h.mtuProbeResults) == 0 {
+		return nil
+	}
+	res := h.mtuProbeResults[0]
+	h.mtuProbeResults = h.mtuProbeResults[1:]
+	return &res
+}
+
 func (h *sentPacketHandler) GetLeastUnacked() protocol.PacketNumber {
 	return h.largestInOrderAcked() + 1
 }
@@ -378,6 +398,12 @@ func (h *sentPacketHandler) retransmitOldestTwoPackets() {
 
 func (h *sentPacketHandler) queueRTO(el *PacketElement) {
 	packet := &el.Value
+	if packet.IsMTUProbe {
+		// The probe was probably dropped because it was too large.
+		// This is no indication of congestion.
+		h.onMTUProbeLost(el)
+		return
+	}
 	utils.Debugf(
 		"\tQueueing packet 0x%x for retransmission (RTO), %d outstanding",
 		packet.PacketNumber,
@@ -400,6 +426,15 @@ func (h *sentPacketHandler) queueHandshakePacketsForRetransmission() {
 	}
 }
 
+// onMTUProbeLost removes a lost path MTU probe. Probes are not retransmitted.
+func (h *sentPacketHandler) onMTUProbeLost(packetElement *PacketElement) {
+	packet := &packetElement.Value
+	h.bytesInFlight -= packet.Length
+	h.mtuProbeResults = append(h.mtuProbeResults, MTUProbeResult{Size: packet.Length})
+	h.packetHistory.Remove(packetElement)
+	h.stopWaitingManager.QueuedRetransmissionForPacketNumber(packet.PacketNumber)
+}
+
 func (h *sentPacketHandler) queuePacketForRetransmission(packetElement *PacketElement) {
 	packet := &packetElement.Value
 	h.bytesInFlight -= packet.Length
@@ -5,6 +5,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -87,7 +88,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats).(*sentPacketHandler)
+		handler = NewSentPacketHandler(rttStats, utils.DefaultClock{}).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -824,6 +825,42 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
 			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
 		})
+
+		Context("when the alarm fires exactly at the loss time", func() {
+			var clock *utils.VirtualClock
+
+			BeforeEach(func() {
+				start := time.Now().Add(-time.Hour)
+				clock = utils.NewVirtualClock(start)
+				handler = NewSentPacketHandler(&congestion.RTTStats{}, clock).(*sentPacketHandler)
+				handler.SetHandshakeComplete()
+				for i := 1; i <= 2; i++ {
+					err := handler.SentPacket(retransmittablePacket(protocol.PacketNumber(i)))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				clock.AdvanceTo(start.Add(100 * time.Millisecond))
+				err := handler.ReceivedAck(&wire.AckFrame{LargestAcked: 2, LowestAcked: 2}, 1, clock.Now())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.lossTime.IsZero()).To(BeFalse())
+				Expect(handler.GetAlarmTimeout()).To(Equal(handler.lossTime))
+			})
+
+			It("declares packets lost", func() {
+				clock.AdvanceTo(handler.GetAlarmTimeout())
+				handler.OnAlarm()
+				Expect(handler.lossTime.IsZero()).To(BeTrue())
+				Expect(handler.retransmissionQueue).To(HaveLen(1))
+				Expect(handler.retransmissionQueue[0].PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			})
+
+			It("doesn't declare packets lost before the loss time", func() {
+				lossTime := handler.lossTime
+				clock.AdvanceTo(lossTime.Add(-time.Nanosecond))
+				handler.OnAlarm()
+				Expect(handler.lossTime).To(Equal(lossTime))
+				Expect(handler.retransmissionQueue).To(BeEmpty())
+			})
+		})
 	})
 
 	Context("retransmission for handshake packets", func() {
@@ -882,4 +919,86 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.rtoCount).To(BeEquivalentTo(1))
 		})
 	})
+
+	Context("path MTU probes", func() {
+		var cong *mockCongestion
+
+		mtuProbe := func(num protocol.PacketNumber, size protocol.ByteCount) *Packet {
+			return &Packet{
+				PacketNumber:    num,
+				Length:          size,
+				Frames:          []wire.Frame{&wire.PingFrame{}},
+				EncryptionLevel: protocol.EncryptionForwardSecure,
+				IsMTUProbe:      true,
+			}
+		}
+
+		BeforeEach(func() {
+			cong = &mockCongestion{}
+			handler.congestion = cong
+		})
+
+		It("reports acknowledged probes", func() {
+			Expect(handler.DequeueMTUProbeResult()).To(BeNil())
+			err := handler.SentPacket(mtuProbe(1, 1500))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(1500)))
+			err = handler.ReceivedAck(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.DequeueMTUProbeResult()).To(Equal(&MTUProbeResult{Size: 1500, Acked: true}))
+			Expect(handler.DequeueMTUProbeResult()).To(BeNil())
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
+		It("reports probes declared lost, without retransmitting them or reducing the congestion window", func() {
+			err := handler.SentPacket(mtuProbe(1, 1500))
+			Expect(err).ToNot(HaveOccurred())
+			err = handler.SentPacket(retransmittablePacket(2))
+			Expect(err).ToNot(HaveOccurred())
+			handler.packetHistory.Front().Value.SendTime = time.Now().Add(-time.Hour)
+			err = handler.ReceivedAck(&wire.AckFrame{LargestAcked: 2, LowestAcked: 2}, 1, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.DequeueMTUProbeResult()).To(Equal(&MTUProbeResult{Size: 1500}))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(cong.packetsLost).To(BeEmpty())
+			Expect(handler.packetHistory.Len()).To(BeZero())
+			Expect(handler.bytesInFlight).To(BeZero())
+			Expect(handler.GetStopWaitingFrame(false)).To(Equal(&wire.StopWaitingFrame{LeastUnacked: 3}))
+		})
+
+		It("reports probes lost when the RTO expires, without a congestion response", func() {
+			err := handler.SentPacket(mtuProbe(1, 1500))
+			Expect(err).ToNot(HaveOccurred())
+			handler.OnAlarm()
+			Expect(handler.DequeueMTUProbeResult()).To(Equal(&MTUProbeResult{Size: 1500}))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(cong.onRetransmissionTimeout).To(BeFalse())
+			Expect(cong.packetsLost).To(BeEmpty())
+		})
+	})
+
+	Context("using a virtual clock", func() {
+		var (
+			clock *utils.VirtualClock
+			start time.Time
+		)
+
+		BeforeEach(func() {
+			start = time.Now().Add(-time.Hour)
+			clock = utils.NewVirtualClock(start)
+			handler = NewSentPacketHandler(&congestion.RTTStats{}, clock).(*sentPacketHandler)
+			handler.SetHandshakeComplete()
+		})
+
+		It("uses the clock for send times and RTT measurements", func() {
+			err := handler.SentPacket(retransmittablePacket(1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.packetHistory.Front().Value.SendTime).To(Equal(start))
+			Expect(handler.GetAlarmTimeout()).To(Equal(start.Add(defaultRTOTimeout)))
+			clock.AdvanceTo(start.Add(300 * time.Millisecond))
+			err = handler.ReceivedAck(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, clock.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.rttStats.LatestRTT()).To(Equal(300 * time.Millisecond))
+		})
+	})
 })
@@ -0,0 +1,84 @@
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// maxGSOSegments is the maximum number of segments that can be sent using a single GSO send (UDP_MAX_SEGMENTS in the Linux kernel)
+	maxGSOSegments = 64
+	// maxGSOSize is the maximum size of all segments of a GSO send
+	maxGSOSize = 65000
+)
+
+// A batchConn reads and writes multiple packets in a single system call.
+// It is implemented by ipv4.PacketConn and ipv6.PacketConn.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// newBatchConn returns a batchConn for the given net.PacketConn.
+// It returns false if batched I/O is not supported for this connection.
+func newBatchConn(c net.PacketConn) (batchConn, bool) {
+	udpConn, ok := c.(*net.UDPConn)
+	if !ok || !batchIOSupported {
+		return nil, false
+	}
+	// An IPv6 socket might also receive packets from IPv4 addresses (using IPv4-mapped IPv6 addresses).
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		return ipv6.NewPacketConn(udpConn), true
+	}
+	return ipv4.NewPacketConn(udpConn), true
+}
+
+// gsoEnabled says if UDP generic segmentation offload should be used for sending on this connection.
+// GSO can be disabled by setting the QUIC_GO_DISABLE_GSO environment variable.
+func gsoEnabled(c net.PacketConn) bool {
+	if os.Getenv("QUIC_GO_DISABLE_GSO") != "" {
+		return false
+	}
+	udpConn, ok := c.(*net.UDPConn)
+	if !ok {
+		return false
+	}
+	return gsoSupported(udpConn)
+}
+
+// gsoSegments returns how many of the packets can be sent as segments of a single GSO send.
+// All segments must have the same size, only the last segment may be smaller.
+func gsoSegments(packets [][]byte) int {
+	size := len(packets[0])
+	maxSegments := maxGSOSegments
+	if size > 0 && maxGSOSize/size < maxSegments {
+		maxSegments = maxGSOSize / size
+	}
+	n := 1
+	for n < len(packets) && n < maxSegments {
+		l := len(packets[n])
+		if l > size {
+			break
+		}
+		n++
+		if l < size {
+			break
+		}
+	}
+	return n
+}
+
+// isGSOError says if a send failed because the network interface doesn't support GSO
+func isGSOError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EIO
+}
@@ -0,0 +1,44 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// On Linux, ReadBatch and WriteBatch use recvmmsg and sendmmsg.
+const batchIOSupported = true
+
+// UDP_SEGMENT from linux/udp.h, not defined in the syscall package.
+// It is set on the SOL_UDP level, which is the same as IPPROTO_UDP.
+const udpSegment = 103
+
+// gsoSupported checks if the kernel supports the UDP_SEGMENT socket option (added in Linux 4.18)
+func gsoSupported(c *net.UDPConn) bool {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		_, serr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// appendUDPSegmentSizeMsg appends a control message setting the GSO segment size
+func appendUDPSegmentSizeMsg(b []byte, size uint16) []byte {
+	const dataLen = 2 // the segment size is an uint16
+	startLen := len(b)
+	b = append(b, make([]byte, syscall.CmsgSpace(dataLen))...)
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[startLen]))
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(dataLen))
+	*(*uint16)(unsafe.Pointer(&b[startLen+syscall.CmsgSpace(0)])) = size
+	return b
+}
@@ -0,0 +1,64 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batched I/O", func() {
+	It("reads and writes batches on a UDP connection", func() {
+		serverConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer serverConn.Close()
+		clientConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer clientConn.Close()
+
+		c := newConn(clientConn, serverConn.LocalAddr())
+		Expect(c.batchConn).ToNot(BeNil())
+		Expect(c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})).To(Succeed())
+
+		r := newPacketReader(serverConn)
+		Expect(r).To(BeAssignableToTypeOf(&batchPacketReader{}))
+		var received []string
+		Eventually(func() []string {
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			for _, p := range packets {
+				Expect(p.remoteAddr.String()).To(Equal(clientConn.LocalAddr().String()))
+				received = append(received, string(p.data))
+			}
+			return received
+		}).Should(Equal([]string{"foo", "bar"}))
+	})
+	It("sends segments using GSO", func() {
+		serverConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer serverConn.Close()
+		clientConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer clientConn.Close()
+
+		if !gsoSupported(clientConn) {
+			Skip("the kernel doesn't support GSO")
+		}
+		c := newConn(clientConn, serverConn.LocalAddr())
+		Expect(c.gso).To(BeTrue())
+		Expect(c.WriteBatch([][]byte{[]byte("foo"), []byte("bar"), []byte("ba")})).To(Succeed())
+
+		r := newPacketReader(serverConn)
+		var received []string
+		Eventually(func() []string {
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			for _, p := range packets {
+				received = append(received, string(p.data))
+			}
+			return received
+		}).Should(Equal([]string{"foo", "bar", "ba"}))
+	})
+})
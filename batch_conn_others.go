@@ -0,0 +1,13 @@
+// +build !linux
+
+package quic
+
+import "net"
+
+// On other platforms, ReadBatch and WriteBatch only read and write a single packet per system call.
+const batchIOSupported = false
+
+// GSO is only supported on Linux
+func gsoSupported(*net.UDPConn) bool { return false }
+
+func appendUDPSegmentSizeMsg(b []byte, _ uint16) []byte { return b }
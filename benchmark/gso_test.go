@@ -0,0 +1,43 @@
+// +build linux
+
+package benchmark
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+)
+
+func init() {
+	var _ = Describe("GSO Benchmarks", func() {
+		dataLen := size * /* MB */ 1e6
+		data := make([]byte, dataLen)
+		rand.Seed(GinkgoRandomSeed())
+		rand.Read(data) // no need to check for an error. math.Rand.Read never errors
+
+		version := protocol.SupportedVersions[0]
+
+		Context("with GSO", func() {
+			Measure(fmt.Sprintf("transferring a %d MB file", size), func(b Benchmarker) {
+				transferFile(b, version, data)
+			}, samples)
+		})
+
+		Context("without GSO", func() {
+			BeforeEach(func() {
+				os.Setenv("QUIC_GO_DISABLE_GSO", "1")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("QUIC_GO_DISABLE_GSO")
+			})
+
+			Measure(fmt.Sprintf("transferring a %d MB file", size), func(b Benchmarker) {
+				transferFile(b, version, data)
+			}, samples)
+		})
+	})
+}
@@ -8,18 +8,17 @@ import (
 	"net"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
-	"github.com/lucas-clemente/quic-go/qerr"
 )
 
 type client struct {
 	mutex sync.Mutex
 
 	conn     connection
+	demux    *demultiplexer // the demultiplexer of the net.PacketConn, which may be shared with a server and other clients
 	hostname string
 
 	handshakeChan <-chan handshakeEvent
@@ -103,7 +102,8 @@ func DialNonFWSecure(
 
 	clientConfig := populateClientConfig(config)
 	c := &client{
-		conn:                   &conn{pconn: pconn, currentAddr: remoteAddr},
+		conn:                   newConn(pconn, remoteAddr),
+		demux:                  getDemultiplexer(pconn),
 		connectionID:           connID,
 		hostname:               hostname,
 		tlsConf:                tlsConf,
@@ -112,7 +112,9 @@ func DialNonFWSecure(
 		versionNegotiationChan: make(chan struct{}),
 	}
 
-	utils.Infof("Starting new connection to %s (%s -> %s), connectionID %x, version %s", hostname, c.conn.LocalAddr().String(), c.conn.RemoteAddr().String(), c.connectionID, c.version)
+	c.demux.raiseMaxPacketSize(protocol.ByteCount(clientConfig.MaxPacketSize))
+
+	utils.Infof("Starting new connection to %s (%s -> %s), connectionID %x, version %s", hostname, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.connectionID, c.version)
 
 	if err := c.establishSecureConnection(); err != nil {
 		return nil, err
@@ -121,6 +123,8 @@ func DialNonFWSecure(
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
+// The net.PacketConn may be shared with a Listener and other sessions dialed from it.
+// It is closed as soon as the last of them is closed.
 // The host parameter is used for SNI.
 func Dial(
 	pconn net.PacketConn,
@@ -167,6 +171,26 @@ func populateClientConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowClient
 	}
+	maxUnprocessedPackets := config.MaxUnprocessedPackets
+	if maxUnprocessedPackets <= 0 {
+		maxUnprocessedPackets = protocol.MaxSessionUnprocessedPackets
+	}
+
+	sendBufferSize := config.SendBufferSize
+	if sendBufferSize == 0 {
+		sendBufferSize = protocol.DefaultSendBufferSize
+	}
+
+	maxPacketSize := config.MaxPacketSize
+	if maxPacketSize == 0 {
+		maxPacketSize = uint64(protocol.MaxPacketSize)
+	}
+	maxPacketSize = utils.MaxUint64(utils.MinUint64(maxPacketSize, uint64(protocol.MaxPacketBufferSize)), uint64(protocol.MinPacketSize))
+
+	clock := config.clock
+	if clock == nil {
+		clock = utils.DefaultClock{}
+	}
 
 	return &Config{
 		Versions:                              versions,
@@ -175,16 +199,26 @@ func populateClientConfig(config *Config) *Config {
 		RequestConnectionIDOmission:           config.RequestConnectionIDOmission,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
-		KeepAlive: config.KeepAlive,
+		MaxReceiveBufferPerSession:            config.MaxReceiveBufferPerSession,
+		SendBufferSize:                        sendBufferSize,
+		EnableDatagrams:                       config.EnableDatagrams,
+		KeepAlive:             config.KeepAlive,
+		MaxUnprocessedPackets: maxUnprocessedPackets,
+		MaxPacketSize:         maxPacketSize,
+		clock:                 clock,
 	}
 }
 
 // establishSecureConnection returns as soon as the connection is secure (as opposed to forward-secure)
 func (c *client) establishSecureConnection() error {
 	if err := c.createNewSession(c.version, nil); err != nil {
+		c.demux.release()
+		return err
+	}
+	if err := c.demux.addClient(c.connectionID, c.conn.RemoteAddr(), c); err != nil {
+		c.demux.release()
 		return err
 	}
-	go c.listen()
 
 	var runErr error
 	errorChan := make(chan struct{})
@@ -197,7 +231,10 @@ func (c *client) establishSecureConnection() error {
 		}
 		close(errorChan)
 		utils.Infof("Connection %x closed.", c.connectionID)
-		c.conn.Close()
+		c.mutex.Lock()
+		c.demux.removeClient(c.connectionID)
+		c.mutex.Unlock()
+		c.demux.release()
 	}()
 
 	// wait until the server accepts the QUIC version (or an error occurs)
@@ -221,32 +258,15 @@ func (c *client) establishSecureConnection() error {
 	}
 }
 
-// Listen listens
-func (c *client) listen() {
-	var err error
-
-	for {
-		var n int
-		var addr net.Addr
-		data := getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, addr, err = c.conn.Read(data)
-		if err != nil {
-			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
-				c.session.Close(err)
-			}
-			break
-		}
-		data = data[:n]
-
-		c.handlePacket(addr, data)
+// handleReadError handles an error that occurred when reading from the connection
+func (c *client) handleReadError(err error) {
+	if !strings.HasSuffix(err.Error(), "use of closed network connection") {
+		c.session.Close(err)
 	}
 }
 
 func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) {
-	rcvTime := time.Now()
+	rcvTime := c.config.clock.Now()
 
 	r := bytes.NewReader(packet)
 	hdr, err := wire.ParsePublicHeader(r, protocol.PerspectiveServer, c.version)
@@ -282,7 +302,7 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) {
 			return
 		}
 		utils.Infof("Received Public Reset, rejected packet number: %#x.", pr.RejectedPacketNumber)
-		c.session.closeRemote(qerr.Error(qerr.PublicReset, fmt.Sprintf("Received a Public Reset for packet number %#x", pr.RejectedPacketNumber)))
+		c.session.closeRemote(&PublicResetError{RejectedPacketNumber: pr.RejectedPacketNumber, Remote: true})
 		return
 	}
 
@@ -328,18 +348,23 @@ func (c *client) handlePacketWithVersionFlag(hdr *wire.PublicHeader) error {
 
 	newVersion := protocol.ChooseSupportedVersion(c.config.Versions, hdr.SupportedVersions)
 	if newVersion == protocol.VersionUnsupported {
-		return qerr.InvalidVersion
+		return &VersionNegotiationError{Ours: c.config.Versions, Theirs: hdr.SupportedVersions}
 	}
 
 	// switch to negotiated version
 	initialVersion := c.version
 	c.version = newVersion
+	oldConnectionID := c.connectionID
 	var err error
 	c.connectionID, err = utils.GenerateConnectionID()
 	if err != nil {
 		return err
 	}
 	utils.Infof("Switching to QUIC version %s. New connection ID: %x", newVersion, c.connectionID)
+	c.demux.removeClient(oldConnectionID)
+	if err := c.demux.addClient(c.connectionID, c.conn.RemoteAddr(), c); err != nil {
+		return err
+	}
 
 	// create a new session and close the old one
 	// the new session must be created first to update client member variables
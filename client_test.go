@@ -10,7 +10,6 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
-	"github.com/lucas-clemente/quic-go/qerr"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -42,22 +41,23 @@ var _ = Describe("Client", func() {
 	BeforeEach(func() {
 		originalClientSessConstructor = newClientSession
 		Eventually(areSessionsRunning).Should(BeFalse())
-		msess, _, _ := newMockSession(nil, 0, 0, nil, nil, nil)
+		msess, _, _ := newMockSession(nil, 0, 0, nil, nil, nil, nil)
 		sess = msess.(*mockSession)
 		addr = &net.UDPAddr{IP: net.IPv4(192, 168, 100, 200), Port: 1337}
 		packetConn = &mockPacketConn{
 			addr:         &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
 			dataReadFrom: addr,
 		}
-		config = &Config{
+		config = populateClientConfig(&Config{
 			Versions: []protocol.VersionNumber{protocol.SupportedVersions[0], 77, 78},
-		}
+		})
 		cl = &client{
 			config:       config,
 			connectionID: 0x1337,
 			session:      sess,
 			version:      protocol.SupportedVersions[0],
 			conn:         &conn{pconn: packetConn, currentAddr: addr},
+			demux:        newDemultiplexer(packetConn),
 			versionNegotiationChan: make(chan struct{}),
 		}
 	})
@@ -259,11 +259,19 @@ var _ = Describe("Client", func() {
 				HandshakeTimeout:            1337 * time.Minute,
 				IdleTimeout:                 42 * time.Hour,
 				RequestConnectionIDOmission: true,
+				MaxUnprocessedPackets:       42,
+				MaxPacketSize:               1500,
+				MaxReceiveBufferPerSession:  1 << 20,
+				SendBufferSize:              1 << 10,
 			}
 			c := populateClientConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
 			Expect(c.IdleTimeout).To(Equal(42 * time.Hour))
 			Expect(c.RequestConnectionIDOmission).To(BeTrue())
+			Expect(c.MaxUnprocessedPackets).To(Equal(42))
+			Expect(c.MaxPacketSize).To(Equal(uint64(1500)))
+			Expect(c.MaxReceiveBufferPerSession).To(Equal(uint64(1 << 20)))
+			Expect(c.SendBufferSize).To(Equal(uint64(1 << 10)))
 		})
 
 		It("fills in default values if options are not set in the Config", func() {
@@ -272,6 +280,14 @@ var _ = Describe("Client", func() {
 			Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 			Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
+			Expect(c.MaxUnprocessedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
+			Expect(c.MaxPacketSize).To(Equal(uint64(protocol.MaxPacketSize)))
+			Expect(c.SendBufferSize).To(Equal(uint64(protocol.DefaultSendBufferSize)))
+		})
+
+		It("uses the default receive queue length if a negative value is configured", func() {
+			c := populateClientConfig(&Config{MaxUnprocessedPackets: -1})
+			Expect(c.MaxUnprocessedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
 		})
 
 		It("errors when receiving an error from the connection", func(done Done) {
@@ -407,7 +423,10 @@ var _ = Describe("Client", func() {
 			It("errors if no matching version is found", func() {
 				cl.handlePacket(nil, wire.ComposeVersionNegotiation(0x1337, []protocol.VersionNumber{1}))
 				Expect(cl.session.(*mockSession).closed).To(BeTrue())
-				Expect(cl.session.(*mockSession).closeReason).To(MatchError(qerr.InvalidVersion))
+				Expect(cl.session.(*mockSession).closeReason).To(Equal(&VersionNegotiationError{
+					Ours:   config.Versions,
+					Theirs: []protocol.VersionNumber{1},
+				}))
 			})
 
 			It("errors if the version is supported by quic-go, but disabled by the quic.Config", func() {
@@ -416,7 +435,7 @@ var _ = Describe("Client", func() {
 				Expect(config.Versions).ToNot(ContainElement(v))
 				cl.handlePacket(nil, wire.ComposeVersionNegotiation(0x1337, []protocol.VersionNumber{v}))
 				Expect(cl.session.(*mockSession).closed).To(BeTrue())
-				Expect(cl.session.(*mockSession).closeReason).To(MatchError(qerr.InvalidVersion))
+				Expect(cl.session.(*mockSession).closeReason).To(BeAssignableToTypeOf(&VersionNegotiationError{}))
 			})
 
 			It("changes to the version preferred by the quic.Config", func() {
@@ -524,23 +543,16 @@ var _ = Describe("Client", func() {
 			packetConn.dataToRead = b.Bytes()
 
 			Expect(sess.packetCount).To(BeZero())
-			stoppedListening := make(chan struct{})
-			go func() {
-				cl.listen()
-				// it should continue listening when receiving valid packets
-				close(stoppedListening)
-			}()
-
+			Expect(cl.demux.addClient(cl.connectionID, addr, cl)).To(Succeed())
 			Eventually(func() int { return sess.packetCount }).Should(Equal(1))
 			Expect(sess.closed).To(BeFalse())
-			Consistently(stoppedListening).ShouldNot(BeClosed())
 		})
 
 		It("closes the session when encountering an error while reading from the connection", func() {
 			testErr := errors.New("test error")
 			packetConn.readErr = testErr
-			cl.listen()
-			Expect(sess.closed).To(BeTrue())
+			Expect(cl.demux.addClient(cl.connectionID, addr, cl)).To(Succeed())
+			Eventually(func() bool { return sess.closed }).Should(BeTrue())
 			Expect(sess.closeReason).To(MatchError(testErr))
 		})
 	})
@@ -550,7 +562,7 @@ var _ = Describe("Client", func() {
 			cl.handlePacket(addr, wire.WritePublicReset(cl.connectionID, 1, 0))
 			Expect(cl.session.(*mockSession).closed).To(BeTrue())
 			Expect(cl.session.(*mockSession).closedRemote).To(BeTrue())
-			Expect(cl.session.(*mockSession).closeReason.(*qerr.QuicError).ErrorCode).To(Equal(qerr.PublicReset))
+			Expect(cl.session.(*mockSession).closeReason).To(Equal(&PublicResetError{RejectedPacketNumber: 1, Remote: true}))
 		})
 
 		It("ignores Public Resets with the wrong connection ID", func() {
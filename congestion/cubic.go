@@ -39,7 +39,7 @@ const maxCubicTimeInterval = 30 * time.Millisecond
 
 // Cubic implements the cubic algorithm from TCP
 type Cubic struct {
-	clock Clock
+	clock utils.Clock
 	// Number of connections to simulate.
 	numConnections int
 	// Time when this cycle started, after last loss event.
@@ -68,7 +68,7 @@ type Cubic struct {
 }
 
 // NewCubic returns a new Cubic instance
-func NewCubic(clock Clock) *Cubic {
+func NewCubic(clock utils.Clock) *Cubic {
 	c := &Cubic{
 		clock:          clock,
 		numConnections: defaultNumConnections,
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -17,6 +18,10 @@ func (c *mockClock) Now() time.Time {
 	return time.Time(*c)
 }
 
+func (c *mockClock) NewTimer(time.Duration) utils.ClockTimer {
+	panic("not implemented")
+}
+
 func (c *mockClock) Advance(d time.Duration) {
 	*c = mockClock(time.Time(*c).Add(d))
 }
@@ -2,34 +2,130 @@ package quic
 
 import (
 	"net"
+	"os"
 	"sync"
+	"syscall"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"golang.org/x/net/ipv4"
 )
 
 type connection interface {
 	Write([]byte) error
-	Read([]byte) (int, net.Addr, error)
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
 }
 
+// A batchWriter writes multiple packets at once.
+// If a connection implements this interface, the session collects packets and writes them using WriteBatch.
+type batchWriter interface {
+	WriteBatch([][]byte) error
+}
+
+// A dontFragmentSetter is a connection that can prevent the packets it sends from being fragmented.
+// Path MTU discovery is only performed on connections that implement this interface.
+type dontFragmentSetter interface {
+	SetDontFragment() error
+}
+
 type conn struct {
 	mutex sync.RWMutex
 
 	pconn       net.PacketConn
 	currentAddr net.Addr
+
+	batchConn     batchConn // nil if the pconn doesn't support batched I/O
+	gso           bool      // use UDP generic segmentation offload, only used together with the batchConn
+	writeMessages []ipv4.Message
 }
 
 var _ connection = &conn{}
+var _ batchWriter = &conn{}
+var _ dontFragmentSetter = &conn{}
+
+func newConn(pconn net.PacketConn, remoteAddr net.Addr) *conn {
+	c := &conn{
+		pconn:       pconn,
+		currentAddr: remoteAddr,
+	}
+	if bc, ok := newBatchConn(pconn); ok {
+		c.batchConn = bc
+		c.gso = gsoEnabled(pconn)
+	}
+	return c
+}
 
 func (c *conn) Write(p []byte) error {
 	_, err := c.pconn.WriteTo(p, c.currentAddr)
 	return err
 }
 
-func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+// WriteBatch writes the packets, using a single system call for up to protocol.PacketBatchSize packets, if possible.
+// If GSO is enabled, consecutive packets of equal size are sent as segments of a single message.
+func (c *conn) WriteBatch(packets [][]byte) error {
+	if c.batchConn == nil {
+		for _, p := range packets {
+			if err := c.Write(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	c.mutex.RLock()
+	addr := c.currentAddr
+	c.mutex.RUnlock()
+
+	for len(packets) > 0 {
+		msgs := c.prepareMessages(packets, addr)
+		n, err := c.batchConn.WriteBatch(msgs, 0)
+		if err != nil {
+			if c.gso && isGSOError(err) {
+				// The kernel supports GSO, but the network interface doesn't.
+				utils.Infof("Disabling GSO: %s", err.Error())
+				c.gso = false
+				continue
+			}
+			return err
+		}
+		for _, msg := range msgs[:n] {
+			packets = packets[len(msg.Buffers):]
+		}
+	}
+	return nil
+}
+
+// prepareMessages prepares the messages passed to WriteBatch.
+// The messages reference the packets, the packets are not copied.
+func (c *conn) prepareMessages(packets [][]byte, addr net.Addr) []ipv4.Message {
+	var n int
+	for len(packets) > 0 {
+		if n == len(c.writeMessages) {
+			c.writeMessages = append(c.writeMessages, ipv4.Message{})
+		}
+		msg := &c.writeMessages[n]
+		numSegments := 1
+		if c.gso {
+			numSegments = gsoSegments(packets)
+		}
+		msg.Buffers = packets[:numSegments]
+		msg.OOB = msg.OOB[:0]
+		if numSegments > 1 {
+			msg.OOB = appendUDPSegmentSizeMsg(msg.OOB, uint16(len(packets[0])))
+		}
+		msg.Addr = addr
+		packets = packets[numSegments:]
+		n++
+	}
+	return c.writeMessages[:n]
+}
+
+// SetDontFragment sets the Don't Fragment bit on all packets sent on the underlying socket.
+// It returns an error if this is not supported for this connection.
+func (c *conn) SetDontFragment() error {
+	return setDontFragment(c.pconn)
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -52,3 +148,14 @@ func (c *conn) RemoteAddr() net.Addr {
 func (c *conn) Close() error {
 	return c.pconn.Close()
 }
+
+// isMsgSizeError says if a write failed because the packet is too large to be sent without fragmentation
+func isMsgSizeError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EMSGSIZE
+}
@@ -2,8 +2,11 @@ package quic
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net"
+	"os"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -67,15 +70,105 @@ var _ = Describe("Connection", func() {
 		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
 	})
 
-	It("reads", func() {
-		packetConn.dataToRead = []byte("foo")
-		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
-		p := make([]byte, 10)
-		n, raddr, err := c.Read(p)
-		Expect(err).ToNot(HaveOccurred())
-		Expect(raddr.String()).To(Equal("127.0.0.1:1336"))
-		Expect(n).To(Equal(3))
-		Expect(p[0:3]).To(Equal([]byte("foo")))
+	Context("writing batches", func() {
+		It("writes packet by packet if the connection doesn't support batched I/O", func() {
+			err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		})
+
+		It("writes using the batchConn", func() {
+			bc := &mockBatchConn{}
+			c.batchConn = bc
+			err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bc.writeCalls).To(Equal(1))
+			Expect(bc.written).To(Equal([][]byte{[]byte("foo"), []byte("bar")}))
+			Expect(bc.writtenTo.String()).To(Equal("192.168.100.200:1337"))
+			Expect(packetConn.dataWritten.Len()).To(BeZero())
+		})
+
+		It("retries if not all packets were written at once", func() {
+			bc := &mockBatchConn{maxWriteBatch: 2}
+			c.batchConn = bc
+			err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bc.writeCalls).To(Equal(2))
+			Expect(bc.written).To(Equal([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}))
+		})
+
+		It("returns write errors", func() {
+			testErr := errors.New("write error")
+			c.batchConn = &mockBatchConn{writeErr: testErr}
+			err := c.WriteBatch([][]byte{[]byte("foo")})
+			Expect(err).To(MatchError(testErr))
+		})
+
+		Context("using GSO", func() {
+			var bc *mockBatchConn
+
+			BeforeEach(func() {
+				bc = &mockBatchConn{}
+				c.batchConn = bc
+				c.gso = true
+			})
+
+			It("sends packets of equal size as segments of a single message", func() {
+				err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bc.writeCalls).To(Equal(1))
+				Expect(bc.writtenSegments).To(Equal([]int{3}))
+				Expect(bc.written).To(Equal([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}))
+			})
+
+			It("only allows the last segment to be smaller", func() {
+				err := c.WriteBatch([][]byte{[]byte("foo"), []byte("fo"), []byte("bar"), []byte("foobar"), []byte("baz"), []byte("ba")})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bc.writeCalls).To(Equal(1))
+				// [foo, fo], [bar], [foobar], [baz, ba]
+				Expect(bc.writtenSegments).To(Equal([]int{2, 2}))
+				Expect(bc.written).To(HaveLen(6))
+			})
+
+			It("limits the number of segments", func() {
+				packets := make([][]byte, maxGSOSegments+1)
+				for i := range packets {
+					packets[i] = []byte("foo")
+				}
+				err := c.WriteBatch(packets)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bc.writtenSegments).To(Equal([]int{maxGSOSegments}))
+				Expect(bc.written).To(HaveLen(maxGSOSegments + 1))
+			})
+
+			It("limits the size of a message", func() {
+				packets := make([][]byte, 10)
+				for i := range packets {
+					packets[i] = make([]byte, maxGSOSize/4)
+				}
+				err := c.WriteBatch(packets)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bc.writtenSegments).To(Equal([]int{4, 4, 2}))
+			})
+
+			It("disables GSO if the network interface doesn't support it", func() {
+				bc.gsoErr = &net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EIO)}
+				err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.gso).To(BeFalse())
+				Expect(bc.writeCalls).To(Equal(2))
+				Expect(bc.writtenSegments).To(BeEmpty())
+				Expect(bc.written).To(Equal([][]byte{[]byte("foo"), []byte("bar")}))
+			})
+
+			It("returns other errors", func() {
+				testErr := errors.New("write error")
+				bc.gsoErr = testErr
+				err := c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})
+				Expect(err).To(MatchError(testErr))
+				Expect(c.gso).To(BeTrue())
+			})
+		})
 	})
 
 	It("gets the remote address", func() {
@@ -0,0 +1,87 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// The datagramQueue queues the messages that are sent and received in DATAGRAM frames.
+type datagramQueue struct {
+	sendQueue chan *wire.DatagramFrame
+	// nextFrame is the frame that was taken from the sendQueue, but that didn't fit into the last packet
+	// it is only accessed by the packer
+	nextFrame *wire.DatagramFrame
+
+	rcvQueue chan []byte
+
+	closeErr error
+	closed   chan struct{}
+
+	hasData func()
+}
+
+func newDatagramQueue(hasData func()) *datagramQueue {
+	return &datagramQueue{
+		sendQueue: make(chan *wire.DatagramFrame, protocol.DatagramSendQueueLen),
+		rcvQueue:  make(chan []byte, protocol.DatagramRcvQueueLen),
+		closed:    make(chan struct{}),
+		hasData:   hasData,
+	}
+}
+
+// Add queues a frame for sending.
+// It blocks while the send queue is full.
+func (q *datagramQueue) Add(f *wire.DatagramFrame) error {
+	select {
+	case q.sendQueue <- f:
+		q.hasData()
+		return nil
+	case <-q.closed:
+		return q.closeErr
+	}
+}
+
+// Peek gets the next frame for sending, without removing it from the queue
+func (q *datagramQueue) Peek() *wire.DatagramFrame {
+	if q.nextFrame != nil {
+		return q.nextFrame
+	}
+	select {
+	case q.nextFrame = <-q.sendQueue:
+	default:
+	}
+	return q.nextFrame
+}
+
+// Pop removes the frame returned by Peek from the queue
+func (q *datagramQueue) Pop() {
+	q.nextFrame = nil
+}
+
+// HandleDatagramFrame queues the data of a received DATAGRAM frame, until it is read by Receive.
+// If the receive queue is full, the data is dropped.
+func (q *datagramQueue) HandleDatagramFrame(f *wire.DatagramFrame) {
+	select {
+	case q.rcvQueue <- f.Data:
+	default:
+		utils.Debugf("Discarding received DATAGRAM frame (%d bytes data), since the receive queue is full", len(f.Data))
+	}
+}
+
+// Receive gets the data of a received DATAGRAM frame.
+// It blocks until a frame is received, or the queue is closed.
+func (q *datagramQueue) Receive() ([]byte, error) {
+	select {
+	case data := <-q.rcvQueue:
+		return data, nil
+	case <-q.closed:
+		return nil, q.closeErr
+	}
+}
+
+// CloseWithError closes the queue. Pending and future calls to Add and Receive return the error.
+func (q *datagramQueue) CloseWithError(e error) {
+	q.closeErr = e
+	close(q.closed)
+}
@@ -0,0 +1,122 @@
+package quic
+
+import (
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datagram Queue", func() {
+	var queue *datagramQueue
+	var queued int
+
+	BeforeEach(func() {
+		queued = 0
+		queue = newDatagramQueue(func() { queued++ })
+	})
+
+	Context("sending", func() {
+		It("returns nil when there's no frame queued", func() {
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("queues frames", func() {
+			f := &wire.DatagramFrame{Data: []byte("foobar")}
+			Expect(queue.Add(f)).To(Succeed())
+			Expect(queued).To(Equal(1))
+			Expect(queue.Peek()).To(Equal(f))
+			Expect(queue.Peek()).To(Equal(f))
+			queue.Pop()
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("blocks while the queue is full", func() {
+			for i := 0; i < protocol.DatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{})).To(Succeed())
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foobar")})).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			// Peek takes a frame out of the channel
+			Expect(queue.Peek()).ToNot(BeNil())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns the error when the queue is closed", func() {
+			testErr := errors.New("test error")
+			for i := 0; i < protocol.DatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{})).To(Succeed())
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(queue.Add(&wire.DatagramFrame{})).To(MatchError(testErr))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.CloseWithError(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("receiving", func() {
+		It("receives messages", func() {
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foo")})
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("bar")})
+			data, err := queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foo")))
+			data, err = queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("bar")))
+		})
+
+		It("blocks until a message is received", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				data, err := queue.Receive()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("drops messages when the queue is full", func() {
+			for i := 0; i < protocol.DatagramRcvQueueLen; i++ {
+				queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte{byte(i)}})
+			}
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("dropped")})
+			for i := 0; i < protocol.DatagramRcvQueueLen; i++ {
+				data, err := queue.Receive()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte{byte(i)}))
+			}
+		})
+
+		It("returns the error when the queue is closed", func() {
+			testErr := errors.New("test error")
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := queue.Receive()
+				Expect(err).To(MatchError(testErr))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.CloseWithError(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
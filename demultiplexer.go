@@ -0,0 +1,218 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// A demuxServer handles all packets that don't belong to a connection dialed on the same net.PacketConn
+type demuxServer interface {
+	handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet []byte) error
+	handleReadError(error)
+}
+
+// A demuxClient handles the packets for a connection it dialed
+type demuxClient interface {
+	handlePacket(remoteAddr net.Addr, packet []byte)
+	handleReadError(error)
+}
+
+type demuxClientEntry struct {
+	client     demuxClient
+	remoteAddr net.Addr
+}
+
+var errDemuxHasServer = errors.New("quic: a Listener is already using this connection")
+
+// The demultiplexer reads packets from a net.PacketConn, and passes them to the server and the clients using this connection.
+// Packets are routed by their connection ID: packets belonging to a connection that was dialed on this net.PacketConn
+// are passed to the client, all other packets are passed to the server.
+// Since servers may omit the connection ID, packets without a connection ID are passed to the client dialing the sender.
+type demultiplexer struct {
+	conn   net.PacketConn
+	reader packetReader
+
+	refCount int // protected by the mutex of the demuxes map
+
+	startOnce sync.Once
+
+	mutex   sync.RWMutex
+	server  demuxServer
+	clients map[protocol.ConnectionID]demuxClientEntry
+	readErr error
+}
+
+// demuxes holds the demultiplexers for all net.PacketConns that are in use
+var demuxes = struct {
+	sync.Mutex
+	m map[net.PacketConn]*demultiplexer
+}{m: make(map[net.PacketConn]*demultiplexer)}
+
+// getDemultiplexer returns the demultiplexer for a net.PacketConn, creating it if necessary.
+// Every call must be followed by a call to release, once the caller doesn't use the connection any more.
+func getDemultiplexer(conn net.PacketConn) *demultiplexer {
+	demuxes.Lock()
+	defer demuxes.Unlock()
+	d, ok := demuxes.m[conn]
+	if !ok {
+		d = newDemultiplexer(conn)
+		demuxes.m[conn] = d
+		return d
+	}
+	d.refCount++
+	return d
+}
+
+func newDemultiplexer(conn net.PacketConn) *demultiplexer {
+	return &demultiplexer{
+		conn:     conn,
+		reader:   newPacketReader(conn),
+		refCount: 1,
+		clients:  make(map[protocol.ConnectionID]demuxClientEntry),
+	}
+}
+
+// release releases the demultiplexer.
+// The net.PacketConn is closed when the last user releases it.
+func (d *demultiplexer) release() error {
+	demuxes.Lock()
+	defer demuxes.Unlock()
+	d.refCount--
+	if d.refCount > 0 {
+		return nil
+	}
+	if demuxes.m[d.conn] == d {
+		delete(demuxes.m, d.conn)
+	}
+	return d.conn.Close()
+}
+
+// addServer sets the server. There can only be one server per net.PacketConn.
+func (d *demultiplexer) addServer(s demuxServer) error {
+	d.mutex.Lock()
+	if d.readErr != nil {
+		d.mutex.Unlock()
+		return d.readErr
+	}
+	if d.server != nil {
+		d.mutex.Unlock()
+		return errDemuxHasServer
+	}
+	d.server = s
+	d.mutex.Unlock()
+	d.start()
+	return nil
+}
+
+// removeServer removes the server, if it is the server using this demultiplexer
+func (d *demultiplexer) removeServer(s demuxServer) {
+	d.mutex.Lock()
+	if d.server == s {
+		d.server = nil
+	}
+	d.mutex.Unlock()
+}
+
+// addClient adds a client for a connection ID
+func (d *demultiplexer) addClient(connID protocol.ConnectionID, remoteAddr net.Addr, c demuxClient) error {
+	d.mutex.Lock()
+	if d.readErr != nil {
+		d.mutex.Unlock()
+		return d.readErr
+	}
+	d.clients[connID] = demuxClientEntry{client: c, remoteAddr: remoteAddr}
+	d.mutex.Unlock()
+	d.start()
+	return nil
+}
+
+// raiseMaxPacketSize makes sure that packets up to the given size can be received.
+// It must be called by every user that might receive packets larger than the standard size.
+func (d *demultiplexer) raiseMaxPacketSize(size protocol.ByteCount) {
+	d.reader.SetMaxPacketSize(size)
+}
+
+func (d *demultiplexer) removeClient(connID protocol.ConnectionID) {
+	d.mutex.Lock()
+	delete(d.clients, connID)
+	d.mutex.Unlock()
+}
+
+// start starts reading from the net.PacketConn, once the first server or client was added
+func (d *demultiplexer) start() {
+	d.startOnce.Do(func() {
+		go d.run()
+	})
+}
+
+func (d *demultiplexer) run() {
+	for {
+		packets, err := d.reader.ReadPackets()
+		if err != nil {
+			d.handleReadError(err)
+			return
+		}
+		for _, p := range packets {
+			d.handlePacket(p.remoteAddr, p.data)
+		}
+	}
+}
+
+func (d *demultiplexer) handlePacket(remoteAddr net.Addr, packet []byte) {
+	// Packets sent by a client always contain a connection ID.
+	connID, err := wire.PeekConnectionID(bytes.NewReader(packet), protocol.PerspectiveClient)
+
+	d.mutex.RLock()
+	var client demuxClient
+	if err == nil {
+		if entry, ok := d.clients[connID]; ok {
+			client = entry.client
+		}
+	} else {
+		// This might be a packet sent by a server that omitted the connection ID.
+		for _, entry := range d.clients {
+			if remoteAddr != nil && entry.remoteAddr != nil && entry.remoteAddr.Network() == remoteAddr.Network() && entry.remoteAddr.String() == remoteAddr.String() {
+				client = entry.client
+				break
+			}
+		}
+	}
+	server := d.server
+	d.mutex.RUnlock()
+
+	if client != nil {
+		client.handlePacket(remoteAddr, packet)
+		return
+	}
+	if server == nil {
+		return
+	}
+	if err := server.handlePacket(d.conn, remoteAddr, packet); err != nil {
+		utils.Errorf("error handling packet: %s", err.Error())
+	}
+}
+
+// handleReadError passes an error that occurred when reading from the net.PacketConn to all users
+func (d *demultiplexer) handleReadError(err error) {
+	d.mutex.Lock()
+	d.readErr = err
+	server := d.server
+	clients := make([]demuxClient, 0, len(d.clients))
+	for _, entry := range d.clients {
+		clients = append(clients, entry.client)
+	}
+	d.mutex.Unlock()
+
+	if server != nil {
+		server.handleReadError(err)
+	}
+	for _, c := range clients {
+		c.handleReadError(err)
+	}
+}
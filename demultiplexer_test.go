@@ -0,0 +1,213 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type receivedPacketWithAddr struct {
+	remoteAddr net.Addr
+	data       []byte
+}
+
+// a net.PacketConn that returns the packets sent on a channel
+type chanPacketConn struct {
+	mockPacketConn
+	packets chan receivedPacketWithAddr
+	readErr chan error
+}
+
+func newChanPacketConn() *chanPacketConn {
+	return &chanPacketConn{
+		packets: make(chan receivedPacketWithAddr, 10),
+		readErr: make(chan error, 1),
+	}
+}
+
+func (c *chanPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-c.packets:
+		return copy(b, p.data), p.remoteAddr, nil
+	case err := <-c.readErr:
+		return 0, nil, err
+	}
+}
+
+type mockDemuxHandler struct {
+	mutex   sync.Mutex
+	packets []receivedPacketWithAddr
+	readErr error
+}
+
+func (h *mockDemuxHandler) handleClientPacket(remoteAddr net.Addr, packet []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.packets = append(h.packets, receivedPacketWithAddr{remoteAddr: remoteAddr, data: packet})
+}
+
+func (h *mockDemuxHandler) handleReadError(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.readErr = err
+}
+
+func (h *mockDemuxHandler) getPackets() []receivedPacketWithAddr {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.packets
+}
+
+func (h *mockDemuxHandler) getReadErr() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.readErr
+}
+
+type mockDemuxServer struct{ mockDemuxHandler }
+
+func (s *mockDemuxServer) handlePacket(_ net.PacketConn, remoteAddr net.Addr, packet []byte) error {
+	s.handleClientPacket(remoteAddr, packet)
+	return nil
+}
+
+type mockDemuxClient struct{ mockDemuxHandler }
+
+func (c *mockDemuxClient) handlePacket(remoteAddr net.Addr, packet []byte) {
+	c.handleClientPacket(remoteAddr, packet)
+}
+
+var _ = Describe("Demultiplexer", func() {
+	var (
+		conn       *chanPacketConn
+		demux      *demultiplexer
+		remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1234}
+	)
+
+	composePacket := func(connID protocol.ConnectionID, omitConnID bool) []byte {
+		b := &bytes.Buffer{}
+		err := (&wire.PublicHeader{
+			ConnectionID:     connID,
+			OmitConnectionID: omitConnID,
+			PacketNumber:     1,
+			PacketNumberLen:  protocol.PacketNumberLen1,
+		}).Write(b, protocol.VersionWhatever, protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		return append(b.Bytes(), []byte("foobar")...)
+	}
+
+	BeforeEach(func() {
+		conn = newChanPacketConn()
+		demux = getDemultiplexer(conn)
+	})
+
+	AfterEach(func() {
+		demuxes.Lock()
+		delete(demuxes.m, conn)
+		demuxes.Unlock()
+	})
+
+	Context("reference counting", func() {
+		It("returns the same demultiplexer for the same connection", func() {
+			Expect(getDemultiplexer(conn)).To(Equal(demux))
+			Expect(getDemultiplexer(newChanPacketConn())).ToNot(Equal(demux))
+		})
+
+		It("closes the connection when the last user releases it", func() {
+			getDemultiplexer(conn)
+			Expect(demux.release()).To(Succeed())
+			Expect(conn.closed).To(BeFalse())
+			Expect(demux.release()).To(Succeed())
+			Expect(conn.closed).To(BeTrue())
+			// a new demultiplexer is created for the connection
+			Expect(getDemultiplexer(conn)).ToNot(BeIdenticalTo(demux))
+		})
+	})
+
+	Context("routing packets", func() {
+		var (
+			server *mockDemuxServer
+			client *mockDemuxClient
+		)
+
+		BeforeEach(func() {
+			server = &mockDemuxServer{}
+			client = &mockDemuxClient{}
+			Expect(demux.addServer(server)).To(Succeed())
+			Expect(demux.addClient(0x1337, remoteAddr, client)).To(Succeed())
+		})
+
+		It("passes packets for dialed connections to the client", func() {
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x1337, false)}
+			Eventually(client.getPackets).Should(HaveLen(1))
+			Expect(client.getPackets()[0].data).To(Equal(composePacket(0x1337, false)))
+			Expect(client.getPackets()[0].remoteAddr).To(Equal(remoteAddr))
+			Consistently(server.getPackets).Should(BeEmpty())
+		})
+
+		It("passes all other packets to the server", func() {
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x42, false)}
+			Eventually(server.getPackets).Should(HaveLen(1))
+			Expect(server.getPackets()[0].data).To(Equal(composePacket(0x42, false)))
+			Consistently(client.getPackets).Should(BeEmpty())
+		})
+
+		It("passes packets without a connection ID to the client dialing the sender", func() {
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0, true)}
+			Eventually(client.getPackets).Should(HaveLen(1))
+			otherAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5678}
+			conn.packets <- receivedPacketWithAddr{remoteAddr: otherAddr, data: composePacket(0, true)}
+			Eventually(server.getPackets).Should(HaveLen(1))
+			Expect(client.getPackets()).To(HaveLen(1))
+		})
+
+		It("stops passing packets to removed clients", func() {
+			demux.removeClient(0x1337)
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x1337, false)}
+			Eventually(server.getPackets).Should(HaveLen(1))
+			Expect(client.getPackets()).To(BeEmpty())
+		})
+
+		It("drops packets for unknown connections if there's no server", func() {
+			demux.removeServer(server)
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x42, false)}
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x1337, false)}
+			Eventually(client.getPackets).Should(HaveLen(1))
+			Expect(server.getPackets()).To(BeEmpty())
+		})
+
+		It("refuses a second server", func() {
+			Expect(demux.addServer(&mockDemuxServer{})).To(MatchError(errDemuxHasServer))
+		})
+
+		It("only removes the server if it's the one using the demultiplexer", func() {
+			demux.removeServer(&mockDemuxServer{})
+			conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x42, false)}
+			Eventually(server.getPackets).Should(HaveLen(1))
+		})
+
+		It("passes read errors to the server and all clients", func() {
+			testErr := errors.New("read error")
+			conn.readErr <- testErr
+			Eventually(server.getReadErr).Should(MatchError(testErr))
+			Eventually(client.getReadErr).Should(MatchError(testErr))
+			Expect(demux.addClient(0x42, remoteAddr, &mockDemuxClient{})).To(MatchError(testErr))
+		})
+	})
+
+	It("only starts reading once the first user was added", func() {
+		conn.packets <- receivedPacketWithAddr{remoteAddr: remoteAddr, data: composePacket(0x42, false)}
+		Consistently(func() int { return len(conn.packets) }, 50*time.Millisecond).Should(Equal(1))
+		server := &mockDemuxServer{}
+		Expect(demux.addServer(server)).To(Succeed())
+		Eventually(server.getPackets).Should(HaveLen(1))
+	})
+})
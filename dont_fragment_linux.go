@@ -0,0 +1,37 @@
+// +build linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// setDontFragment sets the Don't Fragment bit on IPv4 packets, and disables fragmentation of IPv6 packets.
+// It uses the *_PMTUDISC_PROBE mode, which ignores the path MTU cached by the kernel:
+// Sending a packet larger than the path MTU succeeds, unless the packet is larger than the MTU of the network interface.
+func setDontFragment(c net.PacketConn) error {
+	udpConn, ok := c.(*net.UDPConn)
+	if !ok {
+		return errors.New("the Don't Fragment bit can only be set on UDP sockets")
+	}
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errIPv4, errIPv6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		errIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		errIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+	}); err != nil {
+		return err
+	}
+	// The IPv6 option can't be set on IPv4 sockets.
+	// On IPv6 sockets, the IPv4 option applies to packets sent to IPv4-mapped addresses.
+	if errIPv4 != nil && errIPv6 != nil {
+		return os.NewSyscallError("setsockopt", errIPv4)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Don't Fragment bit", func() {
+	getsockopt := func(c *net.UDPConn, level, opt int) int {
+		rawConn, err := c.SyscallConn()
+		Expect(err).ToNot(HaveOccurred())
+		var val int
+		var serr error
+		Expect(rawConn.Control(func(fd uintptr) {
+			val, serr = syscall.GetsockoptInt(int(fd), level, opt)
+		})).To(Succeed())
+		Expect(serr).ToNot(HaveOccurred())
+		return val
+	}
+
+	It("sets the Don't Fragment bit on IPv4 sockets", func() {
+		c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+		Expect(setDontFragment(c)).To(Succeed())
+		Expect(getsockopt(c, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER)).To(Equal(syscall.IP_PMTUDISC_PROBE))
+	})
+
+	It("disables fragmentation on IPv6 sockets", func() {
+		c, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback, Port: 0})
+		if err != nil {
+			Skip("IPv6 is not available")
+		}
+		defer c.Close()
+		Expect(setDontFragment(c)).To(Succeed())
+		Expect(getsockopt(c, syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER)).To(Equal(syscall.IPV6_PMTUDISC_PROBE))
+	})
+
+	It("errors on connections that are not UDP sockets", func() {
+		Expect(setDontFragment(&mockPacketConn{})).ToNot(Succeed())
+	})
+
+	It("detects packets that are too large to be sent", func() {
+		c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+		conn := newConn(c, c.LocalAddr())
+		Expect(conn.SetDontFragment()).To(Succeed())
+		// this is larger than the maximum size of a UDP datagram
+		err = conn.Write(make([]byte, 70000))
+		Expect(err).To(HaveOccurred())
+		Expect(isMsgSizeError(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,12 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+func setDontFragment(net.PacketConn) error {
+	return errors.New("setting the Don't Fragment bit is not supported on this platform")
+}
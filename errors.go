@@ -0,0 +1,185 @@
+package quic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// A TransportError is a QUIC error code, sent in a CONNECTION_CLOSE frame.
+// Sessions closed using Close are closed with a TransportError, either with the error code passed to Close,
+// or with PeerGoingAway for a nil error. Remote distinguishes between sessions closed by the peer and closed locally.
+type TransportError = qerr.QuicError
+
+// An ApplicationError is an error defined by the application protocol.
+// It is returned when a stream is reset, or when a session is closed with an error code, either locally or by the peer.
+type ApplicationError struct {
+	Code         ErrorCode
+	ReasonPhrase string
+	// Remote is set if the error was received from the peer
+	Remote bool
+}
+
+var _ error = &ApplicationError{}
+
+func (e *ApplicationError) Error() string {
+	if len(e.ReasonPhrase) == 0 {
+		return fmt.Sprintf("Application error %#x (%s)", uint32(e.Code), side(e.Remote))
+	}
+	return fmt.Sprintf("Application error %#x (%s): %s", uint32(e.Code), side(e.Remote), e.ReasonPhrase)
+}
+
+// closeReasonPhrase is the reason phrase of the CONNECTION_CLOSE frame sent to peers that don't support APPLICATION_CLOSE
+func (e *ApplicationError) closeReasonPhrase() string {
+	if len(e.ReasonPhrase) == 0 {
+		return fmt.Sprintf("Application error %#x", uint32(e.Code))
+	}
+	return fmt.Sprintf("Application error %#x: %s", uint32(e.Code), e.ReasonPhrase)
+}
+
+// An IdleTimeoutError is returned when a session is closed because there was no network activity for the idle timeout.
+type IdleTimeoutError struct {
+	// Remote is set if the peer closed the session due to its idle timeout
+	Remote bool
+}
+
+var _ error = &IdleTimeoutError{}
+
+func (e *IdleTimeoutError) Error() string {
+	return fmt.Sprintf("timeout: no recent network activity (%s)", side(e.Remote))
+}
+
+// Timeout is always true, such that an IdleTimeoutError is a net.Error
+func (e *IdleTimeoutError) Timeout() bool { return true }
+
+// Temporary is always false
+func (e *IdleTimeoutError) Temporary() bool { return false }
+
+// A HandshakeTimeoutError is returned when a session is closed because the handshake didn't complete in time.
+type HandshakeTimeoutError struct {
+	// Remote is set if the peer closed the session due to its handshake timeout
+	Remote bool
+}
+
+var _ error = &HandshakeTimeoutError{}
+
+func (e *HandshakeTimeoutError) Error() string {
+	return fmt.Sprintf("timeout: handshake did not complete in time (%s)", side(e.Remote))
+}
+
+// Timeout is always true, such that a HandshakeTimeoutError is a net.Error
+func (e *HandshakeTimeoutError) Timeout() bool { return true }
+
+// Temporary is always false
+func (e *HandshakeTimeoutError) Temporary() bool { return false }
+
+// A PublicResetError is returned when a session is closed because the peer sent a Public Reset,
+// i.e. a stateless reset, usually because it lost the state of the connection.
+type PublicResetError struct {
+	RejectedPacketNumber protocol.PacketNumber
+	// Remote is set if the Public Reset was received from the peer.
+	// Sessions are only closed with a PublicResetError when they receive a Public Reset, so it is always set.
+	Remote bool
+}
+
+var _ error = &PublicResetError{}
+
+func (e *PublicResetError) Error() string {
+	return fmt.Sprintf("received a Public Reset for packet number %#x", e.RejectedPacketNumber)
+}
+
+// A VersionNegotiationError is returned by Dial when the client and the server don't support a common QUIC version.
+type VersionNegotiationError struct {
+	// Ours are the versions supported by the client
+	Ours []VersionNumber
+	// Theirs are the versions supported by the server, as sent in the version negotiation packet
+	Theirs []VersionNumber
+	// Remote is set if the peer closed the session.
+	// The client closes the session when it receives a version negotiation packet without a common version, so it is never set.
+	Remote bool
+}
+
+var _ error = &VersionNegotiationError{}
+
+func (e *VersionNegotiationError) Error() string {
+	return fmt.Sprintf("no compatible QUIC version found (we support %s, the server supports %s)", e.Ours, e.Theirs)
+}
+
+func side(remote bool) string {
+	if remote {
+		return "remote"
+	}
+	return "local"
+}
+
+// remoteCloseError converts a CONNECTION_CLOSE frame received from the peer to the error that the session is closed with
+func remoteCloseError(code qerr.ErrorCode, reasonPhrase string) error {
+	switch code {
+	case qerr.NetworkIdleTimeout:
+		return &IdleTimeoutError{Remote: true}
+	case qerr.HandshakeTimeout:
+		return &HandshakeTimeoutError{Remote: true}
+	}
+	return &TransportError{ErrorCode: code, ErrorMessage: reasonPhrase, Remote: true}
+}
+
+// toQuicError converts the error that a session is closed with to the error sent in the CONNECTION_CLOSE frame
+func toQuicError(err error) *qerr.QuicError {
+	switch e := err.(type) {
+	case *IdleTimeoutError:
+		return qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity.")
+	case *HandshakeTimeoutError:
+		return qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time.")
+	case *PublicResetError:
+		return qerr.Error(qerr.PublicReset, e.Error())
+	case *VersionNegotiationError:
+		return qerr.Error(qerr.InvalidVersion, e.Error())
+	}
+	return qerr.ToQuicError(err)
+}
+
+// toCloseCause converts the error that a session is closed with to the error returned by CloseCause
+func toCloseCause(err error) error {
+	switch e := err.(type) {
+	case nil:
+		return qerr.Error(qerr.PeerGoingAway, "")
+	case qerr.ErrorCode:
+		return qerr.Error(e, "")
+	}
+	return err
+}
+
+type closeCauseKey struct{}
+
+// closeCause holds the error that caused a session to be closed
+type closeCause struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func (c *closeCause) Set(err error) {
+	c.mutex.Lock()
+	c.err = err
+	c.mutex.Unlock()
+}
+
+func (c *closeCause) Get() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// CloseCause returns the error that caused a session to be closed.
+// ctx must be the context returned by Session.Context, or a context derived from it.
+// The error is one of the error types defined in this package, or the error passed to Session.Close.
+// CloseCause returns nil if the session is still open, or if ctx doesn't belong to a session.
+func CloseCause(ctx context.Context) error {
+	c, ok := ctx.Value(closeCauseKey{}).(*closeCause)
+	if !ok {
+		return nil
+	}
+	return c.Get()
+}
@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Application errors", func() {
+	It("has a string representation for local errors", func() {
+		err := &ApplicationError{Code: 0x1337, ReasonPhrase: "foobar"}
+		Expect(err.Error()).To(Equal("Application error 0x1337 (local): foobar"))
+	})
+
+	It("has a string representation for remote errors", func() {
+		err := &ApplicationError{Code: 0x42, Remote: true}
+		Expect(err.Error()).To(Equal("Application error 0x42 (remote)"))
+	})
+
+	It("puts the error code in the reason phrase of a CONNECTION_CLOSE", func() {
+		Expect((&ApplicationError{Code: 0x1337, ReasonPhrase: "foobar"}).closeReasonPhrase()).To(Equal("Application error 0x1337: foobar"))
+		Expect((&ApplicationError{Code: 0x42}).closeReasonPhrase()).To(Equal("Application error 0x42"))
+	})
+})
+
+var _ = Describe("Session close errors", func() {
+	It("has idle timeout errors", func() {
+		var err net.Error = &IdleTimeoutError{Remote: true}
+		Expect(err.Timeout()).To(BeTrue())
+		Expect(err.Temporary()).To(BeFalse())
+		Expect(err.Error()).To(Equal("timeout: no recent network activity (remote)"))
+	})
+
+	It("has handshake timeout errors", func() {
+		var err net.Error = &HandshakeTimeoutError{}
+		Expect(err.Timeout()).To(BeTrue())
+		Expect(err.Temporary()).To(BeFalse())
+		Expect(err.Error()).To(Equal("timeout: handshake did not complete in time (local)"))
+	})
+
+	It("has Public Reset errors", func() {
+		err := &PublicResetError{RejectedPacketNumber: 0x42, Remote: true}
+		Expect(err.Error()).To(Equal("received a Public Reset for packet number 0x42"))
+	})
+
+	It("has version negotiation errors", func() {
+		err := &VersionNegotiationError{
+			Ours:   []protocol.VersionNumber{protocol.Version39},
+			Theirs: []protocol.VersionNumber{0x1337},
+		}
+		Expect(err.Error()).To(ContainSubstring("no compatible QUIC version found"))
+	})
+
+	Context("converting errors received from the peer", func() {
+		It("converts idle timeouts", func() {
+			Expect(remoteCloseError(qerr.NetworkIdleTimeout, "foobar")).To(Equal(&IdleTimeoutError{Remote: true}))
+		})
+
+		It("converts handshake timeouts", func() {
+			Expect(remoteCloseError(qerr.HandshakeTimeout, "foobar")).To(Equal(&HandshakeTimeoutError{Remote: true}))
+		})
+
+		It("converts other errors to transport errors", func() {
+			err := remoteCloseError(qerr.InvalidStreamData, "foobar")
+			Expect(err).To(Equal(&TransportError{ErrorCode: qerr.InvalidStreamData, ErrorMessage: "foobar", Remote: true}))
+		})
+	})
+
+	Context("converting errors sent to the peer", func() {
+		It("converts idle timeouts", func() {
+			Expect(toQuicError(&IdleTimeoutError{}).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+		})
+
+		It("converts handshake timeouts", func() {
+			Expect(toQuicError(&HandshakeTimeoutError{}).ErrorCode).To(Equal(qerr.HandshakeTimeout))
+		})
+
+		It("converts Public Resets", func() {
+			Expect(toQuicError(&PublicResetError{Remote: true}).ErrorCode).To(Equal(qerr.PublicReset))
+		})
+
+		It("converts version negotiation errors", func() {
+			Expect(toQuicError(&VersionNegotiationError{}).ErrorCode).To(Equal(qerr.InvalidVersion))
+		})
+
+		It("converts other errors", func() {
+			Expect(toQuicError(errors.New("foobar")).ErrorCode).To(Equal(qerr.InternalError))
+		})
+	})
+
+	Context("getting the close cause", func() {
+		It("returns nil for contexts that don't belong to a session", func() {
+			Expect(CloseCause(context.Background())).To(BeNil())
+		})
+
+		It("uses PeerGoingAway when the session was closed without an error", func() {
+			Expect(toCloseCause(nil)).To(Equal(&TransportError{ErrorCode: qerr.PeerGoingAway}))
+		})
+
+		It("converts error codes", func() {
+			Expect(toCloseCause(qerr.InvalidStreamData)).To(Equal(&TransportError{ErrorCode: qerr.InvalidStreamData}))
+		})
+	})
+})
@@ -0,0 +1,269 @@
+package h2quic
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+const (
+	// altSvcProtocolID is the ALPN-like protocol identifier that gQUIC servers use in the Alt-Svc header
+	altSvcProtocolID = "quic"
+	// altSvcDefaultMaxAge is the freshness lifetime of an alternative service, if no ma parameter is given
+	altSvcDefaultMaxAge = 24 * time.Hour
+	// altSvcInitialBrokenBackoff is the time that an alternative is not used after it failed for the first time
+	altSvcInitialBrokenBackoff = 5 * time.Minute
+	// altSvcMaxBrokenBackoff is the maximum time that a broken alternative is not used
+	altSvcMaxBrokenBackoff = 48 * time.Hour
+)
+
+// An altSvc is an alternative service advertised by a server, as defined in RFC 7838.
+type altSvc struct {
+	// host is the host of the alternative authority. An empty host means the host of the origin.
+	host string
+	port string
+	// versions contains the QUIC versions that were advertised by the server.
+	// If the server didn't send the v parameter, it is nil.
+	versions []protocol.VersionNumber
+	expires  time.Time
+}
+
+// parseAltSvc parses the values of the Alt-Svc header fields.
+// It returns the alternatives for the QUIC protocol, in the order they were advertised.
+// If the header contains the special value "clear", cleared is true.
+// Alternatives that can't be parsed are skipped.
+func parseAltSvc(header []string, now time.Time) (alts []altSvc, cleared bool) {
+	for _, value := range header {
+		for _, entry := range splitUnquoted(value, ',') {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if entry == "clear" {
+				return nil, true
+			}
+			fields := splitUnquoted(entry, ';')
+			alt, ok := parseAltSvcAlternative(strings.TrimSpace(fields[0]))
+			if !ok {
+				continue
+			}
+			maxAge := altSvcDefaultMaxAge
+			for _, param := range fields[1:] {
+				key, val, ok := parseAltSvcParameter(param)
+				if !ok {
+					continue
+				}
+				switch key {
+				case "ma":
+					secs, err := strconv.ParseUint(val, 10, 32)
+					if err != nil {
+						continue
+					}
+					maxAge = time.Duration(secs) * time.Second
+				case "v":
+					alt.versions = parseAltSvcVersions(val)
+				}
+			}
+			alt.expires = now.Add(maxAge)
+			alts = append(alts, alt)
+		}
+	}
+	return alts, false
+}
+
+// parseAltSvcAlternative parses an alternative of the form quic="host:port"
+func parseAltSvcAlternative(s string) (altSvc, bool) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 || strings.TrimSpace(s[:i]) != altSvcProtocolID {
+		return altSvc{}, false
+	}
+	authority, ok := unquote(strings.TrimSpace(s[i+1:]))
+	if !ok {
+		return altSvc{}, false
+	}
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		return altSvc{}, false
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return altSvc{}, false
+	}
+	return altSvc{host: host, port: port}, true
+}
+
+func parseAltSvcParameter(s string) (string, string, bool) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	val, ok := unquote(strings.TrimSpace(s[i+1:]))
+	if !ok {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(s[:i])), val, true
+}
+
+func parseAltSvcVersions(s string) []protocol.VersionNumber {
+	versions := make([]protocol.VersionNumber, 0)
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, protocol.VersionNumber(n))
+	}
+	return versions
+}
+
+// splitUnquoted splits s at every occurrence of sep that is not inside a quoted string
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes from a quoted-string, as defined in RFC 7230, section 3.2.6.
+// Tokens are returned unchanged.
+func unquote(s string) (string, bool) {
+	if len(s) == 0 || s[0] != '"' {
+		return s, len(s) > 0
+	}
+	if len(s) < 2 || s[len(s)-1] != '"' {
+		return "", false
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, true
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b), true
+}
+
+// usableWith says if the alternative can be used with any of the given versions
+func (a *altSvc) usableWith(versions []protocol.VersionNumber) bool {
+	if a.versions == nil {
+		return true
+	}
+	return protocol.ChooseSupportedVersion(versions, a.versions) != protocol.VersionUnsupported
+}
+
+type brokenAltSvc struct {
+	until   time.Time
+	backoff time.Duration
+}
+
+// The altSvcCache stores the alternative services per origin.
+// It also keeps track of alternatives that failed, such that they are not used again until a backoff period has passed.
+type altSvcCache struct {
+	mutex sync.Mutex
+
+	alternatives map[string]altSvc       // origin -> alternative
+	broken       map[string]brokenAltSvc // alternative authority -> broken state
+}
+
+func newAltSvcCache() *altSvcCache {
+	return &altSvcCache{
+		alternatives: make(map[string]altSvc),
+		broken:       make(map[string]brokenAltSvc),
+	}
+}
+
+// update processes the Alt-Svc header received in a response from the origin
+func (c *altSvcCache) update(origin string, hdr http.Header, versions []protocol.VersionNumber, now time.Time) {
+	values, ok := hdr["Alt-Svc"]
+	if !ok {
+		return
+	}
+	alts, cleared := parseAltSvc(values, now)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cleared {
+		delete(c.alternatives, origin)
+		return
+	}
+	for _, alt := range alts {
+		if alt.usableWith(versions) {
+			c.alternatives[origin] = alt
+			return
+		}
+	}
+	// the origin doesn't advertise the alternative any more
+	delete(c.alternatives, origin)
+}
+
+// get returns the authority (host:port) of the alternative service for the origin, if there's a fresh one that is not marked broken
+func (c *altSvcCache) get(origin string, originHost string, now time.Time) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	alt, ok := c.alternatives[origin]
+	if !ok {
+		return "", false
+	}
+	if !now.Before(alt.expires) {
+		delete(c.alternatives, origin)
+		return "", false
+	}
+	authority := alt.authority(originHost)
+	if b, ok := c.broken[authority]; ok && now.Before(b.until) {
+		return "", false
+	}
+	return authority, true
+}
+
+// markBroken marks an alternative authority as broken.
+// Every consecutive failure doubles the time the alternative is not used, up to altSvcMaxBrokenBackoff.
+func (c *altSvcCache) markBroken(authority string, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	backoff := altSvcInitialBrokenBackoff
+	if b, ok := c.broken[authority]; ok {
+		backoff = b.backoff * 2
+		if backoff > altSvcMaxBrokenBackoff {
+			backoff = altSvcMaxBrokenBackoff
+		}
+	}
+	c.broken[authority] = brokenAltSvc{until: now.Add(backoff), backoff: backoff}
+}
+
+// markWorking resets the broken state of an alternative authority
+func (c *altSvcCache) markWorking(authority string) {
+	c.mutex.Lock()
+	delete(c.broken, authority)
+	c.mutex.Unlock()
+}
+
+func (a *altSvc) authority(originHost string) string {
+	host := a.host
+	if host == "" {
+		host = originHost
+	}
+	return net.JoinHostPort(host, a.port)
+}
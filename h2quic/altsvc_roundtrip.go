@@ -0,0 +1,112 @@
+package h2quic
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// AltSvcRoundTripper is a http.RoundTripper that discovers QUIC support using the Alt-Svc header (RFC 7838).
+// Requests are sent using the Fallback RoundTripper (usually HTTP over TCP/TLS), until the origin advertises a QUIC alternative.
+// Subsequent requests to that origin are then sent over QUIC.
+// If a request over QUIC fails, the alternative is considered broken for a while, and the request is retried using the Fallback.
+type AltSvcRoundTripper struct {
+	// Fallback is used for all requests that are not sent over QUIC.
+	// If nil, http.DefaultTransport is used.
+	Fallback http.RoundTripper
+
+	// QuicRoundTripper is used for requests to origins that advertised a QUIC alternative.
+	// If nil, a RoundTripper with default values is used.
+	QuicRoundTripper *RoundTripper
+
+	initOnce sync.Once
+	cache    *altSvcCache
+}
+
+var _ roundTripCloser = &AltSvcRoundTripper{}
+
+func (r *AltSvcRoundTripper) init() {
+	r.initOnce.Do(func() {
+		r.cache = newAltSvcCache()
+		if r.QuicRoundTripper == nil {
+			r.QuicRoundTripper = &RoundTripper{}
+		}
+	})
+}
+
+// RoundTrip does a round trip.
+func (r *AltSvcRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.init()
+
+	if req.URL == nil || req.URL.Scheme != "https" {
+		return r.fallback().RoundTrip(req)
+	}
+
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	origin := "https://" + hostname
+	originHost, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return r.fallback().RoundTrip(req)
+	}
+
+	if addr, ok := r.cache.get(origin, originHost, time.Now()); ok {
+		rsp, err := r.QuicRoundTripper.roundTripAlt(req, addr)
+		if err == nil {
+			r.cache.markWorking(addr)
+			r.cache.update(origin, rsp.Header, r.versions(), time.Now())
+			return rsp, nil
+		}
+		// the request failed because it was canceled, not because the alternative is broken
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		utils.Infof("Request to alternative service %s for %s failed: %s. Falling back.", addr, origin, err.Error())
+		r.cache.markBroken(addr, time.Now())
+		r.QuicRoundTripper.removeClient(hostname, addr)
+		// the request body might already have been consumed
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			newReq := *req
+			newReq.Body = body
+			req = &newReq
+		}
+	}
+
+	rsp, err := r.fallback().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.update(origin, rsp.Header, r.versions(), time.Now())
+	return rsp, nil
+}
+
+// Close closes the QUIC connections that this RoundTripper has used.
+func (r *AltSvcRoundTripper) Close() error {
+	r.init()
+	return r.QuicRoundTripper.Close()
+}
+
+func (r *AltSvcRoundTripper) fallback() http.RoundTripper {
+	if r.Fallback == nil {
+		return http.DefaultTransport
+	}
+	return r.Fallback
+}
+
+// versions returns the QUIC versions that can be used for alternative services
+func (r *AltSvcRoundTripper) versions() []protocol.VersionNumber {
+	if r.QuicRoundTripper.QuicConfig != nil && len(r.QuicRoundTripper.QuicConfig.Versions) > 0 {
+		return r.QuicRoundTripper.QuicConfig.Versions
+	}
+	return protocol.SupportedVersions
+}
@@ -0,0 +1,164 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockRoundTripper struct {
+	requests []*http.Request
+	response *http.Response
+	err      error
+}
+
+func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.response, nil
+}
+
+var _ = Describe("Alt-Svc RoundTripper", func() {
+	var (
+		rt           *AltSvcRoundTripper
+		fallback     *mockRoundTripper
+		origDialAddr = dialAddr
+	)
+
+	BeforeEach(func() {
+		origDialAddr = dialAddr
+		fallback = &mockRoundTripper{response: &http.Response{Header: http.Header{}}}
+		rt = &AltSvcRoundTripper{Fallback: fallback}
+	})
+
+	AfterEach(func() {
+		dialAddr = origDialAddr
+	})
+
+	It("uses the fallback if no alternative is known", func() {
+		req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp).To(Equal(fallback.response))
+		Expect(fallback.requests).To(HaveLen(1))
+	})
+
+	It("uses the fallback for plain HTTP requests", func() {
+		fallback.response.Header.Set("Alt-Svc", `quic=":443"`)
+		req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rt.cache.alternatives).To(BeEmpty())
+	})
+
+	It("returns errors from the fallback", func() {
+		testErr := errors.New("fallback error")
+		fallback.err = testErr
+		req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	Context("using alternatives", func() {
+		var (
+			dialedAddr    string
+			dialedTLSConf *tls.Config
+			dialErr       error
+		)
+
+		BeforeEach(func() {
+			dialedAddr = ""
+			dialedTLSConf = nil
+			dialErr = errors.New("dial error")
+			dialAddr = func(addr string, tlsConf *tls.Config, _ *quic.Config) (quic.Session, error) {
+				dialedAddr = addr
+				dialedTLSConf = tlsConf
+				return nil, dialErr
+			}
+			fallback.response.Header.Set("Alt-Svc", `quic="alt.example.org:8443"`)
+			req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialedAddr).To(BeEmpty())
+			fallback.requests = nil
+		})
+
+		It("dials the alternative", func() {
+			req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialedAddr).To(Equal("alt.example.org:8443"))
+			Expect(dialedTLSConf.ServerName).To(Equal("www.example.org"))
+		})
+
+		It("falls back and marks the alternative as broken if QUIC fails", func() {
+			req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fallback.requests).To(HaveLen(1))
+			Expect(rt.cache.broken).To(HaveKey("alt.example.org:8443"))
+			Expect(rt.QuicRoundTripper.clients).To(BeEmpty())
+			// the next request doesn't try QUIC
+			dialedAddr = ""
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialedAddr).To(BeEmpty())
+			Expect(fallback.requests).To(HaveLen(2))
+		})
+
+		It("returns the error of a canceled request, without falling back or marking the alternative as broken", func() {
+			req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = rt.RoundTrip(req.WithContext(ctx))
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(fallback.requests).To(BeEmpty())
+			Expect(rt.cache.broken).To(BeEmpty())
+		})
+
+		It("resends the request body when falling back", func() {
+			req, err := http.NewRequest("POST", "https://www.example.org/", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fallback.requests).To(HaveLen(1))
+			body, err := ioutil.ReadAll(fallback.requests[0].Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal([]byte("foobar")))
+		})
+
+		It("returns the error if the request body can't be resent", func() {
+			req, err := http.NewRequest("POST", "https://www.example.org/", &mockBody{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(fallback.requests).To(BeEmpty())
+		})
+
+		It("doesn't use alternatives that were cleared", func() {
+			fallback.response.Header.Set("Alt-Svc", "clear")
+			req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rt.cache.alternatives).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package h2quic
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alt-Svc", func() {
+	now := time.Now()
+
+	Context("parsing", func() {
+		It("parses the header set by the server", func() {
+			alts, cleared := parseAltSvc([]string{`quic=":443"; ma=2592000; v="39,38,37"`}, now)
+			Expect(cleared).To(BeFalse())
+			Expect(alts).To(HaveLen(1))
+			Expect(alts[0].host).To(BeEmpty())
+			Expect(alts[0].port).To(Equal("443"))
+			Expect(alts[0].versions).To(Equal([]protocol.VersionNumber{39, 38, 37}))
+			Expect(alts[0].expires).To(Equal(now.Add(2592000 * time.Second)))
+		})
+
+		It("parses an alternative with a host", func() {
+			alts, _ := parseAltSvc([]string{`quic="alt.example.org:8443"`}, now)
+			Expect(alts).To(HaveLen(1))
+			Expect(alts[0].host).To(Equal("alt.example.org"))
+			Expect(alts[0].port).To(Equal("8443"))
+			Expect(alts[0].authority("www.example.org")).To(Equal("alt.example.org:8443"))
+		})
+
+		It("uses the host of the origin for alternatives without a host", func() {
+			alts, _ := parseAltSvc([]string{`quic=":1337"`}, now)
+			Expect(alts).To(HaveLen(1))
+			Expect(alts[0].authority("www.example.org")).To(Equal("www.example.org:1337"))
+		})
+
+		It("uses the default max age", func() {
+			alts, _ := parseAltSvc([]string{`quic=":443"`}, now)
+			Expect(alts).To(HaveLen(1))
+			Expect(alts[0].expires).To(Equal(now.Add(altSvcDefaultMaxAge)))
+			Expect(alts[0].versions).To(BeNil())
+		})
+
+		It("parses multiple alternatives", func() {
+			alts, _ := parseAltSvc([]string{`h2="alt.example.org:443", quic=":443"; v="39", quic=":8443"; ma=60`}, now)
+			Expect(alts).To(HaveLen(2))
+			Expect(alts[0].port).To(Equal("443"))
+			Expect(alts[0].versions).To(Equal([]protocol.VersionNumber{39}))
+			Expect(alts[1].port).To(Equal("8443"))
+			Expect(alts[1].expires).To(Equal(now.Add(time.Minute)))
+		})
+
+		It("parses multiple header fields", func() {
+			alts, _ := parseAltSvc([]string{`quic=":443"`, `quic=":8443"`}, now)
+			Expect(alts).To(HaveLen(2))
+		})
+
+		It("recognizes the clear value", func() {
+			alts, cleared := parseAltSvc([]string{"clear"}, now)
+			Expect(cleared).To(BeTrue())
+			Expect(alts).To(BeEmpty())
+		})
+
+		It("skips invalid alternatives", func() {
+			alts, _ := parseAltSvc([]string{`quic="foobar", quic=":99999", quic=":443`}, now)
+			Expect(alts).To(BeEmpty())
+			alts, _ = parseAltSvc([]string{`quic="foobar", quic=":443"`}, now)
+			Expect(alts).To(HaveLen(1))
+		})
+
+		It("ignores invalid max age values", func() {
+			alts, _ := parseAltSvc([]string{`quic=":443"; ma=foobar`}, now)
+			Expect(alts).To(HaveLen(1))
+			Expect(alts[0].expires).To(Equal(now.Add(altSvcDefaultMaxAge)))
+		})
+
+		It("unquotes escaped characters", func() {
+			s, ok := unquote(`"foo\"bar"`)
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(`foo"bar`))
+		})
+	})
+
+	Context("checking versions", func() {
+		It("accepts alternatives without versions", func() {
+			alt := altSvc{}
+			Expect(alt.usableWith(protocol.SupportedVersions)).To(BeTrue())
+		})
+
+		It("accepts alternatives that support one of our versions", func() {
+			alt := altSvc{versions: []protocol.VersionNumber{1, protocol.SupportedVersions[0]}}
+			Expect(alt.usableWith(protocol.SupportedVersions)).To(BeTrue())
+		})
+
+		It("rejects alternatives that don't support any of our versions", func() {
+			alt := altSvc{versions: []protocol.VersionNumber{1, 2}}
+			Expect(alt.usableWith(protocol.SupportedVersions)).To(BeFalse())
+		})
+	})
+
+	Context("the cache", func() {
+		var cache *altSvcCache
+		origin := "https://www.example.org:443"
+
+		BeforeEach(func() {
+			cache = newAltSvcCache()
+		})
+
+		It("saves an alternative", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			addr, ok := cache.get(origin, "www.example.org", now)
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("www.example.org:443"))
+		})
+
+		It("doesn't return alternatives for other origins", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			_, ok := cache.get("https://www.example.org:8443", "www.example.org", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("ignores responses without the Alt-Svc header", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			cache.update(origin, http.Header{}, protocol.SupportedVersions, now)
+			_, ok := cache.get(origin, "www.example.org", now)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("skips alternatives with unsupported versions", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"; v="1", quic=":8443"`}}, protocol.SupportedVersions, now)
+			addr, ok := cache.get(origin, "www.example.org", now)
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("www.example.org:8443"))
+		})
+
+		It("forgets the alternative if the origin only advertises unusable alternatives", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"; v="1"`}}, protocol.SupportedVersions, now)
+			_, ok := cache.get(origin, "www.example.org", now)
+			Expect(ok).To(BeFalse())
+			Expect(cache.alternatives).To(BeEmpty())
+		})
+
+		It("clears alternatives", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			cache.update(origin, http.Header{"Alt-Svc": {"clear"}}, protocol.SupportedVersions, now)
+			_, ok := cache.get(origin, "www.example.org", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("expires alternatives", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"; ma=10`}}, protocol.SupportedVersions, now)
+			_, ok := cache.get(origin, "www.example.org", now.Add(9*time.Second))
+			Expect(ok).To(BeTrue())
+			_, ok = cache.get(origin, "www.example.org", now.Add(10*time.Second))
+			Expect(ok).To(BeFalse())
+			Expect(cache.alternatives).To(BeEmpty())
+		})
+
+		It("doesn't return broken alternatives", func() {
+			cache.update(origin, http.Header{"Alt-Svc": {`quic=":443"`}}, protocol.SupportedVersions, now)
+			cache.markBroken("www.example.org:443", now)
+			_, ok := cache.get(origin, "www.example.org", now.Add(altSvcInitialBrokenBackoff-time.Second))
+			Expect(ok).To(BeFalse())
+			_, ok = cache.get(origin, "www.example.org", now.Add(altSvcInitialBrokenBackoff))
+			Expect(ok).To(BeTrue())
+		})
+
+		It("doubles the backoff for alternatives that fail repeatedly", func() {
+			cache.markBroken("www.example.org:443", now)
+			cache.markBroken("www.example.org:443", now)
+			Expect(cache.broken["www.example.org:443"].until).To(Equal(now.Add(2 * altSvcInitialBrokenBackoff)))
+			for i := 0; i < 20; i++ {
+				cache.markBroken("www.example.org:443", now)
+			}
+			Expect(cache.broken["www.example.org:443"].until).To(Equal(now.Add(altSvcMaxBrokenBackoff)))
+		})
+
+		It("resets the backoff when an alternative works", func() {
+			cache.markBroken("www.example.org:443", now)
+			cache.markWorking("www.example.org:443")
+			Expect(cache.broken).To(BeEmpty())
+		})
+	})
+})
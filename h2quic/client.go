@@ -35,6 +35,7 @@ type client struct {
 	opts    *roundTripperOpts
 
 	hostname        string
+	connectAddr     string // the address that is dialed, only different from the hostname when using an alternative service
 	encryptionLevel protocol.EncryptionLevel
 	handshakeErr    error
 	dialOnce        sync.Once
@@ -66,8 +67,10 @@ func newClient(
 	if quicConfig != nil {
 		config = quicConfig
 	}
+	hostname = authorityAddr("https", hostname)
 	return &client{
-		hostname:        authorityAddr("https", hostname),
+		hostname:        hostname,
+		connectAddr:     hostname,
 		responses:       make(map[protocol.StreamID]chan *http.Response),
 		encryptionLevel: protocol.EncryptionUnencrypted,
 		tlsConf:         tlsConfig,
@@ -79,8 +82,25 @@ func newClient(
 
 // dial dials the connection
 func (c *client) dial() error {
+	tlsConf := c.tlsConf
+	if c.connectAddr != c.hostname {
+		// The alternative service has to present a certificate that is valid for the origin.
+		// See RFC 7838, section 2.1.
+		host, _, err := net.SplitHostPort(c.hostname)
+		if err != nil {
+			return err
+		}
+		if tlsConf == nil {
+			tlsConf = &tls.Config{}
+		} else {
+			tlsConf = tlsConf.Clone()
+		}
+		if tlsConf.ServerName == "" {
+			tlsConf.ServerName = host
+		}
+	}
 	var err error
-	c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+	c.session, err = dialAddr(c.connectAddr, tlsConf, c.config)
 	if err != nil {
 		return err
 	}
@@ -98,6 +118,21 @@ func (c *client) dial() error {
 	return nil
 }
 
+// connect dials the connection, if that didn't happen yet.
+// It blocks until the handshake completes, and returns the handshake error.
+func (c *client) connect() error {
+	c.dialOnce.Do(func() {
+		c.handshakeErr = c.dial()
+	})
+	return c.handshakeErr
+}
+
+// closed returns a channel that is closed when the QUIC connection is closed.
+// It must only be called after connect succeeded.
+func (c *client) closed() <-chan struct{} {
+	return c.session.Context().Done()
+}
+
 func (c *client) handleHeaderStream() {
 	decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
 	h2framer := http2.NewFramer(nil, c.headerStream)
@@ -127,8 +162,9 @@ func (c *client) handleHeaderStream() {
 		responseChan, ok := c.responses[protocol.StreamID(hframe.StreamID)]
 		c.mutex.RUnlock()
 		if !ok {
-			c.headerErr = qerr.Error(qerr.InternalError, fmt.Sprintf("h2client BUG: response channel for stream %d not found", lastStream))
-			break
+			// the request was canceled before the response arrived
+			utils.Debugf("h2client: ignoring response for canceled request on stream %d", lastStream)
+			continue
 		}
 
 		rsp, err := responseFromHeaders(mhframe)
@@ -143,27 +179,30 @@ func (c *client) handleHeaderStream() {
 	close(c.headerErrored)
 }
 
-// Roundtrip executes a request and returns a response
-func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
+func (c *client) checkRequest(req *http.Request) error {
 	// TODO: add port to address, if it doesn't have one
 	if req.URL.Scheme != "https" {
-		return nil, errors.New("quic http2: unsupported scheme")
+		return errors.New("quic http2: unsupported scheme")
 	}
 	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
-		return nil, fmt.Errorf("h2quic Client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
+		return fmt.Errorf("h2quic Client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
 	}
+	return nil
+}
 
-	c.dialOnce.Do(func() {
-		c.handshakeErr = c.dial()
-	})
-
-	if c.handshakeErr != nil {
-		return nil, c.handshakeErr
+// Roundtrip executes a request and returns a response
+func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := c.checkRequest(req); err != nil {
+		return nil, err
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
 	}
 
 	hasBody := (req.Body != nil)
 
-	responseChan := make(chan *http.Response)
+	// the channel is buffered, such that the header stream is never blocked by a canceled request
+	responseChan := make(chan *http.Response, 1)
 	dataStream, err := c.session.OpenStreamSync()
 	if err != nil {
 		_ = c.CloseWithError(err)
@@ -201,18 +240,23 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 		bodySent = true
 	}
 
+	ctx := req.Context()
 	for !(bodySent && receivedResponse) {
 		select {
 		case res = <-responseChan:
 			receivedResponse = true
-			c.mutex.Lock()
-			delete(c.responses, dataStream.StreamID())
-			c.mutex.Unlock()
+			c.removeResponseChan(dataStream.StreamID())
 		case err := <-resc:
 			bodySent = true
 			if err != nil {
+				// the data stream was already reset by writeRequestBody
+				c.removeResponseChan(dataStream.StreamID())
 				return nil, err
 			}
+		case <-ctx.Done():
+			dataStream.Reset(errorCodeCancel)
+			c.removeResponseChan(dataStream.StreamID())
+			return nil, ctx.Err()
 		case <-c.headerErrored:
 			// an error occured on the header stream
 			_ = c.CloseWithError(c.headerErr)
@@ -229,7 +273,8 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if streamEnded || isHead {
 		res.Body = noBody
 	} else {
-		res.Body = dataStream
+		// the request might still be canceled while the body is read
+		res.Body = newResponseBody(ctx, dataStream)
 		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
@@ -243,18 +288,72 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, nil
 }
 
+// connectStream sends an extended CONNECT request for protocol.
+// It returns the response and the data stream, which stays open for sending data.
+func (c *client) connectStream(req *http.Request, protocol string) (*http.Response, quic.Stream, error) {
+	if err := c.checkRequest(req); err != nil {
+		return nil, nil, err
+	}
+	if err := c.connect(); err != nil {
+		return nil, nil, err
+	}
+
+	responseChan := make(chan *http.Response, 1)
+	dataStream, err := c.session.OpenStreamSync()
+	if err != nil {
+		_ = c.CloseWithError(err)
+		return nil, nil, err
+	}
+	c.mutex.Lock()
+	c.responses[dataStream.StreamID()] = responseChan
+	c.mutex.Unlock()
+
+	if err := c.requestWriter.WriteConnectRequest(req, dataStream.StreamID(), protocol); err != nil {
+		_ = c.CloseWithError(err)
+		return nil, nil, err
+	}
+
+	ctx := req.Context()
+	var res *http.Response
+	select {
+	case res = <-responseChan:
+		c.removeResponseChan(dataStream.StreamID())
+	case <-ctx.Done():
+		dataStream.Reset(errorCodeCancel)
+		c.removeResponseChan(dataStream.StreamID())
+		return nil, nil, ctx.Err()
+	case <-c.headerErrored:
+		// an error occured on the header stream
+		_ = c.CloseWithError(c.headerErr)
+		return nil, nil, c.headerErr
+	}
+
+	res.ContentLength = -1
+	res.Body = dataStream
+	res.Request = req
+	return res, dataStream, nil
+}
+
+func (c *client) removeResponseChan(id protocol.StreamID) {
+	c.mutex.Lock()
+	delete(c.responses, id)
+	c.mutex.Unlock()
+}
+
+// writeRequestBody writes the request body to the data stream.
+// If an error occurs, the data stream is reset, since the server would otherwise treat a truncated body as complete.
 func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (err error) {
 	defer func() {
 		cerr := body.Close()
-		if err == nil {
-			// TODO: what to do with dataStream here? Maybe reset it?
+		if err == nil && cerr != nil {
+			dataStream.Reset(errorCodeInternalError)
 			err = cerr
 		}
 	}()
 
 	_, err = io.Copy(dataStream, body)
 	if err != nil {
-		// TODO: what to do with dataStream here? Maybe reset it?
+		dataStream.Reset(errorCodeInternalError)
 		return err
 	}
 	return dataStream.Close()
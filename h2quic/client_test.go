@@ -192,7 +192,8 @@ var _ = Describe("Client", func() {
 			Eventually(func() bool { return doReturned }).Should(BeTrue())
 			Expect(doErr).ToNot(HaveOccurred())
 			Expect(doRsp).To(Equal(rsp))
-			Expect(doRsp.Body).To(Equal(dataStream))
+			Expect(doRsp.Body).To(BeAssignableToTypeOf(&responseBody{}))
+			Expect(doRsp.Body.(*responseBody).dataStream).To(Equal(dataStream))
 			Expect(doRsp.ContentLength).To(BeEquivalentTo(-1))
 			Expect(doRsp.Request).To(Equal(request))
 
@@ -236,6 +237,105 @@ var _ = Describe("Client", func() {
 			close(done)
 		})
 
+		It("resets the stream when the request is canceled", func(done Done) {
+			ctx, cancel := context.WithCancel(context.Background())
+			request = request.WithContext(ctx)
+			var doErr error
+			var doReturned bool
+			go func() {
+				_, doErr = client.RoundTrip(request)
+				doReturned = true
+			}()
+
+			Eventually(func() map[protocol.StreamID]chan *http.Response { return client.responses }).Should(HaveKey(protocol.StreamID(5)))
+			cancel()
+			Eventually(func() bool { return doReturned }).Should(BeTrue())
+			Expect(doErr).To(MatchError(context.Canceled))
+			Expect(dataStream.reset).To(BeTrue())
+			Expect(dataStream.resetCode).To(Equal(errorCodeCancel))
+			Expect(client.responses).ToNot(HaveKey(protocol.StreamID(5)))
+			close(done)
+		})
+
+		It("resets the stream when the request is canceled while the body is read", func(done Done) {
+			ctx, cancel := context.WithCancel(context.Background())
+			request = request.WithContext(ctx)
+			dataStream.dataToRead.Write([]byte("foo"))
+			var doRsp *http.Response
+			var doReturned bool
+			go func() {
+				defer GinkgoRecover()
+				var err error
+				doRsp, err = client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				doReturned = true
+			}()
+
+			Eventually(func() map[protocol.StreamID]chan *http.Response { return client.responses }).Should(HaveKey(protocol.StreamID(5)))
+			client.responses[5] <- &http.Response{StatusCode: 200}
+			Eventually(func() bool { return doReturned }).Should(BeTrue())
+			_, err := doRsp.Body.Read(make([]byte, 3))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataStream.reset).To(BeFalse())
+			cancel()
+			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Expect(dataStream.resetCode).To(Equal(errorCodeCancel))
+			close(done)
+		})
+
+		Context("sending CONNECT requests", func() {
+			BeforeEach(func() {
+				var err error
+				request, err = http.NewRequest("CONNECT", "https://quic.clemente.io:1337/chat", nil)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns the data stream", func(done Done) {
+				var doRsp *http.Response
+				var doStr quic.Stream
+				var doErr error
+				var doReturned bool
+				go func() {
+					doRsp, doStr, doErr = client.connectStream(request, "websocket")
+					doReturned = true
+				}()
+
+				Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+				mhf := getRequest(headerStream.dataWritten.Bytes())
+				Expect(mhf.HeadersFrame.StreamEnded()).To(BeFalse())
+				Expect(getHeaderFields(mhf)).To(HaveKeyWithValue(":protocol", "websocket"))
+				Eventually(func() map[protocol.StreamID]chan *http.Response { return client.responses }).Should(HaveKey(protocol.StreamID(5)))
+				rsp := &http.Response{StatusCode: 200}
+				client.responses[5] <- rsp
+				Eventually(func() bool { return doReturned }).Should(BeTrue())
+				Expect(doErr).ToNot(HaveOccurred())
+				Expect(doStr).To(Equal(dataStream))
+				Expect(doRsp.Body).To(Equal(dataStream))
+				Expect(doRsp.Request).To(Equal(request))
+				Expect(dataStream.closed).To(BeFalse())
+				Expect(client.responses).ToNot(HaveKey(protocol.StreamID(5)))
+				close(done)
+			})
+
+			It("resets the stream when the request is canceled", func(done Done) {
+				ctx, cancel := context.WithCancel(context.Background())
+				request = request.WithContext(ctx)
+				var doErr error
+				var doReturned bool
+				go func() {
+					_, _, doErr = client.connectStream(request, "websocket")
+					doReturned = true
+				}()
+
+				Eventually(func() map[protocol.StreamID]chan *http.Response { return client.responses }).Should(HaveKey(protocol.StreamID(5)))
+				cancel()
+				Eventually(func() bool { return doReturned }).Should(BeTrue())
+				Expect(doErr).To(MatchError(context.Canceled))
+				Expect(dataStream.reset).To(BeTrue())
+				close(done)
+			})
+		})
+
 		It("blocks if no stream is available", func() {
 			session.streamsToOpen = []quic.Stream{headerStream}
 			session.blockOpenStreamSync = true
@@ -353,6 +453,8 @@ var _ = Describe("Client", func() {
 				Expect(doErr).To(MatchError(testErr))
 				Expect(doRsp).To(BeNil())
 				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				Expect(dataStream.reset).To(BeTrue())
+				Expect(client.responses).ToNot(HaveKey(protocol.StreamID(5)))
 			})
 
 			It("returns the error that occurred when closing the body", func() {
@@ -370,6 +472,8 @@ var _ = Describe("Client", func() {
 				Expect(doErr).To(MatchError(testErr))
 				Expect(doRsp).To(BeNil())
 				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				Expect(dataStream.reset).To(BeTrue())
+				Expect(client.responses).ToNot(HaveKey(protocol.StreamID(5)))
 			})
 		})
 
@@ -488,6 +592,16 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Header).To(HaveKeyWithValue("Cache-Control", []string{"private"}))
 			})
 
+			It("ignores responses for streams without a request", func() {
+				h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      25,
+					EndHeaders:    true,
+					BlockFragment: []byte{0x88}, // :status: 200
+				})
+				go client.handleHeaderStream()
+				Consistently(client.headerErrored).ShouldNot(BeClosed())
+			})
+
 			It("errors if the H2 frame is not a HeadersFrame", func() {
 				h2framer.WritePing(true, [8]byte{0, 0, 0, 0, 0, 0, 0, 0})
 
@@ -0,0 +1,391 @@
+package h2quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const (
+	// DefaultQuicHeadStart is the default time that the QUIC handshake is given before a TCP connection is started
+	DefaultQuicHeadStart = 300 * time.Millisecond
+	// DefaultUDPFailureTimeout is the default time that QUIC is not used for a host after a QUIC handshake failed
+	DefaultUDPFailureTimeout = 5 * time.Minute
+)
+
+// allows mocking of the TCP+TLS dial in the tests
+var dialTLS = func(ctx context.Context, addr string, tlsConf *tls.Config) (net.Conn, error) {
+	rawConn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// same as tls.Dial: use the hostname for SNI and certificate verification, if no ServerName is configured
+	if tlsConf == nil || tlsConf.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+		if tlsConf == nil {
+			tlsConf = &tls.Config{}
+		} else {
+			tlsConf = tlsConf.Clone()
+		}
+		tlsConf.ServerName = host
+	}
+	conn := tls.Client(rawConn, tlsConf)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- conn.Handshake()
+	}()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+		return conn, nil
+	case <-ctx.Done():
+		// closing the connection makes the handshake return
+		rawConn.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// The quicHost tracks the state of the QUIC connection to a host
+type quicHost struct {
+	done chan struct{} // closed as soon as the QUIC handshake completed, successfully or not
+	err  error         // the handshake error, must only be read after done was closed
+	// after a failed handshake, QUIC is not used for this host until this time
+	failedUntil time.Time
+	// the TCP connection that races the QUIC handshake, shared by all requests waiting for the handshake
+	tcpDial *tcpDial
+}
+
+func (h *quicHost) completed() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// A tcpDial establishes a TCP+TLS connection to race a pending QUIC handshake.
+// The dial is canceled when all requests that joined it stopped waiting before it completed.
+type tcpDial struct {
+	done    chan struct{} // closed when the dial completed
+	conn    net.Conn      // must only be read after done was closed
+	err     error         // must only be read after done was closed
+	cancel  context.CancelFunc
+	waiters int // the number of requests using the dial, protected by the DualRoundTripper's mutex
+}
+
+// DualRoundTripper is a http.RoundTripper that races a QUIC handshake against a TCP+TLS connection.
+// The QUIC handshake is started first, and a TCP connection is only established if the QUIC handshake
+// doesn't complete within QuicHeadStart. The request is then sent on whichever connection is ready first.
+// All requests waiting for the QUIC handshake with a host share a single TCP connection attempt.
+// Hosts for which the QUIC handshake failed (e.g. because UDP is blocked) are only contacted using TCP for UDPFailureTimeout.
+// When the QUIC connection to a host is closed, the next request races a new QUIC handshake against TCP again.
+// If the context of a request is canceled, RoundTrip stops waiting and returns immediately.
+// The QUIC handshake with a host is shared by all requests to this host, so it is not canceled.
+type DualRoundTripper struct {
+	// QuicRoundTripper is used for requests sent over QUIC.
+	// Its TLSClientConfig is also used for TCP connections.
+	// If nil, a RoundTripper with default values is used.
+	QuicRoundTripper *RoundTripper
+
+	// QuicHeadStart is the time that the QUIC handshake is given before a TCP connection is started.
+	// If zero, DefaultQuicHeadStart is used.
+	QuicHeadStart time.Duration
+
+	// UDPFailureTimeout is the time that QUIC is not used for a host after a QUIC handshake to this host failed.
+	// If zero, DefaultUDPFailureTimeout is used.
+	UDPFailureTimeout time.Duration
+
+	initOnce     sync.Once
+	tcpTransport *http.Transport
+
+	mutex sync.Mutex
+	hosts map[string]*quicHost
+	// TCP connections that won the race, but were not yet picked up by the tcpTransport
+	tcpConns map[string][]net.Conn
+}
+
+var _ roundTripCloser = &DualRoundTripper{}
+
+func (r *DualRoundTripper) init() {
+	r.initOnce.Do(func() {
+		if r.QuicRoundTripper == nil {
+			r.QuicRoundTripper = &RoundTripper{}
+		}
+		r.tcpTransport = &http.Transport{
+			DialTLS:            r.dialTLS,
+			DisableCompression: r.QuicRoundTripper.DisableCompression,
+		}
+		r.hosts = make(map[string]*quicHost)
+		r.tcpConns = make(map[string][]net.Conn)
+	})
+}
+
+// RoundTrip does a round trip.
+func (r *DualRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.init()
+
+	if req.URL == nil || req.URL.Scheme != "https" {
+		return r.tcpTransport.RoundTrip(req)
+	}
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	host, ok := r.getQuicHost(hostname)
+	if !ok {
+		return r.tcpTransport.RoundTrip(req)
+	}
+	if host.completed() {
+		return r.roundTripCompleted(req, host)
+	}
+
+	ctx := req.Context()
+	canceled := func() (*http.Response, error) {
+		closeRequestBody(req)
+		return nil, ctx.Err()
+	}
+
+	headStart := r.QuicHeadStart
+	if headStart == 0 {
+		headStart = DefaultQuicHeadStart
+	}
+	timer := time.NewTimer(headStart)
+	defer timer.Stop()
+	select {
+	case <-host.done:
+		return r.roundTripCompleted(req, host)
+	case <-timer.C:
+	case <-ctx.Done():
+		return canceled()
+	}
+
+	dial := r.joinTCPDial(hostname, host)
+	leave := func() { r.leaveTCPDial(hostname, host, dial) }
+	roundTripQUIC := func() (*http.Response, error) {
+		leave()
+		return r.QuicRoundTripper.RoundTrip(req)
+	}
+	// the TCP connection is handed to the tcpTransport when it dials a new connection
+	roundTripTCP := func() (*http.Response, error) {
+		defer leave()
+		return r.tcpTransport.RoundTrip(req)
+	}
+
+	select {
+	case <-host.done:
+		if host.err == nil {
+			// QUIC won the race.
+			return roundTripQUIC()
+		}
+		select {
+		case <-dial.done:
+			if dial.err != nil {
+				leave()
+				return nil, dial.err
+			}
+			return roundTripTCP()
+		case <-ctx.Done():
+			leave()
+			return canceled()
+		}
+	case <-dial.done:
+		if dial.err == nil {
+			return roundTripTCP()
+		}
+		// TCP failed. Maybe QUIC will succeed.
+		leave()
+		select {
+		case <-host.done:
+		case <-ctx.Done():
+			return canceled()
+		}
+		if host.err != nil {
+			return nil, host.err
+		}
+		return r.QuicRoundTripper.RoundTrip(req)
+	case <-ctx.Done():
+		leave()
+		return canceled()
+	}
+}
+
+// roundTripCompleted does a round trip for a host where the QUIC handshake already completed
+func (r *DualRoundTripper) roundTripCompleted(req *http.Request, host *quicHost) (*http.Response, error) {
+	if host.err != nil {
+		return r.tcpTransport.RoundTrip(req)
+	}
+	return r.QuicRoundTripper.RoundTrip(req)
+}
+
+// joinTCPDial returns the TCP dial racing the QUIC handshake with a host, and starts it if necessary.
+// Every call must be followed by a call to leaveTCPDial.
+func (r *DualRoundTripper) joinTCPDial(hostname string, host *quicHost) *tcpDial {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if host.tcpDial == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		dial := &tcpDial{done: make(chan struct{}), cancel: cancel}
+		host.tcpDial = dial
+		go func() {
+			conn, err := dialTLS(ctx, hostname, r.QuicRoundTripper.TLSClientConfig)
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if err == nil {
+				if dial.waiters == 0 {
+					conn.Close()
+				} else {
+					r.tcpConns[hostname] = append(r.tcpConns[hostname], conn)
+				}
+			}
+			dial.conn = conn
+			dial.err = err
+			close(dial.done)
+		}()
+	}
+	host.tcpDial.waiters++
+	return host.tcpDial
+}
+
+// leaveTCPDial is called when a request doesn't use the TCP dial any more.
+// When the last request leaves, a pending dial is canceled,
+// and a connection that wasn't picked up by the tcpTransport (e.g. because it reused an idle connection) is closed.
+func (r *DualRoundTripper) leaveTCPDial(hostname string, host *quicHost, dial *tcpDial) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	dial.waiters--
+	if dial.waiters > 0 {
+		return
+	}
+	select {
+	case <-dial.done:
+		if dial.err == nil && r.removeTCPConn(hostname, dial.conn) {
+			dial.conn.Close()
+		}
+	default:
+		dial.cancel()
+		// the next request starts a new dial
+		if host.tcpDial == dial {
+			host.tcpDial = nil
+		}
+	}
+}
+
+// removeTCPConn removes a connection that won the race, if it wasn't picked up by the tcpTransport yet.
+// It returns true if the connection was removed.
+// It must be called with the mutex locked.
+func (r *DualRoundTripper) removeTCPConn(hostname string, conn net.Conn) bool {
+	conns := r.tcpConns[hostname]
+	for i, c := range conns {
+		if c != conn {
+			continue
+		}
+		if len(conns) == 1 {
+			delete(r.tcpConns, hostname)
+		} else {
+			r.tcpConns[hostname] = append(conns[:i:i], conns[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// getQuicHost returns the QUIC state for a host.
+// If no QUIC handshake was started for this host yet, it starts the handshake.
+// It returns false if QUIC must not be used for this host, because a handshake failed recently.
+func (r *DualRoundTripper) getQuicHost(hostname string) (*quicHost, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	host, ok := r.hosts[hostname]
+	if ok && !(host.completed() && host.err != nil) {
+		return host, true
+	}
+	if ok && time.Now().Before(host.failedUntil) {
+		return nil, false
+	}
+
+	host = &quicHost{done: make(chan struct{})}
+	r.hosts[hostname] = host
+	go func() {
+		closed, err := r.QuicRoundTripper.connect(hostname)
+		if err != nil {
+			utils.Infof("QUIC handshake with %s failed: %s. Using TCP.", hostname, err.Error())
+			timeout := r.UDPFailureTimeout
+			if timeout == 0 {
+				timeout = DefaultUDPFailureTimeout
+			}
+			r.mutex.Lock()
+			host.failedUntil = time.Now().Add(timeout)
+			r.mutex.Unlock()
+			r.QuicRoundTripper.removeClient(hostname, hostname)
+		}
+		host.err = err
+		close(host.done)
+		if err == nil && closed != nil {
+			r.forgetQuicHostOnClose(hostname, host, closed)
+		}
+	}()
+	return host, true
+}
+
+// forgetQuicHostOnClose removes the QUIC state for a host when the QUIC connection is closed,
+// such that the next request dials a new QUIC connection, and races it against TCP.
+func (r *DualRoundTripper) forgetQuicHostOnClose(hostname string, host *quicHost, closed <-chan struct{}) {
+	<-closed
+	r.mutex.Lock()
+	current := r.hosts[hostname] == host
+	if current {
+		delete(r.hosts, hostname)
+	}
+	r.mutex.Unlock()
+	if current {
+		utils.Infof("QUIC connection to %s closed.", hostname)
+		r.QuicRoundTripper.removeClient(hostname, hostname)
+	}
+}
+
+// dialTLS is used by the tcpTransport to establish new connections.
+// It uses the connections that won the race against the QUIC handshake first.
+func (r *DualRoundTripper) dialTLS(network, addr string) (net.Conn, error) {
+	r.mutex.Lock()
+	if conns := r.tcpConns[addr]; len(conns) > 0 {
+		conn := conns[0]
+		if len(conns) == 1 {
+			delete(r.tcpConns, addr)
+		} else {
+			r.tcpConns[addr] = conns[1:]
+		}
+		r.mutex.Unlock()
+		return conn, nil
+	}
+	r.mutex.Unlock()
+	return dialTLS(context.Background(), addr, r.QuicRoundTripper.TLSClientConfig)
+}
+
+// Close closes all QUIC and TCP connections that this RoundTripper has used.
+func (r *DualRoundTripper) Close() error {
+	r.init()
+	r.tcpTransport.CloseIdleConnections()
+	r.mutex.Lock()
+	for _, conns := range r.tcpConns {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	r.tcpConns = make(map[string][]net.Conn)
+	r.hosts = make(map[string]*quicHost)
+	r.mutex.Unlock()
+	return r.QuicRoundTripper.Close()
+}
@@ -0,0 +1,359 @@
+package h2quic
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// serveHTTP serves HTTP/1.1 requests on a connection, until the connection is closed
+func serveHTTP(conn net.Conn, body string) {
+	go func() {
+		defer GinkgoRecover()
+		r := bufio.NewReader(conn)
+		for {
+			req, err := http.ReadRequest(r)
+			if err != nil {
+				return
+			}
+			rsp := &http.Response{
+				StatusCode:    200,
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Body:          ioutil.NopCloser(strings.NewReader(body)),
+				ContentLength: int64(len(body)),
+				Request:       req,
+			}
+			Expect(rsp.Write(conn)).To(Succeed())
+		}
+	}()
+}
+
+var _ = Describe("Dual RoundTripper", func() {
+	var (
+		rt           *DualRoundTripper
+		req          *http.Request
+		session      *mockSession
+		headerStream *mockStream
+		quicDials    chan string
+		quicDialErr  error
+		unblockDial  chan struct{}
+		tcpDials     chan string
+		origDialAddr = dialAddr
+		origDialTLS  = dialTLS
+	)
+
+	BeforeEach(func() {
+		origDialAddr = dialAddr
+		origDialTLS = dialTLS
+		rt = &DualRoundTripper{QuicHeadStart: 50 * time.Millisecond}
+		var err error
+		req, err = http.NewRequest("GET", "https://www.example.org/", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		headerStream = newMockStream(3)
+		session = &mockSession{streamsToOpen: []quic.Stream{headerStream, newMockStream(5)}}
+		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
+		quicDials = make(chan string, 10)
+		quicDialErr = nil
+		unblockDial = make(chan struct{})
+		close(unblockDial)
+		dialAddr = func(addr string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+			quicDials <- addr
+			<-unblockDial
+			if quicDialErr != nil {
+				return nil, quicDialErr
+			}
+			return session, nil
+		}
+		tcpDials = make(chan string, 10)
+		dialTLS = func(_ context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+			tcpDials <- addr
+			c1, c2 := net.Pipe()
+			serveHTTP(c2, "TCP response")
+			return c1, nil
+		}
+	})
+
+	AfterEach(func() {
+		dialAddr = origDialAddr
+		dialTLS = origDialTLS
+	})
+
+	readBody := func(rsp *http.Response) string {
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(body)
+	}
+
+	It("uses QUIC if the handshake completes within the head start", func() {
+		go rt.RoundTrip(req)
+		Eventually(quicDials).Should(Receive(Equal("www.example.org:443")))
+		Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+		Consistently(tcpDials, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("uses TCP if the QUIC handshake fails", func() {
+		quicDialErr = errors.New("UDP blocked")
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readBody(rsp)).To(Equal("TCP response"))
+		Expect(quicDials).To(Receive())
+		Expect(tcpDials).To(Receive())
+	})
+
+	It("uses TCP if the QUIC handshake doesn't complete within the head start", func() {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			<-unblock
+			return nil, errors.New("handshake timeout")
+		}
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readBody(rsp)).To(Equal("TCP response"))
+		Expect(tcpDials).To(Receive(Equal("www.example.org:443")))
+		// the TCP connection was handed to the transport, it didn't dial a new one
+		Expect(tcpDials).ToNot(Receive())
+		Expect(rt.tcpConns).To(BeEmpty())
+	})
+
+	It("uses QUIC if the handshake completes before the TCP connection", func() {
+		unblockDial = make(chan struct{})
+		tcpConn, tcpPeer := net.Pipe()
+		unblockTCP := make(chan struct{})
+		dialTLS = func(_ context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+			tcpDials <- addr
+			<-unblockTCP
+			return tcpConn, nil
+		}
+		go rt.RoundTrip(req)
+		Eventually(tcpDials).Should(Receive())
+		close(unblockDial)
+		Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+		close(unblockTCP)
+		// the TCP connection is closed
+		Eventually(func() error {
+			_, err := tcpPeer.Read([]byte{0})
+			return err
+		}).Should(HaveOccurred())
+	})
+
+	It("returns the TCP error if both QUIC and TCP fail", func() {
+		quicDialErr = errors.New("UDP blocked")
+		testErr := errors.New("TCP blocked")
+		dialTLS = func(context.Context, string, *tls.Config) (net.Conn, error) { return nil, testErr }
+		_, err := rt.RoundTrip(req)
+		Expect(err).To(MatchError(ContainSubstring(testErr.Error())))
+	})
+
+	It("shares the TCP dial between requests waiting for the same QUIC handshake", func() {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			<-unblock
+			return nil, errors.New("handshake timeout")
+		}
+		unblockTCP := make(chan struct{})
+		dialTLS = func(_ context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+			tcpDials <- addr
+			<-unblockTCP
+			c1, c2 := net.Pipe()
+			serveHTTP(c2, "TCP response")
+			return c1, nil
+		}
+		const num = 3
+		rsps := make(chan *http.Response, num)
+		for i := 0; i < num; i++ {
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				rsps <- rsp
+			}()
+		}
+		Eventually(tcpDials).Should(Receive())
+		Consistently(tcpDials).ShouldNot(Receive())
+		close(unblockTCP)
+		for i := 0; i < num; i++ {
+			var rsp *http.Response
+			Eventually(rsps).Should(Receive(&rsp))
+			Expect(readBody(rsp)).To(Equal("TCP response"))
+		}
+	})
+
+	It("races QUIC against TCP again after the QUIC connection was closed", func() {
+		go rt.RoundTrip(req)
+		Eventually(quicDials).Should(Receive())
+		Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+		hostKnown := func() bool {
+			rt.mutex.Lock()
+			defer rt.mutex.Unlock()
+			_, ok := rt.hosts["www.example.org:443"]
+			return ok
+		}
+		Expect(hostKnown()).To(BeTrue())
+		session.ctxCancel()
+		Eventually(hostKnown).Should(BeFalse())
+		// the next handshake doesn't complete, so the request is sent over TCP
+		unblock := make(chan struct{})
+		defer close(unblock)
+		dialAddr = func(addr string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+			quicDials <- addr
+			<-unblock
+			return nil, errors.New("handshake timeout")
+		}
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readBody(rsp)).To(Equal("TCP response"))
+		Expect(quicDials).To(Receive())
+		Expect(tcpDials).To(Receive())
+	})
+
+	It("closes the TCP connection that won the race if the transport reuses an idle connection", func() {
+		// the QUIC handshake fails, so the transport now has an idle TCP connection
+		quicDialErr = errors.New("UDP blocked")
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readBody(rsp)).To(Equal("TCP response"))
+		Expect(tcpDials).To(Receive())
+		// try QUIC again, but the handshake doesn't complete
+		rt.mutex.Lock()
+		rt.hosts["www.example.org:443"].failedUntil = time.Now().Add(-time.Second)
+		rt.mutex.Unlock()
+		unblock := make(chan struct{})
+		defer close(unblock)
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			<-unblock
+			return nil, errors.New("handshake timeout")
+		}
+		var tcpPeer net.Conn
+		dialTLS = func(_ context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+			var conn net.Conn
+			conn, tcpPeer = net.Pipe()
+			tcpDials <- addr
+			return conn, nil
+		}
+		rsp, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readBody(rsp)).To(Equal("TCP response"))
+		Expect(tcpDials).To(Receive())
+		Expect(rt.tcpConns).To(BeEmpty())
+		// the connection that won the race is closed
+		_, err = tcpPeer.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("canceling requests", func() {
+		var (
+			unblock chan struct{}
+			ctx     context.Context
+			cancel  context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			unblock = make(chan struct{})
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+				<-unblock
+				return nil, errors.New("handshake timeout")
+			}
+			ctx, cancel = context.WithCancel(context.Background())
+			req = req.WithContext(ctx)
+		})
+
+		AfterEach(func() {
+			close(unblock)
+			cancel()
+		})
+
+		roundTrip := func() <-chan error {
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := rt.RoundTrip(req)
+				errChan <- err
+			}()
+			return errChan
+		}
+
+		It("stops waiting for the QUIC handshake during the head start", func() {
+			rt.QuicHeadStart = time.Hour
+			errChan := roundTrip()
+			Consistently(errChan).ShouldNot(Receive())
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+			Expect(tcpDials).ToNot(Receive())
+		})
+
+		It("cancels the TCP dial", func() {
+			dialCanceled := make(chan struct{})
+			dialTLS = func(ctx context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+				tcpDials <- addr
+				<-ctx.Done()
+				close(dialCanceled)
+				return nil, ctx.Err()
+			}
+			errChan := roundTrip()
+			Eventually(tcpDials).Should(Receive())
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+			Eventually(dialCanceled).Should(BeClosed())
+		})
+
+		It("stops waiting for the QUIC handshake after the TCP dial failed", func() {
+			dialTLS = func(_ context.Context, addr string, _ *tls.Config) (net.Conn, error) {
+				tcpDials <- addr
+				return nil, errors.New("TCP blocked")
+			}
+			errChan := roundTrip()
+			Eventually(tcpDials).Should(Receive())
+			Consistently(errChan).ShouldNot(Receive())
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+		})
+	})
+
+	Context("remembering UDP failures", func() {
+		BeforeEach(func() {
+			quicDialErr = errors.New("UDP blocked")
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readBody(rsp)).To(Equal("TCP response"))
+			Expect(quicDials).To(Receive())
+			Expect(rt.QuicRoundTripper.clients).To(BeEmpty())
+		})
+
+		It("doesn't try QUIC again for a host where the handshake failed", func() {
+			rt.tcpTransport.CloseIdleConnections()
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readBody(rsp)).To(Equal("TCP response"))
+			Expect(quicDials).ToNot(Receive())
+		})
+
+		It("tries QUIC again after the UDP failure timeout", func() {
+			rt.hosts["www.example.org:443"].failedUntil = time.Now().Add(-time.Second)
+			quicDialErr = nil
+			go rt.RoundTrip(req)
+			Eventually(quicDials).Should(Receive())
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+		})
+	})
+
+	It("uses TCP for plain HTTP requests", func() {
+		req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		go rt.RoundTrip(req)
+		Consistently(quicDials).ShouldNot(Receive())
+	})
+})
@@ -12,7 +12,7 @@ import (
 )
 
 func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
-	var path, authority, method, contentLengthStr string
+	var path, authority, method, protocol, contentLengthStr string
 	httpHeaders := http.Header{}
 
 	for _, h := range headers {
@@ -23,6 +23,8 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 			method = h.Value
 		case ":authority":
 			authority = h.Value
+		case ":protocol":
+			protocol = h.Value
 		case "content-length":
 			contentLengthStr = h.Value
 		default:
@@ -40,6 +42,13 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 	if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
 		return nil, errors.New(":path, :authority and :method must not be empty")
 	}
+	if len(protocol) > 0 {
+		if method != "CONNECT" {
+			return nil, errors.New(":protocol is only allowed for CONNECT requests")
+		}
+		// the protocol of an extended CONNECT request is passed to the handler in the same way as by golang.org/x/net/http2
+		httpHeaders.Set(":protocol", protocol)
+	}
 
 	u, err := url.Parse(path)
 	if err != nil {
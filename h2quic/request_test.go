@@ -33,6 +33,31 @@ var _ = Describe("Request", func() {
 		Expect(req.TLS).ToNot(BeNil())
 	})
 
+	It("passes the protocol of extended CONNECT requests as a header", func() {
+		headers := []hpack.HeaderField{
+			{Name: ":path", Value: "/chat"},
+			{Name: ":authority", Value: "quic.clemente.io"},
+			{Name: ":method", Value: "CONNECT"},
+			{Name: ":protocol", Value: "websocket"},
+		}
+		req, err := requestFromHeaders(headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Method).To(Equal("CONNECT"))
+		Expect(req.URL.Path).To(Equal("/chat"))
+		Expect(req.Header.Get(":protocol")).To(Equal("websocket"))
+	})
+
+	It("errors if the protocol is set for a request that's not a CONNECT", func() {
+		headers := []hpack.HeaderField{
+			{Name: ":path", Value: "/chat"},
+			{Name: ":authority", Value: "quic.clemente.io"},
+			{Name: ":method", Value: "GET"},
+			{Name: ":protocol", Value: "websocket"},
+		}
+		_, err := requestFromHeaders(headers)
+		Expect(err).To(MatchError(":protocol is only allowed for CONNECT requests"))
+	})
+
 	It("concatenates the cookie headers", func() {
 		headers := []hpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
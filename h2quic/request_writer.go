@@ -43,7 +43,23 @@ func (w *requestWriter) WriteRequest(req *http.Request, dataStreamID protocol.St
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	w.encodeHeaders(req, requestGzip, "", actualContentLength(req))
+	w.encodeHeaders(req, requestGzip, "", "", actualContentLength(req))
+	return w.writeHeadersFrame(dataStreamID, endStream)
+}
+
+// WriteConnectRequest writes an extended CONNECT request (as in RFC 8441) for the given protocol.
+// The data stream stays open for sending data after the request.
+func (w *requestWriter) WriteConnectRequest(req *http.Request, dataStreamID protocol.StreamID, protocol string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.encodeHeaders(req, false, "", protocol, -1); err != nil {
+		return err
+	}
+	return w.writeHeadersFrame(dataStreamID, false)
+}
+
+func (w *requestWriter) writeHeadersFrame(dataStreamID protocol.StreamID, endStream bool) error {
 	h2framer := http2.NewFramer(w.headerStream, nil)
 	return h2framer.WriteHeaders(http2.HeadersFrameParam{
 		StreamID:      uint32(dataStreamID),
@@ -55,7 +71,7 @@ func (w *requestWriter) WriteRequest(req *http.Request, dataStreamID protocol.St
 }
 
 // the rest of this files is copied from http2.Transport
-func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) ([]byte, error) {
+func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers, protocol string, contentLength int64) ([]byte, error) {
 	w.hbuf.Reset()
 
 	host := req.Host
@@ -67,8 +83,11 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		return nil, err
 	}
 
+	// extended CONNECT requests carry a :path and a :scheme, just like regular requests
+	isConnect := req.Method == "CONNECT" && protocol == ""
+
 	var path string
-	if req.Method != "CONNECT" {
+	if !isConnect {
 		path = req.URL.RequestURI()
 		if !validPseudoPath(path) {
 			orig := path
@@ -104,10 +123,13 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// [RFC3986]).
 	w.writeHeader(":authority", host)
 	w.writeHeader(":method", req.Method)
-	if req.Method != "CONNECT" {
+	if !isConnect {
 		w.writeHeader(":path", path)
 		w.writeHeader(":scheme", req.URL.Scheme)
 	}
+	if protocol != "" {
+		w.writeHeader(":protocol", protocol)
+	}
 	if trailers != "" {
 		w.writeHeader("trailer", trailers)
 	}
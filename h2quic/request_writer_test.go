@@ -71,6 +71,31 @@ var _ = Describe("Request", func() {
 		Expect(headerFrame.StreamEnded()).To(BeFalse())
 	})
 
+	It("writes an extended CONNECT request", func() {
+		req, err := http.NewRequest("CONNECT", "https://quic.clemente.io/chat", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteConnectRequest(req, 1337, "websocket")).To(Succeed())
+		headerFrame, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFrame.StreamID).To(Equal(uint32(1337)))
+		Expect(headerFrame.StreamEnded()).To(BeFalse())
+		Expect(headerFields).To(HaveKeyWithValue(":method", "CONNECT"))
+		Expect(headerFields).To(HaveKeyWithValue(":protocol", "websocket"))
+		Expect(headerFields).To(HaveKeyWithValue(":path", "/chat"))
+		Expect(headerFields).To(HaveKeyWithValue(":scheme", "https"))
+		Expect(headerFields).ToNot(HaveKey("content-length"))
+		Expect(headerFields).ToNot(HaveKey("accept-encoding"))
+	})
+
+	It("doesn't write the :path and :scheme for CONNECT requests", func() {
+		req, err := http.NewRequest("CONNECT", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rw.WriteRequest(req, 1337, false, false)
+		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(headerFields).To(HaveKeyWithValue(":method", "CONNECT"))
+		Expect(headerFields).ToNot(HaveKey(":path"))
+		Expect(headerFields).ToNot(HaveKey(":scheme"))
+	})
+
 	It("requests gzip compression, if requested", func() {
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
 		Expect(err).ToNot(HaveOccurred())
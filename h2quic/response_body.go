@@ -0,0 +1,75 @@
+package h2quic
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The responseBody is the body of a response received by the client.
+// If the request is canceled before the body was read completely, the data stream is reset.
+type responseBody struct {
+	dataStream quic.Stream
+
+	doneOnce sync.Once
+	done     chan struct{} // closed as soon as the body is read until EOF (or an error occurs), or closed
+
+	mutex     sync.Mutex
+	cancelErr error // the error of the request's context, set before the stream is reset
+}
+
+// make sure the responseBody can be used as a http.Response.Body
+var _ io.ReadCloser = &responseBody{}
+
+func newResponseBody(ctx context.Context, stream quic.Stream) *responseBody {
+	b := &responseBody{
+		dataStream: stream,
+		done:       make(chan struct{}),
+	}
+	if ctx.Done() != nil { // the context can be canceled
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-b.done:
+				return
+			}
+			select {
+			case <-b.done: // the body was already read completely or closed
+			default:
+				b.mutex.Lock()
+				b.cancelErr = ctx.Err()
+				b.mutex.Unlock()
+				// resetting the stream unblocks a pending Read
+				stream.Reset(errorCodeCancel)
+			}
+		}()
+	}
+	return b
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.dataStream.Read(p)
+	if err != nil {
+		b.finish()
+		// Read fails with the reset of the stream, but the caller should see why it was reset
+		if err != io.EOF {
+			b.mutex.Lock()
+			if b.cancelErr != nil {
+				err = b.cancelErr
+			}
+			b.mutex.Unlock()
+		}
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.finish()
+	return b.dataStream.Close()
+}
+
+func (b *responseBody) finish() {
+	b.doneOnce.Do(func() { close(b.done) })
+}
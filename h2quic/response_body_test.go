@@ -0,0 +1,102 @@
+package h2quic
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a resettableStream is a mockStream whose Read fails once the stream is reset
+type resettableStream struct {
+	*mockStream
+	resetOnce sync.Once
+	resetChan chan struct{}
+}
+
+func (s *resettableStream) Reset(code quic.ErrorCode) {
+	s.resetOnce.Do(func() { close(s.resetChan) })
+}
+
+func (s *resettableStream) Read(p []byte) (int, error) {
+	if n, _ := s.dataToRead.Read(p); n > 0 {
+		return n, nil
+	}
+	<-s.resetChan
+	return 0, &quic.ApplicationError{Code: errorCodeCancel}
+}
+
+var _ = Describe("Response body", func() {
+	var (
+		stream *mockStream
+		ctx    context.Context
+		cancel context.CancelFunc
+		rb     *responseBody
+	)
+
+	BeforeEach(func() {
+		stream = newMockStream(5)
+		stream.dataToRead.Write([]byte("foobar"))
+		ctx, cancel = context.WithCancel(context.Background())
+		rb = newResponseBody(ctx, stream)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("reads from the stream", func() {
+		b := make([]byte, 10)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+	})
+
+	It("resets the stream when the request is canceled while the body is read", func() {
+		_, err := rb.Read(make([]byte, 3))
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		Eventually(func() bool { return stream.reset }).Should(BeTrue())
+		Expect(stream.resetCode).To(Equal(errorCodeCancel))
+	})
+
+	It("returns the context's error from Read after the stream was reset", func() {
+		str := &resettableStream{mockStream: stream, resetChan: make(chan struct{})}
+		rb = newResponseBody(ctx, str)
+		_, err := rb.Read(make([]byte, 6))
+		Expect(err).ToNot(HaveOccurred())
+		errChan := make(chan error)
+		go func() {
+			_, err := rb.Read(make([]byte, 6))
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		cancel()
+		Eventually(errChan).Should(Receive(Equal(context.Canceled)))
+		_, err = rb.Read(make([]byte, 6))
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("doesn't reset the stream after the body was read until EOF", func() {
+		close(stream.unblockRead)
+		b := make([]byte, 10)
+		_, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rb.Read(b)
+		Expect(err).To(MatchError(io.EOF))
+		cancel()
+		Consistently(func() bool { return stream.reset }, 50*time.Millisecond).Should(BeFalse())
+	})
+
+	It("doesn't reset the stream after the body was closed", func() {
+		Expect(rb.Close()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+		cancel()
+		Consistently(func() bool { return stream.reset }, 50*time.Millisecond).Should(BeFalse())
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -14,9 +15,22 @@ import (
 	"golang.org/x/net/http2/hpack"
 )
 
+// A DataStreamer gives a handler direct access to the QUIC stream of a request.
+// The http.ResponseWriter passed to handlers by the Server implements this interface.
+type DataStreamer interface {
+	// DataStream writes the response headers (using status 200, if WriteHeader wasn't called yet)
+	// and returns the data stream of the request, which can then be used to send and receive data in both directions.
+	// After calling DataStream, the server neither closes nor resets the stream when the handler returns.
+	// The handler is responsible for closing the stream.
+	// Until the stream is closed or reset, it counts against the MaxConcurrentRequests of the Server.
+	// The deadlines set due to the ReadTimeout and WriteTimeout of the http.Server are cleared.
+	DataStream() quic.Stream
+}
+
 type responseWriter struct {
-	dataStreamID protocol.StreamID
-	dataStream   quic.Stream
+	dataStreamID    protocol.StreamID
+	dataStream      quic.Stream
+	dataStreamTaken bool // set when the handler took over the dataStream by calling DataStream()
 
 	headerStream      quic.Stream
 	headerStreamMutex *sync.Mutex
@@ -83,6 +97,16 @@ func (w *responseWriter) Write(p []byte) (int, error) {
 
 func (w *responseWriter) Flush() {}
 
+func (w *responseWriter) DataStream() quic.Stream {
+	if !w.headerWritten {
+		w.WriteHeader(200)
+	}
+	w.dataStreamTaken = true
+	w.dataStream.SetReadDeadline(time.Time{})
+	w.dataStream.SetWriteDeadline(time.Time{})
+	return w.dataStream
+}
+
 // This is a NOP. Use http.Request.Context
 func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
 
@@ -92,6 +116,9 @@ var _ http.Flusher = &responseWriter{}
 // test that we implement http.CloseNotifier
 var _ http.CloseNotifier = &responseWriter{}
 
+// test that we implement DataStreamer
+var _ DataStreamer = &responseWriter{}
+
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
 // permits a body. See RFC 2616, section 4.4.
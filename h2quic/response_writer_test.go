@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
 
+	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,9 +22,13 @@ type mockStream struct {
 	dataToRead   bytes.Buffer
 	dataWritten  bytes.Buffer
 	reset        bool
+	resetCode    quic.ErrorCode
 	closed       bool
 	remoteClosed bool
 
+	readDeadline  time.Time
+	writeDeadline time.Time
+
 	unblockRead chan struct{}
 	ctx         context.Context
 	ctxCancel   context.CancelFunc
@@ -39,13 +44,13 @@ func newMockStream(id protocol.StreamID) *mockStream {
 }
 
 func (s *mockStream) Close() error                          { s.closed = true; s.ctxCancel(); return nil }
-func (s *mockStream) Reset(error)                           { s.reset = true }
+func (s *mockStream) Reset(code quic.ErrorCode)             { s.reset = true; s.resetCode = code }
 func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true; s.ctxCancel() }
 func (s mockStream) StreamID() protocol.StreamID            { return s.id }
 func (s *mockStream) Context() context.Context              { return s.ctx }
 func (s *mockStream) SetDeadline(time.Time) error           { panic("not implemented") }
-func (s *mockStream) SetReadDeadline(time.Time) error       { panic("not implemented") }
-func (s *mockStream) SetWriteDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(t time.Time) error     { s.readDeadline = t; return nil }
+func (s *mockStream) SetWriteDeadline(t time.Time) error    { s.writeDeadline = t; return nil }
 
 func (s *mockStream) Read(p []byte) (int, error) {
 	n, _ := s.dataToRead.Read(p)
@@ -147,6 +152,31 @@ var _ = Describe("Response Writer", func() {
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
 	})
 
+	It("returns the data stream", func() {
+		str := w.DataStream()
+		Expect(str).To(Equal(dataStream))
+		Expect(w.dataStreamTaken).To(BeTrue())
+		// should have written 200 on the header stream
+		fields := decodeHeaderFields()
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+	})
+
+	It("clears the deadlines of the data stream", func() {
+		dataStream.readDeadline = time.Now().Add(time.Minute)
+		dataStream.writeDeadline = time.Now().Add(time.Minute)
+		w.DataStream()
+		Expect(dataStream.readDeadline.IsZero()).To(BeTrue())
+		Expect(dataStream.writeDeadline.IsZero()).To(BeTrue())
+	})
+
+	It("returns the data stream after WriteHeader is called", func() {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		Expect(w.DataStream()).To(Equal(dataStream))
+		fields := decodeHeaderFields()
+		Expect(fields).To(HaveLen(1))
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"101"}))
+	})
+
 	It("doesn't allow writes if the status code doesn't allow a body", func() {
 		w.WriteHeader(304)
 		n, err := w.Write([]byte("foobar"))
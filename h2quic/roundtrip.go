@@ -60,46 +60,100 @@ var ErrNoCachedConn = errors.New("h2quic: no cached connection was available")
 
 // RoundTripOpt is like RoundTrip, but takes options.
 func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	cl, err := r.getClient(hostname, hostname, opt.OnlyCachedConn)
+	if err != nil {
+		return nil, err
+	}
+	return cl.RoundTrip(req)
+}
+
+// ConnectStream sends an extended CONNECT request (as in RFC 8441), which asks the server to use the request stream for protocol.
+// The request method must be CONNECT, and the request must not have a body.
+// It returns the response along with the QUIC stream of the request.
+// If the server accepts the request with a 2xx status code, the stream can be used to exchange data in both directions.
+// The body of the response reads from the same stream.
+// The caller is responsible for closing the stream.
+func (r *RoundTripper) ConnectStream(req *http.Request, protocol string) (*http.Response, quic.Stream, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, nil, err
+	}
+	if req.Method != "CONNECT" {
+		closeRequestBody(req)
+		return nil, nil, fmt.Errorf("quic: invalid method %q for ConnectStream", req.Method)
+	}
+	if req.Body != nil {
+		closeRequestBody(req)
+		return nil, nil, errors.New("quic: CONNECT requests must not have a body")
+	}
+	if protocol == "" {
+		return nil, nil, errors.New("quic: no protocol for CONNECT request")
+	}
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	cl, err := r.getClient(hostname, hostname, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, ok := cl.(interface {
+		connectStream(*http.Request, string) (*http.Response, quic.Stream, error)
+	})
+	if !ok {
+		return nil, nil, errors.New("quic: client doesn't support CONNECT requests")
+	}
+	return c.connectStream(req, protocol)
+}
+
+// roundTripAlt does a round trip, but dials the alternative authority addr instead of the host of the request.
+func (r *RoundTripper) roundTripAlt(req *http.Request, addr string) (*http.Response, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	cl, err := r.getClient(hostname, addr, false)
+	if err != nil {
+		return nil, err
+	}
+	return cl.RoundTrip(req)
+}
+
+func validateRequest(req *http.Request) error {
 	if req.URL == nil {
 		closeRequestBody(req)
-		return nil, errors.New("quic: nil Request.URL")
+		return errors.New("quic: nil Request.URL")
 	}
 	if req.URL.Host == "" {
 		closeRequestBody(req)
-		return nil, errors.New("quic: no Host in request URL")
+		return errors.New("quic: no Host in request URL")
 	}
 	if req.Header == nil {
 		closeRequestBody(req)
-		return nil, errors.New("quic: nil Request.Header")
+		return errors.New("quic: nil Request.Header")
 	}
 
 	if req.URL.Scheme == "https" {
 		for k, vv := range req.Header {
 			if !httplex.ValidHeaderFieldName(k) {
-				return nil, fmt.Errorf("quic: invalid http header field name %q", k)
+				return fmt.Errorf("quic: invalid http header field name %q", k)
 			}
 			for _, v := range vv {
 				if !httplex.ValidHeaderFieldValue(v) {
-					return nil, fmt.Errorf("quic: invalid http header field value %q for key %v", v, k)
+					return fmt.Errorf("quic: invalid http header field value %q for key %v", v, k)
 				}
 			}
 		}
 	} else {
 		closeRequestBody(req)
-		return nil, fmt.Errorf("quic: unsupported protocol scheme: %s", req.URL.Scheme)
+		return fmt.Errorf("quic: unsupported protocol scheme: %s", req.URL.Scheme)
 	}
 
 	if req.Method != "" && !validMethod(req.Method) {
 		closeRequestBody(req)
-		return nil, fmt.Errorf("quic: invalid method %q", req.Method)
-	}
-
-	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
-	if err != nil {
-		return nil, err
+		return fmt.Errorf("quic: invalid method %q", req.Method)
 	}
-	return cl.RoundTrip(req)
+	return nil
 }
 
 // RoundTrip does a round trip.
@@ -107,7 +161,9 @@ func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+// getClient returns the client for requests to hostname.
+// The client dials addr, which is only different from hostname if an alternative service is used.
+func (r *RoundTripper) getClient(hostname, addr string, onlyCached bool) (http.RoundTripper, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -115,17 +171,61 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 		r.clients = make(map[string]roundTripCloser)
 	}
 
-	client, ok := r.clients[hostname]
+	key := clientKey(hostname, addr)
+	client, ok := r.clients[key]
 	if !ok {
 		if onlyCached {
 			return nil, ErrNoCachedConn
 		}
-		client = newClient(hostname, r.TLSClientConfig, &roundTripperOpts{DisableCompression: r.DisableCompression}, r.QuicConfig)
-		r.clients[hostname] = client
+		c := newClient(hostname, r.TLSClientConfig, &roundTripperOpts{DisableCompression: r.DisableCompression}, r.QuicConfig)
+		c.connectAddr = addr
+		client = c
+		r.clients[key] = client
 	}
 	return client, nil
 }
 
+// connect establishes a QUIC connection to hostname, without sending a request.
+// It blocks until the handshake completes.
+// The returned channel is closed when the QUIC connection is closed.
+func (r *RoundTripper) connect(hostname string) (<-chan struct{}, error) {
+	cl, err := r.getClient(hostname, hostname, false)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := cl.(interface {
+		connect() error
+		closed() <-chan struct{}
+	})
+	if !ok {
+		return nil, nil
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c.closed(), nil
+}
+
+// removeClient closes and removes the client for requests to hostname that dials addr.
+// A new client is created for the next request.
+func (r *RoundTripper) removeClient(hostname, addr string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := clientKey(hostname, addr)
+	if client, ok := r.clients[key]; ok {
+		client.Close()
+		delete(r.clients, key)
+	}
+}
+
+func clientKey(hostname, addr string) string {
+	if hostname == addr {
+		return hostname
+	}
+	return hostname + " via " + addr
+}
+
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
@@ -186,6 +186,39 @@ var _ = Describe("RoundTripper", func() {
 		})
 	})
 
+	Context("sending CONNECT requests", func() {
+		var req *http.Request
+
+		BeforeEach(func() {
+			var err error
+			req, err = http.NewRequest("CONNECT", "https://www.example.org/chat", nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("rejects requests that are not CONNECT requests", func() {
+			_, _, err := rt.ConnectStream(req1, "websocket")
+			Expect(err).To(MatchError("quic: invalid method \"GET\" for ConnectStream"))
+		})
+
+		It("rejects requests with a body", func() {
+			req.Body = &mockBody{}
+			_, _, err := rt.ConnectStream(req, "websocket")
+			Expect(err).To(MatchError("quic: CONNECT requests must not have a body"))
+			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests without a protocol", func() {
+			_, _, err := rt.ConnectStream(req, "")
+			Expect(err).To(MatchError("quic: no protocol for CONNECT request"))
+		})
+
+		It("validates the request", func() {
+			req.Header = nil
+			_, _, err := rt.ConnectStream(req, "websocket")
+			Expect(err).To(MatchError("quic: nil Request.Header"))
+		})
+	})
+
 	Context("closing", func() {
 		It("closes", func() {
 			rt.clients = make(map[string]roundTripCloser)
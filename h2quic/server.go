@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -35,7 +36,17 @@ var (
 	quicListenAddr = quic.ListenAddr
 )
 
+// error codes used when resetting a data stream, as defined by HTTP/2 (RFC 7540, section 7)
+const (
+	errorCodeNoError       quic.ErrorCode = 0x0
+	errorCodeInternalError quic.ErrorCode = 0x2
+	errorCodeRefusedStream quic.ErrorCode = 0x7
+	errorCodeCancel        quic.ErrorCode = 0x8
+)
+
 // Server is a HTTP2 server listening for QUIC connections.
+// The ReadTimeout, WriteTimeout and MaxHeaderBytes of the http.Server apply to every request.
+// The IdleTimeout is used as the idle timeout of the QUIC connection, unless the quic.Config sets one.
 type Server struct {
 	*http.Server
 
@@ -43,6 +54,12 @@ type Server struct {
 	// If nil, it uses reasonable default values.
 	QuicConfig *quic.Config
 
+	// MaxConcurrentRequests is the maximum number of requests that are handled concurrently on a single QUIC connection.
+	// Additional requests are refused by resetting their data stream.
+	// Data streams taken over by a handler (see DataStreamer) count as requests until they are closed or reset.
+	// If zero, the number of requests is only limited by the number of streams the client is allowed to open.
+	MaxConcurrentRequests int
+
 	// Private flag for demo, do not use
 	CloseAfterFirstRequest bool
 
@@ -95,10 +112,11 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 
 	var ln quic.Listener
 	var err error
+	quicConfig := s.quicConfig()
 	if conn == nil {
-		ln, err = quicListenAddr(s.Addr, tlsConfig, s.QuicConfig)
+		ln, err = quicListenAddr(s.Addr, tlsConfig, quicConfig)
 	} else {
-		ln, err = quicListen(conn, tlsConfig, s.QuicConfig)
+		ln, err = quicListen(conn, tlsConfig, quicConfig)
 	}
 	if err != nil {
 		s.listenerMutex.Unlock()
@@ -108,7 +126,7 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 	s.listenerMutex.Unlock()
 
 	for {
-		sess, err := ln.Accept()
+		sess, err := ln.Accept(context.Background())
 		if err != nil {
 			return err
 		}
@@ -116,6 +134,34 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 	}
 }
 
+// quicConfig returns the quic.Config used for the listener.
+// If the http.Server sets an IdleTimeout, it is used as the idle timeout of the QUIC connection.
+func (s *Server) quicConfig() *quic.Config {
+	if s.IdleTimeout == 0 || (s.QuicConfig != nil && s.QuicConfig.IdleTimeout != 0) {
+		return s.QuicConfig
+	}
+	config := &quic.Config{}
+	if s.QuicConfig != nil {
+		*config = *s.QuicConfig
+	}
+	config.IdleTimeout = s.IdleTimeout
+	return config
+}
+
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return s.MaxHeaderBytes
+}
+
+// maxHeaderFrameSize is the maximum size of a HEADERS frame.
+// Header blocks that exceed the maximum header size by less than this are decoded and refused with a 431.
+// Larger frames can't be skipped without breaking the HPACK state, so they close the connection.
+func (s *Server) maxHeaderFrameSize() uint32 {
+	return uint32(2 * s.maxHeaderBytes())
+}
+
 func (s *Server) handleHeaderStream(session streamCreator) {
 	stream, err := session.AcceptStream()
 	if err != nil {
@@ -129,11 +175,18 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 
 	hpackDecoder := hpack.NewDecoder(4096, nil)
 	h2framer := http2.NewFramer(nil, stream)
+	h2framer.SetMaxReadFrameSize(s.maxHeaderFrameSize())
+
+	// limits the number of requests that are handled concurrently on this session
+	var requestSlots chan struct{}
+	if s.MaxConcurrentRequests > 0 {
+		requestSlots = make(chan struct{}, s.MaxConcurrentRequests)
+	}
 
 	go func() {
 		var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
 		for {
-			if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
+			if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer, requestSlots); err != nil {
 				// QuicErrors must originate from stream.Read() returning an error.
 				// In this case, the session has already logged the error, so we don't
 				// need to log it again.
@@ -147,7 +200,7 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 	}()
 }
 
-func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
+func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer, requestSlots chan struct{}) error {
 	h2frame, err := h2framer.ReadFrame()
 	if err != nil {
 		return qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
@@ -159,11 +212,15 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	if !h2headersFrame.HeadersEnded() {
 		return errors.New("http2 header continuation not implemented")
 	}
-	headers, err := hpackDecoder.DecodeFull(h2headersFrame.HeaderBlockFragment())
+	headers, tooLarge, err := s.decodeHeaders(hpackDecoder, h2headersFrame.HeaderBlockFragment())
 	if err != nil {
 		utils.Errorf("invalid http2 headers encoding: %s", err.Error())
 		return err
 	}
+	if tooLarge {
+		utils.Infof("Refusing request on data stream %d: header fields exceed %d bytes", h2headersFrame.StreamID, s.maxHeaderBytes())
+		return s.refuseRequest(session, headerStream, headerStreamMutex, h2headersFrame, http.StatusRequestHeaderFieldsTooLarge)
+	}
 
 	req, err := requestFromHeaders(headers)
 	if err != nil {
@@ -187,6 +244,23 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 		return nil
 	}
 
+	if requestSlots != nil {
+		select {
+		case requestSlots <- struct{}{}:
+		default:
+			utils.Infof("Refusing request on data stream %d: too many concurrent requests", h2headersFrame.StreamID)
+			dataStream.Reset(errorCodeRefusedStream)
+			return nil
+		}
+	}
+
+	if s.ReadTimeout > 0 {
+		dataStream.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+	if s.WriteTimeout > 0 {
+		dataStream.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+
 	var streamEnded bool
 	if h2headersFrame.StreamEnded() {
 		dataStream.(remoteCloser).CloseRemote(0)
@@ -201,6 +275,15 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID))
 
 	go func() {
+		if requestSlots != nil {
+			defer func() {
+				// the stream's context is canceled when the stream is closed or reset
+				if responseWriter.dataStreamTaken {
+					<-responseWriter.dataStream.Context().Done()
+				}
+				<-requestSlots
+			}()
+		}
 		handler := s.Handler
 		if handler == nil {
 			handler = http.DefaultServeMux
@@ -224,9 +307,9 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 		} else {
 			responseWriter.WriteHeader(200)
 		}
-		if responseWriter.dataStream != nil {
+		if responseWriter.dataStream != nil && !responseWriter.dataStreamTaken {
 			if !streamEnded && !reqBody.requestRead {
-				responseWriter.dataStream.Reset(nil)
+				responseWriter.dataStream.Reset(errorCodeNoError)
 			}
 			responseWriter.dataStream.Close()
 		}
@@ -239,6 +322,52 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	return nil
 }
 
+// decodeHeaders decodes a header block.
+// If the header fields exceed the maximum header size, the whole block is still decoded to keep the HPACK state in sync, but the fields are discarded.
+func (s *Server) decodeHeaders(hpackDecoder *hpack.Decoder, block []byte) ([]hpack.HeaderField, bool, error) {
+	maxHeaderBytes := s.maxHeaderBytes()
+	var headers []hpack.HeaderField
+	var size int
+	var tooLarge bool
+	hpackDecoder.SetEmitFunc(func(hf hpack.HeaderField) {
+		size += int(hf.Size())
+		if size > maxHeaderBytes {
+			tooLarge = true
+			headers = nil
+			return
+		}
+		if !tooLarge {
+			headers = append(headers, hf)
+		}
+	})
+	if _, err := hpackDecoder.Write(block); err != nil {
+		return nil, false, err
+	}
+	if err := hpackDecoder.Close(); err != nil {
+		return nil, false, err
+	}
+	return headers, tooLarge, nil
+}
+
+// refuseRequest responds to a request with the given status code, without calling the handler
+func (s *Server) refuseRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, h2headersFrame *http2.HeadersFrame, status int) error {
+	dataStream, err := session.GetOrOpenStream(protocol.StreamID(h2headersFrame.StreamID))
+	if err != nil {
+		return err
+	}
+	if dataStream == nil {
+		return nil
+	}
+	responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID))
+	responseWriter.WriteHeader(status)
+	if h2headersFrame.StreamEnded() {
+		dataStream.(remoteCloser).CloseRemote(0)
+	} else {
+		dataStream.Reset(errorCodeNoError)
+	}
+	return dataStream.Close()
+}
+
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
 // Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) Close() error {
@@ -62,6 +62,9 @@ func (s *mockSession) Close(e error) error {
 	s.ctxCancel()
 	return nil
 }
+func (s *mockSession) CloseWithError(quic.ErrorCode, string) error {
+	panic("not implemented")
+}
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
@@ -71,6 +74,15 @@ func (s *mockSession) RemoteAddr() net.Addr {
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
+func (s *mockSession) Stats() quic.SessionStats {
+	panic("not implemented")
+}
+func (s *mockSession) SendMessage([]byte) error {
+	panic("not implemented")
+}
+func (s *mockSession) ReceiveMessage() ([]byte, error) {
+	panic("not implemented")
+}
 
 var _ = Describe("H2 server", func() {
 	var (
@@ -123,7 +135,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
@@ -137,7 +149,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -153,7 +165,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -171,7 +183,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
@@ -186,7 +198,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -204,7 +216,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
 		})
@@ -219,7 +231,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -239,18 +251,129 @@ var _ = Describe("H2 server", func() {
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			dataStream.dataToRead.Write([]byte("foo=bar"))
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
 
+		It("sets the read and write deadlines on the data stream", func() {
+			s.ReadTimeout = time.Minute
+			s.WriteTimeout = time.Hour
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dataStream.readDeadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+			Expect(dataStream.writeDeadline).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+		})
+
+		Context("limiting concurrent requests", func() {
+			var requestSlots chan struct{}
+
+			BeforeEach(func() {
+				requestSlots = make(chan struct{}, 1)
+				headerStream.dataToRead.Write([]byte{
+					0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+					// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+					0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				})
+			})
+
+			It("frees the slot when the handler returns", func() {
+				handlerReturn := make(chan struct{})
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					<-handlerReturn
+				})
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, requestSlots)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requestSlots).To(HaveLen(1))
+				close(handlerReturn)
+				Eventually(func() int { return len(requestSlots) }).Should(BeZero())
+				Expect(dataStream.reset).To(BeFalse())
+			})
+
+			It("holds the slot until a data stream taken over by the handler is closed", func() {
+				headerStream.dataToRead.Reset()
+				headerStream.dataToRead.Write([]byte{
+					0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+					// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+					0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				})
+				strChan := make(chan quic.Stream, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					strChan <- w.(DataStreamer).DataStream()
+				})
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, requestSlots)
+				Expect(err).NotTo(HaveOccurred())
+				var str quic.Stream
+				Eventually(strChan).Should(Receive(&str))
+				Consistently(func() int { return len(requestSlots) }).Should(Equal(1))
+				Expect(str.Close()).To(Succeed())
+				Eventually(func() int { return len(requestSlots) }).Should(BeZero())
+			})
+
+			It("resets the data stream if too many requests are active", func() {
+				var handlerCalled bool
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handlerCalled = true
+				})
+				requestSlots <- struct{}{}
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, requestSlots)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dataStream.reset).To(BeTrue())
+				Expect(dataStream.resetCode).To(Equal(errorCodeRefusedStream))
+				Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+			})
+		})
+
+		It("responds with 431 if the header fields are too large", func() {
+			s.MaxHeaderBytes = 100
+			var handlerCalled bool
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handlerCalled).To(BeFalse())
+			Expect(dataStream.closed).To(BeTrue())
+			frame, err := http2.NewFramer(nil, &headerStream.dataWritten).ReadFrame()
+			Expect(err).NotTo(HaveOccurred())
+			fields, err := hpack.NewDecoder(4096, nil).DecodeFull(frame.(*http2.HeadersFrame).HeaderBlockFragment())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fields).To(ContainElement(hpack.HeaderField{Name: ":status", Value: "431"}))
+		})
+
+		It("doesn't close the data stream if the handler took it over", func() {
+			var handlerReturned bool
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				str := w.(DataStreamer).DataStream()
+				Expect(str).To(Equal(dataStream))
+				handlerReturned = true
+			})
+			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() bool { return handlerReturned }).Should(BeTrue())
+			Consistently(func() bool { return dataStream.closed }).Should(BeFalse())
+			Expect(dataStream.reset).To(BeFalse())
+		})
+
 		It("errors when non-header frames are received", func() {
 			headerStream.dataToRead.Write([]byte{
 				0x0, 0x0, 0x06, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
 				'f', 'o', 'o', 'b', 'a', 'r',
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
 		})
 
@@ -269,7 +392,7 @@ var _ = Describe("H2 server", func() {
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
 			dataStream.Close()
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
@@ -295,6 +418,54 @@ var _ = Describe("H2 server", func() {
 		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 	})
 
+	It("responds with 431 if a single header field is too large, without closing the connection", func() {
+		s.MaxHeaderBytes = 1000
+		var handlerCalled bool
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+		})
+		var headerBlock bytes.Buffer
+		enc := hpack.NewEncoder(&headerBlock)
+		Expect(enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})).To(Succeed())
+		Expect(enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})).To(Succeed())
+		Expect(enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})).To(Succeed())
+		Expect(enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com"})).To(Succeed())
+		Expect(enc.WriteField(hpack.HeaderField{Name: "cookie", Value: strings.Repeat("a", 1500)})).To(Succeed())
+		headerStream := &mockStream{id: 3}
+		err := http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      5,
+			BlockFragment: headerBlock.Bytes(),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+		Consistently(func() bool { return session.closed }).Should(BeFalse())
+		Expect(handlerCalled).To(BeFalse())
+		frame, err := http2.NewFramer(nil, &headerStream.dataWritten).ReadFrame()
+		Expect(err).NotTo(HaveOccurred())
+		fields, err := hpack.NewDecoder(4096, nil).DecodeFull(frame.(*http2.HeadersFrame).HeaderBlockFragment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(ContainElement(hpack.HeaderField{Name: ":status", Value: "431"}))
+	})
+
+	It("closes the connection if a header frame exceeds the maximum frame size", func() {
+		s.MaxHeaderBytes = 1000
+		headerStream := &mockStream{id: 3}
+		err := http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      5,
+			BlockFragment: make([]byte, 2001),
+			EndHeaders:    true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		Eventually(func() bool { return session.closed }).Should(BeTrue())
+		Expect(session.closedWithError).To(MatchError(qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")))
+	})
+
 	It("closes the connection if it encounters an error on the header stream", func() {
 		var handlerCalled bool
 		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -463,6 +634,28 @@ var _ = Describe("H2 server", func() {
 		})
 	})
 
+	Context("the quic.Config", func() {
+		It("uses the IdleTimeout of the http.Server", func() {
+			s.IdleTimeout = time.Minute
+			s.QuicConfig = &quic.Config{HandshakeTimeout: time.Second}
+			conf := s.quicConfig()
+			Expect(conf.IdleTimeout).To(Equal(time.Minute))
+			Expect(conf.HandshakeTimeout).To(Equal(time.Second))
+			Expect(s.QuicConfig.IdleTimeout).To(BeZero())
+		})
+
+		It("uses the IdleTimeout of the http.Server if no quic.Config is set", func() {
+			s.IdleTimeout = time.Minute
+			Expect(s.quicConfig().IdleTimeout).To(Equal(time.Minute))
+		})
+
+		It("prefers the IdleTimeout of the quic.Config", func() {
+			s.IdleTimeout = time.Minute
+			s.QuicConfig = &quic.Config{IdleTimeout: time.Hour}
+			Expect(s.quicConfig()).To(Equal(s.QuicConfig))
+		})
+	})
+
 	Context("ListenAndServeTLS", func() {
 		BeforeEach(func() {
 			s.Server.Addr = "localhost:0"
@@ -0,0 +1,85 @@
+package gquic_test
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	_ "github.com/lucas-clemente/quic-clients" // download clients
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Emulated network conditions", func() {
+	var proxy *quicproxy.QuicProxy
+
+	downloadFile := func(version protocol.VersionNumber, link *quicproxy.LinkConfig) {
+		var err error
+		proxy, err = quicproxy.NewQuicProxy("localhost:0", version, &quicproxy.Opts{
+			RemoteAddr:   "localhost:" + testserver.Port(),
+			IncomingLink: link,
+			OutgoingLink: link,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		command := exec.Command(
+			clientPath,
+			"--quic-version="+strconv.Itoa(int(version)),
+			"--host=127.0.0.1",
+			"--port="+strconv.Itoa(proxy.LocalPort()),
+			"https://quic.clemente.io/prdata",
+		)
+		session, err := Start(command, nil, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer session.Kill()
+		Eventually(session, 20).Should(Exit(0))
+		Expect(bytes.Contains(session.Out.Contents(), testserver.PRData)).To(BeTrue())
+	}
+
+	AfterEach(func() {
+		Expect(proxy.Close()).To(Succeed())
+	})
+
+	for _, v := range protocol.SupportedVersions {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC version %s", version), func() {
+			It("downloads a file over a link with a limited bandwidth and a short queue", func() {
+				downloadFile(version, &quicproxy.LinkConfig{
+					Bandwidth: 500 * 1000, // 500 kB/s
+					QueueLen:  10,
+					Delay:     10 * time.Millisecond,
+				})
+			})
+
+			It("downloads a file over a link with burst loss", func() {
+				downloadFile(version, &quicproxy.LinkConfig{
+					Delay: 10 * time.Millisecond,
+					Loss: &quicproxy.GilbertElliott{
+						P:        0.02,
+						R:        0.5,
+						LossGood: 0.01,
+						LossBad:  0.8,
+					},
+				})
+			})
+
+			It("downloads a file over a link with jitter, reordering, duplication and corruption", func() {
+				downloadFile(version, &quicproxy.LinkConfig{
+					Delay:                10 * time.Millisecond,
+					Jitter:               5 * time.Millisecond,
+					ReorderProbability:   0.05,
+					DuplicateProbability: 0.05,
+					CorruptProbability:   0.005,
+				})
+			})
+		})
+	}
+})
@@ -0,0 +1,117 @@
+package self_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Emulated network conditions", func() {
+	var (
+		proxy  *quicproxy.QuicProxy
+		server quic.Listener
+	)
+
+	AfterEach(func() {
+		Expect(proxy.Close()).To(Succeed())
+		Expect(server.Close()).To(Succeed())
+	})
+
+	// runTransfer sends data from the server to the client, with the given network conditions in both directions
+	runTransfer := func(version protocol.VersionNumber, link *quicproxy.LinkConfig) {
+		var err error
+		server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), &quic.Config{
+			Versions: []protocol.VersionNumber{version},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			sess, err := server.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+
+		incoming := *link
+		outgoing := *link
+		outgoing.Seed++
+		proxy, err = quicproxy.NewQuicProxy("localhost:0", version, &quicproxy.Opts{
+			RemoteAddr:   server.Addr().String(),
+			IncomingLink: &incoming,
+			OutgoingLink: &outgoing,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		sess, err := quic.DialAddr(
+			proxy.LocalAddr().String(),
+			&tls.Config{InsecureSkipVerify: true},
+			&quic.Config{Versions: []protocol.VersionNumber{version}},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close(nil)
+		str, err := sess.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(gbytes.TimeoutReader(str, 20*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(testserver.PRData))
+	}
+
+	for _, v := range protocol.SupportedVersions {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC version %s", version), func() {
+			It("transfers data over a link with a limited bandwidth and a short queue", func() {
+				runTransfer(version, &quicproxy.LinkConfig{
+					Bandwidth: 500 * 1000, // 500 kB/s
+					QueueLen:  10,
+					Delay:     10 * time.Millisecond,
+				})
+				Expect(proxy.LinkStats(quicproxy.DirectionOutgoing).QueueDrops).ToNot(BeZero())
+			})
+
+			It("transfers data over a link with burst loss", func() {
+				runTransfer(version, &quicproxy.LinkConfig{
+					Delay: 10 * time.Millisecond,
+					Loss: &quicproxy.GilbertElliott{
+						P:        0.02,
+						R:        0.5,
+						LossGood: 0.01,
+						LossBad:  0.8,
+					},
+				})
+			})
+
+			It("transfers data over a link with jitter, reordering and duplication", func() {
+				runTransfer(version, &quicproxy.LinkConfig{
+					Delay:                10 * time.Millisecond,
+					Jitter:               5 * time.Millisecond,
+					ReorderProbability:   0.05,
+					DuplicateProbability: 0.05,
+				})
+			})
+
+			It("transfers data over a link that corrupts packets", func() {
+				runTransfer(version, &quicproxy.LinkConfig{
+					Delay:              10 * time.Millisecond,
+					CorruptProbability: 0.005,
+				})
+			})
+		})
+	}
+})
@@ -0,0 +1,322 @@
+package quicproxy
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// GilbertElliott configures the Gilbert-Elliott burst loss model.
+// The link is either in the good or in the bad state, and changes its state before every packet.
+// Packets are lost with a state-dependent probability.
+type GilbertElliott struct {
+	// P is the probability to move from the good to the bad state.
+	P float64
+	// R is the probability to move from the bad to the good state.
+	R float64
+	// LossGood is the loss probability in the good state (1-k in the literature).
+	LossGood float64
+	// LossBad is the loss probability in the bad state (1-h in the literature).
+	LossBad float64
+}
+
+// LinkConfig configures the network conditions emulated by a Link.
+// The zero value is a link without any delay, loss or bandwidth limit.
+type LinkConfig struct {
+	// Bandwidth is the bandwidth of the link, in bytes per second.
+	// If 0, the bandwidth is not limited.
+	Bandwidth uint64
+	// BurstSize is the size of the token bucket, in bytes.
+	// If it is smaller than MaxPacketBufferSize, MaxPacketBufferSize is used.
+	BurstSize protocol.ByteCount
+	// QueueLen is the number of packets that can wait for the bandwidth to become available.
+	// When the queue is full, packets are dropped (drop-tail). If 0, the queue is not limited.
+	QueueLen int
+	// Delay is the one-way propagation delay.
+	Delay time.Duration
+	// Jitter is the maximum random delay added to every packet.
+	// Jitter doesn't reorder packets: a packet is never delivered before a packet sent earlier.
+	Jitter time.Duration
+	// ReorderProbability is the probability that a packet is delivered without the propagation delay,
+	// so that it overtakes the packets sent before it.
+	ReorderProbability float64
+	// DuplicateProbability is the probability that a packet is delivered twice.
+	DuplicateProbability float64
+	// CorruptProbability is the probability that a single random bit of a packet is flipped.
+	CorruptProbability float64
+	// Loss configures burst loss. If nil, no packets are lost.
+	Loss *GilbertElliott
+	// Seed seeds the random number generator. If 0, a random seed is used.
+	Seed int64
+}
+
+// LinkStats are statistics about the packets sent on a Link.
+type LinkStats struct {
+	// Packets is the number of packets passed to the link.
+	Packets uint64
+	// Lost is the number of packets lost due to the loss model.
+	Lost uint64
+	// QueueDrops is the number of packets dropped because the queue was full.
+	QueueDrops uint64
+	// Duplicated is the number of packets that were duplicated.
+	Duplicated uint64
+	// Corrupted is the number of packets that were corrupted.
+	Corrupted uint64
+	// Reordered is the number of packets that were reordered.
+	Reordered uint64
+}
+
+type scheduledPacket struct {
+	at   time.Time
+	seq  uint64
+	data []byte
+}
+
+type packetQueue []*scheduledPacket
+
+var _ heap.Interface = &packetQueue{}
+
+func (q packetQueue) Len() int { return len(q) }
+func (q packetQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q packetQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *packetQueue) Push(x interface{}) { *q = append(*q, x.(*scheduledPacket)) }
+func (q *packetQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	p := old[n-1]
+	*q = old[:n-1]
+	return p
+}
+
+// A Link emulates a network link in one direction.
+type Link struct {
+	mutex sync.Mutex
+
+	conf LinkConfig
+	send func([]byte)
+	rand *rand.Rand
+
+	badState bool
+
+	// token bucket
+	tokens        float64
+	lastDeparture time.Time
+	// departure times of the packets waiting for the bandwidth to become available
+	departures []time.Time
+
+	lastDelivery time.Time
+	seq          uint64
+	scheduled    packetQueue
+
+	stats LinkStats
+
+	wakeup    chan struct{}
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLink creates a new Link.
+// The send function is called for every packet when it is delivered. It is never called concurrently.
+func NewLink(conf *LinkConfig, send func([]byte)) *Link {
+	if conf == nil {
+		conf = &LinkConfig{}
+	}
+	l := &Link{
+		conf:      *conf,
+		send:      send,
+		wakeup:    make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+	}
+	if l.conf.BurstSize < protocol.MaxPacketBufferSize {
+		l.conf.BurstSize = protocol.MaxPacketBufferSize
+	}
+	l.tokens = float64(l.conf.BurstSize)
+	seed := l.conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	l.rand = rand.New(rand.NewSource(seed))
+	go l.run()
+	return l
+}
+
+// Send sends a packet on the link.
+// The link takes ownership of the data.
+func (l *Link) Send(data []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stats.Packets++
+	if l.isLost() {
+		l.stats.Lost++
+		return
+	}
+	now := time.Now()
+	depart, ok := l.depart(now, protocol.ByteCount(len(data)))
+	if !ok {
+		l.stats.QueueDrops++
+		return
+	}
+	if l.chance(l.conf.CorruptProbability) && len(data) > 0 {
+		l.stats.Corrupted++
+		corrupted := make([]byte, len(data))
+		copy(corrupted, data)
+		bit := l.rand.Intn(8 * len(data))
+		corrupted[bit/8] ^= 1 << uint(bit%8)
+		data = corrupted
+	}
+
+	var deliver time.Time
+	if l.chance(l.conf.ReorderProbability) {
+		l.stats.Reordered++
+		deliver = depart
+	} else {
+		deliver = depart.Add(l.conf.Delay)
+		if l.conf.Jitter > 0 {
+			deliver = deliver.Add(time.Duration(l.rand.Int63n(int64(l.conf.Jitter))))
+		}
+		if deliver.Before(l.lastDelivery) {
+			deliver = l.lastDelivery
+		}
+		l.lastDelivery = deliver
+	}
+	l.schedule(deliver, data)
+	if l.chance(l.conf.DuplicateProbability) {
+		l.stats.Duplicated++
+		l.schedule(deliver, data)
+	}
+}
+
+// isLost advances the Gilbert-Elliott model, and says if the packet is lost
+func (l *Link) isLost() bool {
+	ge := l.conf.Loss
+	if ge == nil {
+		return false
+	}
+	if l.badState {
+		if l.chance(ge.R) {
+			l.badState = false
+		}
+	} else if l.chance(ge.P) {
+		l.badState = true
+	}
+	if l.badState {
+		return l.chance(ge.LossBad)
+	}
+	return l.chance(ge.LossGood)
+}
+
+// depart calculates when a packet leaves the token bucket.
+// It returns false if the packet has to be dropped because the queue is full.
+func (l *Link) depart(now time.Time, size protocol.ByteCount) (time.Time, bool) {
+	if l.conf.Bandwidth == 0 {
+		return now, true
+	}
+	// remove all packets that already left the queue
+	var i int
+	for i < len(l.departures) && !l.departures[i].After(now) {
+		i++
+	}
+	l.departures = l.departures[i:]
+	if l.conf.QueueLen > 0 && len(l.departures) >= l.conf.QueueLen {
+		return time.Time{}, false
+	}
+
+	start := now
+	if l.lastDeparture.After(now) {
+		start = l.lastDeparture
+	}
+	rate := float64(l.conf.Bandwidth) / float64(time.Second)
+	if !l.lastDeparture.IsZero() {
+		l.tokens += float64(start.Sub(l.lastDeparture)) * rate
+	}
+	if l.tokens > float64(l.conf.BurstSize) {
+		l.tokens = float64(l.conf.BurstSize)
+	}
+	depart := start
+	if l.tokens < float64(size) {
+		depart = start.Add(time.Duration((float64(size) - l.tokens) / rate))
+		l.tokens = 0
+	} else {
+		l.tokens -= float64(size)
+	}
+	l.lastDeparture = depart
+	if depart.After(now) {
+		l.departures = append(l.departures, depart)
+	}
+	return depart, true
+}
+
+func (l *Link) chance(p float64) bool {
+	return p > 0 && l.rand.Float64() < p
+}
+
+func (l *Link) schedule(at time.Time, data []byte) {
+	l.seq++
+	heap.Push(&l.scheduled, &scheduledPacket{at: at, seq: l.seq, data: data})
+	select {
+	case l.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (l *Link) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		l.mutex.Lock()
+		now := time.Now()
+		var due [][]byte
+		for len(l.scheduled) > 0 && !l.scheduled[0].at.After(now) {
+			due = append(due, heap.Pop(&l.scheduled).(*scheduledPacket).data)
+		}
+		next := time.Hour
+		if len(l.scheduled) > 0 {
+			next = l.scheduled[0].at.Sub(now)
+		}
+		l.mutex.Unlock()
+
+		for _, data := range due {
+			select {
+			case <-l.closeChan:
+				return
+			default:
+			}
+			l.send(data)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+		select {
+		case <-l.closeChan:
+			return
+		case <-l.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+// Stats returns statistics about the packets sent on the link.
+func (l *Link) Stats() LinkStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stats
+}
+
+// Close closes the link. Packets that were not yet delivered are discarded.
+func (l *Link) Close() {
+	l.closeOnce.Do(func() { close(l.closeChan) })
+}
@@ -0,0 +1,227 @@
+package quicproxy
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type deliveredPacket struct {
+	data []byte
+	time time.Time
+}
+
+var _ = Describe("Link", func() {
+	var (
+		link      *Link
+		delivered chan deliveredPacket
+	)
+
+	startLink := func(conf *LinkConfig) {
+		c := delivered
+		link = NewLink(conf, func(data []byte) {
+			c <- deliveredPacket{data: data, time: time.Now()}
+		})
+	}
+
+	BeforeEach(func() {
+		delivered = make(chan deliveredPacket, 10000)
+	})
+
+	AfterEach(func() {
+		link.Close()
+	})
+
+	It("delivers packets immediately if no conditions are configured", func() {
+		startLink(nil)
+		start := time.Now()
+		link.Send([]byte("foobar"))
+		var p deliveredPacket
+		Eventually(delivered).Should(Receive(&p))
+		Expect(p.data).To(Equal([]byte("foobar")))
+		Expect(p.time).To(BeTemporally("~", start, 10*time.Millisecond))
+		Expect(link.Stats().Packets).To(BeEquivalentTo(1))
+	})
+
+	It("delays packets", func() {
+		startLink(&LinkConfig{Delay: 100 * time.Millisecond})
+		start := time.Now()
+		link.Send([]byte("foobar"))
+		var p deliveredPacket
+		Eventually(delivered).Should(Receive(&p))
+		Expect(p.time).To(SatisfyAll(
+			BeTemporally(">=", start.Add(100*time.Millisecond)),
+			BeTemporally("<", start.Add(150*time.Millisecond)),
+		))
+	})
+
+	It("adds jitter, without reordering packets", func() {
+		startLink(&LinkConfig{
+			Delay:  10 * time.Millisecond,
+			Jitter: 50 * time.Millisecond,
+			Seed:   1,
+		})
+		for i := 0; i < 100; i++ {
+			link.Send([]byte{byte(i)})
+		}
+		for i := 0; i < 100; i++ {
+			var p deliveredPacket
+			Eventually(delivered).Should(Receive(&p))
+			Expect(p.data).To(Equal([]byte{byte(i)}))
+		}
+	})
+
+	It("reorders packets", func() {
+		startLink(&LinkConfig{
+			Delay:              50 * time.Millisecond,
+			ReorderProbability: 0.5,
+			Seed:               1,
+		})
+		for i := 0; i < 100; i++ {
+			link.Send([]byte{byte(i)})
+		}
+		inOrder := true
+		seen := make(map[byte]bool)
+		last := -1
+		for i := 0; i < 100; i++ {
+			var p deliveredPacket
+			Eventually(delivered).Should(Receive(&p))
+			seen[p.data[0]] = true
+			if int(p.data[0]) < last {
+				inOrder = false
+			}
+			last = int(p.data[0])
+		}
+		Expect(inOrder).To(BeFalse())
+		Expect(seen).To(HaveLen(100))
+		Expect(link.Stats().Reordered).To(And(BeNumerically(">", 25), BeNumerically("<", 75)))
+	})
+
+	It("duplicates packets", func() {
+		startLink(&LinkConfig{DuplicateProbability: 1})
+		link.Send([]byte("foo"))
+		link.Send([]byte("bar"))
+		var p deliveredPacket
+		for _, data := range []string{"foo", "foo", "bar", "bar"} {
+			Eventually(delivered).Should(Receive(&p))
+			Expect(p.data).To(Equal([]byte(data)))
+		}
+		Consistently(delivered).ShouldNot(Receive())
+		Expect(link.Stats().Duplicated).To(BeEquivalentTo(2))
+	})
+
+	It("corrupts packets by flipping a single bit", func() {
+		startLink(&LinkConfig{CorruptProbability: 1, Seed: 1})
+		data := bytes.Repeat([]byte{0x42}, 100)
+		for i := 0; i < 10; i++ {
+			link.Send(data)
+			var p deliveredPacket
+			Eventually(delivered).Should(Receive(&p))
+			Expect(p.data).To(HaveLen(len(data)))
+			var flipped int
+			for j := range data {
+				for b := p.data[j] ^ data[j]; b != 0; b &= b - 1 {
+					flipped++
+				}
+			}
+			Expect(flipped).To(Equal(1))
+		}
+		// the original packet is not modified
+		Expect(data).To(Equal(bytes.Repeat([]byte{0x42}, 100)))
+		Expect(link.Stats().Corrupted).To(BeEquivalentTo(10))
+	})
+
+	Context("bandwidth", func() {
+		It("limits the bandwidth", func() {
+			startLink(&LinkConfig{
+				Bandwidth: 100000, // 100 kB/s
+				BurstSize: 10000,
+			})
+			start := time.Now()
+			// the first 10 kB are sent immediately, the remaining 20 kB take 200 ms
+			for i := 0; i < 30; i++ {
+				link.Send(make([]byte, 1000))
+			}
+			var p deliveredPacket
+			for i := 0; i < 10; i++ {
+				Eventually(delivered).Should(Receive(&p))
+			}
+			Expect(p.time).To(BeTemporally("~", start, 20*time.Millisecond))
+			for i := 10; i < 30; i++ {
+				Eventually(delivered).Should(Receive(&p))
+			}
+			Expect(p.time).To(BeTemporally("~", start.Add(200*time.Millisecond), 30*time.Millisecond))
+		})
+
+		It("drops packets when the queue is full", func() {
+			startLink(&LinkConfig{
+				Bandwidth: 10000, // 10 kB/s
+				BurstSize: 10000,
+				QueueLen:  5,
+			})
+			// 10 packets are sent immediately, 5 packets are queued
+			for i := 0; i < 20; i++ {
+				link.Send(make([]byte, 1000))
+			}
+			Expect(link.Stats().QueueDrops).To(BeEquivalentTo(5))
+			Eventually(delivered, time.Second).Should(HaveLen(15))
+			Consistently(delivered).Should(HaveLen(15))
+		})
+
+		It("accepts new packets when the queue drained", func() {
+			startLink(&LinkConfig{
+				Bandwidth: 100000, // 100 kB/s
+				BurstSize: 10000,
+				QueueLen:  1,
+			})
+			for i := 0; i < 12; i++ {
+				link.Send(make([]byte, 1000))
+			}
+			Expect(link.Stats().QueueDrops).To(BeEquivalentTo(1))
+			time.Sleep(20 * time.Millisecond)
+			link.Send(make([]byte, 1000))
+			Expect(link.Stats().QueueDrops).To(BeEquivalentTo(1))
+			Eventually(delivered).Should(HaveLen(12))
+		})
+	})
+
+	It("loses packets in bursts, according to the Gilbert-Elliott model", func() {
+		startLink(&LinkConfig{
+			Loss: &GilbertElliott{
+				P:        0.1,
+				R:        0.3,
+				LossGood: 0,
+				LossBad:  1,
+			},
+			Seed: 1,
+		})
+		const num = 10000
+		for i := 0; i < num; i++ {
+			link.Send([]byte{byte(i % 256)})
+		}
+		stats := link.Stats()
+		Expect(stats.Packets).To(BeEquivalentTo(num))
+		// the steady-state probability of the bad state is P / (P + R)
+		Expect(float64(stats.Lost) / num).To(BeNumerically("~", 0.25, 0.03))
+		Eventually(delivered).Should(HaveLen(num - int(stats.Lost)))
+	})
+
+	It("doesn't lose packets in the good state", func() {
+		startLink(&LinkConfig{
+			Loss: &GilbertElliott{P: 0, LossGood: 0, LossBad: 1},
+		})
+		for i := 0; i < 100; i++ {
+			link.Send([]byte("foobar"))
+		}
+		Expect(link.Stats().Lost).To(BeZero())
+	})
+
+	It("discards packets when it is closed", func() {
+		startLink(&LinkConfig{Delay: 50 * time.Millisecond})
+		link.Send([]byte("foobar"))
+		link.Close()
+		Consistently(delivered, 100*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -16,6 +16,9 @@ type connection struct {
 
 	incomingPacketCounter uint64
 	outgoingPacketCounter uint64
+
+	incomingLink *Link // nil if no network conditions are emulated
+	outgoingLink *Link // nil if no network conditions are emulated
 }
 
 // Direction is the direction a packet is sent.
@@ -76,6 +79,12 @@ type Opts struct {
 	// simulating a connection with non-zero RTTs.
 	// Note that the RTT is the sum of the delay for the incoming and the outgoing packet.
 	DelayPacket DelayCallback
+	// IncomingLink configures the network conditions emulated for packets from the client to the server.
+	// Every connection uses its own link.
+	// The delay determined by DelayPacket is applied before a packet is passed to the link.
+	IncomingLink *LinkConfig
+	// OutgoingLink configures the network conditions emulated for packets from the server to the client.
+	OutgoingLink *LinkConfig
 }
 
 // QuicProxy is a QUIC proxy that can drop and delay packets.
@@ -90,6 +99,9 @@ type QuicProxy struct {
 	dropPacket  DropCallback
 	delayPacket DelayCallback
 
+	incomingLink *LinkConfig
+	outgoingLink *LinkConfig
+
 	// Mapping from client addresses (as host:port) to connection
 	clientDict map[string]*connection
 }
@@ -123,12 +135,14 @@ func NewQuicProxy(local string, version protocol.VersionNumber, opts *Opts) (*Qu
 	}
 
 	p := QuicProxy{
-		clientDict:  make(map[string]*connection),
-		conn:        conn,
-		serverAddr:  raddr,
-		dropPacket:  packetDropper,
-		delayPacket: packetDelayer,
-		version:     version,
+		clientDict:   make(map[string]*connection),
+		conn:         conn,
+		serverAddr:   raddr,
+		dropPacket:   packetDropper,
+		delayPacket:  packetDelayer,
+		incomingLink: opts.IncomingLink,
+		outgoingLink: opts.OutgoingLink,
+		version:      version,
 	}
 
 	go p.runProxy()
@@ -137,9 +151,47 @@ func NewQuicProxy(local string, version protocol.VersionNumber, opts *Opts) (*Qu
 
 // Close stops the UDP Proxy
 func (p *QuicProxy) Close() error {
+	p.mutex.Lock()
+	for _, conn := range p.clientDict {
+		if conn.incomingLink != nil {
+			conn.incomingLink.Close()
+		}
+		if conn.outgoingLink != nil {
+			conn.outgoingLink.Close()
+		}
+	}
+	p.mutex.Unlock()
 	return p.conn.Close()
 }
 
+// LinkStats returns the statistics of the emulated links in the given direction, summed over all connections.
+func (p *QuicProxy) LinkStats(dir Direction) LinkStats {
+	var stats LinkStats
+	add := func(l *Link) {
+		if l == nil {
+			return
+		}
+		s := l.Stats()
+		stats.Packets += s.Packets
+		stats.Lost += s.Lost
+		stats.QueueDrops += s.QueueDrops
+		stats.Duplicated += s.Duplicated
+		stats.Corrupted += s.Corrupted
+		stats.Reordered += s.Reordered
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, conn := range p.clientDict {
+		if dir.Is(DirectionIncoming) {
+			add(conn.incomingLink)
+		}
+		if dir.Is(DirectionOutgoing) {
+			add(conn.outgoingLink)
+		}
+	}
+	return stats
+}
+
 // LocalAddr is the address the proxy is listening on.
 func (p *QuicProxy) LocalAddr() net.Addr {
 	return p.conn.LocalAddr()
@@ -155,16 +207,29 @@ func (p *QuicProxy) newConnection(cliAddr *net.UDPAddr) (*connection, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &connection{
+	conn := &connection{
 		ClientAddr: cliAddr,
 		ServerConn: srvudp,
-	}, nil
+	}
+	if p.incomingLink != nil {
+		conn.incomingLink = NewLink(p.incomingLink, func(raw []byte) {
+			// TODO: handle error
+			_, _ = srvudp.Write(raw)
+		})
+	}
+	if p.outgoingLink != nil {
+		conn.outgoingLink = NewLink(p.outgoingLink, func(raw []byte) {
+			// TODO: handle error
+			_, _ = p.conn.WriteToUDP(raw, cliAddr)
+		})
+	}
+	return conn, nil
 }
 
 // runProxy listens on the proxy address and handles incoming packets.
 func (p *QuicProxy) runProxy() error {
 	for {
-		buffer := make([]byte, protocol.MaxPacketSize)
+		buffer := make([]byte, protocol.MaxPacketBufferSize)
 		n, cliaddr, err := p.conn.ReadFromUDP(buffer)
 		if err != nil {
 			return err
@@ -194,7 +259,9 @@ func (p *QuicProxy) runProxy() error {
 
 		// Send the packet to the server
 		delay := p.delayPacket(DirectionIncoming, packetCount)
-		if delay != 0 {
+		if conn.incomingLink != nil {
+			sendDelayed(conn.incomingLink, raw, delay)
+		} else if delay != 0 {
 			time.AfterFunc(delay, func() {
 				// TODO: handle error
 				_, _ = conn.ServerConn.Write(raw)
@@ -211,7 +278,7 @@ func (p *QuicProxy) runProxy() error {
 // runConnection handles packets from server to a single client
 func (p *QuicProxy) runConnection(conn *connection) error {
 	for {
-		buffer := make([]byte, protocol.MaxPacketSize)
+		buffer := make([]byte, protocol.MaxPacketBufferSize)
 		n, err := conn.ServerConn.Read(buffer)
 		if err != nil {
 			return err
@@ -225,7 +292,9 @@ func (p *QuicProxy) runConnection(conn *connection) error {
 		}
 
 		delay := p.delayPacket(DirectionOutgoing, packetCount)
-		if delay != 0 {
+		if conn.outgoingLink != nil {
+			sendDelayed(conn.outgoingLink, raw, delay)
+		} else if delay != 0 {
 			time.AfterFunc(delay, func() {
 				// TODO: handle error
 				_, _ = p.conn.WriteToUDP(raw, conn.ClientAddr)
@@ -238,3 +307,11 @@ func (p *QuicProxy) runConnection(conn *connection) error {
 		}
 	}
 }
+
+func sendDelayed(link *Link, raw []byte, delay time.Duration) {
+	if delay == 0 {
+		link.Send(raw)
+		return
+	}
+	time.AfterFunc(delay, func() { link.Send(raw) })
+}
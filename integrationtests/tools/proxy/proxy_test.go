@@ -350,5 +350,58 @@ var _ = Describe("QUIC Proxy", func() {
 				expectDelay(start, delay, 3)
 			})
 		})
+
+		Context("emulated links", func() {
+			It("sends incoming packets over the link", func() {
+				startProxy(&Opts{
+					RemoteAddr:   serverConn.LocalAddr().String(),
+					IncomingLink: &LinkConfig{DuplicateProbability: 1},
+				})
+				for i := 1; i <= 3; i++ {
+					_, err := clientConn.Write(makePacket(protocol.PacketNumber(i), []byte("foobar"+strconv.Itoa(i))))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Eventually(serverReceivedPackets).Should(HaveLen(6))
+				Expect(proxy.LinkStats(DirectionIncoming).Packets).To(BeEquivalentTo(3))
+				Expect(proxy.LinkStats(DirectionIncoming).Duplicated).To(BeEquivalentTo(3))
+				Expect(proxy.LinkStats(DirectionOutgoing)).To(BeZero())
+			})
+
+			It("sends outgoing packets over the link, after the delay callback", func() {
+				delay := 100 * time.Millisecond
+				startProxy(&Opts{
+					RemoteAddr: serverConn.LocalAddr().String(),
+					DelayPacket: func(d Direction, _ uint64) time.Duration {
+						if d == DirectionOutgoing {
+							return delay
+						}
+						return 0
+					},
+					OutgoingLink: &LinkConfig{Delay: delay},
+				})
+
+				clientReceivedPackets := make(chan packetData, 2)
+				go func() {
+					for {
+						buf := make([]byte, protocol.MaxPacketSize)
+						n, _, err2 := clientConn.ReadFromUDP(buf)
+						if err2 != nil {
+							return
+						}
+						clientReceivedPackets <- packetData(buf[0:n])
+					}
+				}()
+
+				start := time.Now()
+				_, err := clientConn.Write(makePacket(1, []byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(clientReceivedPackets).Should(HaveLen(1))
+				Expect(time.Now()).To(SatisfyAll(
+					BeTemporally(">=", start.Add(2*delay)),
+					BeTemporally("<", start.Add(3*delay)),
+				))
+				Expect(proxy.LinkStats(DirectionBoth).Packets).To(BeEquivalentTo(1))
+			})
+		})
 	})
 })
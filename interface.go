@@ -6,8 +6,10 @@ import (
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
 // The StreamID is the ID of a QUIC stream.
@@ -16,10 +18,16 @@ type StreamID = protocol.StreamID
 // A VersionNumber is a QUIC version number.
 type VersionNumber = protocol.VersionNumber
 
+// An ErrorCode is an error code defined by the application protocol.
+// It is sent to the peer when a stream is reset or when the session is closed with an error.
+type ErrorCode = protocol.ApplicationErrorCode
+
 // A Cookie can be used to verify the ownership of the client address.
 type Cookie = handshake.Cookie
 
 // Stream is the interface implemented by QUIC streams
+// Streams also implement io.WriterTo and io.ReaderFrom, such that io.Copy moves data
+// between streams and files without copying it into an intermediate buffer.
 type Stream interface {
 	// Read reads data from the stream.
 	// Read can be made to time out and return a net.Error with Timeout() == true
@@ -31,8 +39,9 @@ type Stream interface {
 	io.Writer
 	io.Closer
 	StreamID() StreamID
-	// Reset closes the stream with an error.
-	Reset(error)
+	// Reset closes the stream with an error code, which is sent to the peer in a RST_STREAM frame.
+	// Pending and future calls to Read and Write return an *ApplicationError.
+	Reset(ErrorCode)
 	// The context is canceled as soon as the write-side of the stream is closed.
 	// This happens when Close() is called, or when the stream is reset (either locally or remotely).
 	// Warning: This API should not be considered stable and might change soon.
@@ -69,11 +78,51 @@ type Session interface {
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
 	RemoteAddr() net.Addr
+	// SendMessage sends a message in an unreliable DATAGRAM frame.
+	// The message is subject to congestion control, but it is never retransmitted. It must fit into a single packet.
+	// SendMessage blocks while too many messages are waiting to be sent.
+	// Datagrams must be enabled in the Config, and the peer must support them.
+	SendMessage([]byte) error
+	// ReceiveMessage returns the next message received in a DATAGRAM frame, blocking until one is available.
+	// Messages that arrive while too many messages are waiting to be received are dropped.
+	ReceiveMessage() ([]byte, error)
 	// Close closes the connection. The error will be sent to the remote peer in a CONNECTION_CLOSE frame. An error value of nil is allowed and will cause a normal PeerGoingAway to be sent.
 	Close(error) error
+	// CloseWithError closes the connection with an error code defined by the application protocol.
+	// The error code and the reason phrase are sent to the peer in an APPLICATION_CLOSE frame,
+	// and operations on the session and its streams on both sides return an *ApplicationError.
+	// Peers that don't support APPLICATION_CLOSE frames, and peers that haven't completed the handshake yet,
+	// receive a CONNECTION_CLOSE frame with the error code in the reason phrase instead.
+	CloseWithError(code ErrorCode, reason string) error
 	// The context is cancelled when the session is closed.
+	// The error that caused the session to be closed can be retrieved using CloseCause.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// Stats returns statistics about the session.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() SessionStats
+}
+
+// SessionStats contains statistics about a session.
+type SessionStats struct {
+	// ReceiveQueueLen is the number of received packets that are waiting to be processed.
+	// If this value approaches ReceiveQueueCap, the session is not able to keep up with the rate of incoming packets.
+	ReceiveQueueLen int
+	// ReceiveQueueCap is the maximum number of received packets that can be queued, see Config.MaxUnprocessedPackets.
+	ReceiveQueueCap int
+	// DroppedPackets is the number of received packets that were dropped because the receive queue was full.
+	DroppedPackets uint64
+	// MaxPacketSize is the size of the largest packets currently sent.
+	// It grows when path MTU discovery finds that the path supports larger packets, see Config.MaxPacketSize.
+	MaxPacketSize uint64
+	// ReceiveConnectionWindow is the connection-level receive flow control window, i.e. the number of bytes the peer may send beyond the data that was read.
+	// It grows with the bandwidth-delay product of the connection, up to Config.MaxReceiveConnectionFlowControlWindow, and shrinks when the connection is idle.
+	ReceiveConnectionWindow uint64
+	// ReceiveBuffered is the number of bytes of received stream data that are buffered, because they were not yet read by the application,
+	// or because they were received out of order.
+	ReceiveBuffered uint64
+	// SendBuffered is the number of bytes of stream data that were written by the application, but not yet sent.
+	SendBuffered uint64
 }
 
 // A NonFWSession is a QUIC connection between two peers half-way through the handshake.
@@ -113,16 +162,91 @@ type Config struct {
 	// MaxReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
 	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
 	MaxReceiveConnectionFlowControlWindow uint64
+	// MaxReceiveBufferPerSession is the maximum number of bytes of received data that a session buffers on all its streams.
+	// Flow control windows are only increased if the memory is available. Every stream can always use its initial window,
+	// but no stream can grow its window beyond its fair share of the budget.
+	// If this value is zero, the memory is only limited by the flow control windows.
+	MaxReceiveBufferPerSession uint64
+	// MaxReceiveBufferPerListener is the maximum number of bytes of received data that all sessions of a listener buffer.
+	// Every session can use at most its fair share of this budget for growing its flow control windows.
+	// If this value is zero, the memory is only limited by the flow control windows.
+	// This option is only valid for the server.
+	MaxReceiveBufferPerListener uint64
+	// SendBufferSize is the size of the send buffer of every stream.
+	// Stream.Write copies the data to the send buffer and returns immediately. It only blocks while the send buffer is full.
+	// Data remaining in the send buffer when the stream is closed is sent before the stream is finished.
+	// If this value is zero, it defaults to 64 kB.
+	SendBufferSize uint64
+	// EnableDatagrams enables sending and receiving unreliable messages in DATAGRAM frames, see Session.SendMessage.
+	// Support for datagrams is negotiated during the handshake, so the peer has to enable them as well.
+	EnableDatagrams bool
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
 	KeepAlive bool
+	// MaxUnprocessedPackets is the maximum number of received packets that are queued for a session before they are processed.
+	// Packets received while the queue is full are dropped.
+	// If this value is zero or negative, it defaults to 1000 packets.
+	MaxUnprocessedPackets int
+	// StatelessRetryThreshold is the number of handshakes in progress at which the server starts requiring
+	// clients to validate their address before any state is created for them.
+	// New clients then receive a stateless retry, containing a source address token that they have to send back.
+	// If this value is zero, stateless retries are never sent. If it is negative, they are always sent.
+	// Stateless retries are not yet supported for the TLS handshake.
+	// This option is only valid for the server.
+	StatelessRetryThreshold int
+	// MaxConcurrentHandshakes is the maximum number of handshakes the server performs concurrently.
+	// New clients are refused with a CONNECTION_CLOSE (error code TooManySessionsOnServer) while this limit is reached.
+	// If this value is zero or negative, it defaults to 1000 handshakes.
+	// This option is only valid for the server.
+	MaxConcurrentHandshakes int
+	// MaxAcceptQueueLen is the maximum number of sessions that completed the handshake, but were not yet returned by Accept.
+	// Sessions that complete the handshake while the queue is full are closed with a CONNECTION_CLOSE (error code TooManySessionsOnServer).
+	// If this value is zero or negative, it defaults to 32 sessions.
+	// This option is only valid for the server.
+	MaxAcceptQueueLen int
+	// MaxPacketSize is the maximum size of QUIC packets, not including the IP and UDP headers.
+	// If it is larger than the default of 1350 bytes, the path MTU is discovered by sending padded probe packets,
+	// and larger packets are sent once the path was found to support them. Larger packets are also accepted from the peer.
+	// The probes are sent with the Don't Fragment bit set. Path MTU discovery is only performed if the operating system
+	// supports setting this bit, which is currently only the case on Linux.
+	// If this value is zero, it defaults to 1350 bytes. It is limited to the range from 1200 to 8952 bytes.
+	MaxPacketSize uint64
+
+	// clock is the clock used by the session. It is only set when running tests in virtual time.
+	// If nil, the system clock is used.
+	clock utils.Clock
+	// receiveBudget is the memory budget shared by all sessions of a listener, see MaxReceiveBufferPerListener.
+	receiveBudget *flowcontrol.MemoryBudget
+	// receiveBacklog keeps track of the sessions of a listener that don't keep up with incoming packets
+	receiveBacklog *receiveBacklog
 }
 
 // A Listener for incoming QUIC connections
 type Listener interface {
 	// Close the server, sending CONNECTION_CLOSE frames to each peer.
 	Close() error
+	// Shutdown stops accepting new sessions, sends CONNECTION_CLOSE frames to all peers,
+	// and waits until all sessions are closed or the context expires.
+	// Pending and future calls to Accept return ErrServerClosed.
+	Shutdown(context.Context) error
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
-	Accept() (Session, error)
+	// It returns the context's error if the context is canceled before a new session arrives.
+	Accept(context.Context) (Session, error)
+	// Stats returns statistics about the receive queues of the sessions of the listener.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() ListenerStats
+}
+
+// ListenerStats contains statistics about the receive queues of the sessions of a listener.
+// The listener uses them as a backpressure signal: while more than half of its sessions are backlogged,
+// new connections are refused with a TooManySessionsOnServer CONNECTION_CLOSE.
+type ListenerStats struct {
+	// Sessions is the number of sessions that are currently running, including sessions that are still in the handshake.
+	Sessions int
+	// BackloggedSessions is the number of sessions whose receive queue is more than half full.
+	// A session stays backlogged until it has processed all queued packets.
+	BackloggedSessions int
+	// DroppedPackets is the number of received packets that were dropped because the receive queue of their session was full.
+	DroppedPackets uint64
 }
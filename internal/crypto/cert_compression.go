@@ -8,10 +8,15 @@ import (
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
+// maxUncompressedCertChainLength is the maximum length of an uncompressed certificate chain.
+// This is the same limit that Chromium uses.
+const maxUncompressedCertChainLength = 128 * 1024
+
 type entryType uint8
 
 const (
@@ -148,9 +153,11 @@ func decompressChain(data []byte) ([][]byte, error) {
 	if hasCompressedCerts {
 		uncompressedLength, err := utils.LittleEndian.ReadUint32(r)
 		if err != nil {
-			fmt.Println(4)
 			return nil, err
 		}
+		if uncompressedLength > maxUncompressedCertChainLength {
+			return nil, errors.New("CertCompression: uncompressed certificate chain too long")
+		}
 
 		zlibDict := buildZlibDictForEntries(entries, chain)
 		gz, err := zlib.NewReaderDict(r, zlibDict)
@@ -163,15 +170,16 @@ func decompressChain(data []byte) ([][]byte, error) {
 		var certIndex int
 		for totalLength < uncompressedLength {
 			lenBytes := make([]byte, 4)
-			_, err := gz.Read(lenBytes)
-			if err != nil {
+			if _, err := io.ReadFull(gz, lenBytes); err != nil {
 				return nil, err
 			}
 			certLen := binary.LittleEndian.Uint32(lenBytes)
+			if remaining := uncompressedLength - totalLength; remaining < 4 || certLen > remaining-4 {
+				return nil, errors.New("CertCompression: certificate exceeds the uncompressed length")
+			}
 
 			cert := make([]byte, certLen)
-			n, err := gz.Read(cert)
-			if uint32(n) != certLen && err != nil {
+			if _, err := io.ReadFull(gz, cert); err != nil {
 				return nil, err
 			}
 
@@ -189,6 +197,12 @@ func decompressChain(data []byte) ([][]byte, error) {
 
 			totalLength += 4 + certLen
 		}
+
+		for ; certIndex < len(entries); certIndex++ {
+			if entries[certIndex].t == entryCompressed {
+				return nil, errors.New("CertCompression: missing compressed certificate")
+			}
+		}
 	}
 
 	return chain, nil
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"hash/fnv"
+	"io"
 
 	"github.com/lucas-clemente/quic-go-certificates"
 	. "github.com/onsi/ginkgo"
@@ -264,6 +265,45 @@ var _ = Describe("Cert compression and decompression", func() {
 		Expect(decompressed).To(Equal(chain))
 	})
 
+	Context("decompressing invalid chains", func() {
+		// compress writes the entries, the uncompressed length, and the zlib compressed data
+		compress := func(entries []byte, uncompressedLen uint32, data []byte) []byte {
+			b := bytes.NewBuffer(entries)
+			lenBytes := make([]byte, 4)
+			binary.LittleEndian.PutUint32(lenBytes, uncompressedLen)
+			b.Write(lenBytes)
+			z, err := zlib.NewWriterLevelDict(b, flate.BestCompression, certDictZlib)
+			Expect(err).ToNot(HaveOccurred())
+			z.Write(data)
+			z.Close()
+			return b.Bytes()
+		}
+
+		It("rejects chains that are too long", func() {
+			data := compress([]byte{0x01, 0x00}, maxUncompressedCertChainLength+1, nil)
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError("CertCompression: uncompressed certificate chain too long"))
+		})
+
+		It("rejects certificates that exceed the uncompressed length", func() {
+			data := compress([]byte{0x01, 0x00}, 8, []byte{0xff, 0xff, 0xff, 0xff, 0xde, 0xca, 0xfb, 0xad})
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError("CertCompression: certificate exceeds the uncompressed length"))
+		})
+
+		It("rejects truncated certificates", func() {
+			data := compress([]byte{0x01, 0x00}, 10, []byte{0x06, 0x00, 0x00, 0x00, 0xde, 0xca, 0xfb, 0xad})
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		})
+
+		It("rejects chains with missing certificates", func() {
+			data := compress([]byte{0x01, 0x01, 0x00}, 8, []byte{0x04, 0x00, 0x00, 0x00, 0xde, 0xca, 0xfb, 0xad})
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError("CertCompression: missing compressed certificate"))
+		})
+	})
+
 	It("rejects invalid CCS / CCRT hashes", func() {
 		cert := []byte{0xde, 0xca, 0xfb, 0xad}
 		chain := [][]byte{cert}
@@ -0,0 +1,35 @@
+// +build gofuzz
+
+package crypto
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FuzzCertChain is an entry point for go-fuzz (https://github.com/dvyukov/go-fuzz).
+// It fuzzes the decompression of certificate chains.
+// To run it, use
+//   go-fuzz-build -func FuzzCertChain github.com/lucas-clemente/quic-go/internal/crypto
+//   go-fuzz -bin crypto-fuzz.zip -workdir fuzzing/certchain
+// The seed corpus can be generated by running the tests with the gofuzz build tag, see fuzz_test.go.
+//
+// Every chain that can be decompressed is compressed again, and the result has to be decompressed to the same chain.
+func FuzzCertChain(data []byte) int {
+	chain, err := decompressChain(data)
+	if err != nil {
+		return 0
+	}
+	compressed, err := compressChain(chain, getCommonCertificateHashes(), nil)
+	if err != nil {
+		panic(fmt.Sprintf("failed to compress the decompressed certificate chain: %s", err))
+	}
+	chain2, err := decompressChain(compressed)
+	if err != nil {
+		panic(fmt.Sprintf("failed to decompress the compressed certificate chain: %s", err))
+	}
+	if !reflect.DeepEqual(chain, chain2) {
+		panic("certificate chains not equal")
+	}
+	return 1
+}
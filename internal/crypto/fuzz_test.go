@@ -0,0 +1,61 @@
+// +build gofuzz
+
+package crypto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lucas-clemente/quic-go-certificates"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fuzzing", func() {
+	// the seeds are generated from the certificate chains used in the compression tests
+	getSeeds := func() [][]byte {
+		setHash := make([]byte, 8)
+		binary.LittleEndian.PutUint64(setHash, certsets.CertSet3Hash)
+		cert1 := []byte{0xde, 0xca, 0xfb, 0xad}
+		cert2 := []byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe}
+		var seeds [][]byte
+		for _, chain := range [][][]byte{
+			nil,
+			{cert1},
+			{cert1, cert2},
+			{certsets.CertSet3[42]},
+			{cert1, certsets.CertSet3[42]},
+		} {
+			compressed, err := compressChain(chain, setHash, nil)
+			Expect(err).ToNot(HaveOccurred())
+			seeds = append(seeds, compressed)
+		}
+		return seeds
+	}
+
+	It("decompresses and compresses the seeds", func() {
+		for _, seed := range getSeeds() {
+			Expect(FuzzCertChain(seed)).To(Equal(1))
+		}
+	})
+
+	It("rejects a chain with a huge certificate", func() {
+		// this input caused an allocation of 4 GB
+		Expect(FuzzCertChain([]byte("\x01\x0000008\x1128XXY\xd93$"))).To(BeZero())
+	})
+
+	It("writes the seed corpus", func() {
+		dir := os.Getenv("QUIC_GO_FUZZ_CORPUS")
+		if dir == "" {
+			Skip("QUIC_GO_FUZZ_CORPUS not set")
+		}
+		dir = filepath.Join(dir, "certchain", "corpus")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		for i, seed := range getSeeds() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("seed-%d", i)), seed, 0644)).To(Succeed())
+		}
+	})
+})
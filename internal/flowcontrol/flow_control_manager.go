@@ -15,7 +15,9 @@ import (
 type flowControlManager struct {
 	connParams             handshake.ParamsNegotiator
 	rttStats               *congestion.RTTStats
+	clock                  utils.Clock
 	maxReceiveStreamWindow protocol.ByteCount
+	budget                 *MemoryBudget
 
 	streamFlowController map[protocol.StreamID]*flowController
 	connFlowController   *flowController
@@ -27,18 +29,23 @@ var _ FlowControlManager = &flowControlManager{}
 var errMapAccess = errors.New("Error accessing the flowController map.")
 
 // NewFlowControlManager creates a new flow control manager
+// If a budget is given, the memory for the stream-level receive windows is reserved from it before the windows are increased.
 func NewFlowControlManager(
 	connParams handshake.ParamsNegotiator,
 	maxReceiveStreamWindow protocol.ByteCount,
 	maxReceiveConnectionWindow protocol.ByteCount,
+	budget *MemoryBudget,
 	rttStats *congestion.RTTStats,
+	clock utils.Clock,
 ) FlowControlManager {
 	return &flowControlManager{
 		connParams:             connParams,
 		rttStats:               rttStats,
+		clock:                  clock,
 		maxReceiveStreamWindow: maxReceiveStreamWindow,
+		budget:                 budget,
 		streamFlowController:   make(map[protocol.StreamID]*flowController),
-		connFlowController:     newFlowController(0, false, connParams, maxReceiveConnectionWindow, rttStats),
+		connFlowController:     newFlowController(0, false, connParams, maxReceiveConnectionWindow, rttStats, clock),
 	}
 }
 
@@ -51,13 +58,21 @@ func (f *flowControlManager) NewStream(streamID protocol.StreamID, contributesTo
 	if _, ok := f.streamFlowController[streamID]; ok {
 		return
 	}
-	f.streamFlowController[streamID] = newFlowController(streamID, contributesToConnection, f.connParams, f.maxReceiveStreamWindow, f.rttStats)
+	fc := newFlowController(streamID, contributesToConnection, f.connParams, f.maxReceiveStreamWindow, f.rttStats, f.clock)
+	if f.budget != nil {
+		fc.setBudget(f.budget)
+	}
+	f.streamFlowController[streamID] = fc
 }
 
 // RemoveStream removes a closed stream from flow control
+// the memory reserved for the stream is returned to the budget
 func (f *flowControlManager) RemoveStream(streamID protocol.StreamID) {
 	f.mutex.Lock()
-	delete(f.streamFlowController, streamID)
+	if fc, ok := f.streamFlowController[streamID]; ok {
+		fc.releaseBudget()
+		delete(f.streamFlowController, streamID)
+	}
 	f.mutex.Unlock()
 }
 
@@ -142,8 +157,10 @@ func (f *flowControlManager) GetWindowUpdates() (res []WindowUpdate) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
+	now := f.clock.Now()
 	// get WindowUpdates for streams
 	for id, fc := range f.streamFlowController {
+		fc.maybeShrinkWindowIncrement(now)
 		if necessary, newIncrement, offset := fc.MaybeUpdateWindow(); necessary {
 			res = append(res, WindowUpdate{StreamID: id, Offset: offset})
 			if fc.ContributesToConnection() && newIncrement != 0 {
@@ -152,6 +169,7 @@ func (f *flowControlManager) GetWindowUpdates() (res []WindowUpdate) {
 		}
 	}
 	// get a WindowUpdate for the connection
+	f.connFlowController.maybeShrinkWindowIncrement(now)
 	if necessary, _, offset := f.connFlowController.MaybeUpdateWindow(); necessary {
 		res = append(res, WindowUpdate{StreamID: 0, Offset: offset})
 	}
@@ -175,6 +193,23 @@ func (f *flowControlManager) GetReceiveWindow(streamID protocol.StreamID) (proto
 	return flowController.receiveWindow, nil
 }
 
+// GetReceiveWindowIncrement gets the number of bytes the peer is allowed to send beyond the data that was read
+// streamID may be 0 here
+func (f *flowControlManager) GetReceiveWindowIncrement(streamID protocol.StreamID) (protocol.ByteCount, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if streamID == 0 {
+		return f.connFlowController.receiveWindowIncrement, nil
+	}
+
+	flowController, err := f.getFlowController(streamID)
+	if err != nil {
+		return 0, err
+	}
+	return flowController.receiveWindowIncrement, nil
+}
+
 // streamID must not be 0 here
 func (f *flowControlManager) AddBytesSent(streamID protocol.StreamID, n protocol.ByteCount) error {
 	f.mutex.Lock()
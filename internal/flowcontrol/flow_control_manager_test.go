@@ -6,6 +6,7 @@ import (
 	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/qerr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -18,7 +19,7 @@ var _ = Describe("Flow Control Manager", func() {
 		mockPn := mocks.NewMockParamsNegotiator(mockCtrl)
 		mockPn.EXPECT().GetReceiveStreamFlowControlWindow().AnyTimes().Return(protocol.ByteCount(100))
 		mockPn.EXPECT().GetReceiveConnectionFlowControlWindow().AnyTimes().Return(protocol.ByteCount(200))
-		fcm = NewFlowControlManager(mockPn, protocol.MaxByteCount, protocol.MaxByteCount, &congestion.RTTStats{}).(*flowControlManager)
+		fcm = NewFlowControlManager(mockPn, protocol.MaxByteCount, protocol.MaxByteCount, nil, &congestion.RTTStats{}, utils.DefaultClock{}).(*flowControlManager)
 	})
 
 	It("creates a connection level flow controller", func() {
@@ -53,6 +54,40 @@ var _ = Describe("Flow Control Manager", func() {
 		Expect(fcm.streamFlowController).ToNot(HaveKey(protocol.StreamID(5)))
 	})
 
+	Context("using a memory budget", func() {
+		var budget *MemoryBudget
+
+		BeforeEach(func() {
+			budget = NewMemoryBudget(300, nil)
+			fcm.budget = budget
+		})
+
+		It("reserves the initial window for new streams", func() {
+			fcm.NewStream(5, true)
+			fcm.NewStream(7, true)
+			Expect(budget.Used()).To(Equal(protocol.ByteCount(2 * 100)))
+			Expect(budget.users).To(Equal(2))
+		})
+
+		It("releases the memory when a stream is removed", func() {
+			fcm.NewStream(5, true)
+			fcm.RemoveStream(5)
+			Expect(budget.Used()).To(BeZero())
+			Expect(budget.users).To(BeZero())
+		})
+
+		It("only increases the window if memory is available", func() {
+			fcm.NewStream(5, true)
+			fcm.NewStream(7, true)
+			fcm.streamFlowController[5].receiveWindowIncrement = 250
+			Expect(fcm.UpdateHighestReceived(5, 100)).To(Succeed())
+			Expect(fcm.AddBytesRead(5, 100)).To(Succeed())
+			Expect(budget.Used()).To(Equal(protocol.ByteCount(100)))
+			Expect(fcm.GetWindowUpdates()).To(ContainElement(WindowUpdate{StreamID: 5, Offset: 100 + 150}))
+			Expect(budget.Used()).To(Equal(protocol.ByteCount(100 + 150)))
+		})
+	})
+
 	Context("receiving data", func() {
 		BeforeEach(func() {
 			fcm.NewStream(1, false)
@@ -159,31 +194,69 @@ var _ = Describe("Flow Control Manager", func() {
 				Expect(err).To(MatchError(errMapAccess))
 			})
 
-			It("increases the connection-level window, when a stream window was increased by autotuning", func() {
-				setRtt(10 * time.Millisecond)
-				fcm.streamFlowController[4].lastWindowUpdateTime = time.Now().Add(-1 * time.Millisecond)
-				err := fcm.UpdateHighestReceived(4, 100)
-				Expect(err).ToNot(HaveOccurred())
-				err = fcm.AddBytesRead(4, 90)
-				Expect(err).ToNot(HaveOccurred())
-				updates := fcm.GetWindowUpdates()
-				Expect(updates).To(HaveLen(2))
-				connLevelIncrement := protocol.ByteCount(protocol.ConnectionFlowControlMultiplier * 200) // 300
-				Expect(updates).To(ContainElement(WindowUpdate{StreamID: 4, Offset: 290}))
-				Expect(updates).To(ContainElement(WindowUpdate{StreamID: 0, Offset: 90 + connLevelIncrement}))
-			})
+			Context("auto-tuning", func() {
+				var clock *utils.VirtualClock
+
+				BeforeEach(func() {
+					clock = utils.NewVirtualClock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+					fcm.clock = clock
+					fcm.connFlowController.clock = clock
+					for _, controller := range fcm.streamFlowController {
+						controller.clock = clock
+					}
+					setRtt(10 * time.Millisecond)
+				})
+
+				// read receives 100 bytes on a stream, and reads 90 bytes right away
+				read := func(streamID protocol.StreamID) {
+					Expect(fcm.UpdateHighestReceived(streamID, 100)).To(Succeed())
+					Expect(fcm.AddBytesRead(streamID, 90)).To(Succeed())
+				}
 
-			It("doesn't increase the connection-level window, when a non-contributing stream window was increased by autotuning", func() {
-				setRtt(10 * time.Millisecond)
-				fcm.streamFlowController[1].lastWindowUpdateTime = time.Now().Add(-1 * time.Millisecond)
-				err := fcm.UpdateHighestReceived(1, 100)
-				Expect(err).ToNot(HaveOccurred())
-				err = fcm.AddBytesRead(1, 90)
-				Expect(err).ToNot(HaveOccurred())
-				updates := fcm.GetWindowUpdates()
-				Expect(updates).To(HaveLen(1))
-				Expect(updates).To(ContainElement(WindowUpdate{StreamID: 1, Offset: 290}))
-				// the only window update is for stream 1, thus there's no connection-level window update
+				It("increases the connection-level window, when a stream window was increased by autotuning", func() {
+					read(4)
+					updates := fcm.GetWindowUpdates()
+					Expect(updates).To(HaveLen(2))
+					connLevelIncrement := protocol.ByteCount(protocol.ConnectionFlowControlMultiplier * 200) // 300
+					Expect(updates).To(ContainElement(WindowUpdate{StreamID: 4, Offset: 90 + 200}))
+					Expect(updates).To(ContainElement(WindowUpdate{StreamID: 0, Offset: 90 + connLevelIncrement}))
+				})
+
+				It("doesn't increase the connection-level window, when a non-contributing stream window was increased by autotuning", func() {
+					read(1)
+					updates := fcm.GetWindowUpdates()
+					Expect(updates).To(HaveLen(1))
+					Expect(updates).To(ContainElement(WindowUpdate{StreamID: 1, Offset: 90 + 200}))
+					// the only window update is for stream 1, thus there's no connection-level window update
+				})
+
+				It("gets the receive window increment", func() {
+					read(4)
+					fcm.GetWindowUpdates()
+					increment, err := fcm.GetReceiveWindowIncrement(4)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(increment).To(Equal(protocol.ByteCount(200)))
+					increment, err = fcm.GetReceiveWindowIncrement(6)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(increment).To(Equal(protocol.ByteCount(100)))
+					increment, err = fcm.GetReceiveWindowIncrement(0)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(increment).To(Equal(protocol.ByteCount(300)))
+				})
+
+				It("errors when asked for the receive window increment of a stream that doesn't exist", func() {
+					_, err := fcm.GetReceiveWindowIncrement(17)
+					Expect(err).To(MatchError(errMapAccess))
+				})
+
+				It("shrinks the windows of idle streams", func() {
+					read(4)
+					fcm.GetWindowUpdates()
+					clock.AdvanceTo(clock.Now().Add(protocol.FlowControlIdleRTTs * 10 * time.Millisecond))
+					Expect(fcm.GetWindowUpdates()).To(BeEmpty())
+					Expect(fcm.streamFlowController[4].receiveWindowIncrement).To(Equal(protocol.ByteCount(100)))
+					Expect(fcm.connFlowController.receiveWindowIncrement).To(Equal(protocol.ByteCount(200)))
+				})
 			})
 		})
 	})
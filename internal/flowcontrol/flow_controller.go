@@ -16,17 +16,31 @@ type flowController struct {
 
 	connParams handshake.ParamsNegotiator
 	rttStats   *congestion.RTTStats
+	clock      utils.Clock
 
 	bytesSent  protocol.ByteCount
 	sendWindow protocol.ByteCount
 
 	lastWindowUpdateTime time.Time
 
-	bytesRead                 protocol.ByteCount
-	highestReceived           protocol.ByteCount
-	receiveWindow             protocol.ByteCount
-	receiveWindowIncrement    protocol.ByteCount
-	maxReceiveWindowIncrement protocol.ByteCount
+	bytesRead                     protocol.ByteCount
+	highestReceived               protocol.ByteCount
+	receiveWindow                 protocol.ByteCount
+	receiveWindowIncrement        protocol.ByteCount
+	initialReceiveWindowIncrement protocol.ByteCount
+	maxReceiveWindowIncrement     protocol.ByteCount
+	// the receiveWindowIncrement that was used for the last window update
+	lastWindowUpdateIncrement protocol.ByteCount
+
+	// for estimating the bandwidth-delay product
+	lastReadTime     time.Time
+	epochStartTime   time.Time
+	epochStartOffset protocol.ByteCount
+
+	// the budget that memory for received data is reserved from, may be nil
+	budget *MemoryBudget
+	// the memory reserved from the budget, i.e. the number of bytes the peer may send beyond the data that was read
+	reserved protocol.ByteCount
 }
 
 // ErrReceivedSmallerByteOffset occurs if the ByteOffset received is smaller than a ByteOffset that was set previously
@@ -39,12 +53,14 @@ func newFlowController(
 	connParams handshake.ParamsNegotiator,
 	maxReceiveWindow protocol.ByteCount,
 	rttStats *congestion.RTTStats,
+	clock utils.Clock,
 ) *flowController {
 	fc := flowController{
 		streamID:                  streamID,
 		contributesToConnection:   contributesToConnection,
 		connParams:                connParams,
 		rttStats:                  rttStats,
+		clock:                     clock,
 		maxReceiveWindowIncrement: maxReceiveWindow,
 	}
 
@@ -55,6 +71,8 @@ func newFlowController(
 		fc.receiveWindow = connParams.GetReceiveStreamFlowControlWindow()
 		fc.receiveWindowIncrement = fc.receiveWindow
 	}
+	fc.initialReceiveWindowIncrement = fc.receiveWindowIncrement
+	fc.lastWindowUpdateIncrement = fc.receiveWindowIncrement
 
 	return &fc
 }
@@ -123,32 +141,52 @@ func (c *flowController) IncrementHighestReceived(increment protocol.ByteCount)
 	c.highestReceived += increment
 }
 
+// AddBytesRead should be called when data was read by the application.
+// The rate at which data is read is used to estimate the bandwidth-delay product of the connection.
 func (c *flowController) AddBytesRead(n protocol.ByteCount) {
+	now := c.clock.Now()
+	c.maybeShrinkWindowIncrement(now)
 	// pretend we sent a WindowUpdate when reading the first byte
 	// this way auto-tuning of the window increment already works for the first WindowUpdate
 	if c.bytesRead == 0 {
-		c.lastWindowUpdateTime = time.Now()
+		c.lastWindowUpdateTime = now
+	}
+	// the first read (after an idle period) starts a new measurement epoch
+	// all data read at the same time is counted in the same epoch, such that the estimate doesn't depend on how the data is split into reads
+	if c.epochStartTime.IsZero() {
+		c.epochStartTime = now
+		c.epochStartOffset = c.bytesRead
+	} else if now.After(c.lastReadTime) {
+		c.maybeAdjustWindowIncrementToBDP(now)
 	}
 	c.bytesRead += n
+	c.lastReadTime = now
+	if c.budget != nil {
+		released := utils.MinByteCount(n, c.reserved)
+		c.reserved -= released
+		c.budget.release(released)
+	}
 }
 
 // MaybeUpdateWindow updates the receive window, if necessary
-// if the receive window increment is changed, the new value is returned, otherwise a 0
+// if the receive window increment was increased since the last window update, the new value is returned, otherwise a 0
 // the last return value is the new offset of the receive window
 func (c *flowController) MaybeUpdateWindow() (bool, protocol.ByteCount /* new increment */, protocol.ByteCount /* new offset */) {
 	diff := c.receiveWindow - c.bytesRead
 
 	// Chromium implements the same threshold
 	if diff < (c.receiveWindowIncrement / 2) {
-		var newWindowIncrement protocol.ByteCount
-		oldWindowIncrement := c.receiveWindowIncrement
-
 		c.maybeAdjustWindowIncrement()
-		if c.receiveWindowIncrement != oldWindowIncrement {
-			newWindowIncrement = c.receiveWindowIncrement
+		if c.budget != nil {
+			c.receiveWindowIncrement = c.reserveWindowIncrement(c.receiveWindowIncrement)
 		}
 
-		c.lastWindowUpdateTime = time.Now()
+		var newWindowIncrement protocol.ByteCount
+		if c.receiveWindowIncrement > c.lastWindowUpdateIncrement {
+			newWindowIncrement = c.receiveWindowIncrement
+		}
+		c.lastWindowUpdateIncrement = c.receiveWindowIncrement
+		c.lastWindowUpdateTime = c.clock.Now()
 		c.receiveWindow = c.bytesRead + c.receiveWindowIncrement
 		return true, newWindowIncrement, c.receiveWindow
 	}
@@ -156,7 +194,42 @@ func (c *flowController) MaybeUpdateWindow() (bool, protocol.ByteCount /* new in
 	return false, 0, 0
 }
 
+// setBudget sets the budget that memory for received data is reserved from
+// The memory for the current receive window is reserved immediately, since the peer is already allowed to send that much data.
+func (c *flowController) setBudget(budget *MemoryBudget) {
+	c.budget = budget
+	c.budget.addUser()
+	c.reserved = c.receiveWindow - c.bytesRead
+	c.budget.forceReserve(c.reserved)
+}
+
+// releaseBudget returns all reserved memory to the budget
+func (c *flowController) releaseBudget() {
+	if c.budget == nil {
+		return
+	}
+	c.budget.release(c.reserved)
+	c.budget.removeUser()
+	c.reserved = 0
+	c.budget = nil
+}
+
+// reserveWindowIncrement reserves the memory needed to increase the window by inc
+// The initial window increment is always granted, such that every stream can make progress, even if the budget is used up.
+// Any memory beyond that is only granted if available, so the returned increment might be smaller than inc.
+func (c *flowController) reserveWindowIncrement(inc protocol.ByteCount) protocol.ByteCount {
+	if guaranteed := utils.MinByteCount(inc, c.initialReceiveWindowIncrement); c.reserved < guaranteed {
+		c.budget.forceReserve(guaranteed - c.reserved)
+		c.reserved = guaranteed
+	}
+	if inc > c.reserved {
+		c.reserved += c.budget.reserve(inc-c.reserved, c.reserved)
+	}
+	return c.reserved
+}
+
 // maybeAdjustWindowIncrement increases the receiveWindowIncrement if we're sending WindowUpdates too often
+// In that case the peer is blocked by flow control, and the BDP estimate is limited by the window.
 func (c *flowController) maybeAdjustWindowIncrement() {
 	if c.lastWindowUpdateTime.IsZero() {
 		return
@@ -167,24 +240,73 @@ func (c *flowController) maybeAdjustWindowIncrement() {
 		return
 	}
 
-	timeSinceLastWindowUpdate := time.Since(c.lastWindowUpdateTime)
+	timeSinceLastWindowUpdate := c.clock.Now().Sub(c.lastWindowUpdateTime)
 
 	// interval between the window updates is sufficiently large, no need to increase the increment
 	if timeSinceLastWindowUpdate >= 2*rtt {
 		return
 	}
 
-	oldWindowSize := c.receiveWindowIncrement
-	c.receiveWindowIncrement = utils.MinByteCount(2*c.receiveWindowIncrement, c.maxReceiveWindowIncrement)
+	c.setWindowIncrement(2 * c.receiveWindowIncrement)
+}
 
-	// debug log, if the window size was actually increased
-	if oldWindowSize < c.receiveWindowIncrement {
-		newWindowSize := c.receiveWindowIncrement / (1 << 10)
-		if c.streamID == 0 {
-			utils.Debugf("Increasing receive flow control window for the connection to %d kB", newWindowSize)
-		} else {
-			utils.Debugf("Increasing receive flow control window increment for stream %d to %d kB", c.streamID, newWindowSize)
-		}
+// maybeAdjustWindowIncrementToBDP increases the receiveWindowIncrement if the bandwidth-delay product requires a larger window
+// The sending rate of the peer is estimated from the rate at which data was read during the last RTT, i.e. since the start of the epoch.
+// Since a WindowUpdate is sent when half of the window increment is used up, the increment has to be twice the BDP to not block the peer.
+func (c *flowController) maybeAdjustWindowIncrementToBDP(now time.Time) {
+	rtt := c.rttStats.SmoothedRTT()
+	if rtt == 0 {
+		return
+	}
+	elapsed := now.Sub(c.epochStartTime)
+	if elapsed < rtt {
+		return
+	}
+	bdp := protocol.ByteCount(float64(c.bytesRead-c.epochStartOffset) * float64(rtt) / float64(elapsed))
+	c.epochStartTime = now
+	c.epochStartOffset = c.bytesRead
+	c.setWindowIncrement(2 * bdp)
+}
+
+// setWindowIncrement increases the receiveWindowIncrement, up to the maxReceiveWindowIncrement
+func (c *flowController) setWindowIncrement(inc protocol.ByteCount) {
+	inc = utils.MinByteCount(inc, c.maxReceiveWindowIncrement)
+	if inc <= c.receiveWindowIncrement {
+		return
+	}
+	c.receiveWindowIncrement = inc
+
+	newWindowSize := c.receiveWindowIncrement / (1 << 10)
+	if c.streamID == 0 {
+		utils.Debugf("Increasing receive flow control window for the connection to %d kB", newWindowSize)
+	} else {
+		utils.Debugf("Increasing receive flow control window increment for stream %d to %d kB", c.streamID, newWindowSize)
+	}
+}
+
+// maybeShrinkWindowIncrement resets the receiveWindowIncrement to its initial value, if no data was read for a while
+// This releases the memory reserved for streams that are not used any more.
+// When data is read again, the increment grows again as fast as the sending rate requires.
+func (c *flowController) maybeShrinkWindowIncrement(now time.Time) {
+	if c.lastReadTime.IsZero() {
+		return
+	}
+	rtt := c.rttStats.SmoothedRTT()
+	if rtt == 0 || now.Sub(c.lastReadTime) < protocol.FlowControlIdleRTTs*rtt {
+		return
+	}
+	// start a new measurement epoch with the next read
+	c.lastReadTime = time.Time{}
+	c.epochStartTime = time.Time{}
+	if c.receiveWindowIncrement <= c.initialReceiveWindowIncrement {
+		return
+	}
+	c.receiveWindowIncrement = c.initialReceiveWindowIncrement
+	c.lastWindowUpdateIncrement = c.initialReceiveWindowIncrement
+	if c.streamID == 0 {
+		utils.Debugf("Resetting receive flow control window for the idle connection to %d kB", c.receiveWindowIncrement/(1<<10))
+	} else {
+		utils.Debugf("Resetting receive flow control window increment for idle stream %d to %d kB", c.streamID, c.receiveWindowIncrement/(1<<10))
 	}
 }
 
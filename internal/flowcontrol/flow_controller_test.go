@@ -6,6 +6,7 @@ import (
 	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -16,6 +17,7 @@ var _ = Describe("Flow controller", func() {
 	BeforeEach(func() {
 		controller = &flowController{}
 		controller.rttStats = &congestion.RTTStats{}
+		controller.clock = utils.DefaultClock{}
 	})
 
 	Context("Constructor", func() {
@@ -35,33 +37,33 @@ var _ = Describe("Flow controller", func() {
 		})
 
 		It("reads the stream send and receive windows when acting as stream-level flow controller", func() {
-			fc := newFlowController(5, true, mockPn, maxReceiveStreamWindow, rttStats)
+			fc := newFlowController(5, true, mockPn, maxReceiveStreamWindow, rttStats, utils.DefaultClock{})
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(protocol.ByteCount(2000)))
 			Expect(fc.maxReceiveWindowIncrement).To(Equal(maxReceiveStreamWindow))
 		})
 
 		It("reads the stream send and receive windows when acting as connection-level flow controller", func() {
-			fc := newFlowController(0, false, mockPn, maxReceiveConnectionWindow, rttStats)
+			fc := newFlowController(0, false, mockPn, maxReceiveConnectionWindow, rttStats, utils.DefaultClock{})
 			Expect(fc.streamID).To(Equal(protocol.StreamID(0)))
 			Expect(fc.receiveWindow).To(Equal(protocol.ByteCount(4000)))
 			Expect(fc.maxReceiveWindowIncrement).To(Equal(maxReceiveConnectionWindow))
 		})
 
 		It("does not set the stream flow control windows for sending", func() {
-			fc := newFlowController(5, true, mockPn, protocol.MaxByteCount, rttStats)
+			fc := newFlowController(5, true, mockPn, protocol.MaxByteCount, rttStats, utils.DefaultClock{})
 			Expect(fc.sendWindow).To(BeZero())
 		})
 
 		It("does not set the connection flow control windows for sending", func() {
-			fc := newFlowController(0, false, mockPn, protocol.MaxByteCount, rttStats)
+			fc := newFlowController(0, false, mockPn, protocol.MaxByteCount, rttStats, utils.DefaultClock{})
 			Expect(fc.sendWindow).To(BeZero())
 		})
 
 		It("says if it contributes to connection-level flow control", func() {
-			fc := newFlowController(1, false, mockPn, protocol.MaxByteCount, rttStats)
+			fc := newFlowController(1, false, mockPn, protocol.MaxByteCount, rttStats, utils.DefaultClock{})
 			Expect(fc.ContributesToConnection()).To(BeFalse())
-			fc = newFlowController(5, true, mockPn, protocol.MaxByteCount, rttStats)
+			fc = newFlowController(5, true, mockPn, protocol.MaxByteCount, rttStats, utils.DefaultClock{})
 			Expect(fc.ContributesToConnection()).To(BeTrue())
 		})
 	})
@@ -156,24 +158,20 @@ var _ = Describe("Flow controller", func() {
 		})
 
 		It("triggers a window update when necessary", func() {
-			controller.lastWindowUpdateTime = time.Now().Add(-time.Hour)
 			readPosition := receiveWindow - receiveWindowIncrement/2 + 1
 			controller.bytesRead = readPosition
 			updateNecessary, _, offset := controller.MaybeUpdateWindow()
 			Expect(updateNecessary).To(BeTrue())
 			Expect(offset).To(Equal(readPosition + receiveWindowIncrement))
 			Expect(controller.receiveWindow).To(Equal(readPosition + receiveWindowIncrement))
-			Expect(controller.lastWindowUpdateTime).To(BeTemporally("~", time.Now(), 20*time.Millisecond))
 		})
 
 		It("doesn't trigger a window update when not necessary", func() {
-			lastWindowUpdateTime := time.Now().Add(-time.Hour)
-			controller.lastWindowUpdateTime = lastWindowUpdateTime
 			readPosition := receiveWindow - receiveWindow/2 - 1
 			controller.bytesRead = readPosition
 			updateNecessary, _, _ := controller.MaybeUpdateWindow()
 			Expect(updateNecessary).To(BeFalse())
-			Expect(controller.lastWindowUpdateTime).To(Equal(lastWindowUpdateTime))
+			Expect(controller.receiveWindow).To(Equal(receiveWindow))
 		})
 
 		It("updates the highestReceived", func() {
@@ -216,11 +214,20 @@ var _ = Describe("Flow controller", func() {
 		})
 
 		Context("receive window increment auto-tuning", func() {
-			var oldIncrement protocol.ByteCount
+			var (
+				oldIncrement protocol.ByteCount
+				clock        *utils.VirtualClock
+				start        time.Time
+			)
 
 			BeforeEach(func() {
 				oldIncrement = controller.receiveWindowIncrement
+				controller.initialReceiveWindowIncrement = oldIncrement
+				controller.lastWindowUpdateIncrement = oldIncrement
 				controller.maxReceiveWindowIncrement = 3000
+				start = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+				clock = utils.NewVirtualClock(start)
+				controller.clock = clock
 			})
 
 			// update the congestion such that it returns a given value for the smoothed RTT
@@ -229,83 +236,180 @@ var _ = Describe("Flow controller", func() {
 				Expect(controller.rttStats.SmoothedRTT()).To(Equal(t)) // make sure it worked
 			}
 
-			It("doesn't increase the increment for a new stream", func() {
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
-			})
+			// read reads n bytes, evenly spaced over the duration d
+			read := func(n protocol.ByteCount, d time.Duration) {
+				const steps = 10
+				for i := 0; i < steps; i++ {
+					controller.AddBytesRead(n / steps)
+					clock.AdvanceTo(clock.Now().Add(d / steps))
+				}
+			}
 
 			It("doesn't increase the increment when no RTT estimate is available", func() {
-				setRtt(0)
-				controller.lastWindowUpdateTime = time.Now()
+				read(5000, 10*time.Millisecond)
+				controller.lastWindowUpdateTime = clock.Now()
 				controller.maybeAdjustWindowIncrement()
 				Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
 			})
 
-			It("increases the increment when the last WindowUpdate was sent less than two RTTs ago", func() {
-				setRtt(20 * time.Millisecond)
-				controller.lastWindowUpdateTime = time.Now().Add(-35 * time.Millisecond)
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(2 * oldIncrement))
-			})
+			Context("estimating the bandwidth-delay product", func() {
+				BeforeEach(func() {
+					setRtt(20 * time.Millisecond)
+				})
 
-			It("doesn't increase the increase increment when the last WindowUpdate was sent more than two RTTs ago", func() {
-				setRtt(20 * time.Millisecond)
-				controller.lastWindowUpdateTime = time.Now().Add(-45 * time.Millisecond)
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
-			})
+				It("doesn't increase the increment before one RTT has passed", func() {
+					read(1000, 15*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
 
-			It("doesn't increase the increment to a value higher than the maxReceiveWindowIncrement", func() {
-				setRtt(20 * time.Millisecond)
-				controller.lastWindowUpdateTime = time.Now().Add(-35 * time.Millisecond)
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(2 * oldIncrement)) // 1200
-				// because the lastWindowUpdateTime is updated by MaybeTriggerWindowUpdate(), we can just call maybeAdjustWindowIncrement() multiple times and get an increase of the increment every time
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(2 * 2 * oldIncrement)) // 2400
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(controller.maxReceiveWindowIncrement)) // 3000
-				controller.maybeAdjustWindowIncrement()
-				Expect(controller.receiveWindowIncrement).To(Equal(controller.maxReceiveWindowIncrement)) // 3000
-			})
+				It("sets the increment to twice the bandwidth-delay product", func() {
+					// 2000 bytes per 40 ms is 1000 bytes per RTT
+					read(2000, 40*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(2000)))
+				})
 
-			It("returns the new increment when updating the window", func() {
-				setRtt(20 * time.Millisecond)
-				controller.AddBytesRead(9900) // receive window is 10000
-				controller.lastWindowUpdateTime = time.Now().Add(-35 * time.Millisecond)
-				necessary, newIncrement, offset := controller.MaybeUpdateWindow()
-				Expect(necessary).To(BeTrue())
-				Expect(newIncrement).To(Equal(2 * oldIncrement))
-				Expect(controller.receiveWindowIncrement).To(Equal(newIncrement))
-				Expect(offset).To(Equal(protocol.ByteCount(9900 + newIncrement)))
-			})
+				It("doesn't decrease the increment when data is read slowly", func() {
+					read(250, 100*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
 
-			It("increases the increment sent in the first WindowUpdate, if data is read fast enough", func() {
-				setRtt(20 * time.Millisecond)
-				controller.AddBytesRead(9900)
-				necessary, newIncrement, _ := controller.MaybeUpdateWindow()
-				Expect(necessary).To(BeTrue())
-				Expect(newIncrement).To(Equal(2 * oldIncrement))
+				It("increases the increment when the sending rate increases, up to the maxReceiveWindowIncrement", func() {
+					// the estimate for one epoch is updated with the first read of the next epoch
+					read(oldIncrement, 20*time.Millisecond)
+					read(2*oldIncrement, 20*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(2 * oldIncrement)) // 1200
+					read(4*oldIncrement, 20*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(4 * oldIncrement)) // 2400
+					read(4*oldIncrement, 20*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(controller.maxReceiveWindowIncrement)) // 3000
+				})
+
+				It("counts all data read at the same time in the same epoch", func() {
+					controller.AddBytesRead(500)
+					clock.AdvanceTo(clock.Now().Add(20 * time.Millisecond))
+					controller.AddBytesRead(100)
+					Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(1000)))
+					// this read happens at the same time, and belongs to the next epoch
+					controller.AddBytesRead(500)
+					Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(1000)))
+				})
+
+				It("returns the new increment when updating the window", func() {
+					controller.bytesRead = 7200
+					// 900 bytes per RTT
+					read(2700, 60*time.Millisecond) // receive window is 10000
+					necessary, newIncrement, offset := controller.MaybeUpdateWindow()
+					Expect(necessary).To(BeTrue())
+					Expect(newIncrement).To(Equal(protocol.ByteCount(2 * 900)))
+					Expect(controller.receiveWindowIncrement).To(Equal(newIncrement))
+					Expect(offset).To(Equal(protocol.ByteCount(9900 + newIncrement)))
+				})
+
+				It("only returns the increment if it was increased since the last window update", func() {
+					controller.bytesRead = 7200
+					read(2700, 60*time.Millisecond) // receive window is 10000
+					necessary, newIncrement, _ := controller.MaybeUpdateWindow()
+					Expect(necessary).To(BeTrue())
+					Expect(newIncrement).ToNot(BeZero())
+					clock.AdvanceTo(clock.Now().Add(100 * time.Millisecond))
+					controller.AddBytesRead(2 * 900)
+					necessary, newIncrement, offset := controller.MaybeUpdateWindow()
+					Expect(necessary).To(BeTrue())
+					Expect(newIncrement).To(BeZero())
+					Expect(offset).To(Equal(protocol.ByteCount(9900 + 2*900 + 2*900)))
+				})
 			})
 
-			It("doesn't increamse the increment sent in the first WindowUpdate, if data is read slowly", func() {
-				setRtt(5 * time.Millisecond)
-				controller.AddBytesRead(9900)
-				time.Sleep(15 * time.Millisecond) // more than 2x RTT
-				necessary, newIncrement, _ := controller.MaybeUpdateWindow()
-				Expect(necessary).To(BeTrue())
-				Expect(newIncrement).To(BeZero())
+			Context("when the peer is blocked by flow control", func() {
+				It("doesn't increase the increment for a new stream", func() {
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
+
+				It("increases the increment when the last WindowUpdate was sent less than two RTTs ago", func() {
+					setRtt(20 * time.Millisecond)
+					controller.lastWindowUpdateTime = clock.Now().Add(-35 * time.Millisecond)
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(2 * oldIncrement))
+				})
+
+				It("doesn't increase the increase increment when the last WindowUpdate was sent more than two RTTs ago", func() {
+					setRtt(20 * time.Millisecond)
+					controller.lastWindowUpdateTime = clock.Now().Add(-45 * time.Millisecond)
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
+
+				It("doesn't increase the increment to a value higher than the maxReceiveWindowIncrement", func() {
+					setRtt(20 * time.Millisecond)
+					controller.lastWindowUpdateTime = clock.Now().Add(-35 * time.Millisecond)
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(2 * oldIncrement)) // 1200
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(2 * 2 * oldIncrement)) // 2400
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(controller.maxReceiveWindowIncrement)) // 3000
+					controller.maybeAdjustWindowIncrement()
+					Expect(controller.receiveWindowIncrement).To(Equal(controller.maxReceiveWindowIncrement)) // 3000
+				})
+
+				It("increases the increment sent in the first WindowUpdate, if data is read fast enough", func() {
+					setRtt(20 * time.Millisecond)
+					controller.AddBytesRead(9900)
+					necessary, newIncrement, _ := controller.MaybeUpdateWindow()
+					Expect(necessary).To(BeTrue())
+					Expect(newIncrement).To(Equal(2 * oldIncrement))
+				})
+
+				It("doesn't increase the increment sent in the first WindowUpdate, if data is read slowly", func() {
+					setRtt(20 * time.Millisecond)
+					controller.AddBytesRead(9900)
+					clock.AdvanceTo(clock.Now().Add(45 * time.Millisecond)) // more than 2x RTT
+					necessary, newIncrement, offset := controller.MaybeUpdateWindow()
+					Expect(necessary).To(BeTrue())
+					Expect(newIncrement).To(BeZero())
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+					Expect(offset).To(Equal(protocol.ByteCount(9900 + oldIncrement)))
+				})
 			})
 
-			It("only returns the increment if it was increased", func() {
-				setRtt(20 * time.Millisecond)
-				controller.AddBytesRead(9900) // receive window is 10000
-				controller.lastWindowUpdateTime = time.Now().Add(-45 * time.Millisecond)
-				necessary, newIncrement, offset := controller.MaybeUpdateWindow()
-				Expect(necessary).To(BeTrue())
-				Expect(newIncrement).To(BeZero())
-				Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
-				Expect(offset).To(Equal(protocol.ByteCount(9900 + oldIncrement)))
+			Context("idle streams", func() {
+				BeforeEach(func() {
+					setRtt(20 * time.Millisecond)
+					read(2000, 40*time.Millisecond)
+					Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(2000)))
+				})
+
+				It("resets the increment when no data was read for a while", func() {
+					clock.AdvanceTo(controller.lastReadTime.Add(protocol.FlowControlIdleRTTs * 20 * time.Millisecond))
+					controller.AddBytesRead(1)
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
+
+				It("doesn't reset the increment before the stream is idle", func() {
+					clock.AdvanceTo(controller.lastReadTime.Add(protocol.FlowControlIdleRTTs*20*time.Millisecond - time.Millisecond))
+					controller.AddBytesRead(1)
+					Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(2000)))
+				})
+
+				It("resets the increment without reading", func() {
+					clock.AdvanceTo(clock.Now().Add(time.Minute))
+					controller.maybeShrinkWindowIncrement(clock.Now())
+					Expect(controller.receiveWindowIncrement).To(Equal(oldIncrement))
+				})
+
+				It("returns the increment in the next window update, when it grows again", func() {
+					clock.AdvanceTo(clock.Now().Add(50 * time.Millisecond)) // don't double the increment
+					controller.bytesRead = controller.receiveWindow
+					_, newIncrement, _ := controller.MaybeUpdateWindow()
+					Expect(newIncrement).To(Equal(protocol.ByteCount(2000)))
+					clock.AdvanceTo(clock.Now().Add(time.Minute))
+					read(2000, 40*time.Millisecond)
+					Expect(controller.lastWindowUpdateIncrement).To(Equal(oldIncrement))
+					controller.bytesRead = controller.receiveWindow
+					_, newIncrement, _ = controller.MaybeUpdateWindow()
+					Expect(newIncrement).To(Equal(protocol.ByteCount(2000)))
+				})
 			})
 
 			Context("setting the minimum increment", func() {
@@ -328,14 +432,73 @@ var _ = Describe("Flow controller", func() {
 				It("doesn't auto-tune the window after the increment was increased", func() {
 					setRtt(20 * time.Millisecond)
 					controller.bytesRead = 9900 // receive window is 10000
-					controller.lastWindowUpdateTime = time.Now().Add(-20 * time.Millisecond)
+					controller.lastWindowUpdateTime = clock.Now().Add(-20 * time.Millisecond)
 					controller.EnsureMinimumWindowIncrement(912)
 					necessary, newIncrement, offset := controller.MaybeUpdateWindow()
 					Expect(necessary).To(BeTrue())
-					Expect(newIncrement).To(BeZero()) // no auto-tuning
+					Expect(newIncrement).To(Equal(protocol.ByteCount(912))) // no auto-tuning
 					Expect(offset).To(Equal(protocol.ByteCount(9900 + 912)))
 				})
 			})
 		})
+
+		Context("memory budget", func() {
+			var budget *MemoryBudget
+
+			BeforeEach(func() {
+				controller.bytesRead = 9500
+				controller.receiveWindowIncrement = 1200
+				controller.initialReceiveWindowIncrement = 600
+				controller.maxReceiveWindowIncrement = 3000
+				budget = NewMemoryBudget(2000, nil)
+				controller.setBudget(budget)
+			})
+
+			It("reserves the memory for the current window", func() {
+				Expect(controller.reserved).To(Equal(protocol.ByteCount(500)))
+				Expect(budget.Used()).To(Equal(protocol.ByteCount(500)))
+			})
+
+			It("releases memory when data is read", func() {
+				controller.AddBytesRead(100)
+				Expect(controller.reserved).To(Equal(protocol.ByteCount(400)))
+				Expect(budget.Used()).To(Equal(protocol.ByteCount(400)))
+			})
+
+			It("reserves memory before increasing the window", func() {
+				controller.AddBytesRead(200)
+				necessary, _, offset := controller.MaybeUpdateWindow()
+				Expect(necessary).To(BeTrue())
+				Expect(offset).To(Equal(protocol.ByteCount(9700 + 1200)))
+				Expect(budget.Used()).To(Equal(protocol.ByteCount(1200)))
+			})
+
+			It("limits the increment to the available memory, but always grants the initial increment", func() {
+				budget.forceReserve(1500)
+				controller.AddBytesRead(200)
+				necessary, _, offset := controller.MaybeUpdateWindow()
+				Expect(necessary).To(BeTrue())
+				Expect(offset).To(Equal(protocol.ByteCount(9700 + 600)))
+				Expect(controller.receiveWindowIncrement).To(Equal(protocol.ByteCount(600)))
+				Expect(budget.Used()).To(Equal(protocol.ByteCount(1500 + 600)))
+			})
+
+			It("limits the increment to the fair share of the budget", func() {
+				budget.addUser()
+				controller.AddBytesRead(200)
+				necessary, _, offset := controller.MaybeUpdateWindow()
+				Expect(necessary).To(BeTrue())
+				Expect(offset).To(Equal(protocol.ByteCount(9700 + 1000)))
+				Expect(budget.Used()).To(Equal(protocol.ByteCount(1000)))
+			})
+
+			It("returns the memory to the budget", func() {
+				controller.releaseBudget()
+				Expect(budget.Used()).To(BeZero())
+				Expect(budget.users).To(BeZero())
+				controller.AddBytesRead(100) // must not release memory a second time
+				Expect(budget.Used()).To(BeZero())
+			})
+		})
 	})
 })
@@ -18,6 +18,7 @@ type FlowControlManager interface {
 	AddBytesRead(streamID protocol.StreamID, n protocol.ByteCount) error
 	GetWindowUpdates() []WindowUpdate
 	GetReceiveWindow(streamID protocol.StreamID) (protocol.ByteCount, error)
+	GetReceiveWindowIncrement(streamID protocol.StreamID) (protocol.ByteCount, error)
 	// methods needed for sending data
 	AddBytesSent(streamID protocol.StreamID, n protocol.ByteCount) error
 	SendWindowSize(streamID protocol.StreamID) (protocol.ByteCount, error)
@@ -0,0 +1,108 @@
+package flowcontrol
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A MemoryBudget limits the memory used for buffering received data.
+// Memory is reserved before a flow control window is advertised, and released when the data is read.
+// Budgets can be nested: the budget of a session draws from the budget of the listener.
+// Every user of a budget (a stream, or a session in case of the listener budget) may only use its fair share of the budget.
+type MemoryBudget struct {
+	mutex sync.Mutex
+
+	parent *MemoryBudget
+	max    protocol.ByteCount // 0 means that the budget is unlimited
+	used   protocol.ByteCount
+	users  int
+}
+
+// NewMemoryBudget creates a new memory budget
+// if max is 0, only the limits of the parent (which may be nil) apply
+func NewMemoryBudget(max protocol.ByteCount, parent *MemoryBudget) *MemoryBudget {
+	if parent != nil {
+		parent.addUser()
+	}
+	return &MemoryBudget{
+		parent: parent,
+		max:    max,
+	}
+}
+
+// Used returns the number of bytes currently reserved
+func (b *MemoryBudget) Used() protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.used
+}
+
+// Close returns all memory reserved by this budget to its parent
+func (b *MemoryBudget) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.parent == nil {
+		return
+	}
+	b.parent.release(b.used)
+	b.parent.removeUser()
+	b.parent = nil
+}
+
+func (b *MemoryBudget) addUser() {
+	b.mutex.Lock()
+	b.users++
+	b.mutex.Unlock()
+}
+
+func (b *MemoryBudget) removeUser() {
+	b.mutex.Lock()
+	b.users--
+	b.mutex.Unlock()
+}
+
+// reserve reserves up to n bytes for a user that already holds held bytes
+// it returns the number of bytes that were reserved
+func (b *MemoryBudget) reserve(n, held protocol.ByteCount) protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.max != 0 {
+		fairShare := b.max / protocol.ByteCount(utils.Max(b.users, 1))
+		if held >= fairShare || b.used >= b.max {
+			return 0
+		}
+		n = utils.MinByteCount(n, utils.MinByteCount(fairShare-held, b.max-b.used))
+	}
+	if b.parent != nil {
+		n = b.parent.reserve(n, b.used)
+	}
+	b.used += n
+	return n
+}
+
+// forceReserve reserves n bytes, even if this exceeds the budget
+// it is used for memory that was already promised to the peer, e.g. the initial flow control window
+func (b *MemoryBudget) forceReserve(n protocol.ByteCount) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.parent != nil {
+		b.parent.forceReserve(n)
+	}
+	b.used += n
+}
+
+func (b *MemoryBudget) release(n protocol.ByteCount) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	n = utils.MinByteCount(n, b.used)
+	if b.parent != nil {
+		b.parent.release(n)
+	}
+	b.used -= n
+}
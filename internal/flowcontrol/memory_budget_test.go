@@ -0,0 +1,113 @@
+package flowcontrol
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory budget", func() {
+	It("doesn't limit reservations if no maximum is set", func() {
+		b := NewMemoryBudget(0, nil)
+		b.addUser()
+		Expect(b.reserve(protocol.MaxByteCount/2, 0)).To(Equal(protocol.MaxByteCount / 2))
+		Expect(b.Used()).To(Equal(protocol.MaxByteCount / 2))
+	})
+
+	It("limits reservations", func() {
+		b := NewMemoryBudget(1000, nil)
+		b.addUser()
+		Expect(b.reserve(600, 0)).To(Equal(protocol.ByteCount(600)))
+		Expect(b.reserve(600, 600)).To(Equal(protocol.ByteCount(400)))
+		Expect(b.reserve(600, 1000)).To(BeZero())
+		Expect(b.Used()).To(Equal(protocol.ByteCount(1000)))
+	})
+
+	It("limits every user to its fair share", func() {
+		b := NewMemoryBudget(1000, nil)
+		b.addUser()
+		b.addUser()
+		Expect(b.reserve(600, 0)).To(Equal(protocol.ByteCount(500)))
+		Expect(b.reserve(100, 500)).To(BeZero())
+		Expect(b.reserve(600, 0)).To(Equal(protocol.ByteCount(500)))
+		b.removeUser()
+		Expect(b.Used()).To(Equal(protocol.ByteCount(1000)))
+	})
+
+	It("forces reservations beyond the budget", func() {
+		b := NewMemoryBudget(1000, nil)
+		b.forceReserve(1500)
+		Expect(b.Used()).To(Equal(protocol.ByteCount(1500)))
+		Expect(b.reserve(100, 0)).To(BeZero())
+	})
+
+	It("releases memory", func() {
+		b := NewMemoryBudget(1000, nil)
+		b.addUser()
+		Expect(b.reserve(1000, 0)).To(Equal(protocol.ByteCount(1000)))
+		b.release(300)
+		Expect(b.Used()).To(Equal(protocol.ByteCount(700)))
+		Expect(b.reserve(1000, 700)).To(Equal(protocol.ByteCount(300)))
+	})
+
+	It("doesn't release more memory than was reserved", func() {
+		b := NewMemoryBudget(1000, nil)
+		b.forceReserve(100)
+		b.release(200)
+		Expect(b.Used()).To(BeZero())
+	})
+
+	Context("nested budgets", func() {
+		var parent *MemoryBudget
+
+		BeforeEach(func() {
+			parent = NewMemoryBudget(1000, nil)
+		})
+
+		It("registers with the parent", func() {
+			NewMemoryBudget(0, parent)
+			NewMemoryBudget(0, parent)
+			Expect(parent.users).To(Equal(2))
+		})
+
+		It("reserves memory from the parent", func() {
+			b := NewMemoryBudget(0, parent)
+			b.addUser()
+			Expect(b.reserve(600, 0)).To(Equal(protocol.ByteCount(600)))
+			Expect(b.Used()).To(Equal(protocol.ByteCount(600)))
+			Expect(parent.Used()).To(Equal(protocol.ByteCount(600)))
+			b.forceReserve(100)
+			Expect(parent.Used()).To(Equal(protocol.ByteCount(700)))
+			b.release(200)
+			Expect(parent.Used()).To(Equal(protocol.ByteCount(500)))
+		})
+
+		It("applies the limits of the parent", func() {
+			b := NewMemoryBudget(2000, parent)
+			b.addUser()
+			Expect(b.reserve(1500, 0)).To(Equal(protocol.ByteCount(1000)))
+			Expect(b.Used()).To(Equal(protocol.ByteCount(1000)))
+		})
+
+		It("limits every child to its fair share of the parent", func() {
+			b1 := NewMemoryBudget(0, parent)
+			b1.addUser()
+			NewMemoryBudget(0, parent)
+			Expect(b1.reserve(1000, 0)).To(Equal(protocol.ByteCount(500)))
+		})
+
+		It("returns the memory to the parent when closed", func() {
+			b1 := NewMemoryBudget(0, parent)
+			b1.addUser()
+			b2 := NewMemoryBudget(0, parent)
+			b2.addUser()
+			Expect(b1.reserve(1000, 0)).To(Equal(protocol.ByteCount(500)))
+			b1.Close()
+			Expect(parent.Used()).To(BeZero())
+			Expect(parent.users).To(Equal(1))
+			Expect(b2.reserve(1000, 0)).To(Equal(protocol.ByteCount(1000)))
+			b1.Close() // closing a second time has no effect
+			Expect(parent.users).To(Equal(1))
+		})
+	})
+})
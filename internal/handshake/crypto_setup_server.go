@@ -74,11 +74,6 @@ func NewCryptoSetup(
 	acceptSTK func(net.Addr, *Cookie) bool,
 	aeadChanged chan<- protocol.EncryptionLevel,
 ) (CryptoSetup, ParamsNegotiator, error) {
-	stkGenerator, err := NewCookieGenerator()
-	if err != nil {
-		return nil, nil, err
-	}
-
 	pn := newParamsNegotiatorGQUIC(protocol.PerspectiveServer, version, params)
 	return &cryptoSetupServer{
 		connID:            connID,
@@ -86,7 +81,7 @@ func NewCryptoSetup(
 		version:           version,
 		supportedVersions: supportedVersions,
 		scfg:              scfg,
-		stkGenerator:      stkGenerator,
+		stkGenerator:      scfg.cookieGenerator,
 		keyDerivation:     crypto.DeriveQuicCryptoAESKeys,
 		keyExchange:       getEphermalKEX,
 		nullAEAD:          crypto.NewNullAEAD(protocol.PerspectiveServer, version),
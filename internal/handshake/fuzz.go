@@ -0,0 +1,33 @@
+// +build gofuzz
+
+package handshake
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// FuzzHandshakeMessage is an entry point for go-fuzz (https://github.com/dvyukov/go-fuzz).
+// To run it, use
+//   go-fuzz-build -func FuzzHandshakeMessage github.com/lucas-clemente/quic-go/internal/handshake
+//   go-fuzz -bin handshake-fuzz.zip -workdir fuzzing/handshake
+// The seed corpus can be generated by running the tests with the gofuzz build tag, see fuzz_test.go.
+//
+// Every message that can be parsed is written again, and the result has to be parsed to the same message.
+func FuzzHandshakeMessage(data []byte) int {
+	msg, err := ParseHandshakeMessage(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	b := &bytes.Buffer{}
+	msg.Write(b)
+	msg2, err := ParseHandshakeMessage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse the written handshake message: %s", err))
+	}
+	if !reflect.DeepEqual(msg, msg2) {
+		panic(fmt.Sprintf("handshake messages not equal: %s vs. %s", msg, msg2))
+	}
+	return 1
+}
@@ -0,0 +1,51 @@
+// +build gofuzz
+
+package handshake
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fuzzing", func() {
+	// the seeds are taken from the test vectors of the parser tests
+	getSeeds := func() [][]byte {
+		shlo := &bytes.Buffer{}
+		HandshakeMessage{
+			Tag: TagSHLO,
+			Data: map[Tag][]byte{
+				TagAEAD: []byte("foobar"),
+				TagEXPY: []byte("raboof"),
+			},
+		}.Write(shlo)
+		return [][]byte{
+			sampleCHLO,
+			shlo.Bytes(),
+			[]byte("CHLO\x00\x00\x00\x00"),
+		}
+	}
+
+	It("parses and writes the seeds", func() {
+		for _, seed := range getSeeds() {
+			Expect(FuzzHandshakeMessage(seed)).To(Equal(1))
+		}
+	})
+
+	It("writes the seed corpus", func() {
+		dir := os.Getenv("QUIC_GO_FUZZ_CORPUS")
+		if dir == "" {
+			Skip("QUIC_GO_FUZZ_CORPUS not set")
+		}
+		dir = filepath.Join(dir, "handshake", "corpus")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		for i, seed := range getSeeds() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("seed-%d", i)), seed, 0644)).To(Succeed())
+		}
+	})
+})
@@ -30,4 +30,6 @@ type CryptoSetup interface {
 type TransportParameters struct {
 	RequestConnectionIDOmission bool
 	IdleTimeout                 time.Duration
+	MaxPacketSize               protocol.ByteCount // the largest packet that will be accepted, only sent in the TLS handshake
+	MaxDatagramFrameSize        protocol.ByteCount // the largest DATAGRAM frame that will be accepted, 0 if datagrams are not supported
 }
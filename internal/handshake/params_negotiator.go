@@ -63,6 +63,25 @@ func (h *paramsNegotiator) SetFromTransportParameters(params []transportParamete
 				return fmt.Errorf("wrong length for idle_timeout: %d (expected 2)", len(p.Value))
 			}
 			h.setRemoteIdleTimeout(time.Duration(binary.BigEndian.Uint16(p.Value)) * time.Second)
+		case maxPacketSizeParameterID:
+			if len(p.Value) != 2 {
+				return fmt.Errorf("wrong length for max_packet_size: %d (expected 2)", len(p.Value))
+			}
+			maxPacketSize := protocol.ByteCount(binary.BigEndian.Uint16(p.Value))
+			if maxPacketSize < protocol.MinPacketSize {
+				return fmt.Errorf("invalid value for max_packet_size: %d (minimum %d)", maxPacketSize, protocol.MinPacketSize)
+			}
+			h.remoteMaxPacketSize = maxPacketSize
+		case maxDatagramFrameSizeParameterID:
+			if len(p.Value) != 2 {
+				return fmt.Errorf("wrong length for max_datagram_frame_size: %d (expected 2)", len(p.Value))
+			}
+			h.remoteMaxDatagramFrameSize = protocol.ByteCount(binary.BigEndian.Uint16(p.Value))
+		case applicationCloseParameterID:
+			if len(p.Value) != 0 {
+				return fmt.Errorf("wrong length for application_close: %d (expected empty)", len(p.Value))
+			}
+			h.remoteSupportsApplicationClose = true
 		case omitConnectionIDParameterID:
 			if len(p.Value) != 0 {
 				return fmt.Errorf("wrong length for omit_connection_id: %d (expected empty)", len(p.Value))
@@ -88,19 +107,25 @@ func (h *paramsNegotiator) GetTransportParameters() []transportParameter {
 	idleTimeout := make([]byte, 2)
 	binary.BigEndian.PutUint16(idleTimeout, uint16(h.idleTimeout))
 	maxPacketSize := make([]byte, 2)
-	binary.BigEndian.PutUint16(maxPacketSize, uint16(protocol.MaxReceivePacketSize))
+	binary.BigEndian.PutUint16(maxPacketSize, uint16(h.maxPacketSize))
 	params := []transportParameter{
 		{initialMaxStreamDataParameterID, initialMaxStreamData},
 		{initialMaxDataParameterID, initialMaxData},
 		{initialMaxStreamIDParameterID, initialMaxStreamID},
 		{idleTimeoutParameterID, idleTimeout},
 		{maxPacketSizeParameterID, maxPacketSize},
+		{applicationCloseParameterID, []byte{}},
 	}
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 	if h.omitConnectionID {
 		params = append(params, transportParameter{omitConnectionIDParameterID, []byte{}})
 	}
+	if h.maxDatagramFrameSize > 0 {
+		maxDatagramFrameSize := make([]byte, 2)
+		binary.BigEndian.PutUint16(maxDatagramFrameSize, uint16(h.maxDatagramFrameSize))
+		params = append(params, transportParameter{maxDatagramFrameSizeParameterID, maxDatagramFrameSize})
+	}
 	return params
 }
 
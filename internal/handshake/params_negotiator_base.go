@@ -19,6 +19,12 @@ type ParamsNegotiator interface {
 	GetMaxIncomingStreams() uint32
 	// get the idle timeout that was sent by the peer
 	GetRemoteIdleTimeout() time.Duration
+	// get the maximum packet size that the peer accepts
+	GetRemoteMaxPacketSize() protocol.ByteCount
+	// get the maximum size of a DATAGRAM frame that the peer accepts, 0 if the peer doesn't support datagrams
+	GetRemoteMaxDatagramFrameSize() protocol.ByteCount
+	// determines if the peer supports APPLICATION_CLOSE frames
+	RemoteSupportsApplicationClose() bool
 	// determines if the client requests omission of connection IDs.
 	OmitConnectionID() bool
 }
@@ -44,6 +50,11 @@ type paramsNegotiatorBase struct {
 	maxIncomingDynamicStreamsPerConnection uint32
 	idleTimeout                            time.Duration
 	remoteIdleTimeout                      time.Duration
+	maxPacketSize                          protocol.ByteCount
+	remoteMaxPacketSize                    protocol.ByteCount
+	maxDatagramFrameSize                   protocol.ByteCount
+	remoteMaxDatagramFrameSize             protocol.ByteCount
+	remoteSupportsApplicationClose         bool
 	sendStreamFlowControlWindow            protocol.ByteCount
 	sendConnectionFlowControlWindow        protocol.ByteCount
 	receiveStreamFlowControlWindow         protocol.ByteCount
@@ -58,6 +69,10 @@ func (h *paramsNegotiatorBase) init(params *TransportParameters) {
 	h.requestConnectionIDOmission = params.RequestConnectionIDOmission
 
 	h.idleTimeout = params.IdleTimeout
+	h.maxPacketSize = utils.MaxByteCount(params.MaxPacketSize, protocol.MaxReceivePacketSize)
+	// Peers that don't announce a maximum packet size might not be able to receive packets larger than the standard size.
+	h.remoteMaxPacketSize = protocol.MaxReceivePacketSize
+	h.maxDatagramFrameSize = params.MaxDatagramFrameSize
 	if h.perspective == protocol.PerspectiveServer {
 		h.maxStreamsPerConnection = protocol.MaxStreamsPerConnection                // this is the value negotiated based on what the client sent
 		h.maxIncomingDynamicStreamsPerConnection = protocol.MaxStreamsPerConnection // "incoming" seen from the client's perspective
@@ -126,3 +141,21 @@ func (h *paramsNegotiatorBase) GetRemoteIdleTimeout() time.Duration {
 	defer h.mutex.RUnlock()
 	return h.remoteIdleTimeout
 }
+
+func (h *paramsNegotiatorBase) GetRemoteMaxPacketSize() protocol.ByteCount {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.remoteMaxPacketSize
+}
+
+func (h *paramsNegotiatorBase) GetRemoteMaxDatagramFrameSize() protocol.ByteCount {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.remoteMaxDatagramFrameSize
+}
+
+func (h *paramsNegotiatorBase) RemoteSupportsApplicationClose() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.remoteSupportsApplicationClose
+}
@@ -83,6 +83,23 @@ func (h *paramsNegotiatorGQUIC) SetFromMap(params map[Tag][]byte) error {
 		}
 		h.sendConnectionFlowControlWindow = protocol.ByteCount(sendConnectionFlowControlWindow)
 	}
+	if value, ok := params[TagMDFS]; ok {
+		maxDatagramFrameSize, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
+		if err != nil {
+			return errMalformedTag
+		}
+		h.remoteMaxDatagramFrameSize = protocol.ByteCount(maxDatagramFrameSize)
+	}
+	if value, ok := params[TagMPSZ]; ok {
+		maxPacketSize, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
+		if err != nil || protocol.ByteCount(maxPacketSize) < protocol.MinPacketSize {
+			return errMalformedTag
+		}
+		h.remoteMaxPacketSize = protocol.ByteCount(maxPacketSize)
+	}
+	if _, ok := params[TagAPCL]; ok {
+		h.remoteSupportsApplicationClose = true
+	}
 
 	_, containsSFCW := params[TagSFCW]
 	_, containsCFCW := params[TagCFCW]
@@ -105,14 +122,24 @@ func (h *paramsNegotiatorGQUIC) GetHelloMap() (map[Tag][]byte, error) {
 	utils.LittleEndian.WriteUint32(mids, protocol.MaxIncomingDynamicStreamsPerConnection)
 	icsl := bytes.NewBuffer([]byte{})
 	utils.LittleEndian.WriteUint32(icsl, uint32(h.idleTimeout/time.Second))
+	mpsz := bytes.NewBuffer([]byte{})
+	utils.LittleEndian.WriteUint32(mpsz, uint32(h.maxPacketSize))
 
-	return map[Tag][]byte{
+	params := map[Tag][]byte{
 		TagICSL: icsl.Bytes(),
 		TagMSPC: mspc.Bytes(),
 		TagMIDS: mids.Bytes(),
 		TagCFCW: cfcw.Bytes(),
 		TagSFCW: sfcw.Bytes(),
-	}, nil
+		TagMPSZ: mpsz.Bytes(),
+		TagAPCL: {},
+	}
+	if h.maxDatagramFrameSize > 0 {
+		mdfs := bytes.NewBuffer([]byte{})
+		utils.LittleEndian.WriteUint32(mdfs, uint32(h.maxDatagramFrameSize))
+		params[TagMDFS] = mdfs.Bytes()
+	}
+	return params, nil
 }
 
 func (h *paramsNegotiatorGQUIC) OmitConnectionID() bool {
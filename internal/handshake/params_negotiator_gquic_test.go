@@ -222,6 +222,82 @@ var _ = Describe("Params Negotiator (for gQUIC)", func() {
 		})
 	})
 
+	Context("datagrams", func() {
+		It("doesn't send the maximum DATAGRAM frame size, if datagrams are disabled", func() {
+			entryMap, err := pnClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).ToNot(HaveKey(TagMDFS))
+		})
+
+		It("sends the maximum DATAGRAM frame size", func() {
+			pnClient = newParamsNegotiatorGQUIC(
+				protocol.PerspectiveClient,
+				protocol.VersionWhatever,
+				&TransportParameters{MaxDatagramFrameSize: 0x1234},
+			)
+			entryMap, err := pnClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).To(HaveKeyWithValue(TagMDFS, []byte{0x34, 0x12, 0, 0}))
+		})
+
+		It("reads the maximum DATAGRAM frame size of the peer", func() {
+			Expect(pn.GetRemoteMaxDatagramFrameSize()).To(BeZero())
+			err := pn.SetFromMap(map[Tag][]byte{TagMDFS: {0x34, 0x12, 0, 0}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.GetRemoteMaxDatagramFrameSize()).To(Equal(protocol.ByteCount(0x1234)))
+		})
+
+		It("errors when given an invalid value", func() {
+			err := pn.SetFromMap(map[Tag][]byte{TagMDFS: {0x34, 0x12, 0}}) // 1 byte too short
+			Expect(err).To(MatchError(errMalformedTag))
+		})
+	})
+
+	Context("maximum packet size", func() {
+		It("sends the maximum packet size", func() {
+			pnClient = newParamsNegotiatorGQUIC(
+				protocol.PerspectiveClient,
+				protocol.VersionWhatever,
+				&TransportParameters{MaxPacketSize: 0x1234},
+			)
+			entryMap, err := pnClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).To(HaveKeyWithValue(TagMPSZ, []byte{0x34, 0x12, 0, 0}))
+		})
+
+		It("assumes the standard packet size if the peer doesn't announce a maximum packet size", func() {
+			err := pn.SetFromMap(map[Tag][]byte{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.GetRemoteMaxPacketSize()).To(Equal(protocol.MaxReceivePacketSize))
+		})
+
+		It("reads the maximum packet size of the peer", func() {
+			err := pn.SetFromMap(map[Tag][]byte{TagMPSZ: {0x34, 0x12, 0, 0}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.GetRemoteMaxPacketSize()).To(Equal(protocol.ByteCount(0x1234)))
+		})
+
+		It("errors when given a maximum packet size that is too small", func() {
+			err := pn.SetFromMap(map[Tag][]byte{TagMPSZ: {0xe8, 0x3, 0, 0}}) // 1000
+			Expect(err).To(MatchError(errMalformedTag))
+		})
+	})
+
+	Context("APPLICATION_CLOSE frames", func() {
+		It("advertises support for APPLICATION_CLOSE frames", func() {
+			entryMap, err := pnClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).To(HaveKeyWithValue(TagAPCL, []byte{}))
+		})
+
+		It("reads if the peer supports APPLICATION_CLOSE frames", func() {
+			Expect(pn.RemoteSupportsApplicationClose()).To(BeFalse())
+			err := pn.SetFromMap(map[Tag][]byte{TagAPCL: {}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.RemoteSupportsApplicationClose()).To(BeTrue())
+		})
+	})
+
 	Context("max streams per connection", func() {
 		It("errors when given an invalid max streams per connection value", func() {
 			values := map[Tag][]byte{TagMSPC: {2, 0, 0}} // 1 byte too short
@@ -48,7 +48,7 @@ var _ = Describe("Params Negotiator (for TLS)", func() {
 			pn.idleTimeout = 0xcafe
 			buf := make([]byte, 4)
 			values := paramsListToMap(pn.GetTransportParameters())
-			Expect(values).To(HaveLen(5))
+			Expect(values).To(HaveLen(6))
 			binary.BigEndian.PutUint32(buf, uint32(protocol.ReceiveStreamFlowControlWindow))
 			Expect(values).To(HaveKeyWithValue(initialMaxStreamDataParameterID, buf))
 			binary.BigEndian.PutUint32(buf, uint32(protocol.ReceiveConnectionFlowControlWindow))
@@ -56,6 +56,32 @@ var _ = Describe("Params Negotiator (for TLS)", func() {
 			Expect(values).To(HaveKeyWithValue(initialMaxStreamIDParameterID, []byte{0xff, 0xff, 0xff, 0xff}))
 			Expect(values).To(HaveKeyWithValue(idleTimeoutParameterID, []byte{0xca, 0xfe}))
 			Expect(values).To(HaveKeyWithValue(maxPacketSizeParameterID, []byte{0x5, 0xac})) // 1452 = 0x5ac
+			Expect(values).To(HaveKeyWithValue(applicationCloseParameterID, []byte{}))
+		})
+
+		It("advertises a larger maximum packet size", func() {
+			pn = newParamsNegotiator(
+				protocol.PerspectiveServer,
+				protocol.VersionWhatever,
+				&TransportParameters{MaxPacketSize: 0x1234},
+			)
+			values := paramsListToMap(pn.GetTransportParameters())
+			Expect(values).To(HaveKeyWithValue(maxPacketSizeParameterID, []byte{0x12, 0x34}))
+		})
+
+		It("advertises support for datagrams", func() {
+			pn = newParamsNegotiator(
+				protocol.PerspectiveServer,
+				protocol.VersionWhatever,
+				&TransportParameters{MaxDatagramFrameSize: 0x4321},
+			)
+			values := paramsListToMap(pn.GetTransportParameters())
+			Expect(values).To(HaveKeyWithValue(maxDatagramFrameSizeParameterID, []byte{0x43, 0x21}))
+		})
+
+		It("doesn't advertise support for datagrams, if they are disabled", func() {
+			values := paramsListToMap(pn.GetTransportParameters())
+			Expect(values).ToNot(HaveKey(maxDatagramFrameSizeParameterID))
 		})
 
 		It("request ommision of the connection ID", func() {
@@ -73,6 +99,36 @@ var _ = Describe("Params Negotiator (for TLS)", func() {
 			Expect(pn.GetSendConnectionFlowControlWindow()).To(Equal(protocol.ByteCount(0x22334455)))
 			Expect(pn.GetRemoteIdleTimeout()).To(Equal(0x1337 * time.Second))
 			Expect(pn.OmitConnectionID()).To(BeFalse())
+			Expect(pn.GetRemoteMaxPacketSize()).To(Equal(protocol.MaxReceivePacketSize))
+			Expect(pn.GetRemoteMaxDatagramFrameSize()).To(BeZero())
+			Expect(pn.RemoteSupportsApplicationClose()).To(BeFalse())
+		})
+
+		It("reads if the peer supports APPLICATION_CLOSE frames", func() {
+			params[applicationCloseParameterID] = []byte{}
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.RemoteSupportsApplicationClose()).To(BeTrue())
+		})
+
+		It("reads the maximum DATAGRAM frame size", func() {
+			params[maxDatagramFrameSizeParameterID] = []byte{0x4, 0xd2} // 1234
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.GetRemoteMaxDatagramFrameSize()).To(Equal(protocol.ByteCount(1234)))
+		})
+
+		It("reads the maximum packet size", func() {
+			params[maxPacketSizeParameterID] = []byte{0x5, 0xdc} // 1500
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pn.GetRemoteMaxPacketSize()).To(Equal(protocol.ByteCount(1500)))
+		})
+
+		It("rejects a maximum packet size that is too small", func() {
+			params[maxPacketSizeParameterID] = []byte{0x3, 0xe8} // 1000
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).To(MatchError("invalid value for max_packet_size: 1000 (minimum 1200)"))
 		})
 
 		It("saves if it should omit the connection ID", func() {
@@ -139,6 +195,24 @@ var _ = Describe("Params Negotiator (for TLS)", func() {
 			Expect(err).To(MatchError("wrong length for idle_timeout: 3 (expected 2)"))
 		})
 
+		It("rejects the parameters if the max_packet_size has the wrong length", func() {
+			params[maxPacketSizeParameterID] = []byte{0x11, 0x22, 0x33} // should be 2 bytes
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).To(MatchError("wrong length for max_packet_size: 3 (expected 2)"))
+		})
+
+		It("rejects the parameters if the max_datagram_frame_size has the wrong length", func() {
+			params[maxDatagramFrameSizeParameterID] = []byte{0x11} // should be 2 bytes
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).To(MatchError("wrong length for max_datagram_frame_size: 1 (expected 2)"))
+		})
+
+		It("rejects the parameters if application_close is non-empty", func() {
+			params[applicationCloseParameterID] = []byte{0} // should be empty
+			err := pn.SetFromTransportParameters(paramsMapToList(params))
+			Expect(err).To(MatchError("wrong length for application_close: 1 (expected empty)"))
+		})
+
 		It("rejects the parameters if omit_connection_id is non-empty", func() {
 			params[omitConnectionIDParameterID] = []byte{0} // should be empty
 			err := pn.SetFromTransportParameters(paramsMapToList(params))
@@ -3,8 +3,11 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"net"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
 // ServerConfig is a server config
@@ -13,6 +16,8 @@ type ServerConfig struct {
 	certChain crypto.CertChain
 	ID        []byte
 	obit      []byte
+	// the cookieGenerator is shared between all sessions, such that a token can be used for multiple connections
+	cookieGenerator *CookieGenerator
 }
 
 // NewServerConfig creates a new server config
@@ -28,11 +33,17 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 		return nil, err
 	}
 
+	cookieGenerator, err := NewCookieGenerator()
+	if err != nil {
+		return nil, err
+	}
+
 	return &ServerConfig{
-		kex:       kex,
-		certChain: certChain,
-		ID:        id,
-		obit:      obit,
+		kex:             kex,
+		certChain:       certChain,
+		ID:              id,
+		obit:            obit,
+		cookieGenerator: cookieGenerator,
 	}, nil
 }
 
@@ -63,3 +74,38 @@ func (s *ServerConfig) Sign(sni string, chlo []byte) ([]byte, error) {
 func (s *ServerConfig) GetCertsCompressed(sni string, commonSetHashes, compressedHashes []byte) ([]byte, error) {
 	return s.certChain.GetCertsCompressed(sni, commonSetHashes, compressedHashes)
 }
+
+// AcceptToken decodes a source address token, and checks if it is accepted for the client address.
+func (s *ServerConfig) AcceptToken(token []byte, remoteAddr net.Addr, accept func(net.Addr, *Cookie) bool) bool {
+	cookie, err := s.cookieGenerator.DecodeToken(token)
+	if err != nil {
+		utils.Debugf("STK invalid: %s", err.Error())
+		return false
+	}
+	return accept(remoteAddr, cookie)
+}
+
+// NewRetryMessage creates a REJ that only contains a new source address token.
+// It is sent for a stateless retry, before any state is created for the client.
+func (s *ServerConfig) NewRetryMessage(remoteAddr net.Addr) ([]byte, error) {
+	token, err := s.cookieGenerator.NewToken(remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return retryMessage(token), nil
+}
+
+// RetryMessageLen returns the length of the REJ that was sent for a stateless retry.
+// The client sends the token it received in this REJ in the next CHLO.
+func RetryMessageLen(token []byte) protocol.ByteCount {
+	return protocol.ByteCount(len(retryMessage(token)))
+}
+
+func retryMessage(token []byte) []byte {
+	var b bytes.Buffer
+	HandshakeMessage{
+		Tag:  TagREJ,
+		Data: map[Tag][]byte{TagSTK: token},
+	}.Write(&b)
+	return b.Bytes()
+}
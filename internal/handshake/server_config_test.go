@@ -2,6 +2,7 @@ package handshake
 
 import (
 	"bytes"
+	"net"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 
@@ -41,4 +42,59 @@ var _ = Describe("ServerConfig", func() {
 		expected.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
 		Expect(scfg.Get()).To(Equal(expected.Bytes()))
 	})
+
+	Context("stateless retries", func() {
+		var scfg *ServerConfig
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+		acceptAll := func(net.Addr, *Cookie) bool { return true }
+
+		BeforeEach(func() {
+			var err error
+			scfg, err = NewServerConfig(kex, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("creates a REJ that only contains a source address token", func() {
+			rej, err := scfg.NewRetryMessage(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			msg, err := ParseHandshakeMessage(bytes.NewReader(rej))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg.Tag).To(Equal(TagREJ))
+			Expect(msg.Data).To(HaveLen(1))
+			Expect(msg.Data).To(HaveKey(TagSTK))
+			Expect(RetryMessageLen(msg.Data[TagSTK])).To(BeEquivalentTo(len(rej)))
+		})
+
+		It("accepts tokens that it issued", func() {
+			rej, err := scfg.NewRetryMessage(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			msg, err := ParseHandshakeMessage(bytes.NewReader(rej))
+			Expect(err).ToNot(HaveOccurred())
+			var cookie *Cookie
+			accepted := scfg.AcceptToken(msg.Data[TagSTK], remoteAddr, func(_ net.Addr, c *Cookie) bool {
+				cookie = c
+				return true
+			})
+			Expect(accepted).To(BeTrue())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+		})
+
+		It("uses the callback to decide if a token is accepted", func() {
+			rej, err := scfg.NewRetryMessage(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			msg, err := ParseHandshakeMessage(bytes.NewReader(rej))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.AcceptToken(msg.Data[TagSTK], remoteAddr, func(net.Addr, *Cookie) bool { return false })).To(BeFalse())
+		})
+
+		It("rejects tokens issued by a different server config", func() {
+			scfg2, err := NewServerConfig(kex, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rej, err := scfg2.NewRetryMessage(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			msg, err := ParseHandshakeMessage(bytes.NewReader(rej))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.AcceptToken(msg.Data[TagSTK], remoteAddr, acceptAll)).To(BeFalse())
+		})
+	})
 })
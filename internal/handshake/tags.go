@@ -49,6 +49,14 @@ const (
 	TagCFCW Tag = 'C' + 'F'<<8 + 'C'<<16 + 'W'<<24
 	// TagSFCW is the initial stream flow control receive window.
 	TagSFCW Tag = 'S' + 'F'<<8 + 'C'<<16 + 'W'<<24
+	// TagMDFS is the maximum size of a DATAGRAM frame that is accepted (unofficial tag by us)
+	// It is only sent if datagrams are enabled.
+	TagMDFS Tag = 'M' + 'D'<<8 + 'F'<<16 + 'S'<<24
+	// TagMPSZ is the maximum packet size that is accepted (unofficial tag by us)
+	TagMPSZ Tag = 'M' + 'P'<<8 + 'S'<<16 + 'Z'<<24
+	// TagAPCL signals support for APPLICATION_CLOSE frames (unofficial tag by us)
+	// Its value is empty.
+	TagAPCL Tag = 'A' + 'P'<<8 + 'C'<<16 + 'L'<<24
 
 	// TagFHL2 forces head of line blocking.
 	// Chrome experiment (see https://codereview.chromium.org/2115033002)
@@ -16,6 +16,8 @@ const (
 	omitConnectionIDParameterID
 	maxPacketSizeParameterID
 	statelessResetTokenParameterID
+	maxDatagramFrameSizeParameterID
+	applicationCloseParameterID
 )
 
 type transportParameter struct {
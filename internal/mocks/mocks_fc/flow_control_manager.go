@@ -116,6 +116,19 @@ func (mr *MockFlowControlManagerMockRecorder) GetReceiveWindow(streamID interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceiveWindow", reflect.TypeOf((*MockFlowControlManager)(nil).GetReceiveWindow), streamID)
 }
 
+// GetReceiveWindowIncrement mocks base method
+func (m *MockFlowControlManager) GetReceiveWindowIncrement(streamID protocol.StreamID) (protocol.ByteCount, error) {
+	ret := m.ctrl.Call(m, "GetReceiveWindowIncrement", streamID)
+	ret0, _ := ret[0].(protocol.ByteCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReceiveWindowIncrement indicates an expected call of GetReceiveWindowIncrement
+func (mr *MockFlowControlManagerMockRecorder) GetReceiveWindowIncrement(streamID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceiveWindowIncrement", reflect.TypeOf((*MockFlowControlManager)(nil).GetReceiveWindowIncrement), streamID)
+}
+
 // AddBytesSent mocks base method
 func (m *MockFlowControlManager) AddBytesSent(streamID protocol.StreamID, n protocol.ByteCount) error {
 	ret := m.ctrl.Call(m, "AddBytesSent", streamID, n)
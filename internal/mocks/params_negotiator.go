@@ -119,6 +119,42 @@ func (mr *MockParamsNegotiatorMockRecorder) GetRemoteIdleTimeout() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRemoteIdleTimeout", reflect.TypeOf((*MockParamsNegotiator)(nil).GetRemoteIdleTimeout))
 }
 
+// GetRemoteMaxPacketSize mocks base method
+func (m *MockParamsNegotiator) GetRemoteMaxPacketSize() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetRemoteMaxPacketSize")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetRemoteMaxPacketSize indicates an expected call of GetRemoteMaxPacketSize
+func (mr *MockParamsNegotiatorMockRecorder) GetRemoteMaxPacketSize() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRemoteMaxPacketSize", reflect.TypeOf((*MockParamsNegotiator)(nil).GetRemoteMaxPacketSize))
+}
+
+// GetRemoteMaxDatagramFrameSize mocks base method
+func (m *MockParamsNegotiator) GetRemoteMaxDatagramFrameSize() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetRemoteMaxDatagramFrameSize")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetRemoteMaxDatagramFrameSize indicates an expected call of GetRemoteMaxDatagramFrameSize
+func (mr *MockParamsNegotiatorMockRecorder) GetRemoteMaxDatagramFrameSize() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRemoteMaxDatagramFrameSize", reflect.TypeOf((*MockParamsNegotiator)(nil).GetRemoteMaxDatagramFrameSize))
+}
+
+// RemoteSupportsApplicationClose mocks base method
+func (m *MockParamsNegotiator) RemoteSupportsApplicationClose() bool {
+	ret := m.ctrl.Call(m, "RemoteSupportsApplicationClose")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// RemoteSupportsApplicationClose indicates an expected call of RemoteSupportsApplicationClose
+func (mr *MockParamsNegotiatorMockRecorder) RemoteSupportsApplicationClose() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteSupportsApplicationClose", reflect.TypeOf((*MockParamsNegotiator)(nil).RemoteSupportsApplicationClose))
+}
+
 // OmitConnectionID mocks base method
 func (m *MockParamsNegotiator) OmitConnectionID() bool {
 	ret := m.ctrl.Call(m, "OmitConnectionID")
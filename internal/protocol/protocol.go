@@ -30,6 +30,9 @@ type StreamID uint32
 // A ByteCount in QUIC
 type ByteCount uint64
 
+// An ApplicationErrorCode is an error code defined by the application protocol
+type ApplicationErrorCode uint32
+
 // MaxByteCount is the maximum value of a ByteCount
 const MaxByteCount = ByteCount(math.MaxUint64)
 
@@ -6,10 +6,27 @@ import "time"
 // This is the value used by Chromium for a QUIC packet sent using IPv6 (for IPv4 it would be 1370)
 const MaxPacketSize ByteCount = 1350
 
+// MinPacketSize is the smallest value that can be configured as the maximum packet size
+const MinPacketSize ByteCount = 1200
+
+// MaxPacketBufferSize is the largest packet size that can be sent or received, if the path supports it.
+// It is the size of an Ethernet jumbo frame (9000 bytes), minus the IPv6 and UDP headers.
+const MaxPacketBufferSize ByteCount = 9000 - 48
+
+// MaxMTUProbes is the number of probe packets of a given size that have to be lost before path MTU discovery concludes that the size isn't supported by the path
+const MaxMTUProbes = 3
+
+// MTUSearchThreshold is the precision of path MTU discovery.
+// The search stops once the largest size known to work is closer than this to the smallest size known not to work.
+const MTUSearchThreshold ByteCount = 20
+
 // NonForwardSecurePacketSizeReduction is the number of bytes a non forward-secure packet has to be smaller than a forward-secure packet
 // This makes sure that those packets can always be retransmitted without splitting the contained StreamFrames
 const NonForwardSecurePacketSizeReduction = 50
 
+// PacketBatchSize is the maximum number of packets that are read or written in a single system call, if the connection supports batched I/O
+const PacketBatchSize = 32
+
 // DefaultMaxCongestionWindow is the default for the max congestion window
 const DefaultMaxCongestionWindow = 1000
 
@@ -56,6 +73,9 @@ const DefaultMaxReceiveConnectionFlowControlWindowClient = 15 * (1 << 20) // 15
 // This is the value that Chromium is using
 const ConnectionFlowControlMultiplier = 1.5
 
+// FlowControlIdleRTTs is the number of RTTs after which the receive window increment of a stream (or the connection) is reset, if no data was read
+const FlowControlIdleRTTs = 8
+
 // MaxStreamsPerConnection is the maximum value accepted for the number of streams per connection
 const MaxStreamsPerConnection = 100
 
@@ -72,12 +92,43 @@ const MaxStreamsMinimumIncrement = 10
 // note that the number of streams is half this value, since the client can only open streams with open StreamID
 const MaxNewStreamIDDelta = 4 * MaxStreamsPerConnection
 
-// MaxSessionUnprocessedPackets is the max number of packets stored in each session that are not yet processed.
+// MinPooledStreamFrameDataLen is the minimum length of the data of a received StreamFrame to be stored in a buffer from the packet buffer pool
+// Smaller frames would only use a small part of the buffer.
+const MinPooledStreamFrameDataLen = MaxReceivePacketSize / 2
+
+// StreamReadFromChunkSize is the maximum number of bytes read at once by Stream.ReadFrom
+const StreamReadFromChunkSize = 16 * (1 << 10) // 16 kB
+
+// DefaultSendBufferSize is the default size of the send buffer of a stream
+const DefaultSendBufferSize = 64 * (1 << 10) // 64 kB
+
+// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we accept, if datagrams are enabled
+// Any DATAGRAM frame that fits into a packet is accepted.
+const MaxDatagramFrameSize = MaxPacketBufferSize
+
+// MaxDatagramPacketOverhead is the maximum overhead of a forward-secure packet carrying a DATAGRAM frame:
+// the Public Header (flags, connection ID and a 6 byte packet number) and the AEAD tag
+const MaxDatagramPacketOverhead ByteCount = 1 + 8 + 6 + 12
+
+// DatagramSendQueueLen is the maximum number of messages queued for sending, before Session.SendMessage blocks
+const DatagramSendQueueLen = 32
+
+// DatagramRcvQueueLen is the maximum number of received messages that are queued until they are read by Session.ReceiveMessage
+// Messages received while the queue is full are dropped.
+const DatagramRcvQueueLen = 128
+
+// MaxSessionUnprocessedPackets is the default for the max number of packets stored in each session that are not yet processed.
 const MaxSessionUnprocessedPackets = DefaultMaxCongestionWindow
 
 // SkipPacketAveragePeriodLength is the average period length in which one packet number is skipped to prevent an Optimistic ACK attack
 const SkipPacketAveragePeriodLength PacketNumber = 500
 
+// DefaultMaxConcurrentHandshakes is the default for the maximum number of handshakes a server performs concurrently
+const DefaultMaxConcurrentHandshakes = 1000
+
+// DefaultMaxAcceptQueueLen is the default for the maximum number of sessions that completed the handshake, but were not yet accepted by the application
+const DefaultMaxAcceptQueueLen = 32
+
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
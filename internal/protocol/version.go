@@ -50,9 +50,21 @@ func VersionNumberToTag(vn VersionNumber) uint32 {
 	return 'Q' + ((v/100%10)+'0')<<8 + ((v/10%10)+'0')<<16 + ((v%10)+'0')<<24
 }
 
-// VersionTagToNumber is built from VersionNumberToTag in init()
+// VersionTagToNumber maps tags ('Q032') to version numbers ('32')
+// It returns VersionUnsupported if the tag is not a 'Q' followed by 3 digits.
 func VersionTagToNumber(v uint32) VersionNumber {
-	return VersionNumber(((v>>8)&0xff-'0')*100 + ((v>>16)&0xff-'0')*10 + ((v>>24)&0xff - '0'))
+	if v&0xff != 'Q' {
+		return VersionUnsupported
+	}
+	var vn VersionNumber
+	for i := uint(1); i <= 3; i++ {
+		digit := (v >> (8 * i)) & 0xff
+		if digit < '0' || digit > '9' {
+			return VersionUnsupported
+		}
+		vn = 10*vn + VersionNumber(digit-'0')
+	}
+	return vn
 }
 
 // IsSupportedVersion returns true if the server supports this version
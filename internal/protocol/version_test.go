@@ -27,6 +27,12 @@ var _ = Describe("Version", func() {
 		Expect(VersionTagToNumber('Q' + '1'<<8 + '2'<<16 + '3'<<24)).To(Equal(VersionNumber(123)))
 	})
 
+	It("doesn't convert invalid tags", func() {
+		Expect(VersionTagToNumber('X' + '0'<<8 + '3'<<16 + '9'<<24)).To(Equal(VersionUnsupported))
+		Expect(VersionTagToNumber('Q' + '0'<<8 + 'a'<<16 + '9'<<24)).To(Equal(VersionUnsupported))
+		Expect(VersionTagToNumber(0)).To(Equal(VersionUnsupported))
+	})
+
 	It("converts number to tag", func() {
 		Expect(VersionNumberToTag(VersionNumber(123))).To(Equal(uint32('Q' + '1'<<8 + '2'<<16 + '3'<<24)))
 	})
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// There are two pools: one for packets up to the standard size, and one for packets up to the largest size supported.
+// Large buffers are only used by connections that discovered that the path supports packets larger than the standard size.
+var bufferPool, largeBufferPool sync.Pool
+
+// GetPacketBuffer gets a buffer that can hold a packet of the standard size
+func GetPacketBuffer() []byte {
+	return bufferPool.Get().([]byte)
+}
+
+// GetPacketBufferForSize gets a buffer that can hold a packet of the given size
+func GetPacketBufferForSize(size protocol.ByteCount) []byte {
+	if size <= protocol.MaxReceivePacketSize {
+		return GetPacketBuffer()
+	}
+	return largeBufferPool.Get().([]byte)
+}
+
+// PutPacketBuffer returns a buffer to the pool
+// It panics if the buffer was not obtained from the pool.
+func PutPacketBuffer(buf []byte) {
+	switch cap(buf) {
+	case int(protocol.MaxReceivePacketSize):
+		bufferPool.Put(buf[:0])
+	case int(protocol.MaxPacketBufferSize):
+		largeBufferPool.Put(buf[:0])
+	default:
+		panic("PutPacketBuffer called with packet of wrong size!")
+	}
+}
+
+// IsPacketBuffer says if a buffer has the capacity of a buffer obtained from the pool
+func IsPacketBuffer(buf []byte) bool {
+	return cap(buf) == int(protocol.MaxReceivePacketSize) || cap(buf) == int(protocol.MaxPacketBufferSize)
+}
+
+// A PacketBuffer is a buffer from the pool that is shared by multiple users, e.g. the frames parsed from a packet.
+// It is returned to the pool when the last reference to it is released.
+type PacketBuffer struct {
+	Data     []byte
+	refCount int32
+}
+
+// GetSharedPacketBuffer gets a buffer that can hold a packet of the given size.
+// It holds one reference, which must be released by the caller.
+func GetSharedPacketBuffer(size protocol.ByteCount) *PacketBuffer {
+	return &PacketBuffer{
+		Data:     GetPacketBufferForSize(size),
+		refCount: 1,
+	}
+}
+
+// Retain adds a reference to the buffer
+func (b *PacketBuffer) Retain() {
+	atomic.AddInt32(&b.refCount, 1)
+}
+
+// Release removes a reference from the buffer. The buffer is returned to the pool when the last reference is released.
+// It panics if the buffer was released more often than it was retained.
+func (b *PacketBuffer) Release() {
+	refCount := atomic.AddInt32(&b.refCount, -1)
+	if refCount < 0 {
+		panic("PacketBuffer released too often")
+	}
+	if refCount == 0 {
+		PutPacketBuffer(b.Data)
+	}
+}
+
+func init() {
+	bufferPool.New = func() interface{} {
+		return make([]byte, 0, protocol.MaxReceivePacketSize)
+	}
+	largeBufferPool.New = func() interface{} {
+		return make([]byte, 0, protocol.MaxPacketBufferSize)
+	}
+}
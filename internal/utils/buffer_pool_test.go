@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer Pool", func() {
+	It("returns buffers of correct len and cap", func() {
+		buf := GetPacketBuffer()
+		Expect(buf).To(HaveLen(0))
+		Expect(buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+	})
+
+	It("zeroes put buffers' length", func() {
+		for i := 0; i < 1000; i++ {
+			buf := GetPacketBuffer()
+			PutPacketBuffer(buf[0:10])
+			buf = GetPacketBuffer()
+			Expect(buf).To(HaveLen(0))
+			Expect(buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+		}
+	})
+
+	It("returns large buffers for packets larger than the standard size", func() {
+		buf := GetPacketBufferForSize(protocol.MaxReceivePacketSize)
+		Expect(buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+		PutPacketBuffer(buf)
+		buf = GetPacketBufferForSize(protocol.MaxReceivePacketSize + 1)
+		Expect(buf).To(HaveLen(0))
+		Expect(buf).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+		PutPacketBuffer(buf[:10])
+	})
+
+	It("recognizes buffers from the pool", func() {
+		Expect(IsPacketBuffer(GetPacketBuffer()[:10])).To(BeTrue())
+		Expect(IsPacketBuffer(GetPacketBufferForSize(protocol.MaxPacketBufferSize))).To(BeTrue())
+		Expect(IsPacketBuffer(make([]byte, 10))).To(BeFalse())
+	})
+
+	It("panics if wrong-sized buffers are passed", func() {
+		Expect(func() {
+			PutPacketBuffer([]byte{0})
+		}).To(Panic())
+	})
+
+	Context("shared buffers", func() {
+		It("returns the buffer to the pool when the last reference is released", func() {
+			buf := GetSharedPacketBuffer(protocol.MaxReceivePacketSize)
+			Expect(buf.Data).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+			buf.Retain()
+			buf.Release()
+			Expect(buf.refCount).To(BeEquivalentTo(1))
+			buf.Release()
+			Expect(buf.refCount).To(BeZero())
+		})
+
+		It("uses large buffers for packets larger than the standard size", func() {
+			buf := GetSharedPacketBuffer(protocol.MaxReceivePacketSize + 1)
+			Expect(buf.Data).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+			buf.Release()
+		})
+
+		It("panics if the buffer is released too often", func() {
+			buf := GetSharedPacketBuffer(protocol.MaxReceivePacketSize)
+			buf.Release()
+			Expect(func() { buf.Release() }).To(Panic())
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// A Clock returns the current time, and creates timers that fire according to this time.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) ClockTimer
+}
+
+// A ClockTimer is a timer created by a Clock.
+// Its methods behave like the methods of a time.Timer.
+type ClockTimer interface {
+	Chan() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// DefaultClock implements the Clock interface using the Go stdlib clock.
+type DefaultClock struct{}
+
+var _ Clock = DefaultClock{}
+
+// Now gets the current time
+func (DefaultClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a new time.Timer
+func (DefaultClock) NewTimer(d time.Duration) ClockTimer {
+	return &stdlibTimer{time.NewTimer(d)}
+}
+
+type stdlibTimer struct {
+	*time.Timer
+}
+
+func (t *stdlibTimer) Chan() <-chan time.Time { return t.C }
+
+// A VirtualClock is a Clock that only advances when Advance is called.
+// It is used to run tests in virtual time.
+type VirtualClock struct {
+	mutex sync.Mutex
+
+	now    time.Time
+	seq    uint64
+	timers virtualTimerQueue
+}
+
+var _ Clock = &VirtualClock{}
+
+// NewVirtualClock creates a new VirtualClock, starting at the given time
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now gets the current virtual time
+func (c *VirtualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// NewTimer creates a new timer that fires when the virtual time advances by d.
+// When it fires, the current virtual time is sent on its channel.
+func (c *VirtualClock) NewTimer(d time.Duration) ClockTimer {
+	ch := make(chan time.Time, 1)
+	t := &virtualTimer{clock: c, c: ch, index: -1}
+	t.fire = func(now time.Time) {
+		select {
+		case ch <- now:
+		default:
+		}
+	}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc calls f when the virtual time advances by d.
+// f is called on the go routine calling Advance, and must not block.
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	t := &virtualTimer{clock: c, index: -1}
+	t.fire = func(time.Time) { f() }
+	t.Reset(d)
+	return t
+}
+
+// NextDeadline returns the time when the next timer fires.
+// It returns false if no timer is running.
+func (c *VirtualClock) NextDeadline() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].deadline, true
+}
+
+// Advance advances the virtual time to the deadline of the next timer, and fires this timer.
+// Timers that expire at the same time are fired by the following calls, in the order they were started.
+// It returns false if no timer is running.
+func (c *VirtualClock) Advance() bool {
+	c.mutex.Lock()
+	if len(c.timers) == 0 {
+		c.mutex.Unlock()
+		return false
+	}
+	c.fireNext()
+	return true
+}
+
+// AdvanceTo advances the virtual time to t, firing all timers that expire until then in order.
+// The virtual time never moves backwards.
+func (c *VirtualClock) AdvanceTo(t time.Time) {
+	for {
+		c.mutex.Lock()
+		if len(c.timers) == 0 || c.timers[0].deadline.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mutex.Unlock()
+			return
+		}
+		c.fireNext()
+	}
+}
+
+// fireNext removes the next timer from the queue, and fires it.
+// It must be called with the mutex locked, and unlocks it before firing the timer.
+func (c *VirtualClock) fireNext() {
+	timer := heap.Pop(&c.timers).(*virtualTimer)
+	timer.index = -1
+	if timer.deadline.After(c.now) {
+		c.now = timer.deadline
+	}
+	now := c.now
+	c.mutex.Unlock()
+	timer.fire(now)
+}
+
+type virtualTimer struct {
+	clock *VirtualClock
+	c     chan time.Time
+	fire  func(now time.Time)
+
+	deadline time.Time
+	seq      uint64
+	index    int // the index in the timer queue, -1 if the timer is not running
+}
+
+func (t *virtualTimer) Chan() <-chan time.Time { return t.c }
+
+func (t *virtualTimer) Stop() bool {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return t.stop()
+}
+
+func (t *virtualTimer) stop() bool {
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&t.clock.timers, t.index)
+	t.index = -1
+	return true
+}
+
+func (t *virtualTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	active := t.stop()
+	if d < 0 {
+		d = 0
+	}
+	t.deadline = c.now.Add(d)
+	c.seq++
+	t.seq = c.seq
+	heap.Push(&c.timers, t)
+	return active
+}
+
+type virtualTimerQueue []*virtualTimer
+
+func (q virtualTimerQueue) Len() int { return len(q) }
+func (q virtualTimerQueue) Less(i, j int) bool {
+	if q[i].deadline.Equal(q[j].deadline) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].deadline.Before(q[j].deadline)
+}
+func (q virtualTimerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *virtualTimerQueue) Push(x interface{}) {
+	t := x.(*virtualTimer)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+func (q *virtualTimerQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	*q = old[:n-1]
+	return t
+}
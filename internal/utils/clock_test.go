@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clock", func() {
+	Context("default clock", func() {
+		It("returns the current time", func() {
+			Expect(DefaultClock{}.Now()).To(BeTemporally("~", time.Now(), time.Millisecond))
+		})
+
+		It("creates timers", func() {
+			t := DefaultClock{}.NewTimer(10 * time.Millisecond)
+			Eventually(t.Chan()).Should(Receive())
+			Expect(t.Reset(time.Hour)).To(BeFalse())
+			Expect(t.Stop()).To(BeTrue())
+		})
+	})
+
+	Context("virtual clock", func() {
+		var (
+			clock *VirtualClock
+			start time.Time
+		)
+
+		BeforeEach(func() {
+			start = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock = NewVirtualClock(start)
+		})
+
+		It("doesn't advance by itself", func() {
+			Expect(clock.Now()).To(Equal(start))
+			time.Sleep(5 * time.Millisecond)
+			Expect(clock.Now()).To(Equal(start))
+		})
+
+		It("advances to a given time", func() {
+			clock.AdvanceTo(start.Add(time.Minute))
+			Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+			// it never moves backwards
+			clock.AdvanceTo(start)
+			Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+		})
+
+		It("fires timers", func() {
+			t := clock.NewTimer(time.Second)
+			Consistently(t.Chan()).ShouldNot(Receive())
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(clock.Now()).To(Equal(start.Add(time.Second)))
+			Expect(t.Chan()).To(Receive(Equal(start.Add(time.Second))))
+			Expect(clock.Advance()).To(BeFalse())
+		})
+
+		It("fires timers in order", func() {
+			var fired []int
+			clock.AfterFunc(3*time.Second, func() { fired = append(fired, 3) })
+			clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+			clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+			clock.AfterFunc(time.Second, func() { fired = append(fired, 4) })
+			deadline, ok := clock.NextDeadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(Equal(start.Add(time.Second)))
+			clock.AdvanceTo(start.Add(2 * time.Second))
+			Expect(fired).To(Equal([]int{1, 4, 2}))
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(fired).To(Equal([]int{1, 4, 2, 3}))
+		})
+
+		It("stops timers", func() {
+			t := clock.NewTimer(time.Second)
+			Expect(t.Stop()).To(BeTrue())
+			Expect(t.Stop()).To(BeFalse())
+			Expect(clock.Advance()).To(BeFalse())
+			Expect(t.Chan()).ToNot(Receive())
+		})
+
+		It("resets timers", func() {
+			t := clock.NewTimer(time.Second)
+			Expect(t.Reset(time.Minute)).To(BeTrue())
+			clock.AdvanceTo(start.Add(time.Second))
+			Expect(t.Chan()).ToNot(Receive())
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(t.Chan()).To(Receive(Equal(start.Add(time.Minute))))
+			Expect(t.Reset(time.Second)).To(BeFalse())
+		})
+
+		It("fires timers with the same deadline one by one", func() {
+			var fired []int
+			clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+			clock.AfterFunc(time.Second, func() { fired = append(fired, 2) })
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(fired).To(Equal([]int{1}))
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(fired).To(Equal([]int{1, 2}))
+			Expect(clock.Now()).To(Equal(start.Add(time.Second)))
+			Expect(clock.Advance()).To(BeFalse())
+		})
+
+		It("works with the Timer", func() {
+			t := NewTimerWithClock(clock)
+			for i := 1; i <= 3; i++ {
+				t.Reset(clock.Now().Add(time.Second))
+				Expect(clock.Advance()).To(BeTrue())
+				Expect(t.Chan()).To(Receive())
+				t.SetRead()
+			}
+			Expect(clock.Now()).To(Equal(start.Add(3 * time.Second)))
+		})
+	})
+})
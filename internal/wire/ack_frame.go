@@ -29,6 +29,7 @@ type AckFrame struct {
 
 	// time when the LargestAcked was receiveid
 	// this field Will not be set for received ACKs frames
+	// if it is set, the DelayTime is calculated from it when writing the frame
 	PacketReceivedTime time.Time
 	DelayTime          time.Duration
 }
@@ -221,7 +222,9 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		utils.GetByteOrder(version).WriteUint48(b, uint64(f.LargestAcked)&(1<<48-1))
 	}
 
-	f.DelayTime = time.Since(f.PacketReceivedTime)
+	if !f.PacketReceivedTime.IsZero() {
+		f.DelayTime = time.Since(f.PacketReceivedTime)
+	}
 	utils.GetByteOrder(version).WriteUfloat16(b, uint64(f.DelayTime/time.Microsecond))
 
 	var numRanges uint64
@@ -236,7 +239,10 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 
 	var firstAckBlockLength protocol.PacketNumber
 	if !f.HasMissingRanges() {
-		firstAckBlockLength = f.LargestAcked - f.LowestAcked + 1
+		// a LargestAcked of 0 is encoded with a block length of 0, see ParseAckFrame
+		if f.LargestAcked > 0 {
+			firstAckBlockLength = f.LargestAcked - f.LowestAcked + 1
+		}
 	} else {
 		if f.LargestAcked != f.AckRanges[0].Last {
 			return errInconsistentAckLargestAcked
@@ -661,6 +661,18 @@ var _ = Describe("AckFrame", func() {
 						Expect(r.Len()).To(BeZero())
 					})
 
+					It("writes a frame where the largest acked is 0", func() {
+						frameOrig := &AckFrame{}
+						err := frameOrig.Write(b, version)
+						Expect(err).ToNot(HaveOccurred())
+						r := bytes.NewReader(b.Bytes())
+						frame, err := ParseAckFrame(r, version)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(frame.LargestAcked).To(BeZero())
+						Expect(frame.LowestAcked).To(BeZero())
+						Expect(r.Len()).To(BeZero())
+					})
+
 					It("writes the correct block length in a simple ACK frame", func() {
 						frameOrig := &AckFrame{
 							LargestAcked: 20,
@@ -0,0 +1,70 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// An ApplicationCloseFrame closes the connection with an error code defined by the application.
+// Apart from the type byte, it is identical to the CONNECTION_CLOSE frame.
+type ApplicationCloseFrame struct {
+	ErrorCode    protocol.ApplicationErrorCode
+	ReasonPhrase string
+}
+
+// ParseApplicationCloseFrame reads an APPLICATION_CLOSE frame
+func ParseApplicationCloseFrame(r *bytes.Reader, version protocol.VersionNumber) (*ApplicationCloseFrame, error) {
+	frame := &ApplicationCloseFrame{}
+
+	// read the TypeByte
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+
+	errorCode, err := utils.GetByteOrder(version).ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	frame.ErrorCode = protocol.ApplicationErrorCode(errorCode)
+
+	reasonPhraseLen, err := utils.GetByteOrder(version).ReadUint16(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if reasonPhraseLen > uint16(protocol.MaxPacketSize) {
+		return nil, qerr.Error(qerr.InvalidConnectionCloseData, "reason phrase too long")
+	}
+
+	reasonPhrase := make([]byte, reasonPhraseLen)
+	if _, err := io.ReadFull(r, reasonPhrase); err != nil {
+		return nil, err
+	}
+	frame.ReasonPhrase = string(reasonPhrase)
+
+	return frame, nil
+}
+
+// MinLength of a written frame
+func (f *ApplicationCloseFrame) MinLength(version protocol.VersionNumber) (protocol.ByteCount, error) {
+	return 1 + 4 + 2 + protocol.ByteCount(len(f.ReasonPhrase)), nil
+}
+
+// Write writes an APPLICATION_CLOSE frame.
+func (f *ApplicationCloseFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	if len(f.ReasonPhrase) > math.MaxUint16 {
+		return errors.New("ApplicationCloseFrame: ReasonPhrase too long")
+	}
+
+	b.WriteByte(0x09)
+	utils.GetByteOrder(version).WriteUint32(b, uint32(f.ErrorCode))
+	utils.GetByteOrder(version).WriteUint16(b, uint16(len(f.ReasonPhrase)))
+	b.WriteString(f.ReasonPhrase)
+	return nil
+}
@@ -0,0 +1,127 @@
+package wire
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplicationCloseFrame", func() {
+	Context("when parsing", func() {
+		It("accepts sample frame, in little endian", func() {
+			b := bytes.NewReader([]byte{0x9,
+				0x37, 0x13, 0x0, 0x0, // error code
+				0x6, 0x0, // reason phrase length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			})
+			frame, err := ParseApplicationCloseFrame(b, versionLittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.ErrorCode).To(Equal(protocol.ApplicationErrorCode(0x1337)))
+			Expect(frame.ReasonPhrase).To(Equal("foobar"))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("accepts sample frame, in big endian", func() {
+			b := bytes.NewReader([]byte{0x9,
+				0x0, 0x0, 0x13, 0x37, // error code
+				0x0, 0x6, // reason phrase length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			})
+			frame, err := ParseApplicationCloseFrame(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.ErrorCode).To(Equal(protocol.ApplicationErrorCode(0x1337)))
+			Expect(frame.ReasonPhrase).To(Equal("foobar"))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("parses a frame without a reason phrase", func() {
+			b := bytes.NewReader([]byte{0x9,
+				0xad, 0xfb, 0xca, 0xde, // error code
+				0x0, 0x0, // reason phrase length
+			})
+			frame, err := ParseApplicationCloseFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.ReasonPhrase).To(BeEmpty())
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("rejects long reason phrases", func() {
+			b := bytes.NewReader([]byte{0x9,
+				0xad, 0xfb, 0xca, 0xde, // error code
+				0x0, 0xff, // reason phrase length
+			})
+			_, err := ParseApplicationCloseFrame(b, versionLittleEndian)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidConnectionCloseData, "reason phrase too long")))
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x9,
+				0x37, 0x13, 0x0, 0x0, // error code
+				0x6, 0x0, // reason phrase length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			}
+			_, err := ParseApplicationCloseFrame(bytes.NewReader(data), versionLittleEndian)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := ParseApplicationCloseFrame(bytes.NewReader(data[0:i]), versionLittleEndian)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a frame with a reason phrase", func() {
+			b := &bytes.Buffer{}
+			frame := &ApplicationCloseFrame{
+				ErrorCode:    0xdeadbeef,
+				ReasonPhrase: "foobar",
+			}
+			err := frame.Write(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Bytes()).To(Equal([]byte{0x9,
+				0xde, 0xad, 0xbe, 0xef, // error code
+				0x0, 0x6, // reason phrase length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			}))
+		})
+
+		It("rejects ReasonPhrases that are too long", func() {
+			b := &bytes.Buffer{}
+			frame := &ApplicationCloseFrame{
+				ErrorCode:    0xdeadbeef,
+				ReasonPhrase: strings.Repeat("a", 0xffff+0x11),
+			}
+			err := frame.Write(b, protocol.VersionWhatever)
+			Expect(err).To(HaveOccurred())
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("has proper min length", func() {
+			b := &bytes.Buffer{}
+			f := &ApplicationCloseFrame{
+				ErrorCode:    0xdeadbeef,
+				ReasonPhrase: "foobar",
+			}
+			err := f.Write(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.MinLength(0)).To(Equal(protocol.ByteCount(b.Len())))
+		})
+	})
+
+	It("is self-consistent", func() {
+		buf := &bytes.Buffer{}
+		frame := &ApplicationCloseFrame{
+			ErrorCode:    0xdeadbeef,
+			ReasonPhrase: "Lorem ipsum dolor sit amet.",
+		}
+		err := frame.Write(buf, protocol.VersionWhatever)
+		Expect(err).ToNot(HaveOccurred())
+		readframe, err := ParseApplicationCloseFrame(bytes.NewReader(buf.Bytes()), protocol.VersionWhatever)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readframe).To(Equal(frame))
+	})
+})
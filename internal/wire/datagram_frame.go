@@ -0,0 +1,52 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A DatagramFrame carries unreliable application data.
+// It is subject to congestion control, but it is never retransmitted.
+type DatagramFrame struct {
+	Data []byte
+}
+
+// ParseDatagramFrame parses a DATAGRAM frame
+func ParseDatagramFrame(r *bytes.Reader, version protocol.VersionNumber) (*DatagramFrame, error) {
+	// read the TypeByte
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+	dataLen, err := utils.GetByteOrder(version).ReadUint16(r)
+	if err != nil {
+		return nil, err
+	}
+	if int(dataLen) > r.Len() {
+		return nil, io.EOF
+	}
+	frame := &DatagramFrame{Data: make([]byte, dataLen)}
+	if _, err := io.ReadFull(r, frame.Data); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Write writes a DATAGRAM frame
+func (f *DatagramFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	if len(f.Data) > int(protocol.MaxPacketBufferSize) {
+		return errors.New("DatagramFrame: data too large")
+	}
+	b.WriteByte(0x08)
+	utils.GetByteOrder(version).WriteUint16(b, uint16(len(f.Data)))
+	b.Write(f.Data)
+	return nil
+}
+
+// MinLength of a written frame, including the data
+func (f *DatagramFrame) MinLength(version protocol.VersionNumber) (protocol.ByteCount, error) {
+	return 1 + 2 + protocol.ByteCount(len(f.Data)), nil
+}
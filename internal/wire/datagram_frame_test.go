@@ -0,0 +1,83 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatagramFrame", func() {
+	Context("when parsing", func() {
+		It("accepts a sample frame in little endian", func() {
+			b := bytes.NewReader([]byte{0x08,
+				0x6, 0x0, // data length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			})
+			frame, err := ParseDatagramFrame(b, versionLittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Data).To(Equal([]byte("foobar")))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("accepts a sample frame in big endian", func() {
+			b := bytes.NewReader([]byte{0x08,
+				0x0, 0x6, // data length
+				'f', 'o', 'o', 'b', 'a', 'r',
+			})
+			frame, err := ParseDatagramFrame(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Data).To(Equal([]byte("foobar")))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("only reads the data of the frame", func() {
+			b := bytes.NewReader([]byte{0x08, 0x0, 0x3, 'f', 'o', 'o', 'b', 'a', 'r'})
+			frame, err := ParseDatagramFrame(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Data).To(Equal([]byte("foo")))
+			Expect(b.Len()).To(Equal(3))
+		})
+
+		It("errors if the data length exceeds the packet", func() {
+			b := bytes.NewReader([]byte{0x08, 0x0, 0x7, 'f', 'o', 'o', 'b', 'a', 'r'})
+			_, err := ParseDatagramFrame(b, versionBigEndian)
+			Expect(err).To(MatchError(io.EOF))
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x08, 0x0, 0x6, 'f', 'o', 'o', 'b', 'a', 'r'}
+			_, err := ParseDatagramFrame(bytes.NewReader(data), versionBigEndian)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := ParseDatagramFrame(bytes.NewReader(data[0:i]), versionBigEndian)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			b := &bytes.Buffer{}
+			frame := DatagramFrame{Data: []byte("foobar")}
+			err := frame.Write(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Bytes()).To(Equal([]byte{0x08, 0x0, 0x6, 'f', 'o', 'o', 'b', 'a', 'r'}))
+		})
+
+		It("has the correct min length", func() {
+			frame := DatagramFrame{Data: []byte("foobar")}
+			Expect(frame.MinLength(versionBigEndian)).To(Equal(protocol.ByteCount(1 + 2 + 6)))
+		})
+
+		It("has the same length that it writes", func() {
+			b := &bytes.Buffer{}
+			frame := DatagramFrame{Data: []byte("foobar")}
+			err := frame.Write(b, versionLittleEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.MinLength(versionLittleEndian)).To(Equal(protocol.ByteCount(b.Len())))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+// +build gofuzz
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The Fuzz functions in this file are entry points for go-fuzz (https://github.com/dvyukov/go-fuzz).
+// To fuzz the ACK frame parser, run
+//   go-fuzz-build -func FuzzAckFrame github.com/lucas-clemente/quic-go/internal/wire
+//   go-fuzz -bin wire-fuzz.zip -workdir fuzzing/ackframe
+// The seed corpus can be generated by running the tests with the gofuzz build tag, see fuzz_test.go.
+//
+// The first byte of the input selects the version (and the perspective), the rest is parsed.
+// Every input that can be parsed is written again, and the result has to be parsed to the same value.
+
+// fuzzVersions are the versions used for fuzzing.
+// gQUIC 37 and 38 use little endian, gQUIC 39 uses big endian.
+var fuzzVersions = []protocol.VersionNumber{protocol.Version37, protocol.Version39}
+
+func getFuzzVersion(b byte) protocol.VersionNumber {
+	return fuzzVersions[int(b)%len(fuzzVersions)]
+}
+
+func getFuzzPerspective(b byte) protocol.Perspective {
+	if b&0x2 > 0 {
+		return protocol.PerspectiveServer
+	}
+	return protocol.PerspectiveClient
+}
+
+// FuzzPublicHeader fuzzes ParsePublicHeader
+func FuzzPublicHeader(data []byte) int {
+	if len(data) < 1 {
+		return 0
+	}
+	version := getFuzzVersion(data[0])
+	packetSentBy := getFuzzPerspective(data[0])
+	hdr, err := ParsePublicHeader(bytes.NewReader(data[1:]), packetSentBy, version)
+	if err != nil {
+		return 0
+	}
+	// Version Negotiation Packets are never written using the PublicHeader
+	if hdr.VersionFlag && packetSentBy == protocol.PerspectiveServer {
+		return 1
+	}
+	if hdr.VersionFlag {
+		// invalid version tags can't be written again
+		if hdr.VersionNumber == protocol.VersionUnsupported {
+			return 1
+		}
+		version = hdr.VersionNumber
+	}
+	b := &bytes.Buffer{}
+	if err := hdr.Write(b, version, packetSentBy); err != nil {
+		return 1
+	}
+	if length, err := hdr.GetLength(packetSentBy); err == nil && int(length) != b.Len() {
+		panic(fmt.Sprintf("inconsistent PublicHeader length: GetLength returned %d, but wrote %d bytes", length, b.Len()))
+	}
+	hdr2, err := ParsePublicHeader(bytes.NewReader(b.Bytes()), packetSentBy, version)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse the written PublicHeader: %s", err))
+	}
+	if !reflect.DeepEqual(hdr, hdr2) {
+		panic(fmt.Sprintf("PublicHeaders not equal: %#v vs. %#v", hdr, hdr2))
+	}
+	return 1
+}
+
+// FuzzAckFrame fuzzes ParseAckFrame
+func FuzzAckFrame(data []byte) int {
+	if len(data) < 1 {
+		return 0
+	}
+	version := getFuzzVersion(data[0])
+	frame, err := ParseAckFrame(bytes.NewReader(data[1:]), version)
+	if err != nil {
+		return 0
+	}
+	b := &bytes.Buffer{}
+	if err := frame.Write(b, version); err != nil {
+		panic(fmt.Sprintf("failed to write the parsed ACK frame: %s", err))
+	}
+	if length, err := frame.MinLength(version); err != nil || int(length) > b.Len() {
+		panic(fmt.Sprintf("inconsistent ACK frame length: MinLength returned %d (%v), but wrote %d bytes", length, err, b.Len()))
+	}
+	frame2, err := ParseAckFrame(bytes.NewReader(b.Bytes()), version)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse the written ACK frame: %s", err))
+	}
+	if !reflect.DeepEqual(frame, frame2) {
+		panic(fmt.Sprintf("ACK frames not equal: %#v vs. %#v", frame, frame2))
+	}
+	return 1
+}
+
+// FuzzStreamFrame fuzzes ParseStreamFrame
+func FuzzStreamFrame(data []byte) int {
+	if len(data) < 1 {
+		return 0
+	}
+	version := getFuzzVersion(data[0])
+	frame, err := ParseStreamFrame(bytes.NewReader(data[1:]), version)
+	if err != nil {
+		return 0
+	}
+	b := &bytes.Buffer{}
+	if err := frame.Write(b, version); err != nil {
+		panic(fmt.Sprintf("failed to write the parsed STREAM frame: %s", err))
+	}
+	if length, err := frame.MinLength(version); err != nil || int(length+frame.DataLen()) != b.Len() {
+		panic(fmt.Sprintf("inconsistent STREAM frame length: MinLength returned %d (%v), but wrote %d bytes", length, err, b.Len()))
+	}
+	frame2, err := ParseStreamFrame(bytes.NewReader(b.Bytes()), version)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse the written STREAM frame: %s", err))
+	}
+	if !reflect.DeepEqual(frame, frame2) {
+		panic(fmt.Sprintf("STREAM frames not equal: %#v vs. %#v", frame, frame2))
+	}
+	return 1
+}
@@ -0,0 +1,99 @@
+// +build gofuzz
+
+package wire
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The seeds are taken from the test vectors of the parser tests.
+// The first byte selects the version and the perspective, see fuzz.go:
+// 0: little endian, sent by the client, 1: big endian, sent by the client,
+// 2: little endian, sent by the server, 3: big endian, sent by the server
+var (
+	publicHeaderSeeds = [][]byte{
+		{0x0, 0x09, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x51, 0x30, 0x33, 0x34, 0x01},
+		{0x0, 0x08, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0xde},
+		{0x1, 0x18, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0xde, 0xca},
+		{0x0, 0x28, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0xad, 0xfb, 0xca, 0xde},
+		{0x1, 0x38, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x23, 0x42, 0xad, 0xfb, 0xca, 0xde},
+		{0x2, 0x0a, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8},
+		{0x2, 0x10, 0xca, 0xde},
+		{0x2, 0x09, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x51, 0x30, 0x33, 0x39, 0x51, 0x30, 0x33, 0x38},
+		append(append([]byte{0x2, 0x0c, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c}, make([]byte, 32)...), 0x37),
+	}
+
+	ackFrameSeeds = [][]byte{
+		{0x0, 0x40, 0x1c, 0x0, 0x0, 0x1c, 0},
+		{0x0, 0x40, 0x0, 0x0, 0x0, 0x0, 0},
+		{0x0, 0x40, 0x10, 0x0, 0x0, 0x1, 0x2, 0x1, 0x1, 0x2, 0x3, 0x4, 0x5, 0x1, 0x2, 0x3},
+		{0x0, 0x60, 0x18, 0x0, 0x0, 0x1, 0x3, 0x2, 0x10, 0},
+		{0x0, 0x60, 0x27, 0x0, 0x0, 0x6, 0x9, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x13, 0},
+		{0x0, 0x60, 0x52, 0xd1, 0x0, 0x3, 0x17, 0xa, 0x10, 0x4, 0x8, 0x2, 0x12, 0},
+		{0x0, 0x64, 0x15, 0x1, 0x0, 0x0, 0x1, 0x3, 0xff, 0x13, 0},
+		{0x0, 0x64, 0x14, 0x1, 0x0, 0x0, 0x2, 0x1, 0xff, 0x0, 0x1, 0x13, 0},
+		{0x0, 0x64, 0x44, 0x1, 0x0, 0x0, 0x2, 0x19, 0xff, 0x0, 0x19, 0x13, 0},
+		{0x1, 0x65, 0x1, 0x44, 0x0, 0x0, 0x2, 0x0, 0x19, 0xff, 0x0, 0x0, 0x19, 0x0, 0x13, 0},
+		{0x1, 0x48, 0xde, 0xad, 0xbe, 0xef, 0x0, 0x0, 0x13, 0},
+		// the ACK frame with a LargestAcked of 0, which couldn't be written again
+		{0x30, 0x0, 0x0, 0x30, 0x30, 0x0, 0x0},
+	}
+
+	streamFrameSeeds = [][]byte{
+		{0x0, 0x80 ^ 0x20, 0x1, 0x6, 0x0, 'f', 'o', 'o', 'b', 'a', 'r', 'f', 'o', 'o'},
+		{0x0, 0x80 ^ 0x20 ^ 0x4, 0x1, 0x42, 0x0, 0x6, 0x0, 'f', 'o', 'o', 'b', 'a', 'r'},
+		{0x1, 0x80 ^ 0x20, 0x1, 0x0, 0x6, 'f', 'o', 'o', 'b', 'a', 'r', 'f', 'o', 'o'},
+		{0x1, 0x80 ^ 0x20 ^ 0x4, 0x1, 0x0, 0x42, 0x0, 0x6, 'f', 'o', 'o', 'b', 'a', 'r'},
+		{0x0, 0x80, 0x1, 'f', 'o', 'o', 'b', 'a', 'r'},
+		{0x0, 0x80 ^ 0x40 ^ 0x20, 0x1, 0, 0, 'f', 'o', 'o'},
+		{0x0, 0x80 ^ 0x40, 0x1, 'f', 'o', 'o', 'b', 'a', 'r'},
+		{0x1, 0x80 ^ 0x1c ^ 0x3, 0xde, 0xad, 0xbe, 0xef, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 'f', 'o', 'o'},
+	}
+)
+
+// writeCorpus writes the seeds to dir, if it is set.
+// go-fuzz reads the corpus from the corpus directory in its workdir.
+func writeCorpus(dir string, seeds [][]byte) {
+	Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+	for i, seed := range seeds {
+		Expect(ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("seed-%d", i)), seed, 0644)).To(Succeed())
+	}
+}
+
+var _ = Describe("Fuzzing", func() {
+	targets := []struct {
+		name  string
+		fuzz  func([]byte) int
+		seeds [][]byte
+	}{
+		{"publicheader", FuzzPublicHeader, publicHeaderSeeds},
+		{"ackframe", FuzzAckFrame, ackFrameSeeds},
+		{"streamframe", FuzzStreamFrame, streamFrameSeeds},
+	}
+
+	for _, t := range targets {
+		target := t
+
+		Context(target.name, func() {
+			It("parses and writes the seeds", func() {
+				for _, seed := range target.seeds {
+					Expect(target.fuzz(seed)).To(Equal(1), fmt.Sprintf("seed: %#v", seed))
+				}
+			})
+
+			It("writes the seed corpus", func() {
+				dir := os.Getenv("QUIC_GO_FUZZ_CORPUS")
+				if dir == "" {
+					Skip("QUIC_GO_FUZZ_CORPUS not set")
+				}
+				writeCorpus(filepath.Join(dir, target.name, "corpus"), target.seeds)
+			})
+		})
+	}
+})
@@ -10,7 +10,7 @@ import (
 // A RstStreamFrame in QUIC
 type RstStreamFrame struct {
 	StreamID   protocol.StreamID
-	ErrorCode  uint32
+	ErrorCode  protocol.ApplicationErrorCode
 	ByteOffset protocol.ByteCount
 }
 
@@ -19,7 +19,7 @@ func (f *RstStreamFrame) Write(b *bytes.Buffer, version protocol.VersionNumber)
 	b.WriteByte(0x01)
 	utils.GetByteOrder(version).WriteUint32(b, uint32(f.StreamID))
 	utils.GetByteOrder(version).WriteUint64(b, uint64(f.ByteOffset))
-	utils.GetByteOrder(version).WriteUint32(b, f.ErrorCode)
+	utils.GetByteOrder(version).WriteUint32(b, uint32(f.ErrorCode))
 	return nil
 }
 
@@ -49,9 +49,10 @@ func ParseRstStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*RstS
 	}
 	frame.ByteOffset = protocol.ByteCount(byteOffset)
 
-	frame.ErrorCode, err = utils.GetByteOrder(version).ReadUint32(r)
+	errorCode, err := utils.GetByteOrder(version).ReadUint32(r)
 	if err != nil {
 		return nil, err
 	}
+	frame.ErrorCode = protocol.ApplicationErrorCode(errorCode)
 	return frame, nil
 }
@@ -21,7 +21,7 @@ var _ = Describe("RstStreamFrame", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(frame.StreamID).To(Equal(protocol.StreamID(0xdeadbeef)))
 				Expect(frame.ByteOffset).To(Equal(protocol.ByteCount(0x1122334455667788)))
-				Expect(frame.ErrorCode).To(Equal(uint32(0x13371234)))
+				Expect(frame.ErrorCode).To(Equal(protocol.ApplicationErrorCode(0x13371234)))
 			})
 		})
 
@@ -36,7 +36,7 @@ var _ = Describe("RstStreamFrame", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(frame.StreamID).To(Equal(protocol.StreamID(0xdeadbeef)))
 				Expect(frame.ByteOffset).To(Equal(protocol.ByteCount(0x8877665544332211)))
-				Expect(frame.ErrorCode).To(Equal(uint32(0x34123713)))
+				Expect(frame.ErrorCode).To(Equal(protocol.ApplicationErrorCode(0x34123713)))
 			})
 		})
 
@@ -17,6 +17,9 @@ type StreamFrame struct {
 	DataLenPresent bool
 	Offset         protocol.ByteCount
 	Data           []byte
+
+	// buffer is the packet buffer that Data points into, if any
+	buffer *utils.PacketBuffer
 }
 
 var (
@@ -26,6 +29,17 @@ var (
 
 // ParseStreamFrame reads a stream frame. The type byte must not have been read yet.
 func ParseStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*StreamFrame, error) {
+	return parseStreamFrame(r, nil, version)
+}
+
+// ParseStreamFrameFromPacketBuffer reads a stream frame from a packet held in buf. r must read from buf.Data.
+// If buf is nil, the data is copied, as done by ParseStreamFrame.
+// The data of large frames is not copied, but points into buf. The frame holds a reference to buf until PutData is called.
+func ParseStreamFrameFromPacketBuffer(r *bytes.Reader, buf *utils.PacketBuffer, version protocol.VersionNumber) (*StreamFrame, error) {
+	return parseStreamFrame(r, buf, version)
+}
+
+func parseStreamFrame(r *bytes.Reader, buf *utils.PacketBuffer, version protocol.VersionNumber) (*StreamFrame, error) {
 	frame := &StreamFrame{}
 
 	typeByte, err := r.ReadByte()
@@ -61,7 +75,7 @@ func ParseStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*StreamF
 		}
 	}
 
-	if dataLen > uint16(protocol.MaxPacketSize) {
+	if dataLen > uint16(protocol.MaxPacketBufferSize) {
 		return nil, qerr.Error(qerr.InvalidStreamData, "data len too large")
 	}
 
@@ -69,14 +83,24 @@ func ParseStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*StreamF
 		// The rest of the packet is data
 		dataLen = uint16(r.Len())
 	}
-	if dataLen != 0 {
-		frame.Data = make([]byte, dataLen)
+	if buf != nil && protocol.ByteCount(dataLen) >= protocol.MinPooledStreamFrameDataLen {
+		if int(dataLen) > r.Len() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		start := int(r.Size()) - r.Len()
+		frame.Data = buf.Data[start : start+int(dataLen)]
+		r.Seek(int64(dataLen), io.SeekCurrent)
+		buf.Retain()
+		frame.buffer = buf
+	} else if dataLen != 0 {
+		frame.Data = getDataBuffer(protocol.ByteCount(dataLen))
 		if _, err := io.ReadFull(r, frame.Data); err != nil {
 			return nil, err
 		}
 	}
 
 	if frame.Offset+frame.DataLen() < frame.Offset {
+		frame.PutData()
 		return nil, qerr.Error(qerr.InvalidStreamData, "data overflows maximum offset")
 	}
 	if !frame.FinBit && frame.DataLen() == 0 {
@@ -85,6 +109,30 @@ func ParseStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*StreamF
 	return frame, nil
 }
 
+// getDataBuffer gets a buffer for the data of a received StreamFrame
+// Large frames use a buffer from the packet buffer pool, which is returned by PutData.
+// Small frames would only use a small part of a pooled buffer, so their buffer is allocated.
+func getDataBuffer(l protocol.ByteCount) []byte {
+	if l < protocol.MinPooledStreamFrameDataLen {
+		return make([]byte, l)
+	}
+	return utils.GetPacketBufferForSize(l)[:l]
+}
+
+// PutData returns the buffer holding the data of a received StreamFrame to the packet buffer pool.
+// If the data points into a shared packet buffer, the frame's reference to it is released.
+// It must only be called once the data is not used any more.
+func (f *StreamFrame) PutData() {
+	if f.buffer != nil {
+		f.buffer.Release()
+		f.buffer = nil
+		f.Data = nil
+	} else if utils.IsPacketBuffer(f.Data) {
+		utils.PutPacketBuffer(f.Data)
+		f.Data = nil
+	}
+}
+
 // WriteStreamFrame writes a stream frame.
 func (f *StreamFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
 	if len(f.Data) == 0 && !f.FinBit {
@@ -2,8 +2,11 @@ package wire
 
 import (
 	"bytes"
+	"encoding/binary"
+	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/qerr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -167,8 +170,85 @@ var _ = Describe("StreamFrame", func() {
 			Expect(err).To(MatchError(qerr.EmptyStreamFrameNoFin))
 		})
 
+		It("uses a pooled buffer for large frames, and returns it with PutData", func() {
+			data := bytes.Repeat([]byte{'f'}, int(protocol.MinPooledStreamFrameDataLen))
+			b := bytes.NewReader(append([]byte{0x80, 0x1}, data...))
+			frame, err := ParseStreamFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Data).To(Equal(data))
+			Expect(frame.Data).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+			frame.PutData()
+			Expect(frame.Data).To(BeNil())
+		})
+
+		It("doesn't use a pooled buffer for small frames", func() {
+			b := bytes.NewReader([]byte{0x80, 0x1, 'f', 'o', 'o'})
+			frame, err := ParseStreamFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			frame.PutData()
+			Expect(frame.Data).To(Equal([]byte("foo")))
+		})
+
+		Context("parsing from a packet buffer", func() {
+			var buf *utils.PacketBuffer
+
+			BeforeEach(func() {
+				buf = utils.GetSharedPacketBuffer(protocol.MaxReceivePacketSize)
+			})
+
+			It("points into the packet buffer for large frames, and releases it with PutData", func() {
+				data := bytes.Repeat([]byte{'f'}, int(protocol.MinPooledStreamFrameDataLen))
+				buf.Data = append(buf.Data, 0x80, 0x1)
+				buf.Data = append(buf.Data, data...)
+				frame, err := ParseStreamFrameFromPacketBuffer(bytes.NewReader(buf.Data), buf, protocol.VersionWhatever)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Data).To(Equal(data))
+				Expect(&frame.Data[0]).To(BeIdenticalTo(&buf.Data[2]))
+				buf.Release()
+				Expect(frame.Data).To(Equal(data))
+				frame.PutData()
+				Expect(frame.Data).To(BeNil())
+				Expect(func() { buf.Release() }).To(Panic())
+			})
+
+			It("continues reading after the data", func() {
+				data := bytes.Repeat([]byte{'f'}, int(protocol.MinPooledStreamFrameDataLen))
+				buf.Data = append(buf.Data, 0xa0, 0x1)
+				buf.Data = append(buf.Data, 0x0, 0x0)
+				binary.LittleEndian.PutUint16(buf.Data[2:], uint16(len(data)))
+				buf.Data = append(buf.Data, data...)
+				buf.Data = append(buf.Data, 0x42)
+				r := bytes.NewReader(buf.Data)
+				frame, err := ParseStreamFrameFromPacketBuffer(r, buf, protocol.VersionWhatever)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Data).To(Equal(data))
+				Expect(r.Len()).To(Equal(1))
+				frame.PutData()
+				buf.Release()
+			})
+
+			It("copies the data of small frames", func() {
+				buf.Data = append(buf.Data, 0x80, 0x1, 'f', 'o', 'o')
+				frame, err := ParseStreamFrameFromPacketBuffer(bytes.NewReader(buf.Data), buf, protocol.VersionWhatever)
+				Expect(err).ToNot(HaveOccurred())
+				buf.Release()
+				Expect(frame.Data).To(Equal([]byte("foo")))
+				Expect(frame.buffer).To(BeNil())
+			})
+
+			It("errors if the data length exceeds the packet", func() {
+				data := bytes.Repeat([]byte{'f'}, int(protocol.MinPooledStreamFrameDataLen))
+				buf.Data = append(buf.Data, 0xa0, 0x1, 0x0, 0x0)
+				binary.LittleEndian.PutUint16(buf.Data[2:], uint16(len(data)+1))
+				buf.Data = append(buf.Data, data...)
+				_, err := ParseStreamFrameFromPacketBuffer(bytes.NewReader(buf.Data), buf, protocol.VersionWhatever)
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+				buf.Release()
+			})
+		})
+
 		It("rejects frames to too large dataLen", func() {
-			b := bytes.NewReader([]byte{0xa0, 0x1, 0xff, 0xf})
+			b := bytes.NewReader([]byte{0xa0, 0x1, 0xff, 0xff})
 			_, err := ParseStreamFrame(b, protocol.VersionWhatever)
 			Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamData, "data len too large")))
 		})
@@ -0,0 +1,81 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The mtuDiscoverer performs datagram packetization layer path MTU discovery (DPLPMTUD).
+// It sends padded probe packets, and does a binary search for the largest packet size that is acknowledged by the peer.
+// Only one probe is outstanding at any time.
+type mtuDiscoverer struct {
+	current protocol.ByteCount // the largest packet size that is known to work
+	max     protocol.ByteCount // the largest packet size that might work
+
+	nextProbeSize protocol.ByteCount // the size of the next probe, 0 if it needs to be calculated
+	probeSize     protocol.ByteCount // the size of the outstanding probe, 0 if there is none
+	lostProbes    int                // the number of probes of the next probe size that were lost
+}
+
+func newMTUDiscoverer(current, max protocol.ByteCount) *mtuDiscoverer {
+	return &mtuDiscoverer{
+		current: current,
+		max:     max,
+	}
+}
+
+// done says if the search is complete
+func (d *mtuDiscoverer) done() bool {
+	return d.max < d.current+protocol.MTUSearchThreshold
+}
+
+// ShouldSendProbe says if a probe packet should be sent now
+func (d *mtuDiscoverer) ShouldSendProbe() bool {
+	return d.probeSize == 0 && !d.done()
+}
+
+// NextProbeSize returns the size of the next probe packet.
+// It must be called when the probe is sent.
+func (d *mtuDiscoverer) NextProbeSize() protocol.ByteCount {
+	if d.nextProbeSize == 0 {
+		d.nextProbeSize = (d.current + d.max + 1) / 2
+	}
+	d.probeSize = d.nextProbeSize
+	return d.probeSize
+}
+
+// OnProbeResult handles the result of a probe. It returns true if the packet size was raised.
+func (d *mtuDiscoverer) OnProbeResult(res *ackhandler.MTUProbeResult) bool {
+	if res.Size != d.probeSize {
+		return false
+	}
+	d.probeSize = 0
+	if res.Acked {
+		d.current = res.Size
+		d.nextProbeSize = 0
+		d.lostProbes = 0
+		return true
+	}
+	// A single lost probe might have been lost due to congestion. Only give up on this size after a few attempts.
+	d.lostProbes++
+	if d.lostProbes >= protocol.MaxMTUProbes {
+		d.max = res.Size - 1
+		d.nextProbeSize = 0
+		d.lostProbes = 0
+	}
+	return false
+}
+
+// OnProbeTooLarge handles a probe that couldn't be sent, because it is larger than the MTU of the network interface.
+// Larger probes won't be sent anymore. The loss of this probe will be reported later, and is ignored.
+func (d *mtuDiscoverer) OnProbeTooLarge() {
+	d.max = d.probeSize - 1
+	d.probeSize = 0
+	d.nextProbeSize = 0
+	d.lostProbes = 0
+}
+
+// CurrentSize returns the largest packet size that is known to work
+func (d *mtuDiscoverer) CurrentSize() protocol.ByteCount {
+	return d.current
+}
@@ -0,0 +1,78 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU Discoverer", func() {
+	var d *mtuDiscoverer
+
+	BeforeEach(func() {
+		d = newMTUDiscoverer(1000, 2000)
+	})
+
+	It("probes the size in the middle of the search interval", func() {
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1500)))
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+	})
+
+	It("raises the size when a probe is acknowledged", func() {
+		size := d.NextProbeSize()
+		Expect(d.OnProbeResult(&ackhandler.MTUProbeResult{Size: size, Acked: true})).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(size))
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1750)))
+	})
+
+	It("retries a lost probe, and lowers the upper bound after MaxMTUProbes probes were lost", func() {
+		for i := 0; i < protocol.MaxMTUProbes; i++ {
+			Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1500)))
+			Expect(d.OnProbeResult(&ackhandler.MTUProbeResult{Size: 1500})).To(BeFalse())
+		}
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1000)))
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1250)))
+	})
+
+	It("lowers the upper bound immediately when a probe is too large for the network interface", func() {
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1500)))
+		d.OnProbeTooLarge()
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1250)))
+		// the loss of the probe that was too large is reported later
+		Expect(d.OnProbeResult(&ackhandler.MTUProbeResult{Size: 1500})).To(BeFalse())
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+		Expect(d.OnProbeResult(&ackhandler.MTUProbeResult{Size: 1250, Acked: true})).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1250)))
+	})
+
+	It("ignores results for other probe sizes", func() {
+		d.NextProbeSize()
+		Expect(d.OnProbeResult(&ackhandler.MTUProbeResult{Size: 1234, Acked: true})).To(BeFalse())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1000)))
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+	})
+
+	It("stops when the search interval is smaller than the threshold", func() {
+		var probes int
+		for d.ShouldSendProbe() {
+			size := d.NextProbeSize()
+			d.OnProbeResult(&ackhandler.MTUProbeResult{Size: size, Acked: size <= 1600})
+			probes++
+		}
+		Expect(d.CurrentSize()).To(And(
+			BeNumerically("<=", 1600),
+			BeNumerically(">", 1600-protocol.MTUSearchThreshold),
+		))
+		Expect(probes).To(BeNumerically("<", 50))
+	})
+
+	It("doesn't probe if the maximum size is already reached", func() {
+		d = newMTUDiscoverer(1350, 1350)
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+	})
+})
@@ -0,0 +1,29 @@
+package quic
+
+import "net"
+
+// The connectedPacketConn is a net.PacketConn for a connected net.Conn that preserves packet boundaries
+type connectedPacketConn struct {
+	net.Conn
+}
+
+var _ net.PacketConn = &connectedPacketConn{}
+
+// NewConnectedPacketConn turns a connected net.Conn that preserves packet boundaries into a net.PacketConn,
+// such that it can be passed to Listen and Dial.
+// This allows running QUIC over any datagram transport, e.g. a connected Unix datagram socket, or a TUN device.
+// Every call to Read must return a single packet, and every call to Write must send a single packet.
+// All packets are sent to the remote address of the net.Conn, and all received packets are reported as being sent from it.
+func NewConnectedPacketConn(c net.Conn) net.PacketConn {
+	return &connectedPacketConn{Conn: c}
+}
+
+func (c *connectedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+// WriteTo sends a packet to the remote address of the net.Conn. The address is ignored.
+func (c *connectedPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.Write(b)
+}
@@ -0,0 +1,44 @@
+package quic
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connected PacketConn", func() {
+	var (
+		pconn  net.PacketConn
+		remote net.Conn
+	)
+
+	BeforeEach(func() {
+		var c net.Conn
+		c, remote = net.Pipe()
+		pconn = NewConnectedPacketConn(c)
+	})
+
+	It("reads packets", func() {
+		go remote.Write([]byte("foobar"))
+		b := make([]byte, 100)
+		n, addr, err := pconn.ReadFrom(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+		Expect(addr).To(Equal(remote.LocalAddr()))
+	})
+
+	It("writes packets to the remote address", func() {
+		go pconn.WriteTo([]byte("foobar"), &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234})
+		b := make([]byte, 100)
+		n, err := remote.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+	})
+
+	It("closes the underlying net.Conn", func() {
+		Expect(pconn.Close()).To(Succeed())
+		_, err := remote.Read(make([]byte, 100))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"github.com/lucas-clemente/quic-go/ackhandler"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
@@ -27,17 +28,22 @@ type packetPacker struct {
 	packetNumberGenerator *packetNumberGenerator
 	connParams            handshake.ParamsNegotiator
 	streamFramer          *streamFramer
+	datagramQueue         *datagramQueue // nil if datagrams are not enabled
 
 	controlFrames []wire.Frame
 	stopWaiting   *wire.StopWaitingFrame
 	ackFrame      *wire.AckFrame
 	leastUnacked  protocol.PacketNumber
+
+	// the maximum size of packets, it is raised by path MTU discovery
+	maxPacketSize protocol.ByteCount
 }
 
 func newPacketPacker(connectionID protocol.ConnectionID,
 	cryptoSetup handshake.CryptoSetup,
 	connParams handshake.ParamsNegotiator,
 	streamFramer *streamFramer,
+	datagramQueue *datagramQueue,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
@@ -48,12 +54,14 @@ func newPacketPacker(connectionID protocol.ConnectionID,
 		perspective:           perspective,
 		version:               version,
 		streamFramer:          streamFramer,
+		datagramQueue:         datagramQueue,
 		packetNumberGenerator: newPacketNumberGenerator(protocol.SkipPacketAveragePeriodLength),
+		maxPacketSize:         protocol.MaxPacketSize,
 	}
 }
 
-// PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame
-func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*packedPacket, error) {
+// PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame or an ApplicationCloseFrame
+func (p *packetPacker) PackConnectionClose(ccf wire.Frame) (*packedPacket, error) {
 	frames := []wire.Frame{ccf}
 	encLevel, sealer := p.cryptoSetup.GetSealer()
 	ph := p.getPublicHeader(encLevel)
@@ -115,8 +123,26 @@ func (p *packetPacker) PackHandshakeRetransmission(packet *ackhandler.Packet) (*
 	}, err
 }
 
+// PackMTUProbePacket packs a packet of the given size for path MTU discovery.
+// It only contains a PING frame, and is padded to the probe size.
+func (p *packetPacker) PackMTUProbePacket(size protocol.ByteCount) (*packedPacket, error) {
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.EncryptionForwardSecure {
+		return nil, errors.New("PacketPacker BUG: path MTU probes must be forward-secure encrypted")
+	}
+	ph := p.getPublicHeader(encLevel)
+	frames := []wire.Frame{&wire.PingFrame{}}
+	raw, err := p.writeAndSealPaddedPacket(ph, frames, sealer, size)
+	return &packedPacket{
+		number:          ph.PacketNumber,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
 // PackPacket packs a new packet
-// the other controlFrames are sent in the next packet, but might be queued and sent in the next packet if the packet would overflow MaxPacketSize otherwise
+// the other controlFrames are sent in the next packet, but might be queued and sent in the next packet if the packet would overflow the maximum packet size otherwise
 func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	if p.streamFramer.HasCryptoStreamFrame() {
 		return p.packCryptoPacket()
@@ -134,7 +160,7 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 		p.stopWaiting.PacketNumberLen = publicHeader.PacketNumberLen
 	}
 
-	maxSize := protocol.MaxPacketSize - protocol.ByteCount(sealer.Overhead()) - publicHeaderLength
+	maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - publicHeaderLength
 	payloadFrames, err := p.composeNextPacket(maxSize, p.canSendData(encLevel))
 	if err != nil {
 		return nil, err
@@ -170,7 +196,7 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 	if err != nil {
 		return nil, err
 	}
-	maxLen := protocol.MaxPacketSize - protocol.ByteCount(sealer.Overhead()) - protocol.NonForwardSecurePacketSizeReduction - publicHeaderLength
+	maxLen := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - protocol.NonForwardSecurePacketSizeReduction - publicHeaderLength
 	frames := []wire.Frame{p.streamFramer.PopCryptoStreamFrame(maxLen)}
 	raw, err := p.writeAndSealPacket(publicHeader, frames, sealer)
 	if err != nil {
@@ -231,6 +257,22 @@ func (p *packetPacker) composeNextPacket(
 		return payloadFrames, nil
 	}
 
+	// DATAGRAM frames are packed before the STREAM frames, since they are meant for latency-critical data
+	if p.datagramQueue != nil {
+		for f := p.datagramQueue.Peek(); f != nil; f = p.datagramQueue.Peek() {
+			l, err := f.MinLength(p.version)
+			if err != nil {
+				return nil, err
+			}
+			if payloadLength+l > maxFrameSize {
+				break
+			}
+			payloadFrames = append(payloadFrames, f)
+			payloadLength += l
+			p.datagramQueue.Pop()
+		}
+	}
+
 	// temporarily increase the maxFrameSize by 2 bytes
 	// this leads to a properly sized packet in all cases, since we do all the packet length calculations with StreamFrames that have the DataLen set
 	// however, for the last StreamFrame in the packet, we can omit the DataLen, thus saving 2 bytes and yielding a packet of exactly the correct size
@@ -290,7 +332,22 @@ func (p *packetPacker) writeAndSealPacket(
 	payloadFrames []wire.Frame,
 	sealer handshake.Sealer,
 ) ([]byte, error) {
-	raw := getPacketBuffer()
+	return p.writeAndSealPaddedPacket(publicHeader, payloadFrames, sealer, 0)
+}
+
+// writeAndSealPaddedPacket writes and seals a packet.
+// If paddedSize is not 0, PADDING is added such that the packet has exactly this size, which may exceed the maximum packet size.
+func (p *packetPacker) writeAndSealPaddedPacket(
+	publicHeader *wire.PublicHeader,
+	payloadFrames []wire.Frame,
+	sealer handshake.Sealer,
+	paddedSize protocol.ByteCount,
+) ([]byte, error) {
+	maxSize := p.maxPacketSize
+	if paddedSize != 0 {
+		maxSize = paddedSize
+	}
+	raw := utils.GetPacketBufferForSize(maxSize)
 	buffer := bytes.NewBuffer(raw)
 
 	if err := publicHeader.Write(buffer, p.version, p.perspective); err != nil {
@@ -303,9 +360,13 @@ func (p *packetPacker) writeAndSealPacket(
 			return nil, err
 		}
 	}
-	if protocol.ByteCount(buffer.Len()+sealer.Overhead()) > protocol.MaxPacketSize {
+	if protocol.ByteCount(buffer.Len()+sealer.Overhead()) > maxSize {
 		return nil, errors.New("PacketPacker BUG: packet too large")
 	}
+	if paddedSize != 0 {
+		// PADDING frames consist of 0 bytes, and extend until the end of the packet
+		buffer.Write(make([]byte, int(paddedSize)-buffer.Len()-sealer.Overhead()))
+	}
 
 	raw = raw[0:buffer.Len()]
 	_ = sealer.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], publicHeader.PacketNumber, raw[:payloadStartIndex])
@@ -326,6 +387,11 @@ func (p *packetPacker) canSendData(encLevel protocol.EncryptionLevel) bool {
 	return encLevel == protocol.EncryptionForwardSecure
 }
 
+// SetMaxPacketSize sets the maximum size of packets
+func (p *packetPacker) SetMaxPacketSize(size protocol.ByteCount) {
+	p.maxPacketSize = size
+}
+
 func (p *packetPacker) SetLeastUnacked(leastUnacked protocol.PacketNumber) {
 	p.leastUnacked = leastUnacked
 }
@@ -3,7 +3,6 @@ package quic
 import (
 	"bytes"
 	"io"
-	"math"
 
 	"github.com/lucas-clemente/quic-go/ackhandler"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
@@ -78,6 +77,7 @@ var _ = Describe("Packet packer", func() {
 			packetNumberGenerator: newPacketNumberGenerator(protocol.SkipPacketAveragePeriodLength),
 			streamFramer:          streamFramer,
 			perspective:           protocol.PerspectiveServer,
+			maxPacketSize:         protocol.MaxPacketSize,
 		}
 		publicHeaderLen = 1 + 8 + 2 // 1 flag byte, 8 connection ID, 2 packet number
 		maxFrameSize = protocol.MaxPacketSize - protocol.ByteCount((&mockSealer{}).Overhead()) - publicHeaderLen
@@ -467,6 +467,19 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.raw).To(HaveLen(int(protocol.MaxPacketSize)))
 		})
 
+		It("packs larger packets after the maximum packet size was raised", func() {
+			packer.SetMaxPacketSize(2000)
+			f := &wire.StreamFrame{
+				StreamID: 5,
+				Data:     bytes.Repeat([]byte{'f'}, 3000),
+			}
+			streamFramer.AddFrameForRetransmission(f)
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(2000))
+			Expect(p.raw).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+		})
+
 		It("splits a stream frame larger than the maximum size", func() {
 			f := &wire.StreamFrame{
 				StreamID: 5,
@@ -553,6 +566,69 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("DATAGRAM frame handling", func() {
+		var datagramQueue *datagramQueue
+
+		BeforeEach(func() {
+			datagramQueue = newDatagramQueue(func() {})
+			packer.datagramQueue = datagramQueue
+		})
+
+		It("packs DATAGRAM frames before STREAM frames", func() {
+			f := &wire.DatagramFrame{Data: []byte("foobar")}
+			Expect(datagramQueue.Add(f)).To(Succeed())
+			sf := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			streamFramer.AddFrameForRetransmission(sf)
+			payloadFrames, err := packer.composeNextPacket(maxFrameSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloadFrames).To(Equal([]wire.Frame{f, sf}))
+			Expect(datagramQueue.Peek()).To(BeNil())
+		})
+
+		It("packs multiple DATAGRAM frames into one packet", func() {
+			f1 := &wire.DatagramFrame{Data: []byte("foo")}
+			f2 := &wire.DatagramFrame{Data: []byte("bar")}
+			Expect(datagramQueue.Add(f1)).To(Succeed())
+			Expect(datagramQueue.Add(f2)).To(Succeed())
+			payloadFrames, err := packer.composeNextPacket(maxFrameSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloadFrames).To(Equal([]wire.Frame{f1, f2}))
+		})
+
+		It("packs a DATAGRAM frame into the next packet, if it doesn't fit", func() {
+			f1 := &wire.DatagramFrame{Data: bytes.Repeat([]byte{'f'}, int(maxFrameSize)/2)}
+			f2 := &wire.DatagramFrame{Data: bytes.Repeat([]byte{'b'}, int(maxFrameSize)/2)}
+			Expect(datagramQueue.Add(f1)).To(Succeed())
+			Expect(datagramQueue.Add(f2)).To(Succeed())
+			payloadFrames, err := packer.composeNextPacket(maxFrameSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloadFrames).To(Equal([]wire.Frame{f1}))
+			payloadFrames, err = packer.composeNextPacket(maxFrameSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloadFrames).To(Equal([]wire.Frame{f2}))
+		})
+
+		It("fills a packet with a DATAGRAM frame of the maximum size", func() {
+			f := &wire.DatagramFrame{}
+			headerLen, _ := f.MinLength(0)
+			f.Data = bytes.Repeat([]byte{'f'}, int(maxFrameSize-headerLen))
+			Expect(datagramQueue.Add(f)).To(Succeed())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f}))
+			Expect(p.raw).To(HaveLen(int(protocol.MaxPacketSize)))
+		})
+
+		It("doesn't pack DATAGRAM frames if it can't send data", func() {
+			f := &wire.DatagramFrame{Data: []byte("foobar")}
+			Expect(datagramQueue.Add(f)).To(Succeed())
+			payloadFrames, err := packer.composeNextPacket(maxFrameSize, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloadFrames).To(BeEmpty())
+			Expect(datagramQueue.Peek()).To(Equal(f))
+		})
+	})
+
 	Context("Blocked frames", func() {
 		It("queues a BLOCKED frame", func() {
 			length := 100
@@ -715,7 +791,7 @@ var _ = Describe("Packet packer", func() {
 			packer.QueueControlFrame(&wire.AckFrame{})
 			p, err := packer.PackAckPacket()
 			Expect(err).NotTo(HaveOccurred())
-			Expect(p.frames).To(Equal([]wire.Frame{&wire.AckFrame{DelayTime: math.MaxInt64}}))
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.AckFrame{}}))
 		})
 
 		It("packs ACK packets with SWFs", func() {
@@ -724,9 +800,28 @@ var _ = Describe("Packet packer", func() {
 			p, err := packer.PackAckPacket()
 			Expect(err).NotTo(HaveOccurred())
 			Expect(p.frames).To(Equal([]wire.Frame{
-				&wire.AckFrame{DelayTime: math.MaxInt64},
+				&wire.AckFrame{},
 				&wire.StopWaitingFrame{PacketNumber: 1, PacketNumberLen: 2},
 			}))
 		})
 	})
+
+	Context("packing path MTU probes", func() {
+		It("packs a padded PING", func() {
+			p, err := packer.PackMTUProbePacket(1500)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+			Expect(p.raw).To(HaveLen(1500))
+			// the PING frame is followed by PADDING
+			payload := p.raw[publicHeaderLen+1:]
+			Expect(payload).To(Equal(make([]byte, len(payload))))
+		})
+
+		It("only sends probes with forward-secure encryption", func() {
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			_, err := packer.PackMTUProbePacket(1500)
+			Expect(err).To(MatchError("PacketPacker BUG: path MTU probes must be forward-secure encrypted"))
+		})
+	})
 })
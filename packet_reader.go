@@ -0,0 +1,138 @@
+package quic
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"golang.org/x/net/ipv4"
+)
+
+type receivedDatagram struct {
+	data       []byte
+	remoteAddr net.Addr
+}
+
+// A packetReader reads packets from a net.PacketConn.
+// The buffers of the packets are taken from the buffer pool. They are owned by the caller.
+type packetReader interface {
+	// ReadPackets blocks until at least one packet was read.
+	// The returned slice is only valid until the next call to ReadPackets.
+	ReadPackets() ([]receivedDatagram, error)
+	// SetMaxPacketSize raises the size of the largest packet that can be read.
+	// It may be called concurrently with ReadPackets, and takes effect with the next call to ReadPackets.
+	SetMaxPacketSize(protocol.ByteCount)
+}
+
+// An atomicPacketSize is the size of the largest packet that a packetReader reads
+type atomicPacketSize uint64 // accessed atomically
+
+func (s *atomicPacketSize) raise(size protocol.ByteCount) {
+	for {
+		old := atomic.LoadUint64((*uint64)(s))
+		if uint64(size) <= old || atomic.CompareAndSwapUint64((*uint64)(s), old, uint64(size)) {
+			return
+		}
+	}
+}
+
+func (s *atomicPacketSize) get() protocol.ByteCount {
+	return protocol.ByteCount(atomic.LoadUint64((*uint64)(s)))
+}
+
+// getBuffer gets a buffer from the buffer pool, that can hold a packet of the maximum packet size.
+// Its length is set to its capacity.
+func (s *atomicPacketSize) getBuffer() []byte {
+	data := utils.GetPacketBufferForSize(s.get())
+	return data[:cap(data)]
+}
+
+// newPacketReader returns a packetReader that uses batched I/O if the net.PacketConn supports it.
+func newPacketReader(c net.PacketConn) packetReader {
+	if bc, ok := newBatchConn(c); ok {
+		return newBatchPacketReader(bc)
+	}
+	return &singlePacketReader{conn: c, packets: make([]receivedDatagram, 1)}
+}
+
+// The singlePacketReader reads a single packet per call to ReadFrom.
+type singlePacketReader struct {
+	maxPacketSize atomicPacketSize
+
+	conn    net.PacketConn
+	packets []receivedDatagram
+}
+
+var _ packetReader = &singlePacketReader{}
+
+func (r *singlePacketReader) ReadPackets() ([]receivedDatagram, error) {
+	data := r.maxPacketSize.getBuffer()
+	// The packet size should not exceed the maximum packet size
+	// If it does, we only read a truncated packet, which will then end up undecryptable
+	n, remoteAddr, err := r.conn.ReadFrom(data)
+	if err != nil {
+		utils.PutPacketBuffer(data)
+		return nil, err
+	}
+	r.packets[0] = receivedDatagram{data: data[:n], remoteAddr: remoteAddr}
+	return r.packets, nil
+}
+
+func (r *singlePacketReader) SetMaxPacketSize(size protocol.ByteCount) {
+	r.maxPacketSize.raise(size)
+}
+
+// The batchPacketReader reads up to protocol.PacketBatchSize packets per call to ReadBatch.
+type batchPacketReader struct {
+	maxPacketSize atomicPacketSize
+
+	conn     batchConn
+	messages []ipv4.Message
+	packets  []receivedDatagram
+}
+
+var _ packetReader = &batchPacketReader{}
+
+func newBatchPacketReader(c batchConn) *batchPacketReader {
+	r := &batchPacketReader{
+		conn:     c,
+		messages: make([]ipv4.Message, protocol.PacketBatchSize),
+		packets:  make([]receivedDatagram, 0, protocol.PacketBatchSize),
+	}
+	for i := range r.messages {
+		r.messages[i].Buffers = make([][]byte, 1)
+	}
+	return r
+}
+
+func (r *batchPacketReader) ReadPackets() ([]receivedDatagram, error) {
+	// the buffers of the packets returned by the last call are now owned by the caller
+	size := r.maxPacketSize.get()
+	for i := range r.messages {
+		buf := r.messages[i].Buffers[0]
+		if buf != nil && protocol.ByteCount(len(buf)) < size {
+			// the maximum packet size was raised since this buffer was allocated
+			utils.PutPacketBuffer(buf)
+			buf = nil
+		}
+		if buf == nil {
+			r.messages[i].Buffers[0] = r.maxPacketSize.getBuffer()
+		}
+	}
+	n, err := r.conn.ReadBatch(r.messages, 0)
+	if err != nil {
+		return nil, err
+	}
+	r.packets = r.packets[:0]
+	for i := 0; i < n; i++ {
+		msg := &r.messages[i]
+		r.packets = append(r.packets, receivedDatagram{data: msg.Buffers[0][:msg.N], remoteAddr: msg.Addr})
+		msg.Buffers[0] = nil
+	}
+	return r.packets, nil
+}
+
+func (r *batchPacketReader) SetMaxPacketSize(size protocol.ByteCount) {
+	r.maxPacketSize.raise(size)
+}
@@ -0,0 +1,176 @@
+package quic
+
+import (
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/net/ipv4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockBatchConn struct {
+	packetsToRead [][]byte // all packets are returned by a single call to ReadBatch
+	readFrom      net.Addr
+	readErr       error
+
+	maxWriteBatch   int // the maximum number of messages written per call to WriteBatch, 0 means unlimited
+	writeCalls      int
+	written         [][]byte
+	writtenTo       net.Addr
+	writtenSegments []int // the number of segments of every message that was written with a segment size
+	writeErr        error
+	gsoErr          error // returned when writing a message with a segment size
+}
+
+var _ batchConn = &mockBatchConn{}
+
+func (c *mockBatchConn) ReadBatch(ms []ipv4.Message, _ int) (int, error) {
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+	var n int
+	for n < len(ms) && n < len(c.packetsToRead) {
+		ms[n].N = copy(ms[n].Buffers[0], c.packetsToRead[n])
+		ms[n].Addr = c.readFrom
+		n++
+	}
+	c.packetsToRead = c.packetsToRead[n:]
+	return n, nil
+}
+
+func (c *mockBatchConn) WriteBatch(ms []ipv4.Message, _ int) (int, error) {
+	c.writeCalls++
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	if c.gsoErr != nil {
+		for _, m := range ms {
+			if len(m.OOB) > 0 {
+				return 0, c.gsoErr
+			}
+		}
+	}
+	n := len(ms)
+	if c.maxWriteBatch != 0 && n > c.maxWriteBatch {
+		n = c.maxWriteBatch
+	}
+	for _, m := range ms[:n] {
+		c.written = append(c.written, m.Buffers...)
+		c.writtenTo = m.Addr
+		if len(m.OOB) > 0 {
+			c.writtenSegments = append(c.writtenSegments, len(m.Buffers))
+		}
+	}
+	return n, nil
+}
+
+var _ = Describe("Packet Reader", func() {
+	remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 100, 200), Port: 1337}
+
+	It("uses the single packet reader for arbitrary net.PacketConns", func() {
+		Expect(newPacketReader(&mockPacketConn{})).To(BeAssignableToTypeOf(&singlePacketReader{}))
+	})
+
+	It("reads a single packet", func() {
+		pconn := &mockPacketConn{dataToRead: []byte("foobar"), dataReadFrom: remoteAddr}
+		r := newPacketReader(pconn)
+		packets, err := r.ReadPackets()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packets).To(HaveLen(1))
+		Expect(packets[0].data).To(Equal([]byte("foobar")))
+		Expect(packets[0].data).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+		Expect(packets[0].remoteAddr).To(Equal(remoteAddr))
+	})
+
+	It("reads large packets after the maximum packet size was raised", func() {
+		pconn := &mockPacketConn{dataToRead: make([]byte, 2000), dataReadFrom: remoteAddr}
+		r := newPacketReader(pconn)
+		r.SetMaxPacketSize(1000) // doesn't lower the size
+		r.SetMaxPacketSize(2000)
+		packets, err := r.ReadPackets()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packets[0].data).To(HaveLen(2000))
+		Expect(packets[0].data).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+	})
+
+	It("returns read errors of the single packet reader", func() {
+		testErr := errors.New("read error")
+		r := newPacketReader(&mockPacketConn{readErr: testErr})
+		_, err := r.ReadPackets()
+		Expect(err).To(MatchError(testErr))
+	})
+
+	Context("reading batches", func() {
+		var (
+			bc *mockBatchConn
+			r  *batchPacketReader
+		)
+
+		BeforeEach(func() {
+			bc = &mockBatchConn{readFrom: remoteAddr}
+			r = newBatchPacketReader(bc)
+		})
+
+		It("reads multiple packets", func() {
+			bc.packetsToRead = [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packets).To(HaveLen(3))
+			Expect(packets[0].data).To(Equal([]byte("foo")))
+			Expect(packets[1].data).To(Equal([]byte("bar")))
+			Expect(packets[2].data).To(Equal([]byte("baz")))
+			for _, p := range packets {
+				Expect(p.data).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+				Expect(p.remoteAddr).To(Equal(remoteAddr))
+			}
+		})
+
+		It("reads at most protocol.PacketBatchSize packets at once", func() {
+			for i := 0; i < protocol.PacketBatchSize+1; i++ {
+				bc.packetsToRead = append(bc.packetsToRead, []byte{byte(i)})
+			}
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packets).To(HaveLen(protocol.PacketBatchSize))
+			packets, err = r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packets).To(HaveLen(1))
+			Expect(packets[0].data).To(Equal([]byte{protocol.PacketBatchSize}))
+		})
+
+		It("doesn't reuse buffers that were returned", func() {
+			bc.packetsToRead = [][]byte{[]byte("foo")}
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			first := packets[0].data
+			bc.packetsToRead = [][]byte{[]byte("bar")}
+			_, err = r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).To(Equal([]byte("foo")))
+		})
+
+		It("replaces buffers that are too small after the maximum packet size was raised", func() {
+			bc.packetsToRead = [][]byte{[]byte("foo")}
+			_, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			r.SetMaxPacketSize(2000)
+			bc.packetsToRead = [][]byte{make([]byte, 2000), make([]byte, 2000)}
+			packets, err := r.ReadPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(packets).To(HaveLen(2))
+			for _, p := range packets {
+				Expect(p.data).To(HaveLen(2000))
+			}
+		})
+
+		It("returns read errors", func() {
+			testErr := errors.New("read error")
+			bc.readErr = testErr
+			_, err := r.ReadPackets()
+			Expect(err).To(MatchError(testErr))
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	"github.com/lucas-clemente/quic-go/qerr"
 )
@@ -25,13 +26,20 @@ type packetUnpacker struct {
 }
 
 func (u *packetUnpacker) Unpack(publicHeaderBinary []byte, hdr *wire.PublicHeader, data []byte) (*unpackedPacket, error) {
-	buf := getPacketBuffer()
-	defer putPacketBuffer(buf)
-	decrypted, encryptionLevel, err := u.aead.Open(buf, data, hdr.PacketNumber, publicHeaderBinary)
+	buf := utils.GetSharedPacketBuffer(protocol.ByteCount(len(data)))
+	defer buf.Release()
+	decrypted, encryptionLevel, err := u.aead.Open(buf.Data, data, hdr.PacketNumber, publicHeaderBinary)
 	if err != nil {
 		// Wrap err in quicError so that public reset is sent by session
 		return nil, qerr.Error(qerr.DecryptionFailure, err.Error())
 	}
+	// STREAM frames can only point into the packet buffer if the packet was decrypted into it.
+	// The null AEAD returns a slice of the received packet instead, which is reused after processing the packet.
+	var sharedBuf *utils.PacketBuffer
+	if len(decrypted) > 0 && &decrypted[0] == &buf.Data[:1][0] {
+		buf.Data = decrypted
+		sharedBuf = buf
+	}
 	r := bytes.NewReader(decrypted)
 
 	if r.Len() == 0 {
@@ -50,7 +58,7 @@ func (u *packetUnpacker) Unpack(publicHeaderBinary []byte, hdr *wire.PublicHeade
 
 		var frame wire.Frame
 		if typeByte&0x80 == 0x80 {
-			frame, err = wire.ParseStreamFrame(r, u.version)
+			frame, err = wire.ParseStreamFrameFromPacketBuffer(r, sharedBuf, u.version)
 			if err != nil {
 				err = qerr.Error(qerr.InvalidStreamData, err.Error())
 			} else {
@@ -100,11 +108,26 @@ func (u *packetUnpacker) Unpack(publicHeaderBinary []byte, hdr *wire.PublicHeade
 				}
 			case 0x07:
 				frame, err = wire.ParsePingFrame(r, u.version)
+			case 0x08:
+				frame, err = wire.ParseDatagramFrame(r, u.version)
+				if err != nil {
+					err = qerr.Error(qerr.InvalidFrameData, err.Error())
+				}
+			case 0x09:
+				frame, err = wire.ParseApplicationCloseFrame(r, u.version)
+				if err != nil {
+					err = qerr.Error(qerr.InvalidConnectionCloseData, err.Error())
+				}
 			default:
 				err = qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("unknown type byte 0x%x", typeByte))
 			}
 		}
 		if err != nil {
+			for _, f := range fs {
+				if sf, ok := f.(*wire.StreamFrame); ok {
+					sf.PutData()
+				}
+			}
 			return nil, err
 		}
 		if frame != nil {
@@ -14,11 +14,16 @@ import (
 
 type mockAEAD struct {
 	encLevelOpen protocol.EncryptionLevel
+	// decrypt into dst, like the AEADs used after the handshake
+	openToDst bool
 }
 
 func (m *mockAEAD) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
 	nullAEAD := crypto.NewNullAEAD(protocol.PerspectiveClient, protocol.VersionWhatever)
 	res, err := nullAEAD.Open(dst, src, packetNumber, associatedData)
+	if err == nil && m.openToDst {
+		res = append(dst[:0], res...)
+	}
 	return res, m.encLevelOpen, err
 }
 func (m *mockAEAD) Seal(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel) {
@@ -198,10 +203,32 @@ var _ = Describe("Packet unpacker", func() {
 		}))
 	})
 
+	It("accepts DATAGRAM frames", func() {
+		f := &wire.DatagramFrame{Data: []byte("foobar")}
+		err := f.Write(buf, 0)
+		Expect(err).ToNot(HaveOccurred())
+		setData(buf.Bytes())
+		packet, err := unpacker.Unpack(hdrBin, hdr, data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.frames).To(Equal([]wire.Frame{f}))
+	})
+
+	It("accepts APPLICATION_CLOSE frames", func() {
+		setData([]byte{0x09, 0x37, 0x13, 0, 0, 0x3, 0, 'f', 'o', 'o'})
+		packet, err := unpacker.Unpack(hdrBin, hdr, data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.frames).To(Equal([]wire.Frame{
+			&wire.ApplicationCloseFrame{
+				ErrorCode:    0x1337,
+				ReasonPhrase: "foo",
+			},
+		}))
+	})
+
 	It("errors on invalid type", func() {
-		setData([]byte{0x08})
+		setData([]byte{0x0a})
 		_, err := unpacker.Unpack(hdrBin, hdr, data)
-		Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x8"))
+		Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0xa"))
 	})
 
 	It("errors on invalid frames", func() {
@@ -214,6 +241,8 @@ var _ = Describe("Packet unpacker", func() {
 			0x04: qerr.InvalidWindowUpdateData,
 			0x05: qerr.InvalidBlockedData,
 			0x06: qerr.InvalidStopWaitingData,
+			0x08: qerr.InvalidFrameData,
+			0x09: qerr.InvalidConnectionCloseData,
 		} {
 			setData([]byte{b})
 			_, err := unpacker.Unpack(hdrBin, hdr, data)
@@ -250,6 +279,45 @@ var _ = Describe("Packet unpacker", func() {
 			Expect(packet.frames).To(Equal([]wire.Frame{f}))
 		})
 
+		Context("large STREAM frames", func() {
+			var f *wire.StreamFrame
+
+			BeforeEach(func() {
+				unpacker.aead.(*mockAEAD).encLevelOpen = protocol.EncryptionForwardSecure
+				f = &wire.StreamFrame{
+					StreamID: 3,
+					Data:     bytes.Repeat([]byte{'f'}, int(protocol.MinPooledStreamFrameDataLen)),
+				}
+				err := f.Write(buf, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Len()).To(Equal(2 + len(f.Data)))
+			})
+
+			It("lets the data point into the buffer the packet was decrypted into", func() {
+				unpacker.aead.(*mockAEAD).openToDst = true
+				setData(buf.Bytes())
+				packet, err := unpacker.Unpack(hdrBin, hdr, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packet.frames).To(HaveLen(1))
+				frame := packet.frames[0].(*wire.StreamFrame)
+				Expect(frame.Data).To(Equal(f.Data))
+				// the data starts after the type byte and the stream ID
+				Expect(frame.Data).To(HaveCap(int(protocol.MaxReceivePacketSize) - 2))
+				frame.PutData()
+			})
+
+			It("copies the data if the packet was not decrypted into the buffer", func() {
+				setData(buf.Bytes())
+				packet, err := unpacker.Unpack(hdrBin, hdr, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packet.frames).To(HaveLen(1))
+				frame := packet.frames[0].(*wire.StreamFrame)
+				Expect(frame.Data).To(Equal(f.Data))
+				Expect(frame.Data).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+				frame.PutData()
+			})
+		})
+
 		It("does not unpack unencrypted STREAM frames on higher streams", func() {
 			unpacker.aead.(*mockAEAD).encLevelOpen = protocol.EncryptionUnencrypted
 			f := &wire.StreamFrame{
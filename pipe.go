@@ -0,0 +1,149 @@
+package quic
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pipeQueueLen is the number of packets that can be queued at each end of a pipe.
+// Packets sent while the queue is full are dropped.
+const pipeQueueLen = 1024
+
+var errPipeClosed = errors.New("quic pipe: use of closed network connection")
+
+var pipeCounter uint64 // accessed atomically
+
+// The pipeAddr is the address of one end of a pipe
+type pipeAddr struct {
+	id uint64
+}
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return fmt.Sprintf("pipe-%d", a.id) }
+
+// A pipeEnd is one end of an in-memory pipe
+type pipeEnd struct {
+	localAddr  pipeAddr
+	remoteAddr pipeAddr
+
+	queue chan []byte
+	peer  *pipeEnd
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mutex           sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{} // closed when the read deadline is changed
+}
+
+var _ net.PacketConn = &pipeEnd{}
+
+// NewPipe creates an in-memory, connected pair of net.PacketConns.
+// It can be used to run a server and a client in the same process without using the network, e.g. in tests.
+// Every packet written to one end is received on the other end, no matter which address it is written to.
+// Like on a real network, packets are dropped if the receiver doesn't read them fast enough.
+func NewPipe() (net.PacketConn, net.PacketConn) {
+	id := atomic.AddUint64(&pipeCounter, 2)
+	a := newPipeEnd(pipeAddr{id: id - 1}, pipeAddr{id: id})
+	b := newPipeEnd(pipeAddr{id: id}, pipeAddr{id: id - 1})
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+func newPipeEnd(localAddr, remoteAddr pipeAddr) *pipeEnd {
+	return &pipeEnd{
+		localAddr:       localAddr,
+		remoteAddr:      remoteAddr,
+		queue:           make(chan []byte, pipeQueueLen),
+		closed:          make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+}
+
+func (p *pipeEnd) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		p.mutex.Lock()
+		deadline := p.readDeadline
+		deadlineChanged := p.deadlineChanged
+		p.mutex.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, errDeadline
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		select {
+		case data := <-p.queue:
+			stopTimer(timer)
+			return copy(b, data), p.remoteAddr, nil
+		case <-p.closed:
+			stopTimer(timer)
+			return 0, nil, errPipeClosed
+		case <-timeout:
+			return 0, nil, errDeadline
+		case <-deadlineChanged:
+			stopTimer(timer)
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// WriteTo sends a packet to the other end of the pipe. The address is ignored.
+// It never blocks.
+func (p *pipeEnd) WriteTo(b []byte, _ net.Addr) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, errPipeClosed
+	default:
+	}
+	data := make([]byte, len(b))
+	copy(data, b)
+	select {
+	case p.peer.queue <- data:
+	default:
+		// the queue is full, or the other end was closed
+	}
+	return len(b), nil
+}
+
+func (p *pipeEnd) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	return nil
+}
+
+func (p *pipeEnd) LocalAddr() net.Addr { return p.localAddr }
+
+func (p *pipeEnd) SetDeadline(t time.Time) error {
+	return p.SetReadDeadline(t)
+}
+
+func (p *pipeEnd) SetReadDeadline(t time.Time) error {
+	p.mutex.Lock()
+	p.readDeadline = t
+	close(p.deadlineChanged)
+	p.deadlineChanged = make(chan struct{})
+	p.mutex.Unlock()
+	return nil
+}
+
+// SetWriteDeadline is a no-op, since WriteTo never blocks.
+func (p *pipeEnd) SetWriteDeadline(time.Time) error { return nil }
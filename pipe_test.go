@@ -0,0 +1,140 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipe", func() {
+	var a, b net.PacketConn
+
+	BeforeEach(func() {
+		a, b = NewPipe()
+	})
+
+	It("has different addresses at both ends", func() {
+		Expect(a.LocalAddr().Network()).To(Equal("pipe"))
+		Expect(a.LocalAddr()).ToNot(Equal(b.LocalAddr()))
+		a2, _ := NewPipe()
+		Expect(a2.LocalAddr()).ToNot(Equal(a.LocalAddr()))
+		Expect(a2.LocalAddr()).ToNot(Equal(b.LocalAddr()))
+	})
+
+	It("sends packets", func() {
+		_, err := a.WriteTo([]byte("foo"), b.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		_, err = a.WriteTo([]byte("bar"), b.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		buf := make([]byte, 100)
+		n, addr, err := b.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf[:n]).To(Equal([]byte("foo")))
+		Expect(addr).To(Equal(a.LocalAddr()))
+		n, _, err = b.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf[:n]).To(Equal([]byte("bar")))
+	})
+
+	It("copies packets when sending them", func() {
+		data := []byte("foo")
+		_, err := b.WriteTo(data, nil)
+		Expect(err).ToNot(HaveOccurred())
+		data[0] = 'b'
+		buf := make([]byte, 100)
+		n, _, err := a.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf[:n]).To(Equal([]byte("foo")))
+	})
+
+	It("drops packets when the queue is full", func() {
+		for i := 0; i < pipeQueueLen+10; i++ {
+			_, err := a.WriteTo([]byte{byte(i)}, nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(b.(*pipeEnd).queue).To(HaveLen(pipeQueueLen))
+	})
+
+	It("returns an error when reading from a closed pipe", func() {
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, _, err := a.ReadFrom(make([]byte, 100))
+			Expect(err).To(MatchError(errPipeClosed))
+			close(done)
+		}()
+		Consistently(done).ShouldNot(BeClosed())
+		Expect(a.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+		_, err := a.WriteTo([]byte("foo"), nil)
+		Expect(err).To(MatchError(errPipeClosed))
+	})
+
+	It("doesn't error when sending to a closed end", func() {
+		Expect(b.Close()).To(Succeed())
+		_, err := a.WriteTo([]byte("foo"), nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("read deadlines", func() {
+		It("returns when the deadline expires", func() {
+			deadline := time.Now().Add(20 * time.Millisecond)
+			Expect(a.SetReadDeadline(deadline)).To(Succeed())
+			_, _, err := a.ReadFrom(make([]byte, 100))
+			Expect(err).To(MatchError(errDeadline))
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+			Expect(time.Now()).To(BeTemporally(">=", deadline))
+		})
+
+		It("returns immediately if the deadline is in the past", func() {
+			Expect(a.SetDeadline(time.Now().Add(-time.Second))).To(Succeed())
+			_, _, err := a.ReadFrom(make([]byte, 100))
+			Expect(err).To(MatchError(errDeadline))
+		})
+
+		It("applies deadlines set while reading", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, _, err := a.ReadFrom(make([]byte, 100))
+				Expect(err).To(MatchError(errDeadline))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(a.SetReadDeadline(time.Now().Add(10 * time.Millisecond))).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	It("runs a QUIC connection", func() {
+		serverConn, clientConn := NewPipe()
+		ln, err := Listen(serverConn, testdata.GetTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+		sess, err := Dial(clientConn, serverConn.LocalAddr(), "quic.clemente.io:443", &tls.Config{InsecureSkipVerify: true}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		str, err := sess.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(sess.Close(nil)).To(Succeed())
+	})
+})
@@ -92,6 +92,8 @@ const (
 	// Invalid data on the headers stream received because of decompression
 	// failure.
 	HeadersStreamDataDecompressFailure ErrorCode = 97
+	// The server has too many open sessions.
+	TooManySessionsOnServer ErrorCode = 96
 	// The peer received too much data, violating flow control.
 	FlowControlReceivedTooMuchData ErrorCode = 59
 	// The peer sent too much data, violating flow control.
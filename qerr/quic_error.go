@@ -17,6 +17,8 @@ func (e ErrorCode) Error() string {
 type QuicError struct {
 	ErrorCode    ErrorCode
 	ErrorMessage string
+	// Remote is set if the error was received from the peer in a CONNECTION_CLOSE frame
+	Remote bool
 }
 
 // Error creates a new QuicError instance
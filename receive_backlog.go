@@ -0,0 +1,53 @@
+package quic
+
+import "sync/atomic"
+
+// The receiveBacklog is shared by all sessions of a listener.
+// It keeps track of the sessions whose receive queue is more than half full, i.e. sessions that don't keep up with the rate of incoming packets.
+// The server consults it before starting new handshakes.
+// All methods may be called on a nil receiveBacklog, which is used for sessions that don't belong to a listener.
+type receiveBacklog struct {
+	sessions           int32  // accessed atomically
+	backloggedSessions int32  // accessed atomically
+	droppedPackets     uint64 // accessed atomically
+}
+
+func (b *receiveBacklog) addSession(delta int32) {
+	if b != nil {
+		atomic.AddInt32(&b.sessions, delta)
+	}
+}
+
+func (b *receiveBacklog) addBackloggedSession(delta int32) {
+	if b != nil {
+		atomic.AddInt32(&b.backloggedSessions, delta)
+	}
+}
+
+func (b *receiveBacklog) addDroppedPacket() {
+	if b != nil {
+		atomic.AddUint64(&b.droppedPackets, 1)
+	}
+}
+
+// overloaded says if more than half of the sessions are backlogged.
+// A single backlogged session is usually a session that receives more packets than it can process.
+// If most sessions are backlogged, the server as a whole can't keep up, and starting more handshakes would make it worse.
+func (b *receiveBacklog) overloaded() bool {
+	if b == nil {
+		return false
+	}
+	backlogged := atomic.LoadInt32(&b.backloggedSessions)
+	return backlogged > 0 && 2*backlogged > atomic.LoadInt32(&b.sessions)
+}
+
+func (b *receiveBacklog) stats() ListenerStats {
+	if b == nil {
+		return ListenerStats{}
+	}
+	return ListenerStats{
+		Sessions:           int(atomic.LoadInt32(&b.sessions)),
+		BackloggedSessions: int(atomic.LoadInt32(&b.backloggedSessions)),
+		DroppedPackets:     atomic.LoadUint64(&b.droppedPackets),
+	}
+}
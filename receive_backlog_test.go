@@ -0,0 +1,38 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Receive backlog", func() {
+	It("is overloaded when more than half of the sessions are backlogged", func() {
+		b := &receiveBacklog{}
+		Expect(b.overloaded()).To(BeFalse())
+		b.addSession(4)
+		b.addBackloggedSession(2)
+		Expect(b.overloaded()).To(BeFalse())
+		b.addBackloggedSession(1)
+		Expect(b.overloaded()).To(BeTrue())
+		b.addSession(2)
+		Expect(b.overloaded()).To(BeFalse())
+	})
+
+	It("reports statistics", func() {
+		b := &receiveBacklog{}
+		b.addSession(3)
+		b.addBackloggedSession(1)
+		b.addDroppedPacket()
+		b.addDroppedPacket()
+		Expect(b.stats()).To(Equal(ListenerStats{Sessions: 3, BackloggedSessions: 1, DroppedPackets: 2}))
+	})
+
+	It("can be used without a listener", func() {
+		var b *receiveBacklog
+		b.addSession(1)
+		b.addBackloggedSession(1)
+		b.addDroppedPacket()
+		Expect(b.overloaded()).To(BeFalse())
+		Expect(b.stats()).To(BeZero())
+	})
+})
@@ -0,0 +1,69 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// SO_REUSEPORT from asm-generic/socket.h, not defined in the syscall package
+const soReusePort = 0xf
+
+// listenUDPReusePort creates a UDP socket with the SO_REUSEPORT option set.
+// Multiple sockets with this option can be bound to the same address.
+// Like net.ListenUDP, it creates a dual-stack IPv6 socket if the address is unspecified,
+// and falls back to an IPv4 socket if IPv6 is not available.
+func listenUDPReusePort(addr *net.UDPAddr) (net.PacketConn, error) {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		conn, err := listenUDPReusePortFamily(syscall.AF_INET6, &syscall.SockaddrInet6{Port: addr.Port})
+		if err == nil || !isAddressFamilyNotSupported(err) {
+			return conn, err
+		}
+		return listenUDPReusePortFamily(syscall.AF_INET, &syscall.SockaddrInet4{Port: addr.Port})
+	}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return listenUDPReusePortFamily(syscall.AF_INET, sa)
+	}
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To16())
+	return listenUDPReusePortFamily(syscall.AF_INET6, sa)
+}
+
+func listenUDPReusePortFamily(family int, sa syscall.Sockaddr) (net.PacketConn, error) {
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	if family == syscall.AF_INET6 {
+		// also receive IPv4 packets (using IPv4-mapped IPv6 addresses), no matter how net.ipv6.bindv6only is configured
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0); err != nil {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// net.FilePacketConn duplicates the file descriptor
+	f := os.NewFile(uintptr(fd), "")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+// isAddressFamilyNotSupported says if creating a socket failed because the kernel doesn't support the address family
+func isAddressFamilyNotSupported(err error) bool {
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EAFNOSUPPORT
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package quic
+
+import (
+	"context"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SO_REUSEPORT", func() {
+	It("binds multiple sockets to the same address", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+		conn1, err := listenUDPReusePort(addr)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn1.Close()
+		conn2, err := listenUDPReusePort(conn1.LocalAddr().(*net.UDPAddr))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn2.Close()
+		Expect(conn1.LocalAddr().(*net.UDPAddr).Port).ToNot(BeZero())
+		Expect(conn2.LocalAddr().String()).To(Equal(conn1.LocalAddr().String()))
+		// a socket without SO_REUSEPORT can't be bound to the same address
+		_, err = net.ListenUDP("udp", conn1.LocalAddr().(*net.UDPAddr))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("binds to IPv6 addresses", func() {
+		conn, err := listenUDPReusePort(&net.UDPAddr{IP: net.IPv6loopback})
+		if err != nil {
+			Skip("IPv6 not available")
+		}
+		defer conn.Close()
+		Expect(conn.LocalAddr().(*net.UDPAddr).IP.Equal(net.IPv6loopback)).To(BeTrue())
+	})
+
+	It("creates dual-stack sockets for unspecified addresses", func() {
+		conn, err := listenUDPReusePort(&net.UDPAddr{})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		addr := conn.LocalAddr().(*net.UDPAddr)
+		if addr.IP.To4() != nil {
+			Skip("IPv6 not available")
+		}
+		Expect(addr.IP.Equal(net.IPv6unspecified)).To(BeTrue())
+		// the socket receives IPv4 packets
+		c, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: addr.Port})
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+		_, err = c.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		b := make([]byte, 10)
+		n, _, err := conn.ReadFrom(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+	})
+
+	It("listens on multiple sockets", func() {
+		ln, err := ListenAddrReusePort("127.0.0.1:0", 4, nil, &Config{Versions: protocol.SupportedVersions})
+		Expect(err).ToNot(HaveOccurred())
+		serv := ln.(*server)
+		Expect(serv.conns).To(HaveLen(4))
+		for _, c := range serv.conns {
+			Expect(c.LocalAddr().String()).To(Equal(ln.Addr().String()))
+		}
+		Expect(ln.Close()).To(Succeed())
+		_, err = ln.Accept(context.Background())
+		Expect(err).To(HaveOccurred())
+	})
+})
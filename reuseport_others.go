@@ -0,0 +1,12 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+func listenUDPReusePort(*net.UDPAddr) (net.PacketConn, error) {
+	return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -2,13 +2,17 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -30,24 +34,33 @@ type server struct {
 	tlsConf *tls.Config
 	config  *Config
 
-	conn net.PacketConn
+	// The server handles packets from all connections.
+	// Packets for existing sessions are routed to the session, no matter which connection they were received on.
+	// A connection may be shared with clients dialing from it, see the demultiplexer.
+	conns      []net.PacketConn
+	demuxes    []*demultiplexer
+	demuxMutex sync.Mutex
 
 	certChain crypto.CertChain
 	scfg      *handshake.ServerConfig
 
-	sessions                  map[protocol.ConnectionID]packetHandler
-	sessionsMutex             sync.RWMutex
+	sessions                  *sessionMap
 	deleteClosedSessionsAfter time.Duration
+	handshakesInProgress      int32 // accessed atomically
 
 	serverError  error
+	errorOnce    sync.Once
 	sessionQueue chan Session
 	errorChan    chan struct{}
 
-	newSession func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config) (packetHandler, <-chan handshakeEvent, error)
+	newSession func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config, retry *statelessRetry) (packetHandler, <-chan handshakeEvent, error)
 }
 
 var _ Listener = &server{}
 
+// ErrServerClosed is returned by Accept after the Listener was closed.
+var ErrServerClosed = errors.New("quic: server closed")
+
 // ListenAddr creates a QUIC server listening on a given address.
 // The listener is not active until Serve() is called.
 // The tls.Config must not be nil, the quic.Config may be nil.
@@ -63,10 +76,55 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 	return Listen(conn, tlsConf, config)
 }
 
+// ListenAddrReusePort creates a QUIC server listening on a given address, using numSockets UDP sockets.
+// All sockets are bound to the same address using the SO_REUSEPORT socket option,
+// and every socket is served by its own go routine.
+// The kernel distributes incoming packets between the sockets, packets belonging to an existing session are
+// passed to this session, no matter which socket they were received on.
+// SO_REUSEPORT is only supported on Linux.
+// The tls.Config must not be nil, the quic.Config may be nil.
+func ListenAddrReusePort(addr string, numSockets int, tlsConf *tls.Config, config *Config) (Listener, error) {
+	if numSockets < 1 {
+		return nil, fmt.Errorf("invalid number of sockets: %d", numSockets)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conns := make([]net.PacketConn, 0, numSockets)
+	closeConns := func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	for i := 0; i < numSockets; i++ {
+		conn, err := listenUDPReusePort(udpAddr)
+		if err != nil {
+			closeConns()
+			return nil, err
+		}
+		conns = append(conns, conn)
+		// if the port was chosen by the kernel, bind all following sockets to the same port
+		udpAddr = conn.LocalAddr().(*net.UDPAddr)
+	}
+	ln, err := listen(conns, tlsConf, config)
+	if err != nil {
+		closeConns()
+		return nil, err
+	}
+	return ln, nil
+}
+
 // Listen listens for QUIC connections on a given net.PacketConn.
 // The listener is not active until Serve() is called.
+// The net.PacketConn may also be used to dial outgoing connections using Dial.
+// It is closed as soon as the listener and all sessions dialed from it are closed.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
+	return listen([]net.PacketConn{conn}, tlsConf, config)
+}
+
+func listen(conns []net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
 	certChain := crypto.NewCertChain(tlsConf)
 	kex, err := crypto.NewCurve25519KEX()
 	if err != nil {
@@ -77,20 +135,31 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 		return nil, err
 	}
 
+	config = populateServerConfig(config)
 	s := &server{
-		conn:                      conn,
+		conns:                     conns,
 		tlsConf:                   tlsConf,
-		config:                    populateServerConfig(config),
+		config:                    config,
 		certChain:                 certChain,
 		scfg:                      scfg,
-		sessions:                  map[protocol.ConnectionID]packetHandler{},
+		sessions:                  newSessionMap(),
 		newSession:                newSession,
 		deleteClosedSessionsAfter: protocol.ClosedSessionDeleteTimeout,
-		sessionQueue:              make(chan Session, 5),
+		sessionQueue:              make(chan Session, config.MaxAcceptQueueLen),
 		errorChan:                 make(chan struct{}),
 	}
-	go s.serve()
-	utils.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
+	for _, conn := range conns {
+		d := getDemultiplexer(conn)
+		d.raiseMaxPacketSize(protocol.ByteCount(config.MaxPacketSize))
+		s.demuxes = append(s.demuxes, d)
+	}
+	for _, d := range s.demuxes {
+		if err := d.addServer(s); err != nil {
+			s.releaseDemultiplexers()
+			return nil, err
+		}
+	}
+	utils.Debugf("Listening for %s connections on %s (%d sockets)", s.Addr().Network(), s.Addr().String(), len(conns))
 	return s, nil
 }
 
@@ -143,6 +212,34 @@ func populateServerConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowServer
 	}
+	maxUnprocessedPackets := config.MaxUnprocessedPackets
+	if maxUnprocessedPackets <= 0 {
+		maxUnprocessedPackets = protocol.MaxSessionUnprocessedPackets
+	}
+	maxConcurrentHandshakes := config.MaxConcurrentHandshakes
+	if maxConcurrentHandshakes <= 0 {
+		maxConcurrentHandshakes = protocol.DefaultMaxConcurrentHandshakes
+	}
+	maxAcceptQueueLen := config.MaxAcceptQueueLen
+	if maxAcceptQueueLen <= 0 {
+		maxAcceptQueueLen = protocol.DefaultMaxAcceptQueueLen
+	}
+
+	sendBufferSize := config.SendBufferSize
+	if sendBufferSize == 0 {
+		sendBufferSize = protocol.DefaultSendBufferSize
+	}
+
+	maxPacketSize := config.MaxPacketSize
+	if maxPacketSize == 0 {
+		maxPacketSize = uint64(protocol.MaxPacketSize)
+	}
+	maxPacketSize = utils.MaxUint64(utils.MinUint64(maxPacketSize, uint64(protocol.MaxPacketBufferSize)), uint64(protocol.MinPacketSize))
+
+	clock := config.clock
+	if clock == nil {
+		clock = utils.DefaultClock{}
+	}
 
 	return &Config{
 		Versions:                              versions,
@@ -152,66 +249,114 @@ func populateServerConfig(config *Config) *Config {
 		KeepAlive:                             config.KeepAlive,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		MaxUnprocessedPackets:                 maxUnprocessedPackets,
+		StatelessRetryThreshold:               config.StatelessRetryThreshold,
+		MaxConcurrentHandshakes:               maxConcurrentHandshakes,
+		MaxAcceptQueueLen:                     maxAcceptQueueLen,
+		MaxPacketSize:                         maxPacketSize,
+		MaxReceiveBufferPerSession:            config.MaxReceiveBufferPerSession,
+		MaxReceiveBufferPerListener:           config.MaxReceiveBufferPerListener,
+		SendBufferSize:                        sendBufferSize,
+		EnableDatagrams:                       config.EnableDatagrams,
+		clock:                                 clock,
+		receiveBudget:                         flowcontrol.NewMemoryBudget(protocol.ByteCount(config.MaxReceiveBufferPerListener), nil),
+		receiveBacklog:                        &receiveBacklog{},
 	}
 }
 
-// serve listens on an existing PacketConn
-func (s *server) serve() {
-	for {
-		data := getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, remoteAddr, err := s.conn.ReadFrom(data)
-		if err != nil {
-			s.serverError = err
-			close(s.errorChan)
-			_ = s.Close()
-			return
-		}
-		data = data[:n]
-		if err := s.handlePacket(s.conn, remoteAddr, data); err != nil {
-			utils.Errorf("error handling packet: %s", err.Error())
-		}
-	}
+// handleReadError handles an error that occurred when reading from one of the connections
+func (s *server) handleReadError(err error) {
+	s.setError(err)
+	_ = s.Close()
 }
 
-// Accept returns newly openend sessions
-func (s *server) Accept() (Session, error) {
+// Accept returns newly openend sessions.
+// It returns ErrServerClosed after the server was closed.
+func (s *server) Accept(ctx context.Context) (Session, error) {
 	var sess Session
 	select {
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
 		return nil, s.serverError
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-// Close the server
+// Close the server.
+// It closes all sessions and the underlying connections.
 func (s *server) Close() error {
-	s.sessionsMutex.Lock()
-	for _, session := range s.sessions {
-		if session != nil {
-			s.sessionsMutex.Unlock()
-			_ = session.Close(nil)
-			s.sessionsMutex.Lock()
-		}
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting new sessions, and closes all sessions, sending a CONNECTION_CLOSE to every peer.
+// It waits until all sessions are closed or the context expires, and then closes the underlying connections.
+func (s *server) Shutdown(ctx context.Context) error {
+	s.setError(ErrServerClosed)
+
+	sessions := s.sessions.openSessions()
+	var wg sync.WaitGroup
+	wg.Add(len(sessions))
+	for _, session := range sessions {
+		go func(sess packetHandler) {
+			_ = sess.Close(nil)
+			wg.Done()
+		}(session)
 	}
-	s.sessionsMutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
 
-	if s.conn == nil {
-		return nil
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if cerr := s.releaseDemultiplexers(); err == nil {
+		err = cerr
 	}
-	return s.conn.Close()
+	return err
+}
+
+// releaseDemultiplexers stops handling packets from the connections.
+// A connection is closed unless it is still used by clients.
+func (s *server) releaseDemultiplexers() error {
+	s.demuxMutex.Lock()
+	demuxes := s.demuxes
+	s.demuxes = nil
+	s.demuxMutex.Unlock()
+
+	var err error
+	for _, d := range demuxes {
+		d.removeServer(s)
+		if rerr := d.release(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// setError sets the error returned by Accept
+// Only the first call has an effect.
+func (s *server) setError(err error) {
+	s.errorOnce.Do(func() {
+		s.serverError = err
+		close(s.errorChan)
+	})
 }
 
 // Addr returns the server's network address
+// If the server uses multiple connections, all of them are bound to this address.
 func (s *server) Addr() net.Addr {
-	return s.conn.LocalAddr()
+	return s.conns[0].LocalAddr()
 }
 
 func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet []byte) error {
-	rcvTime := time.Now()
+	rcvTime := s.config.clock.Now()
 
 	r := bytes.NewReader(packet)
 	connID, err := wire.PeekConnectionID(r, protocol.PerspectiveClient)
@@ -219,9 +364,7 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 		return qerr.Error(qerr.InvalidPacketHeader, err.Error())
 	}
 
-	s.sessionsMutex.RLock()
-	session, ok := s.sessions[connID]
-	s.sessionsMutex.RUnlock()
+	session, ok := s.sessions.get(connID)
 
 	if ok && session == nil {
 		// Late packet for closed session
@@ -283,41 +426,59 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 			return errors.New("Server BUG: negotiated version not supported")
 		}
 
-		utils.Infof("Serving new connection: %x, version %s from %v", hdr.ConnectionID, version, remoteAddr)
-		var handshakeChan <-chan handshakeEvent
-		session, handshakeChan, err = s.newSession(
-			&conn{pconn: pconn, currentAddr: remoteAddr},
-			version,
-			hdr.ConnectionID,
-			s.scfg,
-			s.tlsConf,
-			s.config,
-		)
-		if err != nil {
-			return err
+		select {
+		case <-s.errorChan:
+			// don't accept new connections after the server was closed
+			return nil
+		default:
 		}
-		s.sessionsMutex.Lock()
-		s.sessions[connID] = session
-		s.sessionsMutex.Unlock()
-
-		go func() {
-			// session.run() returns as soon as the session is closed
-			_ = session.run()
-			s.removeConnection(hdr.ConnectionID)
-		}()
-
-		go func() {
-			for {
-				ev := <-handshakeChan
-				if ev.err != nil {
-					return
-				}
-				if ev.encLevel == protocol.EncryptionForwardSecure {
-					break
-				}
+
+		var retry *statelessRetry
+		if s.statelessRetryRequired(version) {
+			var createSession bool
+			createSession, retry, err = s.validateAddress(pconn, remoteAddr, hdr, packet[len(packet)-r.Len():], rcvTime)
+			if err != nil || !createSession {
+				return err
+			}
+		}
+
+		shard := s.sessions.shard(connID)
+		shard.Lock()
+		// If the server uses multiple connections, another go routine might have created the session in the meantime.
+		if session, ok = shard.sessions[connID]; ok {
+			shard.Unlock()
+			if session == nil {
+				return nil
 			}
-			s.sessionQueue <- session
-		}()
+		} else if s.config.receiveBacklog.overloaded() {
+			shard.Unlock()
+			utils.Infof("Refusing connection %x: most sessions are not keeping up with incoming packets", hdr.ConnectionID)
+			return s.refuseConnection(pconn, remoteAddr, hdr)
+		} else if !s.startHandshake() {
+			shard.Unlock()
+			utils.Infof("Refusing connection %x: too many handshakes in progress", hdr.ConnectionID)
+			return s.refuseConnection(pconn, remoteAddr, hdr)
+		} else {
+			utils.Infof("Serving new connection: %x, version %s from %v", hdr.ConnectionID, version, remoteAddr)
+			var handshakeChan <-chan handshakeEvent
+			session, handshakeChan, err = s.newSession(
+				newConn(pconn, remoteAddr),
+				version,
+				hdr.ConnectionID,
+				s.scfg,
+				s.tlsConf,
+				s.config,
+				retry,
+			)
+			if err != nil {
+				shard.Unlock()
+				atomic.AddInt32(&s.handshakesInProgress, -1)
+				return err
+			}
+			shard.sessions[connID] = session
+			shard.Unlock()
+			s.runSession(session, handshakeChan, hdr.ConnectionID)
+		}
 	}
 	session.handlePacket(&receivedPacket{
 		remoteAddr:   remoteAddr,
@@ -328,14 +489,113 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 	return nil
 }
 
+func (s *server) Stats() ListenerStats {
+	return s.config.receiveBacklog.stats()
+}
+
+// startHandshake counts a new handshake.
+// It returns false if MaxConcurrentHandshakes handshakes are already in progress.
+// Sessions for different connection IDs are created concurrently, so the limit is enforced using a compare-and-swap.
+func (s *server) startHandshake() bool {
+	for {
+		n := atomic.LoadInt32(&s.handshakesInProgress)
+		if int(n) >= s.config.MaxConcurrentHandshakes {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.handshakesInProgress, n, n+1) {
+			return true
+		}
+	}
+}
+
+// runSession runs a new session, and queues it for Accept once the handshake completes.
+// If the accept queue is full, the session is closed.
+func (s *server) runSession(session packetHandler, handshakeChan <-chan handshakeEvent, connID protocol.ConnectionID) {
+	runDone := make(chan struct{})
+	go func() {
+		// session.run() returns as soon as the session is closed
+		_ = session.run()
+		s.removeConnection(connID)
+		close(runDone)
+	}()
+
+	go func() {
+	handshakeLoop:
+		for {
+			select {
+			case ev, ok := <-handshakeChan:
+				if !ok { // the handshakeChan is closed as soon as the handshake completes
+					break handshakeLoop
+				}
+				if ev.err != nil {
+					atomic.AddInt32(&s.handshakesInProgress, -1)
+					return
+				}
+				if ev.encLevel == protocol.EncryptionForwardSecure {
+					break handshakeLoop
+				}
+			case <-runDone:
+				// the session was closed before the handshake completed
+				atomic.AddInt32(&s.handshakesInProgress, -1)
+				return
+			}
+		}
+		atomic.AddInt32(&s.handshakesInProgress, -1)
+		select {
+		case <-s.errorChan:
+			// the server was closed while this session was performing the handshake
+			return
+		default:
+		}
+		select {
+		case s.sessionQueue <- session:
+		default:
+			utils.Infof("Refusing connection %x: accept queue full", connID)
+			_ = session.Close(qerr.Error(qerr.TooManySessionsOnServer, "accept queue full"))
+		}
+	}()
+}
+
+// refuseConnection closes a new connection without creating a session, by sending an unencrypted CONNECTION_CLOSE
+func (s *server) refuseConnection(pconn net.PacketConn, remoteAddr net.Addr, hdr *wire.PublicHeader) error {
+	return s.sendUnencryptedPacket(pconn, remoteAddr, hdr, []wire.Frame{
+		&wire.ConnectionCloseFrame{
+			ErrorCode:    qerr.TooManySessionsOnServer,
+			ReasonPhrase: "too many handshakes in progress",
+		},
+	})
+}
+
+// sendUnencryptedPacket sends a packet on a connection for which no session exists.
+// A session created after a stateless retry continues with the packet number following this packet.
+func (s *server) sendUnencryptedPacket(pconn net.PacketConn, remoteAddr net.Addr, hdr *wire.PublicHeader, frames []wire.Frame) error {
+	version := hdr.VersionNumber
+	replyHdr := &wire.PublicHeader{
+		ConnectionID:    hdr.ConnectionID,
+		PacketNumber:    statelessRetryPacketNumber,
+		PacketNumberLen: protocol.PacketNumberLen1,
+	}
+	buf := &bytes.Buffer{}
+	if err := replyHdr.Write(buf, version, protocol.PerspectiveServer); err != nil {
+		return err
+	}
+	payloadStartIndex := buf.Len()
+	for _, f := range frames {
+		if err := f.Write(buf, version); err != nil {
+			return err
+		}
+	}
+	aead := crypto.NewNullAEAD(protocol.PerspectiveServer, version)
+	raw := buf.Bytes()
+	raw = append(raw[:payloadStartIndex], aead.Seal(nil, raw[payloadStartIndex:], replyHdr.PacketNumber, raw[:payloadStartIndex])...)
+	_, err := pconn.WriteTo(raw, remoteAddr)
+	return err
+}
+
 func (s *server) removeConnection(id protocol.ConnectionID) {
-	s.sessionsMutex.Lock()
-	s.sessions[id] = nil
-	s.sessionsMutex.Unlock()
+	s.sessions.set(id, nil)
 
 	time.AfterFunc(s.deleteClosedSessionsAfter, func() {
-		s.sessionsMutex.Lock()
-		delete(s.sessions, id)
-		s.sessionsMutex.Unlock()
+		s.sessions.remove(id)
 	})
 }
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"net"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -60,12 +62,29 @@ func (s *mockSession) closeRemote(e error) {
 func (s *mockSession) OpenStream() (Stream, error) {
 	return &stream{streamID: 1337}, nil
 }
-func (s *mockSession) AcceptStream() (Stream, error)    { panic("not implemented") }
-func (s *mockSession) OpenStreamSync() (Stream, error)  { panic("not implemented") }
-func (s *mockSession) LocalAddr() net.Addr              { panic("not implemented") }
-func (s *mockSession) RemoteAddr() net.Addr             { panic("not implemented") }
-func (*mockSession) Context() context.Context           { panic("not implemented") }
-func (*mockSession) GetVersion() protocol.VersionNumber { return protocol.VersionWhatever }
+func (s *mockSession) AcceptStream() (Stream, error)        { panic("not implemented") }
+func (s *mockSession) OpenStreamSync() (Stream, error)      { panic("not implemented") }
+func (s *mockSession) LocalAddr() net.Addr                  { panic("not implemented") }
+func (s *mockSession) RemoteAddr() net.Addr                 { panic("not implemented") }
+func (*mockSession) Context() context.Context               { panic("not implemented") }
+func (*mockSession) Stats() SessionStats                    { panic("not implemented") }
+func (*mockSession) SendMessage([]byte) error               { panic("not implemented") }
+func (*mockSession) ReceiveMessage() ([]byte, error)        { panic("not implemented") }
+func (*mockSession) CloseWithError(ErrorCode, string) error { panic("not implemented") }
+func (*mockSession) GetVersion() protocol.VersionNumber     { return protocol.VersionWhatever }
+
+// blockingCloseSession is a mockSession whose Close blocks until unblock is closed
+type blockingCloseSession struct {
+	*mockSession
+	closing *int32
+	unblock chan struct{}
+}
+
+func (s *blockingCloseSession) Close(e error) error {
+	atomic.AddInt32(s.closing, 1)
+	<-s.unblock
+	return s.mockSession.Close(e)
+}
 
 var _ Session = &mockSession{}
 var _ NonFWSession = &mockSession{}
@@ -77,6 +96,7 @@ func newMockSession(
 	_ *handshake.ServerConfig,
 	_ *tls.Config,
 	_ *Config,
+	_ *statelessRetry,
 ) (packetHandler, <-chan handshakeEvent, error) {
 	s := mockSession{
 		connectionID:      connectionID,
@@ -87,6 +107,12 @@ func newMockSession(
 	return &s, s.handshakeChan, nil
 }
 
+// getSession returns the session stored for a connection ID, or nil if there is none
+func getSession(m *sessionMap, id protocol.ConnectionID) packetHandler {
+	session, _ := m.get(id)
+	return session
+}
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *mockPacketConn
@@ -108,10 +134,11 @@ var _ = Describe("Server", func() {
 
 		BeforeEach(func() {
 			serv = &server{
-				sessions:     make(map[protocol.ConnectionID]packetHandler),
+				sessions:     newSessionMap(),
 				newSession:   newMockSession,
-				conn:         conn,
-				config:       config,
+				conns:        []net.PacketConn{conn},
+				demuxes:      []*demultiplexer{newDemultiplexer(conn)},
+				config:       populateServerConfig(config),
 				sessionQueue: make(chan Session, 5),
 				errorChan:    make(chan struct{}),
 			}
@@ -132,8 +159,8 @@ var _ = Describe("Server", func() {
 		It("creates new sessions", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[connID].(*mockSession)
+			Expect(serv.sessions.len()).To(Equal(1))
+			sess := getSession(serv.sessions, connID).(*mockSession)
 			Expect(sess.connectionID).To(Equal(connID))
 			Expect(sess.packetCount).To(Equal(1))
 		})
@@ -143,13 +170,13 @@ var _ = Describe("Server", func() {
 			go func() {
 				defer GinkgoRecover()
 				var err error
-				acceptedSess, err = serv.Accept()
+				acceptedSess, err = serv.Accept(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 			}()
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[connID].(*mockSession)
+			Expect(serv.sessions.len()).To(Equal(1))
+			sess := getSession(serv.sessions, connID).(*mockSession)
 			sess.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionSecure}
 			Consistently(func() Session { return acceptedSess }).Should(BeNil())
 			sess.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
@@ -161,26 +188,118 @@ var _ = Describe("Server", func() {
 			var accepted bool
 			go func() {
 				defer GinkgoRecover()
-				serv.Accept()
+				serv.Accept(context.Background())
 				accepted = true
 			}()
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[connID].(*mockSession)
+			Expect(serv.sessions.len()).To(Equal(1))
+			sess := getSession(serv.sessions, connID).(*mockSession)
 			sess.handshakeChan <- handshakeEvent{err: errors.New("handshake failed")}
 			Consistently(func() bool { return accepted }).Should(BeFalse())
 			close(done)
 		})
 
+		It("refuses new connections when too many handshakes are in progress", func() {
+			serv.config.MaxConcurrentHandshakes = 1
+			err := serv.handlePacket(conn, udpAddr, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(conn.dataWritten.Len()).To(BeZero())
+			// another connection
+			packet := append([]byte{}, firstPacket...)
+			packet[1] = 0x42
+			err = serv.handlePacket(conn, udpAddr, packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+			// parse the CONNECTION_CLOSE
+			data := conn.dataWritten.Bytes()
+			r := bytes.NewReader(data)
+			hdr, err := wire.ParsePublicHeader(r, protocol.PerspectiveServer, protocol.SupportedVersions[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.ConnectionID).To(Equal(protocol.ConnectionID(0x4cfa9f9b66861942)))
+			unpacker := &packetUnpacker{
+				version: protocol.SupportedVersions[0],
+				aead:    &nullAEADOpener{aead: crypto.NewNullAEAD(protocol.PerspectiveClient, protocol.SupportedVersions[0])},
+			}
+			p, err := unpacker.Unpack(data[:len(data)-r.Len()], hdr, data[len(data)-r.Len():])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(HaveLen(1))
+			Expect(p.frames[0]).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+			Expect(p.frames[0].(*wire.ConnectionCloseFrame).ErrorCode).To(Equal(qerr.TooManySessionsOnServer))
+		})
+
+		It("refuses new connections while most sessions are backlogged", func() {
+			// two sessions, both of them don't keep up with the incoming packets
+			serv.config.receiveBacklog.addSession(2)
+			serv.config.receiveBacklog.addBackloggedSession(2)
+			err := serv.handlePacket(conn, udpAddr, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serv.sessions.len()).To(BeZero())
+			Expect(conn.dataWritten.Len()).ToNot(BeZero())
+			Expect(serv.Stats()).To(Equal(ListenerStats{Sessions: 2, BackloggedSessions: 2}))
+			// one of them catches up
+			serv.config.receiveBacklog.addBackloggedSession(-1)
+			err = serv.handlePacket(conn, udpAddr, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serv.sessions.len()).To(Equal(1))
+		})
+
+		It("doesn't count the handshake if creating the session fails", func() {
+			testErr := errors.New("session creation failed")
+			serv.newSession = func(connection, protocol.VersionNumber, protocol.ConnectionID, *handshake.ServerConfig, *tls.Config, *Config, *statelessRetry) (packetHandler, <-chan handshakeEvent, error) {
+				return nil, nil, testErr
+			}
+			err := serv.handlePacket(conn, udpAddr, firstPacket)
+			Expect(err).To(MatchError(testErr))
+			Expect(serv.sessions.len()).To(BeZero())
+			Expect(atomic.LoadInt32(&serv.handshakesInProgress)).To(BeZero())
+		})
+
+		It("accepts new connections once a handshake completes", func() {
+			serv.config.MaxConcurrentHandshakes = 1
+			err := serv.handlePacket(conn, udpAddr, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			sess := getSession(serv.sessions, connID).(*mockSession)
+			sess.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
+			Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeZero())
+			packet := append([]byte{}, firstPacket...)
+			packet[1] = 0x42
+			err = serv.handlePacket(conn, udpAddr, packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serv.sessions.len()).To(Equal(2))
+			Expect(conn.dataWritten.Len()).To(BeZero())
+		})
+
+		It("closes sessions that complete the handshake when the accept queue is full", func() {
+			serv.sessionQueue = make(chan Session, 1)
+			err := serv.handlePacket(nil, nil, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			sess1 := getSession(serv.sessions, connID).(*mockSession)
+			packet := append([]byte{}, firstPacket...)
+			packet[1] = 0x42
+			err = serv.handlePacket(nil, nil, packet)
+			Expect(err).ToNot(HaveOccurred())
+			sess2 := getSession(serv.sessions, protocol.ConnectionID(0x4cfa9f9b66861942)).(*mockSession)
+			sess1.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
+			sess2.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
+			Eventually(func() bool { return sess2.closed }).Should(BeTrue())
+			Expect(sess2.closeReason).To(MatchError(qerr.Error(qerr.TooManySessionsOnServer, "accept queue full")))
+			Expect(sess1.closed).To(BeFalse())
+			sess, err := serv.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess).To(Equal(sess1))
+		})
+
 		It("assigns packets to existing sessions", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
 			err = serv.handlePacket(nil, nil, []byte{0x08, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x01})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID].(*mockSession).connectionID).To(Equal(connID))
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(2))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).connectionID).To(Equal(connID))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(2))
 		})
 
 		It("closes and deletes sessions", func() {
@@ -188,13 +307,13 @@ var _ = Describe("Server", func() {
 			nullAEAD := crypto.NewNullAEAD(protocol.PerspectiveServer, protocol.VersionWhatever)
 			err := serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID]).ToNot(BeNil())
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID)).ToNot(BeNil())
 			// make session.run() return
-			serv.sessions[connID].(*mockSession).stopRunLoop <- struct{}{}
+			getSession(serv.sessions, connID).(*mockSession).stopRunLoop <- struct{}{}
 			// The server should now have closed the session, leaving a nil value in the sessions map
-			Consistently(func() map[protocol.ConnectionID]packetHandler { return serv.sessions }).Should(HaveLen(1))
-			Expect(serv.sessions[connID]).To(BeNil())
+			Consistently(serv.sessions.len).Should(Equal(1))
+			Expect(getSession(serv.sessions, connID)).To(BeNil())
 		})
 
 		It("deletes nil session entries after a wait time", func() {
@@ -202,21 +321,19 @@ var _ = Describe("Server", func() {
 			nullAEAD := crypto.NewNullAEAD(protocol.PerspectiveServer, protocol.VersionWhatever)
 			err := serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions).To(HaveKey(connID))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID)).ToNot(BeNil())
 			// make session.run() return
-			serv.sessions[connID].(*mockSession).stopRunLoop <- struct{}{}
+			getSession(serv.sessions, connID).(*mockSession).stopRunLoop <- struct{}{}
 			Eventually(func() bool {
-				serv.sessionsMutex.Lock()
-				_, ok := serv.sessions[connID]
-				serv.sessionsMutex.Unlock()
+				_, ok := serv.sessions.get(connID)
 				return ok
 			}).Should(BeFalse())
 		})
 
 		It("closes sessions and the connection when Close is called", func() {
-			session, _, _ := newMockSession(nil, 0, 0, nil, nil, nil)
-			serv.sessions[1] = session
+			session, _, _ := newMockSession(nil, 0, 0, nil, nil, nil, nil)
+			serv.sessions.set(1, session)
 			err := serv.Close()
 			Expect(err).NotTo(HaveOccurred())
 			Expect(session.(*mockSession).closed).To(BeTrue())
@@ -224,11 +341,16 @@ var _ = Describe("Server", func() {
 		})
 
 		It("ignores packets for closed sessions", func() {
-			serv.sessions[connID] = nil
+			serv.sessions.set(connID, nil)
 			err := serv.handlePacket(nil, nil, []byte{0x08, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x01})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID]).To(BeNil())
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID)).To(BeNil())
+		})
+
+		It("errors if ListenAddrReusePort is called with an invalid number of sockets", func() {
+			_, err := ListenAddrReusePort("127.0.0.1:0", 0, nil, config)
+			Expect(err).To(MatchError("invalid number of sockets: 0"))
 		})
 
 		It("works if no quic.Config is given", func(done Done) {
@@ -245,41 +367,194 @@ var _ = Describe("Server", func() {
 			var returned bool
 			go func() {
 				defer GinkgoRecover()
-				_, err := ln.Accept()
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(ContainSubstring("use of closed network connection"))
+				_, err := ln.Accept(context.Background())
+				Expect(err).To(MatchError(ErrServerClosed))
 				returned = true
 			}()
 			ln.Close()
 			Eventually(func() bool { return returned }).Should(BeTrue())
 		})
 
+		It("returns when the context passed to Accept is canceled", func(done Done) {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			_, err := serv.Accept(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			close(done)
+		})
+
+		Context("shutting down", func() {
+			It("closes all sessions and the connection", func() {
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess := getSession(serv.sessions, connID).(*mockSession)
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				Expect(sess.closed).To(BeTrue())
+				Expect(conn.closed).To(BeTrue())
+			})
+
+			It("returns ErrServerClosed from pending and future calls to Accept", func() {
+				var returned bool
+				go func() {
+					defer GinkgoRecover()
+					_, err := serv.Accept(context.Background())
+					Expect(err).To(MatchError(ErrServerClosed))
+					returned = true
+				}()
+				Consistently(func() bool { return returned }).Should(BeFalse())
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				Eventually(func() bool { return returned }).Should(BeTrue())
+				_, err := serv.Accept(context.Background())
+				Expect(err).To(MatchError(ErrServerClosed))
+			})
+
+			It("doesn't create new sessions after shutting down", func() {
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions.len()).To(BeZero())
+			})
+
+			It("doesn't queue sessions that complete the handshake after shutting down", func() {
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess := getSession(serv.sessions, connID).(*mockSession)
+				serv.setError(ErrServerClosed)
+				sess.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
+				Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeZero())
+				Expect(serv.sessionQueue).To(BeEmpty())
+			})
+
+			It("releases sessions that are closed during the handshake", func() {
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess := getSession(serv.sessions, connID).(*mockSession)
+				Expect(atomic.LoadInt32(&serv.handshakesInProgress)).To(BeEquivalentTo(1))
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				Expect(sess.closed).To(BeTrue())
+				Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeZero())
+				// the goroutine waiting for the handshake returned, so nothing is receiving from the handshakeChan anymore
+				Consistently(sess.handshakeChan).ShouldNot(BeSent(handshakeEvent{encLevel: protocol.EncryptionForwardSecure}))
+				Expect(serv.sessionQueue).To(BeEmpty())
+			})
+
+			It("closes sessions in parallel, and stops waiting when the context expires", func() {
+				unblock := make(chan struct{})
+				var closing int32
+				for i := 1; i <= 3; i++ {
+					sess, _, _ := newMockSession(nil, 0, protocol.ConnectionID(i), nil, nil, nil, nil)
+					serv.sessions.set(protocol.ConnectionID(i), &blockingCloseSession{
+						mockSession: sess.(*mockSession),
+						closing:     &closing,
+						unblock:     unblock,
+					})
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				err := serv.Shutdown(ctx)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+				Expect(atomic.LoadInt32(&closing)).To(BeEquivalentTo(3))
+				Expect(conn.closed).To(BeTrue())
+				close(unblock)
+			})
+		})
+
 		It("errors when encountering a connection error", func(done Done) {
 			testErr := errors.New("connection error")
 			conn.readErr = testErr
-			go serv.serve()
-			_, err := serv.Accept()
+			Expect(serv.demuxes[0].addServer(serv)).To(Succeed())
+			_, err := serv.Accept(context.Background())
 			Expect(err).To(MatchError(testErr))
 			Expect(serv.Close()).To(Succeed())
 			close(done)
 		}, 0.5)
 
 		It("closes all sessions when encountering a connection error", func() {
-			session, _, _ := newMockSession(nil, 0, 0, nil, nil, nil)
-			serv.sessions[0x12345] = session
-			Expect(serv.sessions[0x12345].(*mockSession).closed).To(BeFalse())
+			session, _, _ := newMockSession(nil, 0, 0, nil, nil, nil, nil)
+			serv.sessions.set(0x12345, session)
+			Expect(getSession(serv.sessions, 0x12345).(*mockSession).closed).To(BeFalse())
 			testErr := errors.New("connection error")
 			conn.readErr = testErr
-			go serv.serve()
-			Eventually(func() Session { return serv.sessions[connID] }).Should(BeNil())
+			Expect(serv.demuxes[0].addServer(serv)).To(Succeed())
+			Eventually(func() Session { return getSession(serv.sessions, connID) }).Should(BeNil())
 			Eventually(func() bool { return session.(*mockSession).closed }).Should(BeTrue())
 			Expect(serv.Close()).To(Succeed())
 		})
 
+		Context("with multiple connections", func() {
+			var conn2 *mockPacketConn
+
+			BeforeEach(func() {
+				conn2 = &mockPacketConn{addr: &net.UDPAddr{}}
+				serv.conns = append(serv.conns, conn2)
+				serv.demuxes = append(serv.demuxes, newDemultiplexer(conn2))
+			})
+
+			It("passes packets received on another connection to the session", func() {
+				err := serv.handlePacket(conn, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				err = serv.handlePacket(conn2, nil, []byte{0x08, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x01})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions.len()).To(Equal(1))
+				Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(2))
+			})
+
+			It("only creates a single session if the first packets are received on different connections at the same time", func() {
+				var numSessions int32
+				serv.newSession = func(conn connection, v protocol.VersionNumber, connID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config, retry *statelessRetry) (packetHandler, <-chan handshakeEvent, error) {
+					atomic.AddInt32(&numSessions, 1)
+					return newMockSession(conn, v, connID, sCfg, tlsConf, config, retry)
+				}
+				var wg sync.WaitGroup
+				for _, c := range []net.PacketConn{conn, conn2} {
+					wg.Add(1)
+					go func(c net.PacketConn) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						for i := 0; i < 10; i++ {
+							Expect(serv.handlePacket(c, nil, firstPacket)).To(Succeed())
+						}
+					}(c)
+				}
+				wg.Wait()
+				Expect(atomic.LoadInt32(&numSessions)).To(BeEquivalentTo(1))
+				Expect(serv.sessions.len()).To(Equal(1))
+			})
+
+			It("closes all connections", func() {
+				Expect(serv.Close()).To(Succeed())
+				Expect(conn.closed).To(BeTrue())
+				Expect(conn2.closed).To(BeTrue())
+			})
+
+			It("returns the error of the first connection that fails", func(done Done) {
+				testErr := errors.New("connection error")
+				conn.readErr = testErr
+				conn2.readErr = errors.New("another connection error")
+				demux2 := serv.demuxes[1]
+				Expect(serv.demuxes[0].addServer(serv)).To(Succeed())
+				_, err := serv.Accept(context.Background())
+				Expect(err).To(MatchError(testErr))
+				Eventually(func() bool { return conn2.closed }).Should(BeTrue())
+				Expect(demux2.addServer(serv)).To(Succeed())
+				Eventually(func() error {
+					demux2.mutex.RLock()
+					defer demux2.mutex.RUnlock()
+					return demux2.readErr
+				}).Should(HaveOccurred())
+				_, err = serv.Accept(context.Background())
+				Expect(err).To(MatchError(testErr))
+				close(done)
+			}, 0.5)
+		})
+
 		It("ignores delayed packets with mismatching versions", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 			b := &bytes.Buffer{}
 			// add an unsupported version
 			utils.LittleEndian.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]+1))
@@ -290,7 +565,7 @@ var _ = Describe("Server", func() {
 			// if we didn't ignore the packet, the server would try to send a version negotation packet, which would make the test panic because it doesn't have a udpConn
 			Expect(conn.dataWritten.Bytes()).To(BeEmpty())
 			// make sure the packet was *not* passed to session.handlePacket()
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 		})
 
 		It("errors on invalid public header", func() {
@@ -301,28 +576,28 @@ var _ = Describe("Server", func() {
 		It("ignores public resets for unknown connections", func() {
 			err := serv.handlePacket(nil, nil, wire.WritePublicReset(999, 1, 1337))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(BeEmpty())
+			Expect(serv.sessions.len()).To(BeZero())
 		})
 
 		It("ignores public resets for known connections", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 			err = serv.handlePacket(nil, nil, wire.WritePublicReset(connID, 1, 1337))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 		})
 
 		It("ignores invalid public resets for known connections", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 			data := wire.WritePublicReset(connID, 1, 1337)
 			err = serv.handlePacket(nil, nil, data[:len(data)-2])
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[connID].(*mockSession).packetCount).To(Equal(1))
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(getSession(serv.sessions, connID).(*mockSession).packetCount).To(Equal(1))
 		})
 
 		It("doesn't respond with a version negotiation packet if the first packet is too small", func() {
@@ -345,11 +620,18 @@ var _ = Describe("Server", func() {
 		supportedVersions := []protocol.VersionNumber{1, 3, 5}
 		acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
 		config := Config{
-			Versions:         supportedVersions,
-			AcceptCookie:     acceptCookie,
-			HandshakeTimeout: 1337 * time.Hour,
-			IdleTimeout:      42 * time.Minute,
-			KeepAlive:        true,
+			Versions:                    supportedVersions,
+			AcceptCookie:                acceptCookie,
+			HandshakeTimeout:            1337 * time.Hour,
+			IdleTimeout:                 42 * time.Minute,
+			KeepAlive:                   true,
+			MaxUnprocessedPackets:       42,
+			MaxConcurrentHandshakes:     1234,
+			MaxAcceptQueueLen:           10,
+			MaxPacketSize:               2000,
+			MaxReceiveBufferPerSession:  1 << 20,
+			MaxReceiveBufferPerListener: 1 << 30,
+			SendBufferSize:              1 << 10,
 		}
 		ln, err := Listen(conn, &tls.Config{}, &config)
 		Expect(err).ToNot(HaveOccurred())
@@ -362,6 +644,16 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
 		Expect(server.config.KeepAlive).To(BeTrue())
+		Expect(server.config.MaxUnprocessedPackets).To(Equal(42))
+		Expect(server.config.MaxConcurrentHandshakes).To(Equal(1234))
+		Expect(server.config.MaxAcceptQueueLen).To(Equal(10))
+		Expect(server.sessionQueue).To(HaveCap(10))
+		Expect(server.config.MaxPacketSize).To(Equal(uint64(2000)))
+		Expect(server.demuxes[0].reader.(*singlePacketReader).maxPacketSize.get()).To(Equal(protocol.ByteCount(2000)))
+		Expect(server.config.MaxReceiveBufferPerSession).To(Equal(uint64(1 << 20)))
+		Expect(server.config.MaxReceiveBufferPerListener).To(Equal(uint64(1 << 30)))
+		Expect(server.config.receiveBudget).ToNot(BeNil())
+		Expect(server.config.SendBufferSize).To(Equal(uint64(1 << 10)))
 	})
 
 	It("fills in default values if options are not set in the Config", func() {
@@ -373,6 +665,26 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.MaxUnprocessedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
+		Expect(server.config.MaxConcurrentHandshakes).To(Equal(protocol.DefaultMaxConcurrentHandshakes))
+		Expect(server.config.MaxAcceptQueueLen).To(Equal(protocol.DefaultMaxAcceptQueueLen))
+		Expect(server.config.MaxPacketSize).To(Equal(uint64(protocol.MaxPacketSize)))
+		Expect(server.config.SendBufferSize).To(Equal(uint64(protocol.DefaultSendBufferSize)))
+	})
+
+	It("uses the default receive queue length if a negative value is configured", func() {
+		Expect(populateServerConfig(&Config{MaxUnprocessedPackets: -1}).MaxUnprocessedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
+	})
+
+	It("uses the default handshake limit and accept queue length if negative values are configured", func() {
+		conf := populateServerConfig(&Config{MaxConcurrentHandshakes: -1, MaxAcceptQueueLen: -1})
+		Expect(conf.MaxConcurrentHandshakes).To(Equal(protocol.DefaultMaxConcurrentHandshakes))
+		Expect(conf.MaxAcceptQueueLen).To(Equal(protocol.DefaultMaxAcceptQueueLen))
+	})
+
+	It("limits the maximum packet size", func() {
+		Expect(populateServerConfig(&Config{MaxPacketSize: 100}).MaxPacketSize).To(Equal(uint64(protocol.MinPacketSize)))
+		Expect(populateServerConfig(&Config{MaxPacketSize: 100000}).MaxPacketSize).To(Equal(uint64(protocol.MaxPacketBufferSize)))
 	})
 
 	It("listens on a given address", func() {
@@ -383,6 +695,26 @@ var _ = Describe("Server", func() {
 		Expect(serv.Addr().String()).To(Equal(addr))
 	})
 
+	It("doesn't close the connection while it's still used by a client", func() {
+		ln, err := Listen(conn, &tls.Config{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		demux := getDemultiplexer(conn) // this is what a client dialing from this connection does
+		Expect(ln.Close()).To(Succeed())
+		Expect(conn.closed).To(BeFalse())
+		Expect(demux.release()).To(Succeed())
+		Expect(conn.closed).To(BeTrue())
+	})
+
+	It("errors if another Listener is already using the connection", func() {
+		ln, err := Listen(conn, &tls.Config{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = Listen(conn, &tls.Config{}, config)
+		Expect(err).To(MatchError(errDemuxHasServer))
+		Expect(conn.closed).To(BeFalse())
+		Expect(ln.Close()).To(Succeed())
+		Expect(conn.closed).To(BeTrue())
+	})
+
 	It("errors if given an invalid address", func() {
 		addr := "127.0.0.1"
 		_, err := ListenAddr(addr, nil, config)
@@ -413,7 +745,7 @@ var _ = Describe("Server", func() {
 
 		var returned bool
 		go func() {
-			ln.Accept()
+			ln.Accept(context.Background())
 			returned = true
 		}()
 
@@ -436,14 +768,14 @@ var _ = Describe("Server", func() {
 		Expect(err).ToNot(HaveOccurred())
 		go func() {
 			defer GinkgoRecover()
-			_, err := ln.Accept()
+			_, err := ln.Accept(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 		}()
 
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
-		Expect(ln.(*server).sessions).To(BeEmpty())
+		Expect(ln.(*server).sessions.len()).To(BeZero())
 	})
 })
 
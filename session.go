@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/ackhandler"
@@ -66,22 +67,37 @@ type session struct {
 	sentPacketHandler     ackhandler.SentPacketHandler
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	streamFramer          *streamFramer
+	// datagramQueue queues the messages sent and received in DATAGRAM frames, it is nil if datagrams are not enabled
+	datagramQueue *datagramQueue
 
 	flowControlManager flowcontrol.FlowControlManager
+	// receiveBudget limits the memory used for buffering received data, see Config.MaxReceiveBufferPerSession
+	receiveBudget *flowcontrol.MemoryBudget
 
 	unpacker unpacker
 	packer   *packetPacker
+	// mtuDiscoverer performs path MTU discovery after the handshake completes, if a maximum packet size larger than the default is configured
+	mtuDiscoverer *mtuDiscoverer
 
 	cryptoSetup handshake.CryptoSetup
+	// the stateless retry that was performed before this session was created, only used by the server
+	retry *statelessRetry
 
 	receivedPackets  chan *receivedPacket
+	droppedPackets   uint64 // number of packets dropped because the receivedPackets queue was full, accessed atomically
+	backlogState     int32  // whether the receivedPackets queue is backlogged, accessed atomically
+	maxPacketSize    uint64 // the current maximum packet size, accessed atomically
 	sendingScheduled chan struct{}
+	// if the connection supports batched writes, packets are queued while sending, and written in batches
+	batchWriter batchWriter
+	sendQueue   [][]byte
 	// closeChan is used to notify the run loop that it should terminate.
 	closeChan chan closeError
 	closeOnce sync.Once
 
-	ctx       context.Context
-	ctxCancel context.CancelFunc
+	ctx        context.Context
+	ctxCancel  context.CancelFunc
+	closeCause closeCause
 
 	// when we receive too many undecryptable packets during the handshake, we send a Public reset
 	// but only after a time of protocol.PublicResetTimeout has passed
@@ -110,6 +126,7 @@ type session struct {
 	sessionCreationTime     time.Time
 	lastNetworkActivityTime time.Time
 
+	clock utils.Clock
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
@@ -126,6 +143,7 @@ func newSession(
 	sCfg *handshake.ServerConfig,
 	tlsConf *tls.Config,
 	config *Config,
+	retry *statelessRetry, // nil if the session was created without a stateless retry
 ) (packetHandler, <-chan handshakeEvent, error) {
 	s := &session{
 		conn:         conn,
@@ -133,6 +151,7 @@ func newSession(
 		perspective:  protocol.PerspectiveServer,
 		version:      v,
 		config:       config,
+		retry:        retry,
 	}
 	return s.setup(sCfg, "", tlsConf, v, nil)
 }
@@ -170,23 +189,33 @@ func (s *session) setup(
 	handshakeChan := make(chan handshakeEvent, 3)
 	s.handshakeChan = handshakeChan
 	s.handshakeCompleteChan = make(chan error, 1)
-	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
+	s.receivedPackets = make(chan *receivedPacket, s.config.MaxUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
-	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.ctx, s.ctxCancel = context.WithCancel(context.WithValue(context.Background(), closeCauseKey{}, &s.closeCause))
+	if bw, ok := s.conn.(batchWriter); ok {
+		s.batchWriter = bw
+		s.sendQueue = make([][]byte, 0, protocol.PacketBatchSize)
+	}
 
-	s.timer = utils.NewTimer()
-	now := time.Now()
+	s.clock = s.config.clock
+	s.timer = utils.NewTimerWithClock(s.clock)
+	now := s.clock.Now()
 	s.lastNetworkActivityTime = now
 	s.sessionCreationTime = now
 
 	s.rttStats = &congestion.RTTStats{}
 	transportParams := &handshake.TransportParameters{
-		IdleTimeout: s.config.IdleTimeout,
+		IdleTimeout:   s.config.IdleTimeout,
+		MaxPacketSize: protocol.ByteCount(s.config.MaxPacketSize),
+	}
+	if s.config.EnableDatagrams {
+		s.datagramQueue = newDatagramQueue(s.scheduleSending)
+		transportParams.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
 	}
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats)
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.version)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.clock)
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.version, s.clock)
 
 	var err error
 	if s.perspective == protocol.PerspectiveServer {
@@ -241,11 +270,15 @@ func (s *session) setup(
 		return nil, nil, err
 	}
 
+	s.receiveBudget = flowcontrol.NewMemoryBudget(protocol.ByteCount(s.config.MaxReceiveBufferPerSession), s.config.receiveBudget)
+	s.config.receiveBacklog.addSession(1)
 	s.flowControlManager = flowcontrol.NewFlowControlManager(
 		s.connParams,
 		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
 		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
+		s.receiveBudget,
 		s.rttStats,
+		s.clock,
 	)
 	s.streamsMap = newStreamsMap(s.newStream, s.flowControlManager.RemoveStream, s.perspective, s.connParams)
 	s.streamFramer = newStreamFramer(s.streamsMap, s.flowControlManager)
@@ -253,11 +286,27 @@ func (s *session) setup(
 		s.cryptoSetup,
 		s.connParams,
 		s.streamFramer,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
+	s.setMaxPacketSize(utils.MinByteCount(protocol.ByteCount(s.config.MaxPacketSize), protocol.MaxPacketSize))
 	s.unpacker = &packetUnpacker{aead: s.cryptoSetup, version: s.version}
 
+	if s.retry != nil {
+		// The packet containing the REJ was sent before this session was created.
+		// Treat it as if it was sent by this session, such that the ACK for this packet is accepted.
+		for s.packer.packetNumberGenerator.Peek() <= s.retry.packetNumber {
+			s.packer.packetNumberGenerator.Pop()
+		}
+		if err := s.sentPacketHandler.SentPacket(&ackhandler.Packet{
+			PacketNumber:    s.retry.packetNumber,
+			EncryptionLevel: protocol.EncryptionUnencrypted,
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	return s, handshakeChan, nil
 }
 
@@ -268,6 +317,12 @@ func (s *session) run() error {
 	if s.perspective == protocol.PerspectiveServer {
 		cryptoStream, _ = s.GetOrOpenStream(1)
 		_, _ = s.AcceptStream() // don't expose the crypto stream
+		if s.retry != nil {
+			// the first CHLO and the REJ were exchanged during the stateless retry
+			if err := cryptoStream.(*stream).setInitialOffsets(s.retry.cryptoReadOffset, s.retry.cryptoWriteOffset); err != nil {
+				s.closeLocal(err)
+			}
+		}
 	} else {
 		cryptoStream, _ = s.OpenStream()
 	}
@@ -303,23 +358,26 @@ runLoop:
 			// We do all the interesting stuff after the switch statement, so
 			// nothing to see here.
 		case p := <-s.receivedPackets:
-			err := s.handlePacketImpl(p)
-			if err != nil {
-				if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
-					s.tryQueueingUndecryptablePacket(p)
-					continue
+			processed := s.processReceivedPacket(p)
+			// If the session is falling behind, process queued packets before sending,
+			// such that packets don't have to be dropped.
+			for processed && len(s.receivedPackets) > cap(s.receivedPackets)/2 {
+				if !s.processReceivedPacket(<-s.receivedPackets) {
+					break
 				}
-				s.closeLocal(err)
+			}
+			if len(s.receivedPackets) == 0 {
+				s.setBacklogState(backlogStateNone)
+			}
+			if !processed {
 				continue
 			}
-			// This is a bit unclean, but works properly, since the packet always
-			// begins with the public header and we never copy it.
-			putPacketBuffer(p.publicHeader.Raw)
 		case l, ok := <-aeadChanged:
 			if !ok { // the aeadChanged chan was closed. This means that the handshake is completed.
 				s.handshakeComplete = true
 				aeadChanged = nil // prevent this case from ever being selected again
 				s.sentPacketHandler.SetHandshakeComplete()
+				s.startMTUDiscovery()
 				close(s.handshakeChan)
 				close(s.handshakeCompleteChan)
 			} else {
@@ -328,14 +386,15 @@ runLoop:
 			}
 		}
 
-		now := time.Now()
-		if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
+		now := s.clock.Now()
+		// The timer might fire exactly at the alarm timeout.
+		if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && !timeout.After(now) {
 			// This could cause packets to be retransmitted, so check it before trying
 			// to send packets.
 			s.sentPacketHandler.OnAlarm()
 		}
 
-		if s.config.KeepAlive && s.handshakeComplete && time.Since(s.lastNetworkActivityTime) >= s.connParams.GetRemoteIdleTimeout()/2 {
+		if s.config.KeepAlive && s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.connParams.GetRemoteIdleTimeout()/2 {
 			// send the PING frame since there is no activity in the session
 			s.packer.QueueControlFrame(&wire.PingFrame{})
 			s.keepAlivePingSent = true
@@ -348,10 +407,10 @@ runLoop:
 			s.closeLocal(qerr.Error(qerr.DecryptionFailure, "too many undecryptable packets received"))
 		}
 		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
-			s.closeLocal(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
+			s.closeLocal(&HandshakeTimeoutError{})
 		}
 		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
-			s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
+			s.closeLocal(&IdleTimeoutError{})
 		}
 
 		if err := s.streamsMap.DeleteClosedStreams(); err != nil {
@@ -363,9 +422,20 @@ runLoop:
 	// otherwise this chan will already be closed
 	if !s.handshakeComplete {
 		s.handshakeCompleteChan <- closeErr.err
-		s.handshakeChan <- handshakeEvent{err: closeErr.err}
+		handshakeErr := closeErr.err
+		if handshakeErr == nil {
+			// the handshake didn't complete, so the receiver of the handshakeChan must see an error
+			handshakeErr = qerr.Error(qerr.PeerGoingAway, "")
+		}
+		s.handshakeChan <- handshakeEvent{err: handshakeErr}
 	}
 	s.handleCloseError(closeErr)
+	s.receiveBudget.Close()
+	s.setBacklogState(backlogStateClosed)
+	s.config.receiveBacklog.addSession(-1)
+	if closeErr.err != errCloseSessionForNewVersion {
+		s.closeCause.Set(toCloseCause(closeErr.err))
+	}
 	defer s.ctxCancel()
 	return closeErr.err
 }
@@ -409,7 +479,7 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 
 	if p.rcvTime.IsZero() {
 		// To simplify testing
-		p.rcvTime = time.Now()
+		p.rcvTime = s.clock.Now()
 	}
 
 	s.lastNetworkActivityTime = p.rcvTime
@@ -467,7 +537,9 @@ func (s *session) handleFrames(fs []wire.Frame) error {
 		case *wire.AckFrame:
 			err = s.handleAckFrame(frame)
 		case *wire.ConnectionCloseFrame:
-			s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+			s.closeRemote(remoteCloseError(frame.ErrorCode, frame.ReasonPhrase))
+		case *wire.ApplicationCloseFrame:
+			s.closeRemote(&ApplicationError{Code: frame.ErrorCode, ReasonPhrase: frame.ReasonPhrase, Remote: true})
 		case *wire.GoawayFrame:
 			err = errors.New("unimplemented: handling GOAWAY frames")
 		case *wire.StopWaitingFrame:
@@ -480,6 +552,8 @@ func (s *session) handleFrames(fs []wire.Frame) error {
 			err = s.handleWindowUpdateFrame(frame)
 		case *wire.BlockedFrame:
 		case *wire.PingFrame:
+		case *wire.DatagramFrame:
+			err = s.handleDatagramFrame(frame)
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -501,16 +575,164 @@ func (s *session) handleFrames(fs []wire.Frame) error {
 	return nil
 }
 
+// processReceivedPacket processes a packet from the receivedPackets queue.
+// It returns false if the packet couldn't be decrypted or if the session was closed.
+func (s *session) processReceivedPacket(p *receivedPacket) bool {
+	if err := s.handlePacketImpl(p); err != nil {
+		if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
+			s.tryQueueingUndecryptablePacket(p)
+			return false
+		}
+		s.closeLocal(err)
+		return false
+	}
+	// This is a bit unclean, but works properly, since the packet always
+	// begins with the public header and we never copy it.
+	utils.PutPacketBuffer(p.publicHeader.Raw)
+	return true
+}
+
 // handlePacket is called by the server with a new packet
+// It never blocks, such that a slow session can't stall the server.
 func (s *session) handlePacket(p *receivedPacket) {
 	// Discard packets once the amount of queued packets is larger than
-	// the channel size, protocol.MaxSessionUnprocessedPackets
+	// the channel size, Config.MaxUnprocessedPackets
 	select {
 	case s.receivedPackets <- p:
+		if len(s.receivedPackets) > cap(s.receivedPackets)/2 {
+			s.setBacklogState(backlogStateBacklogged)
+		}
 	default:
+		s.setBacklogState(backlogStateBacklogged)
+		s.config.receiveBacklog.addDroppedPacket()
+		if atomic.AddUint64(&s.droppedPackets, 1) == 1 {
+			utils.Infof("Receive queue of connection %x full, dropping packets", s.connectionID)
+		}
+	}
+}
+
+const (
+	backlogStateNone int32 = iota
+	backlogStateBacklogged
+	// the run loop has stopped, so the session is never backlogged again
+	backlogStateClosed
+)
+
+// setBacklogState updates the backlog state, and the number of backlogged sessions of the listener.
+// It is called by the server when queueing packets, and by the run loop when processing them.
+func (s *session) setBacklogState(state int32) {
+	for {
+		old := atomic.LoadInt32(&s.backlogState)
+		if old == state || old == backlogStateClosed {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&s.backlogState, old, state) {
+			if old == backlogStateBacklogged {
+				s.config.receiveBacklog.addBackloggedSession(-1)
+			} else if state == backlogStateBacklogged {
+				s.config.receiveBacklog.addBackloggedSession(1)
+			}
+			return
+		}
 	}
 }
 
+func (s *session) Stats() SessionStats {
+	// the connection-level window is always available
+	receiveWindow, _ := s.flowControlManager.GetReceiveWindowIncrement(0)
+	var receiveBuffered, sendBuffered protocol.ByteCount
+	s.streamsMap.Iterate(func(str *stream) (bool, error) {
+		receiveBuffered += str.lenOfBufferedData()
+		sendBuffered += str.lenOfDataForWriting()
+		return true, nil
+	})
+	return SessionStats{
+		ReceiveQueueLen:         len(s.receivedPackets),
+		ReceiveQueueCap:         cap(s.receivedPackets),
+		DroppedPackets:          atomic.LoadUint64(&s.droppedPackets),
+		MaxPacketSize:           atomic.LoadUint64(&s.maxPacketSize),
+		ReceiveConnectionWindow: uint64(receiveWindow),
+		ReceiveBuffered:         uint64(receiveBuffered),
+		SendBuffered:            uint64(sendBuffered),
+	}
+}
+
+func (s *session) setMaxPacketSize(size protocol.ByteCount) {
+	s.packer.SetMaxPacketSize(size)
+	atomic.StoreUint64(&s.maxPacketSize, uint64(size))
+}
+
+// startMTUDiscovery starts path MTU discovery, if a maximum packet size larger than the default is configured.
+// The search is limited by the maximum packet size that the peer accepts.
+// Probes must not be fragmented, so path MTU discovery is only performed if the Don't Fragment bit can be set.
+func (s *session) startMTUDiscovery() {
+	if protocol.ByteCount(s.config.MaxPacketSize) <= protocol.MaxPacketSize {
+		return
+	}
+	dfSetter, ok := s.conn.(dontFragmentSetter)
+	if !ok {
+		utils.Debugf("Not performing path MTU discovery for connection %x: the connection doesn't support setting the Don't Fragment bit", s.connectionID)
+		return
+	}
+	if err := dfSetter.SetDontFragment(); err != nil {
+		utils.Debugf("Not performing path MTU discovery for connection %x: %s", s.connectionID, err)
+		return
+	}
+	max := utils.MinByteCount(protocol.ByteCount(s.config.MaxPacketSize), s.connParams.GetRemoteMaxPacketSize())
+	s.mtuDiscoverer = newMTUDiscoverer(protocol.MaxPacketSize, max)
+}
+
+// maybeSendMTUProbe sends a path MTU probe, if one should be sent
+func (s *session) maybeSendMTUProbe() error {
+	if s.mtuDiscoverer == nil {
+		return nil
+	}
+	for res := s.sentPacketHandler.DequeueMTUProbeResult(); res != nil; res = s.sentPacketHandler.DequeueMTUProbeResult() {
+		if s.mtuDiscoverer.OnProbeResult(res) {
+			utils.Debugf("Path MTU discovery: raising the maximum packet size of connection %x to %d bytes", s.connectionID, res.Size)
+			s.setMaxPacketSize(s.mtuDiscoverer.CurrentSize())
+		}
+	}
+	if !s.mtuDiscoverer.ShouldSendProbe() {
+		return nil
+	}
+	packet, err := s.packer.PackMTUProbePacket(s.mtuDiscoverer.NextProbeSize())
+	if err != nil {
+		return err
+	}
+	if err := s.sentPacketHandler.SentPacket(&ackhandler.Packet{
+		PacketNumber:    packet.number,
+		Frames:          packet.frames,
+		Length:          protocol.ByteCount(len(packet.raw)),
+		EncryptionLevel: packet.encryptionLevel,
+		IsMTUProbe:      true,
+	}); err != nil {
+		utils.PutPacketBuffer(packet.raw)
+		return err
+	}
+	s.logPacket(packet)
+	// Packets queued before the probe are written first, such that a write error caused by the size of the probe
+	// can be told apart from errors writing other packets.
+	if err := s.flushSendQueue(); err != nil {
+		utils.PutPacketBuffer(packet.raw)
+		return err
+	}
+	err = s.writePacket(packet.raw)
+	if err == nil {
+		err = s.flushSendQueue()
+	}
+	if err != nil {
+		if !isMsgSizeError(err) {
+			return err
+		}
+		// The probe is larger than the MTU of the network interface.
+		// This is not an error, the probe just failed.
+		utils.Debugf("Path MTU probe of connection %x too large for the network interface (%d bytes)", s.connectionID, len(packet.raw))
+		s.mtuDiscoverer.OnProbeTooLarge()
+	}
+	return nil
+}
+
 func (s *session) handleStreamFrame(frame *wire.StreamFrame) error {
 	str, err := s.streamsMap.GetOrOpenStream(frame.StreamID)
 	if err != nil {
@@ -519,6 +741,7 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame) error {
 	if str == nil {
 		// Stream is closed and already garbage collected
 		// ignore this StreamFrame
+		frame.PutData()
 		return nil
 	}
 	return str.AddStreamFrame(frame)
@@ -547,10 +770,18 @@ func (s *session) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 		return errRstStreamOnInvalidStream
 	}
 
-	str.RegisterRemoteError(fmt.Errorf("RST_STREAM received with code %d", frame.ErrorCode))
+	str.RegisterRemoteError(frame.ErrorCode)
 	return s.flowControlManager.ResetStream(frame.StreamID, frame.ByteOffset)
 }
 
+func (s *session) handleDatagramFrame(frame *wire.DatagramFrame) error {
+	if s.datagramQueue == nil {
+		return qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but datagrams are not enabled")
+	}
+	s.datagramQueue.HandleDatagramFrame(frame)
+	return nil
+}
+
 func (s *session) handleAckFrame(frame *wire.AckFrame) error {
 	return s.sentPacketHandler.ReceivedAck(frame, s.lastRcvdPacketNumber, s.lastNetworkActivityTime)
 }
@@ -575,16 +806,24 @@ func (s *session) Close(e error) error {
 	return nil
 }
 
+// CloseWithError closes the connection with an application error code.
+// It waits until the run loop has stopped before returning
+func (s *session) CloseWithError(code ErrorCode, reason string) error {
+	s.closeLocal(&ApplicationError{Code: code, ReasonPhrase: reason})
+	<-s.ctx.Done()
+	return nil
+}
+
 func (s *session) handleCloseError(closeErr closeError) error {
 	if closeErr.err == nil {
 		closeErr.err = qerr.PeerGoingAway
 	}
 
-	var quicErr *qerr.QuicError
-	var ok bool
-	if quicErr, ok = closeErr.err.(*qerr.QuicError); !ok {
-		quicErr = qerr.ToQuicError(closeErr.err)
+	if appErr, ok := closeErr.err.(*ApplicationError); ok {
+		return s.handleApplicationCloseError(appErr)
 	}
+
+	quicErr := toQuicError(closeErr.err)
 	// Don't log 'normal' reasons
 	if quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout {
 		utils.Infof("Closing connection %x", s.connectionID)
@@ -592,7 +831,16 @@ func (s *session) handleCloseError(closeErr closeError) error {
 		utils.Errorf("Closing session with error: %s", closeErr.err.Error())
 	}
 
-	s.streamsMap.CloseWithError(quicErr)
+	// streams return the typed errors defined in this package, and a QuicError for all other errors
+	var streamErr error = quicErr
+	switch closeErr.err.(type) {
+	case *IdleTimeoutError, *HandshakeTimeoutError, *PublicResetError, *VersionNegotiationError:
+		streamErr = closeErr.err
+	}
+	s.streamsMap.CloseWithError(streamErr)
+	if s.datagramQueue != nil {
+		s.datagramQueue.CloseWithError(streamErr)
+	}
 
 	if closeErr.err == errCloseSessionForNewVersion {
 		return nil
@@ -611,7 +859,39 @@ func (s *session) handleCloseError(closeErr closeError) error {
 	return s.sendConnectionClose(quicErr)
 }
 
+func (s *session) handleApplicationCloseError(appErr *ApplicationError) error {
+	utils.Infof("Closing session %x with application error: %s", s.connectionID, appErr.Error())
+
+	s.streamsMap.CloseWithError(appErr)
+	if s.datagramQueue != nil {
+		s.datagramQueue.CloseWithError(appErr)
+	}
+
+	if appErr.Remote {
+		return nil
+	}
+	// APPLICATION_CLOSE is not part of gQUIC. Peers that didn't announce support for it during the handshake
+	// receive a CONNECTION_CLOSE, with the error code in the reason phrase.
+	if !s.connParams.RemoteSupportsApplicationClose() {
+		return s.sendConnectionClose(qerr.Error(qerr.PeerGoingAway, appErr.closeReasonPhrase()))
+	}
+	return s.sendCloseFrame(&wire.ApplicationCloseFrame{
+		ErrorCode:    appErr.Code,
+		ReasonPhrase: appErr.ReasonPhrase,
+	})
+}
+
 func (s *session) sendPacket() error {
+	err := s.sendPackets()
+	if s.batchWriter != nil {
+		if ferr := s.flushSendQueue(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func (s *session) sendPackets() error {
 	s.packer.SetLeastUnacked(s.sentPacketHandler.GetLeastUnacked())
 
 	// Get WindowUpdate frames
@@ -685,6 +965,10 @@ func (s *session) sendPacket() error {
 			}
 		}
 
+		if err := s.maybeSendMTUProbe(); err != nil {
+			return err
+		}
+
 		hasRetransmission := s.streamFramer.HasFramesForRetransmission()
 		if ack != nil || hasRetransmission {
 			swf := s.sentPacketHandler.GetStopWaitingFrame(hasRetransmission)
@@ -714,7 +998,6 @@ func (s *session) sendPacket() error {
 }
 
 func (s *session) sendPackedPacket(packet *packedPacket) error {
-	defer putPacketBuffer(packet.raw)
 	err := s.sentPacketHandler.SentPacket(&ackhandler.Packet{
 		PacketNumber:    packet.number,
 		Frames:          packet.frames,
@@ -722,18 +1005,51 @@ func (s *session) sendPackedPacket(packet *packedPacket) error {
 		EncryptionLevel: packet.encryptionLevel,
 	})
 	if err != nil {
+		utils.PutPacketBuffer(packet.raw)
 		return err
 	}
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	return s.writePacket(packet.raw)
+}
+
+// writePacket writes a packet, or queues it if the connection supports batched writes.
+// The packet buffer is returned to the pool once the packet was written.
+func (s *session) writePacket(raw []byte) error {
+	if s.batchWriter == nil {
+		defer utils.PutPacketBuffer(raw)
+		return s.conn.Write(raw)
+	}
+	s.sendQueue = append(s.sendQueue, raw)
+	if len(s.sendQueue) >= protocol.PacketBatchSize {
+		return s.flushSendQueue()
+	}
+	return nil
+}
+
+// flushSendQueue writes all queued packets
+func (s *session) flushSendQueue() error {
+	if len(s.sendQueue) == 0 {
+		return nil
+	}
+	err := s.batchWriter.WriteBatch(s.sendQueue)
+	for i, p := range s.sendQueue {
+		utils.PutPacketBuffer(p)
+		s.sendQueue[i] = nil
+	}
+	s.sendQueue = s.sendQueue[:0]
+	return err
 }
 
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
-	s.packer.SetLeastUnacked(s.sentPacketHandler.GetLeastUnacked())
-	packet, err := s.packer.PackConnectionClose(&wire.ConnectionCloseFrame{
+	return s.sendCloseFrame(&wire.ConnectionCloseFrame{
 		ErrorCode:    quicErr.ErrorCode,
 		ReasonPhrase: quicErr.ErrorMessage,
 	})
+}
+
+func (s *session) sendCloseFrame(frame wire.Frame) error {
+	s.packer.SetLeastUnacked(s.sentPacketHandler.GetLeastUnacked())
+	packet, err := s.packer.PackConnectionClose(frame)
 	if err != nil {
 		return err
 	}
@@ -777,13 +1093,52 @@ func (s *session) OpenStreamSync() (Stream, error) {
 	return s.streamsMap.OpenStreamSync()
 }
 
+// SendMessage sends a message in a DATAGRAM frame
+func (s *session) SendMessage(p []byte) error {
+	if s.datagramQueue == nil {
+		return errors.New("datagrams are not enabled")
+	}
+	if s.connParams.GetRemoteMaxDatagramFrameSize() == 0 {
+		return errors.New("the peer doesn't support datagrams")
+	}
+	if max := s.maxMessageSize(); protocol.ByteCount(len(p)) > max {
+		return fmt.Errorf("message too large (%d bytes, maximum %d bytes)", len(p), max)
+	}
+	f := &wire.DatagramFrame{Data: make([]byte, len(p))}
+	copy(f.Data, p)
+	return s.datagramQueue.Add(f)
+}
+
+// maxMessageSize returns the size of the largest message that can be sent in a DATAGRAM frame.
+// The frame must be accepted by the peer, and it must fit into a packet of the current maximum packet size.
+func (s *session) maxMessageSize() protocol.ByteCount {
+	maxFrameSize := utils.MinByteCount(
+		s.connParams.GetRemoteMaxDatagramFrameSize(),
+		protocol.ByteCount(atomic.LoadUint64(&s.maxPacketSize))-protocol.MaxDatagramPacketOverhead,
+	)
+	frameHeaderLen, _ := (&wire.DatagramFrame{}).MinLength(s.version)
+	if maxFrameSize < frameHeaderLen {
+		return 0
+	}
+	return maxFrameSize - frameHeaderLen
+}
+
+// ReceiveMessage gets a message received in a DATAGRAM frame
+func (s *session) ReceiveMessage() ([]byte, error) {
+	if s.datagramQueue == nil {
+		return nil, errors.New("datagrams are not enabled")
+	}
+	return s.datagramQueue.Receive()
+}
+
 func (s *session) WaitUntilHandshakeComplete() error {
 	return <-s.handshakeCompleteChan
 }
 
-func (s *session) queueResetStreamFrame(id protocol.StreamID, offset protocol.ByteCount) {
+func (s *session) queueResetStreamFrame(id protocol.StreamID, offset protocol.ByteCount, code protocol.ApplicationErrorCode) {
 	s.packer.QueueControlFrame(&wire.RstStreamFrame{
 		StreamID:   id,
+		ErrorCode:  code,
 		ByteOffset: offset,
 	})
 	s.scheduleSending()
@@ -796,7 +1151,12 @@ func (s *session) newStream(id protocol.StreamID) *stream {
 	} else {
 		s.flowControlManager.NewStream(id, true)
 	}
-	return newStream(id, s.scheduleSending, s.queueResetStreamFrame, s.flowControlManager)
+	// writes to the crypto stream are not buffered, since the handshake relies on the data being sent before the encryption level changes
+	var sendBufferSize protocol.ByteCount
+	if id != 1 {
+		sendBufferSize = protocol.ByteCount(s.config.SendBufferSize)
+	}
+	return newStream(id, s.scheduleSending, s.queueResetStreamFrame, s.flowControlManager, sendBufferSize)
 }
 
 func (s *session) sendPublicReset(rejectedPacketNumber protocol.PacketNumber) error {
@@ -820,7 +1180,7 @@ func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 	if len(s.undecryptablePackets)+1 > protocol.MaxUndecryptablePackets {
 		// if this is the first time the undecryptablePackets runs full, start the timer to send a Public Reset
 		if s.receivedTooManyUndecrytablePacketsTime.IsZero() {
-			s.receivedTooManyUndecrytablePacketsTime = time.Now()
+			s.receivedTooManyUndecrytablePacketsTime = s.clock.Now()
 			s.maybeResetTimer()
 		}
 		utils.Infof("Dropping undecrytable packet 0x%x (undecryptable packet queue full)", p.publicHeader.PacketNumber)
@@ -0,0 +1,89 @@
+package quic
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// sessionMapShards is the number of shards of a sessionMap
+const sessionMapShards = 64
+
+// The sessionMap maps connection IDs to the sessions of a server.
+// It is sharded by connection ID, such that the go routines serving the different sockets of a server
+// (see ListenAddrReusePort) rarely contend for the same lock.
+// Closed sessions are stored as nil until they are deleted, such that late packets can be recognized.
+type sessionMap struct {
+	shards [sessionMapShards]sessionMapShard
+}
+
+type sessionMapShard struct {
+	sync.RWMutex
+	sessions map[protocol.ConnectionID]packetHandler
+}
+
+func newSessionMap() *sessionMap {
+	m := &sessionMap{}
+	for i := range m.shards {
+		m.shards[i].sessions = make(map[protocol.ConnectionID]packetHandler)
+	}
+	return m
+}
+
+// shard returns the shard that holds the session for a connection ID.
+// It can be used to look up and create a session while holding the shard's lock.
+func (m *sessionMap) shard(id protocol.ConnectionID) *sessionMapShard {
+	return &m.shards[uint64(id)%sessionMapShards]
+}
+
+// get returns the session for a connection ID.
+// The session is nil if the session was already closed.
+func (m *sessionMap) get(id protocol.ConnectionID) (packetHandler, bool) {
+	shard := m.shard(id)
+	shard.RLock()
+	session, ok := shard.sessions[id]
+	shard.RUnlock()
+	return session, ok
+}
+
+func (m *sessionMap) set(id protocol.ConnectionID, session packetHandler) {
+	shard := m.shard(id)
+	shard.Lock()
+	shard.sessions[id] = session
+	shard.Unlock()
+}
+
+func (m *sessionMap) remove(id protocol.ConnectionID) {
+	shard := m.shard(id)
+	shard.Lock()
+	delete(shard.sessions, id)
+	shard.Unlock()
+}
+
+// len returns the number of entries, including closed sessions
+func (m *sessionMap) len() int {
+	var n int
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.RLock()
+		n += len(shard.sessions)
+		shard.RUnlock()
+	}
+	return n
+}
+
+// openSessions returns all sessions that are not closed yet
+func (m *sessionMap) openSessions() []packetHandler {
+	var sessions []packetHandler
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.RLock()
+		for _, session := range shard.sessions {
+			if session != nil {
+				sessions = append(sessions, session)
+			}
+		}
+		shard.RUnlock()
+	}
+	return sessions
+}
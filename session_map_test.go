@@ -0,0 +1,55 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session map", func() {
+	var m *sessionMap
+
+	BeforeEach(func() {
+		m = newSessionMap()
+	})
+
+	It("stores sessions", func() {
+		sess1, _, _ := newMockSession(nil, 0, 1, nil, nil, nil, nil)
+		sess2, _, _ := newMockSession(nil, 0, 2, nil, nil, nil, nil)
+		m.set(1, sess1)
+		m.set(2, sess2)
+		Expect(m.len()).To(Equal(2))
+		s, ok := m.get(1)
+		Expect(ok).To(BeTrue())
+		Expect(s).To(Equal(sess1))
+		s, ok = m.get(2)
+		Expect(ok).To(BeTrue())
+		Expect(s).To(Equal(sess2))
+		_, ok = m.get(3)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("stores closed sessions as nil", func() {
+		m.set(1, nil)
+		s, ok := m.get(1)
+		Expect(ok).To(BeTrue())
+		Expect(s).To(BeNil())
+		Expect(m.openSessions()).To(BeEmpty())
+		m.remove(1)
+		_, ok = m.get(1)
+		Expect(ok).To(BeFalse())
+		Expect(m.len()).To(BeZero())
+	})
+
+	It("distributes the sessions over the shards", func() {
+		for i := 0; i < 4*sessionMapShards; i++ {
+			sess, _, _ := newMockSession(nil, 0, protocol.ConnectionID(i), nil, nil, nil, nil)
+			m.set(protocol.ConnectionID(i), sess)
+		}
+		for i := range m.shards {
+			Expect(m.shards[i].sessions).To(HaveLen(4))
+		}
+		Expect(m.openSessions()).To(HaveLen(4 * sessionMapShards))
+	})
+})
@@ -5,10 +5,13 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
 	"runtime/pprof"
 	"strings"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -21,6 +24,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/mocks/mocks_fc"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	"github.com/lucas-clemente/quic-go/qerr"
 )
@@ -29,6 +33,10 @@ type mockConnection struct {
 	remoteAddr net.Addr
 	localAddr  net.Addr
 	written    chan []byte
+
+	writeErr        error // returned by Write, the packet is not written
+	dontFragmentErr error // returned by SetDontFragment
+	dontFragmentSet bool
 }
 
 func newMockConnection() *mockConnection {
@@ -39,6 +47,9 @@ func newMockConnection() *mockConnection {
 }
 
 func (m *mockConnection) Write(p []byte) error {
+	if m.writeErr != nil {
+		return m.writeErr
+	}
 	b := make([]byte, len(p))
 	copy(b, p)
 	select {
@@ -48,7 +59,14 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
-func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
+
+func (m *mockConnection) SetDontFragment() error {
+	if m.dontFragmentErr != nil {
+		return m.dontFragmentErr
+	}
+	m.dontFragmentSet = true
+	return nil
+}
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
@@ -57,6 +75,24 @@ func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
 func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
 func (*mockConnection) Close() error           { panic("not implemented") }
 
+type mockBatchWriter struct {
+	batches  [][][]byte
+	writeErr error
+}
+
+func (m *mockBatchWriter) WriteBatch(packets [][]byte) error {
+	if m.writeErr != nil {
+		return m.writeErr
+	}
+	batch := make([][]byte, len(packets))
+	for i, p := range packets {
+		batch[i] = make([]byte, len(p))
+		copy(batch[i], p)
+	}
+	m.batches = append(m.batches, batch)
+	return nil
+}
+
 type mockUnpacker struct {
 	unpackErr error
 }
@@ -71,11 +107,14 @@ func (m *mockUnpacker) Unpack(publicHeaderBinary []byte, hdr *wire.PublicHeader,
 }
 
 type mockSentPacketHandler struct {
+	alarm                           time.Time
+	alarmHandled                    chan struct{} // closed when OnAlarm is called
 	retransmissionQueue             []*ackhandler.Packet
 	sentPackets                     []*ackhandler.Packet
 	congestionLimited               bool
 	requestedStopWaiting            bool
 	shouldSendRetransmittablePacket bool
+	mtuProbeResults                 []*ackhandler.MTUProbeResult
 }
 
 func (h *mockSentPacketHandler) SentPacket(packet *ackhandler.Packet) error {
@@ -87,8 +126,7 @@ func (h *mockSentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketN
 }
 func (h *mockSentPacketHandler) SetHandshakeComplete()                  {}
 func (h *mockSentPacketHandler) GetLeastUnacked() protocol.PacketNumber { return 1 }
-func (h *mockSentPacketHandler) GetAlarmTimeout() time.Time             { panic("not implemented") }
-func (h *mockSentPacketHandler) OnAlarm()                               { panic("not implemented") }
+func (h *mockSentPacketHandler) GetAlarmTimeout() time.Time             { return h.alarm }
 func (h *mockSentPacketHandler) SendingAllowed() bool                   { return !h.congestionLimited }
 func (h *mockSentPacketHandler) ShouldSendRetransmittablePacket() bool {
 	b := h.shouldSendRetransmittablePacket
@@ -96,6 +134,11 @@ func (h *mockSentPacketHandler) ShouldSendRetransmittablePacket() bool {
 	return b
 }
 
+func (h *mockSentPacketHandler) OnAlarm() {
+	h.alarm = time.Time{}
+	close(h.alarmHandled)
+}
+
 func (h *mockSentPacketHandler) GetStopWaitingFrame(force bool) *wire.StopWaitingFrame {
 	h.requestedStopWaiting = true
 	return &wire.StopWaitingFrame{LeastUnacked: 0x1337}
@@ -110,6 +153,15 @@ func (h *mockSentPacketHandler) DequeuePacketForRetransmission() *ackhandler.Pac
 	return nil
 }
 
+func (h *mockSentPacketHandler) DequeueMTUProbeResult() *ackhandler.MTUProbeResult {
+	if len(h.mtuProbeResults) > 0 {
+		res := h.mtuProbeResults[0]
+		h.mtuProbeResults = h.mtuProbeResults[1:]
+		return res
+	}
+	return nil
+}
+
 func newMockSentPacketHandler() ackhandler.SentPacketHandler {
 	return &mockSentPacketHandler{}
 }
@@ -142,7 +194,10 @@ func areSessionsRunning() bool {
 	return strings.Contains(b.String(), "quic-go.(*session).run")
 }
 
-type mockParamsNegotiator struct{}
+type mockParamsNegotiator struct {
+	remoteMaxDatagramFrameSize     protocol.ByteCount
+	remoteSupportsApplicationClose bool
+}
 
 var _ handshake.ParamsNegotiator = &mockParamsNegotiator{}
 
@@ -161,7 +216,16 @@ func (m *mockParamsNegotiator) GetReceiveConnectionFlowControlWindow() protocol.
 func (m *mockParamsNegotiator) GetMaxOutgoingStreams() uint32       { return 100 }
 func (m *mockParamsNegotiator) GetMaxIncomingStreams() uint32       { return 100 }
 func (m *mockParamsNegotiator) GetRemoteIdleTimeout() time.Duration { return time.Hour }
-func (m *mockParamsNegotiator) OmitConnectionID() bool              { return false }
+func (m *mockParamsNegotiator) GetRemoteMaxPacketSize() protocol.ByteCount {
+	return protocol.MaxPacketBufferSize
+}
+func (m *mockParamsNegotiator) GetRemoteMaxDatagramFrameSize() protocol.ByteCount {
+	return m.remoteMaxDatagramFrameSize
+}
+func (m *mockParamsNegotiator) RemoteSupportsApplicationClose() bool {
+	return m.remoteSupportsApplicationClose
+}
+func (m *mockParamsNegotiator) OmitConnectionID() bool { return false }
 
 var _ = Describe("Session", func() {
 	var (
@@ -205,6 +269,7 @@ var _ = Describe("Session", func() {
 			scfg,
 			nil,
 			populateServerConfig(&Config{}),
+			nil,
 		)
 		Expect(err).NotTo(HaveOccurred())
 		sess = pSess.(*session)
@@ -254,6 +319,7 @@ var _ = Describe("Session", func() {
 				scfg,
 				nil,
 				conf,
+				nil,
 			)
 			Expect(err).NotTo(HaveOccurred())
 			sess = pSess.(*session)
@@ -418,7 +484,7 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 			n, err := s.Write([]byte{0})
 			Expect(n).To(BeZero())
-			Expect(err).To(MatchError("RST_STREAM received with code 42"))
+			Expect(err).To(Equal(&ApplicationError{Code: 42, Remote: true}))
 		})
 
 		It("doesn't close the stream for reading", func() {
@@ -445,12 +511,14 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 			str.(*stream).writeOffset = 0x1337
 			err = sess.handleRstStreamFrame(&wire.RstStreamFrame{
-				StreamID: 5,
+				StreamID:  5,
+				ErrorCode: 42,
 			})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.packer.controlFrames).To(HaveLen(1))
 			Expect(sess.packer.controlFrames[0].(*wire.RstStreamFrame)).To(Equal(&wire.RstStreamFrame{
 				StreamID:   5,
+				ErrorCode:  42,
 				ByteOffset: 0x1337,
 			}))
 			Expect(str.(*stream).finished()).To(BeTrue())
@@ -503,24 +571,23 @@ var _ = Describe("Session", func() {
 		})
 
 		It("queues a RST_STREAM when a stream gets reset locally", func() {
-			testErr := errors.New("testErr")
 			str, err := sess.streamsMap.GetOrOpenStream(5)
 			str.writeOffset = 0x1337
 			Expect(err).ToNot(HaveOccurred())
-			str.Reset(testErr)
+			str.Reset(0x42)
 			Expect(sess.packer.controlFrames).To(HaveLen(1))
 			Expect(sess.packer.controlFrames[0]).To(Equal(&wire.RstStreamFrame{
 				StreamID:   5,
+				ErrorCode:  0x42,
 				ByteOffset: 0x1337,
 			}))
 			Expect(str.finished()).To(BeFalse())
 		})
 
 		It("doesn't queue another RST_STREAM, when it receives an RST_STREAM as a response for the first", func() {
-			testErr := errors.New("testErr")
 			str, err := sess.streamsMap.GetOrOpenStream(5)
 			Expect(err).ToNot(HaveOccurred())
-			str.Reset(testErr)
+			str.Reset(0x42)
 			Expect(sess.packer.controlFrames).To(HaveLen(1))
 			err = sess.handleRstStreamFrame(&wire.RstStreamFrame{
 				StreamID:   5,
@@ -608,7 +675,31 @@ var _ = Describe("Session", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Eventually(sess.Context().Done()).Should(BeClosed())
 		_, err = str.Read([]byte{0})
-		Expect(err).To(MatchError(qerr.Error(42, "foobar")))
+		Expect(err).To(Equal(&TransportError{ErrorCode: 42, ErrorMessage: "foobar", Remote: true}))
+		Expect(CloseCause(sess.Context())).To(Equal(&TransportError{ErrorCode: 42, ErrorMessage: "foobar", Remote: true}))
+		close(done)
+	})
+
+	It("handles CONNECTION_CLOSE frames sent due to the peer's idle timeout", func(done Done) {
+		go sess.run()
+		str, _ := sess.GetOrOpenStream(5)
+		err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{ErrorCode: qerr.NetworkIdleTimeout, ReasonPhrase: "No recent network activity."}})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+		_, err = str.Write([]byte{0})
+		Expect(err).To(Equal(&IdleTimeoutError{Remote: true}))
+		Expect(CloseCause(sess.Context())).To(Equal(&IdleTimeoutError{Remote: true}))
+		close(done)
+	})
+
+	It("handles APPLICATION_CLOSE frames", func(done Done) {
+		go sess.run()
+		str, _ := sess.GetOrOpenStream(5)
+		err := sess.handleFrames([]wire.Frame{&wire.ApplicationCloseFrame{ErrorCode: 0x1337, ReasonPhrase: "foobar"}})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+		_, err = str.Read([]byte{0})
+		Expect(err).To(Equal(&ApplicationError{Code: 0x1337, ReasonPhrase: "foobar", Remote: true}))
 		close(done)
 	})
 
@@ -735,11 +826,23 @@ var _ = Describe("Session", func() {
 		})
 
 		It("shuts down without error", func() {
+			Expect(CloseCause(sess.Context())).To(BeNil())
 			sess.Close(nil)
 			Eventually(areSessionsRunning).Should(BeFalse())
 			Expect(mconn.written).To(HaveLen(1))
 			Expect(mconn.written).To(Receive(ContainSubstring(string([]byte{0x02, byte(qerr.PeerGoingAway), 0, 0, 0, 0, 0}))))
 			Expect(sess.Context().Done()).To(BeClosed())
+			Expect(CloseCause(sess.Context())).To(Equal(&TransportError{ErrorCode: qerr.PeerGoingAway}))
+		})
+
+		It("exposes the close cause to contexts derived from the session's context", func() {
+			ctx, cancel := context.WithCancel(sess.Context())
+			defer cancel()
+			testErr := errors.New("test error")
+			sess.Close(testErr)
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(ctx.Done()).To(BeClosed())
+			Expect(CloseCause(ctx)).To(MatchError(testErr))
 		})
 
 		It("only closes once", func() {
@@ -765,6 +868,37 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("closes with an application error", func() {
+			sess.connParams = &mockParamsNegotiator{remoteSupportsApplicationClose: true}
+			s, err := sess.GetOrOpenStream(5)
+			Expect(err).NotTo(HaveOccurred())
+			sess.CloseWithError(0x1337, "foobar")
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(mconn.written).To(HaveLen(1))
+			Expect(mconn.written).To(Receive(ContainSubstring(string([]byte{0x09, 0x37, 0x13, 0, 0, 6, 0, 'f', 'o', 'o', 'b', 'a', 'r'}))))
+			_, err = s.Write([]byte{0})
+			Expect(err).To(Equal(&ApplicationError{Code: 0x1337, ReasonPhrase: "foobar"}))
+			Expect(sess.Context().Done()).To(BeClosed())
+			Expect(CloseCause(sess.Context())).To(Equal(&ApplicationError{Code: 0x1337, ReasonPhrase: "foobar"}))
+		})
+
+		It("sends a CONNECTION_CLOSE with the application error, if the peer doesn't support APPLICATION_CLOSE", func() {
+			s, err := sess.GetOrOpenStream(5)
+			Expect(err).NotTo(HaveOccurred())
+			sess.CloseWithError(0x1337, "foobar")
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(mconn.written).To(HaveLen(1))
+			buf := &bytes.Buffer{}
+			err = (&wire.ConnectionCloseFrame{
+				ErrorCode:    qerr.PeerGoingAway,
+				ReasonPhrase: "Application error 0x1337: foobar",
+			}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(Receive(ContainSubstring(buf.String())))
+			_, err = s.Write([]byte{0})
+			Expect(err).To(Equal(&ApplicationError{Code: 0x1337, ReasonPhrase: "foobar"}))
+		})
+
 		It("closes the session in order to replace it with another QUIC version", func() {
 			sess.Close(errCloseSessionForNewVersion)
 			Eventually(areSessionsRunning).Should(BeFalse())
@@ -941,6 +1075,82 @@ var _ = Describe("Session", func() {
 			Expect(mconn.written).To(Receive(ContainSubstring(string([]byte{0x04, 0x05, 0, 0, 0}))))
 		})
 
+		Context("path MTU discovery", func() {
+			var sph *mockSentPacketHandler
+
+			BeforeEach(func() {
+				sph = &mockSentPacketHandler{}
+				sess.sentPacketHandler = sph
+				sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			})
+
+			It("doesn't do path MTU discovery by default", func() {
+				sess.startMTUDiscovery()
+				Expect(sess.mtuDiscoverer).To(BeNil())
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(mconn.written).To(BeEmpty())
+			})
+
+			It("sends a probe packet, and raises the packet size when it is acknowledged", func() {
+				sess.config.MaxPacketSize = 1500
+				sess.startMTUDiscovery()
+				Expect(mconn.dontFragmentSet).To(BeTrue())
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(mconn.written).To(HaveLen(1))
+				Expect(<-mconn.written).To(HaveLen(1425))
+				Expect(sph.sentPackets).To(HaveLen(1))
+				Expect(sph.sentPackets[0].IsMTUProbe).To(BeTrue())
+				Expect(sph.sentPackets[0].Length).To(Equal(protocol.ByteCount(1425)))
+				// only one probe is sent at a time
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(mconn.written).To(BeEmpty())
+				Expect(sess.Stats().MaxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSize))
+
+				sph.mtuProbeResults = []*ackhandler.MTUProbeResult{{Size: 1425, Acked: true}}
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(sess.Stats().MaxPacketSize).To(BeEquivalentTo(1425))
+				Expect(sess.packer.maxPacketSize).To(Equal(protocol.ByteCount(1425)))
+				// the next probe is sent
+				Expect(mconn.written).To(Receive(HaveLen(1463)))
+			})
+
+			It("doesn't do path MTU discovery if the Don't Fragment bit can't be set", func() {
+				sess.config.MaxPacketSize = 1500
+				mconn.dontFragmentErr = errors.New("not supported")
+				sess.startMTUDiscovery()
+				Expect(sess.mtuDiscoverer).To(BeNil())
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(mconn.written).To(BeEmpty())
+			})
+
+			It("treats a probe that is too large for the network interface as a failed probe", func() {
+				sess.config.MaxPacketSize = 1500
+				sess.startMTUDiscovery()
+				mconn.writeErr = &net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)}
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(sph.sentPackets).To(HaveLen(1))
+				Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1424)))
+				Expect(sess.mtuDiscoverer.ShouldSendProbe()).To(BeTrue())
+			})
+
+			It("returns other errors that occur when sending a probe", func() {
+				sess.config.MaxPacketSize = 1500
+				sess.startMTUDiscovery()
+				testErr := errors.New("write failed")
+				mconn.writeErr = testErr
+				Expect(sess.sendPacket()).To(MatchError(testErr))
+			})
+
+			It("limits the probe size to the maximum packet size of the peer", func() {
+				sess.config.MaxPacketSize = uint64(protocol.MaxPacketBufferSize)
+				mockPn := mocks.NewMockParamsNegotiator(mockCtrl)
+				sess.connParams = mockPn
+				mockPn.EXPECT().GetRemoteMaxPacketSize().Return(protocol.ByteCount(1500))
+				sess.startMTUDiscovery()
+				Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1500)))
+			})
+		})
+
 		It("sends public reset", func() {
 			err := sess.sendPublicReset(1)
 			Expect(err).NotTo(HaveOccurred())
@@ -972,6 +1182,166 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("sending packets in batches", func() {
+		var bw *mockBatchWriter
+
+		BeforeEach(func() {
+			bw = &mockBatchWriter{}
+			sess.batchWriter = bw
+			sess.sentPacketHandler = newMockSentPacketHandler()
+			sess.packer.packetNumberGenerator.next = 0x1337 + 9
+			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			_, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("writes all packets in a single batch", func() {
+			sess.streamFramer.AddFrameForRetransmission(&wire.StreamFrame{
+				StreamID: 5,
+				Data:     bytes.Repeat([]byte{'f'}, 3*int(protocol.MaxPacketSize)),
+			})
+			err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mconn.written).To(BeEmpty())
+			Expect(bw.batches).To(HaveLen(1))
+			Expect(len(bw.batches[0])).To(BeNumerically(">=", 3))
+			Expect(sess.sendQueue).To(BeEmpty())
+		})
+
+		It("limits the size of a batch", func() {
+			sess.streamFramer.AddFrameForRetransmission(&wire.StreamFrame{
+				StreamID: 5,
+				Data:     bytes.Repeat([]byte{'f'}, (protocol.PacketBatchSize+10)*int(protocol.MaxPacketSize)),
+			})
+			err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bw.batches).To(HaveLen(2))
+			Expect(bw.batches[0]).To(HaveLen(protocol.PacketBatchSize))
+		})
+
+		It("writes MTU probes in a batch of their own", func() {
+			sess.config.MaxPacketSize = 1500
+			sess.startMTUDiscovery()
+			sess.streamFramer.AddFrameForRetransmission(&wire.StreamFrame{
+				StreamID: 5,
+				Data:     bytes.Repeat([]byte{'f'}, 2*int(protocol.MaxPacketSize)),
+			})
+			err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mconn.written).To(BeEmpty())
+			Expect(bw.batches).To(HaveLen(2))
+			Expect(bw.batches[0]).To(HaveLen(1))
+			Expect(bw.batches[0][0]).To(HaveLen(1425))
+			Expect(len(bw.batches[1])).To(BeNumerically(">=", 2))
+			Expect(sess.sendQueue).To(BeEmpty())
+		})
+
+		It("treats a probe that is too large for the network interface as a failed probe", func() {
+			sess.config.MaxPacketSize = 1500
+			sess.startMTUDiscovery()
+			bw.writeErr = &net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EMSGSIZE)}
+			Expect(sess.sendPacket()).To(Succeed())
+			Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1424)))
+			Expect(sess.sendQueue).To(BeEmpty())
+		})
+	})
+
+	Context("datagrams", func() {
+		It("errors when datagrams are not enabled", func() {
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("datagrams are not enabled"))
+			_, err := sess.ReceiveMessage()
+			Expect(err).To(MatchError("datagrams are not enabled"))
+			err = sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}})
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but datagrams are not enabled")))
+		})
+
+		Context("enabled", func() {
+			var transportParams *handshake.TransportParameters
+			var connParams *mockParamsNegotiator
+
+			BeforeEach(func() {
+				newCryptoSetup = func(
+					_ protocol.ConnectionID,
+					_ net.Addr,
+					_ protocol.VersionNumber,
+					_ *handshake.ServerConfig,
+					params *handshake.TransportParameters,
+					_ []protocol.VersionNumber,
+					_ func(net.Addr, *Cookie) bool,
+					_ chan<- protocol.EncryptionLevel,
+				) (handshake.CryptoSetup, handshake.ParamsNegotiator, error) {
+					transportParams = params
+					return cryptoSetup, &mockParamsNegotiator{}, nil
+				}
+				pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, populateServerConfig(&Config{EnableDatagrams: true}), nil)
+				Expect(err).ToNot(HaveOccurred())
+				sess = pSess.(*session)
+				connParams = &mockParamsNegotiator{remoteMaxDatagramFrameSize: protocol.MaxDatagramFrameSize}
+				sess.connParams = connParams
+				sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			})
+
+			It("advertises support for datagrams", func() {
+				Expect(transportParams.MaxDatagramFrameSize).To(Equal(protocol.MaxDatagramFrameSize))
+			})
+
+			It("sends messages", func() {
+				Expect(sess.SendMessage([]byte("foobar"))).To(Succeed())
+				Expect(sess.sendPacket()).To(Succeed())
+				Expect(mconn.written).To(HaveLen(1))
+				Expect(mconn.written).To(Receive(ContainSubstring(string([]byte{0x08, 0x6, 0x0, 'f', 'o', 'o', 'b', 'a', 'r'}))))
+			})
+
+			It("copies the message", func() {
+				p := []byte("foobar")
+				Expect(sess.SendMessage(p)).To(Succeed())
+				p[0] = 'v'
+				Expect(sess.datagramQueue.Peek().Data).To(Equal([]byte("foobar")))
+			})
+
+			It("errors if the peer doesn't support datagrams", func() {
+				connParams.remoteMaxDatagramFrameSize = 0
+				Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("the peer doesn't support datagrams"))
+			})
+
+			It("errors if the message doesn't fit into a packet", func() {
+				max := protocol.MaxPacketSize - protocol.MaxDatagramPacketOverhead - 3
+				Expect(sess.SendMessage(make([]byte, max))).To(Succeed())
+				Expect(sess.SendMessage(make([]byte, max+1))).To(MatchError(fmt.Sprintf("message too large (%d bytes, maximum %d bytes)", max+1, max)))
+			})
+
+			It("errors if the message is larger than the peer accepts", func() {
+				connParams.remoteMaxDatagramFrameSize = 100
+				Expect(sess.SendMessage(make([]byte, 97))).To(Succeed())
+				Expect(sess.SendMessage(make([]byte, 98))).To(MatchError("message too large (98 bytes, maximum 97 bytes)"))
+			})
+
+			It("receives messages", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}})
+				Expect(err).ToNot(HaveOccurred())
+				data, err := sess.ReceiveMessage()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("unblocks ReceiveMessage when the session is closed", func() {
+				testErr := errors.New("test error")
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := sess.ReceiveMessage()
+					Expect(err).To(MatchError(qerr.ToQuicError(testErr)))
+					close(done)
+				}()
+				go sess.run()
+				Consistently(done).ShouldNot(BeClosed())
+				sess.Close(testErr)
+				Eventually(done).Should(BeClosed())
+				Eventually(areSessionsRunning).Should(BeFalse())
+			})
+		})
+	})
+
 	Context("retransmissions", func() {
 		var sph *mockSentPacketHandler
 		BeforeEach(func() {
@@ -1143,7 +1513,7 @@ var _ = Describe("Session", func() {
 				// close the stream
 				str.(*stream).sentFin()
 				str.Close()
-				str.(*stream).RegisterRemoteError(nil)
+				str.(*stream).RegisterRemoteError(0)
 				err = sess.streamsMap.DeleteClosedStreams()
 				Expect(err).ToNot(HaveOccurred())
 				_, err = sess.flowControlManager.SendWindowSize(5)
@@ -1411,9 +1781,20 @@ var _ = Describe("Session", func() {
 
 	It("passes errors to the handshakeChan", func(done Done) {
 		testErr := errors.New("handshake error")
+		go sess.run()
+		Expect(sess.Close(testErr)).To(Succeed())
+		var ev handshakeEvent
+		Eventually(handshakeChan).Should(Receive(&ev))
+		Expect(ev.err).To(MatchError(testErr))
+		close(done)
+	})
+
+	It("passes an error to the handshakeChan when the session is closed without an error", func(done Done) {
 		go sess.run()
 		Expect(sess.Close(nil)).To(Succeed())
-		Expect(handshakeChan).To(Receive(&handshakeEvent{err: testErr}))
+		var ev handshakeEvent
+		Eventually(handshakeChan).Should(Receive(&ev))
+		Expect(ev.err).To(MatchError(qerr.Error(qerr.PeerGoingAway, "")))
 		close(done)
 	})
 
@@ -1471,22 +1852,47 @@ var _ = Describe("Session", func() {
 	})
 
 	Context("timeouts", func() {
+		It("handles the loss detection alarm when the timer fires exactly at the alarm timeout", func() {
+			clock := utils.NewVirtualClock(time.Now())
+			sess.clock = clock
+			sess.timer = utils.NewTimerWithClock(clock)
+			sph := newMockSentPacketHandler().(*mockSentPacketHandler)
+			sph.alarm = clock.Now().Add(time.Second)
+			sph.alarmHandled = make(chan struct{})
+			sess.sentPacketHandler = sph
+			alarm := sph.alarm
+			go sess.run()
+			defer sess.Close(nil)
+			Eventually(func() time.Time {
+				deadline, _ := clock.NextDeadline()
+				return deadline
+			}).Should(Equal(alarm))
+			Consistently(sph.alarmHandled).ShouldNot(BeClosed())
+			Expect(clock.Advance()).To(BeTrue())
+			Expect(clock.Now()).To(Equal(alarm))
+			Eventually(sph.alarmHandled).Should(BeClosed())
+		})
+
 		It("times out due to no network activity", func(done Done) {
 			sess.handshakeComplete = true
 			sess.lastNetworkActivityTime = time.Now().Add(-time.Hour)
 			err := sess.run() // Would normally not return
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+			Expect(err).To(Equal(&IdleTimeoutError{}))
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
 			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
 			Expect(sess.Context().Done()).To(BeClosed())
+			Expect(CloseCause(sess.Context())).To(Equal(&IdleTimeoutError{}))
 			close(done)
 		})
 
 		It("times out due to non-completed handshake", func(done Done) {
 			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
 			err := sess.run() // Would normally not return
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
+			Expect(err).To(Equal(&HandshakeTimeoutError{}))
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
 			Expect(mconn.written).To(Receive(ContainSubstring("Crypto handshake did not complete in time.")))
 			Expect(sess.Context().Done()).To(BeClosed())
+			Expect(CloseCause(sess.Context())).To(Equal(&HandshakeTimeoutError{}))
 			close(done)
 		})
 
@@ -1515,7 +1921,7 @@ var _ = Describe("Session", func() {
 			}()
 			var err error
 			Eventually(errChan).Should(Receive(&err))
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+			Expect(err).To(Equal(&IdleTimeoutError{}))
 			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
@@ -1526,9 +1932,132 @@ var _ = Describe("Session", func() {
 		for i := protocol.PacketNumber(0); i < protocol.MaxSessionUnprocessedPackets+10; i++ {
 			sess.handlePacket(&receivedPacket{})
 		}
+		Expect(sess.Stats()).To(Equal(SessionStats{
+			ReceiveQueueLen:         protocol.MaxSessionUnprocessedPackets,
+			ReceiveQueueCap:         protocol.MaxSessionUnprocessedPackets,
+			DroppedPackets:          10,
+			MaxPacketSize:           uint64(protocol.MaxPacketSize),
+			ReceiveConnectionWindow: protocol.ReceiveConnectionFlowControlWindow,
+		}))
 		close(done)
 	}, 0.5)
 
+	It("uses the configured size of the receive queue", func() {
+		conf := populateServerConfig(&Config{MaxUnprocessedPackets: 5})
+		pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, conf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		sess = pSess.(*session)
+		for i := 0; i < 8; i++ {
+			sess.handlePacket(&receivedPacket{})
+		}
+		Expect(sess.Stats()).To(Equal(SessionStats{
+			ReceiveQueueLen:         5,
+			ReceiveQueueCap:         5,
+			DroppedPackets:          3,
+			MaxPacketSize:           uint64(protocol.MaxPacketSize),
+			ReceiveConnectionWindow: protocol.ReceiveConnectionFlowControlWindow,
+		}))
+	})
+
+	It("reports to the listener when the receive queue is backlogged", func() {
+		conf := populateServerConfig(&Config{MaxUnprocessedPackets: 10})
+		pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, conf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		sess = pSess.(*session)
+		sess.unpacker = &mockUnpacker{}
+		sess.cryptoSetup = &mockCryptoSetup{}
+		Expect(conf.receiveBacklog.stats()).To(Equal(ListenerStats{Sessions: 1}))
+		for i := 1; i <= 5; i++ {
+			sess.handlePacket(&receivedPacket{
+				publicHeader: &wire.PublicHeader{PacketNumber: protocol.PacketNumber(i), Raw: utils.GetPacketBuffer()},
+				data:         []byte("foobar"),
+			})
+		}
+		Expect(conf.receiveBacklog.stats().BackloggedSessions).To(BeZero())
+		for i := 6; i <= 12; i++ {
+			sess.handlePacket(&receivedPacket{
+				publicHeader: &wire.PublicHeader{PacketNumber: protocol.PacketNumber(i), Raw: utils.GetPacketBuffer()},
+				data:         []byte("foobar"),
+			})
+		}
+		Expect(conf.receiveBacklog.stats()).To(Equal(ListenerStats{Sessions: 1, BackloggedSessions: 1, DroppedPackets: 2}))
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+			close(done)
+		}()
+		Eventually(func() int { return conf.receiveBacklog.stats().BackloggedSessions }).Should(BeZero())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(done).Should(BeClosed())
+		Expect(conf.receiveBacklog.stats()).To(Equal(ListenerStats{DroppedPackets: 2}))
+	})
+
+	It("continues after a stateless retry", func() {
+		retry := &statelessRetry{
+			packetNumber:      1,
+			cryptoReadOffset:  1000,
+			cryptoWriteOffset: 100,
+		}
+		pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, populateServerConfig(&Config{}), retry)
+		Expect(err).ToNot(HaveOccurred())
+		sess = pSess.(*session)
+		Expect(sess.packer.packetNumberGenerator.Peek()).To(BeNumerically(">", 1))
+		// the client acknowledges the packet containing the REJ
+		err = sess.sentPacketHandler.ReceivedAck(&wire.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("processes all queued packets", func() {
+		conf := populateServerConfig(&Config{MaxUnprocessedPackets: 10})
+		pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, conf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		sess = pSess.(*session)
+		sess.unpacker = &mockUnpacker{}
+		sess.cryptoSetup = &mockCryptoSetup{}
+		for i := 1; i <= 10; i++ {
+			sess.handlePacket(&receivedPacket{
+				publicHeader: &wire.PublicHeader{PacketNumber: protocol.PacketNumber(i), Raw: utils.GetPacketBuffer()},
+				data:         []byte("foobar"),
+			})
+		}
+		go sess.run()
+		Eventually(func() int { return sess.Stats().ReceiveQueueLen }).Should(BeZero())
+		Expect(sess.Stats().DroppedPackets).To(BeZero())
+		Expect(sess.Close(nil)).To(Succeed())
+	})
+
+	It("reports the buffered stream data", func() {
+		str, err := sess.GetOrOpenStream(5)
+		Expect(err).ToNot(HaveOccurred())
+		err = str.(*stream).AddStreamFrame(&wire.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("foobar")})
+		Expect(err).ToNot(HaveOccurred())
+		str.(*stream).dataForWriting = []byte("foo")
+		stats := sess.Stats()
+		Expect(stats.ReceiveBuffered).To(BeEquivalentTo(6))
+		Expect(stats.SendBuffered).To(BeEquivalentTo(3))
+	})
+
+	It("reserves memory from the budget of the listener, and releases it when closed", func() {
+		conf := populateServerConfig(&Config{MaxReceiveBufferPerListener: 1 << 20})
+		pSess, _, err := newSession(mconn, protocol.Version37, 0, scfg, nil, conf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		sess = pSess.(*session)
+		_, err = sess.GetOrOpenStream(5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conf.receiveBudget.Used()).ToNot(BeZero())
+		Expect(conf.receiveBudget.Used()).To(Equal(sess.receiveBudget.Used()))
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+			close(done)
+		}()
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(done).Should(BeClosed())
+		Expect(conf.receiveBudget.Used()).To(BeZero())
+	})
+
 	Context("getting streams", func() {
 		It("returns a new stream", func() {
 			str, err := sess.GetOrOpenStream(11)
@@ -1554,6 +2083,15 @@ var _ = Describe("Session", func() {
 			Expect(ok).To(BeFalse())
 		})
 
+		It("uses the configured send buffer size, but doesn't buffer writes on the crypto stream", func() {
+			str, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.(*stream).sendBufferSize).To(Equal(protocol.ByteCount(protocol.DefaultSendBufferSize)))
+			cs, err := sess.streamsMap.GetOrOpenStream(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.sendBufferSize).To(BeZero())
+		})
+
 		// all relevant tests for this are in the streamsMap
 		It("opens streams synchronously", func() {
 			str, err := sess.OpenStreamSync()
@@ -0,0 +1,482 @@
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// simLinkConfig configures one direction of the simulated link
+type simLinkConfig struct {
+	Delay     time.Duration
+	Bandwidth uint64 // in bytes per second, 0 means unlimited
+	LossRate  float64
+}
+
+// A simLink delays and drops packets according to the virtual clock
+type simLink struct {
+	clock *utils.VirtualClock
+	conf  simLinkConfig
+
+	mutex         sync.Mutex
+	rand          *rand.Rand
+	lastDeparture time.Time
+	numPackets    int
+	numLost       int
+}
+
+// a simAddr is the address of one end of a simulated link
+type simAddr string
+
+func (a simAddr) Network() string { return "sim" }
+func (a simAddr) String() string  { return string(a) }
+
+// a simConn is one end of a pipe, which sends packets over a simLink
+// It uses fixed addresses, since the addresses of the pipe depend on the number of pipes created before,
+// and the length of the address changes the length of the source address token.
+type simConn struct {
+	net.PacketConn
+	link *simLink
+	peer *simConn
+
+	localAddr, remoteAddr simAddr
+
+	mutex     sync.Mutex
+	closed    bool
+	numUnread int // the number of packets that arrived, but weren't read yet
+}
+
+func (c *simConn) LocalAddr() net.Addr { return c.localAddr }
+
+func (c *simConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, _, err := c.PacketConn.ReadFrom(b)
+	if err == nil {
+		c.mutex.Lock()
+		c.numUnread--
+		c.mutex.Unlock()
+	}
+	return n, c.remoteAddr, err
+}
+
+func (c *simConn) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	return c.PacketConn.Close()
+}
+
+// deliver queues a packet that arrived over the link, such that it is returned by ReadFrom.
+// Like the pipe, it drops the packet if the queue is full.
+func (c *simConn) deliver(data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.PacketConn.(*pipeEnd).queue <- data:
+		c.numUnread++
+	default:
+	}
+}
+
+// hasUnreadPackets says if packets arrived that the receiver didn't read yet.
+// Packets arriving after the conn was closed are never read.
+func (c *simConn) hasUnreadPackets() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return !c.closed && c.numUnread > 0
+}
+
+// WriteTo delivers the packet when the virtual time has advanced by the link delay
+func (c *simConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	l := c.link
+	data := make([]byte, len(b))
+	copy(data, b)
+
+	now := l.clock.Now()
+	l.mutex.Lock()
+	l.numPackets++
+	if l.conf.LossRate > 0 && l.rand.Float64() < l.conf.LossRate {
+		l.numLost++
+		l.mutex.Unlock()
+		return len(b), nil
+	}
+	depart := now
+	if l.conf.Bandwidth > 0 {
+		if l.lastDeparture.After(depart) {
+			depart = l.lastDeparture
+		}
+		depart = depart.Add(time.Duration(uint64(len(b)) * uint64(time.Second) / l.conf.Bandwidth))
+		l.lastDeparture = depart
+	}
+	l.mutex.Unlock()
+
+	l.clock.AfterFunc(depart.Add(l.conf.Delay).Sub(now), func() {
+		c.peer.deliver(data)
+	})
+	return len(b), nil
+}
+
+// The simulator runs a QUIC client and server over an in-memory link in virtual time.
+// The virtual time advances to the next timer as soon as the peers are idle, i.e. when all packets
+// that arrived were read, and all go routines are blocked, waiting for a packet or a timer.
+// Timers are fired one by one, so the outcome of a simulation only depends on the seed.
+type simulator struct {
+	clock *utils.VirtualClock
+	start time.Time
+
+	conns    []*simConn
+	stackBuf []byte
+}
+
+func newSimulator() *simulator {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &simulator{
+		clock:    utils.NewVirtualClock(start),
+		start:    start,
+		stackBuf: make([]byte, 64*1024),
+	}
+}
+
+// newLink creates a pair of connected net.PacketConns, with the given conditions in each direction
+func (s *simulator) newLink(seed int64, toServer, toClient simLinkConfig) (*simConn, *simConn) {
+	serverEnd, clientEnd := NewPipe()
+	serverConn := &simConn{
+		PacketConn: serverEnd,
+		localAddr:  "server",
+		remoteAddr: "client",
+		link: &simLink{
+			clock: s.clock,
+			conf:  toClient,
+			rand:  rand.New(rand.NewSource(seed)),
+		},
+	}
+	clientConn := &simConn{
+		PacketConn: clientEnd,
+		localAddr:  "client",
+		remoteAddr: "server",
+		link: &simLink{
+			clock: s.clock,
+			conf:  toServer,
+			rand:  rand.New(rand.NewSource(seed + 1)),
+		},
+	}
+	serverConn.peer = clientConn
+	clientConn.peer = serverConn
+	s.conns = append(s.conns, serverConn, clientConn)
+	return serverConn, clientConn
+}
+
+// config returns a Config using the virtual clock
+func (s *simulator) config(c *Config) *Config {
+	if c == nil {
+		c = &Config{}
+	}
+	c.clock = s.clock
+	return c
+}
+
+// hasUnreadPackets says if any of the peers has packets to read
+func (s *simulator) hasUnreadPackets() bool {
+	for _, c := range s.conns {
+		if c.hasUnreadPackets() {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutinesBlocked says if all go routines, except for the calling one, are blocked.
+// Go routines in a syscall count as blocked, since the peers don't make any syscalls.
+func (s *simulator) goroutinesBlocked() bool {
+	n := runtime.Stack(s.stackBuf, true)
+	for n == len(s.stackBuf) {
+		s.stackBuf = make([]byte, 2*len(s.stackBuf))
+		n = runtime.Stack(s.stackBuf, true)
+	}
+	// the first go routine is the calling one
+	first := true
+	for _, line := range bytes.Split(s.stackBuf[:n], []byte("\n")) {
+		// the header of every go routine looks like "goroutine 42 [chan receive, 2 minutes]:"
+		if !bytes.HasPrefix(line, []byte("goroutine ")) {
+			continue
+		}
+		if first {
+			first = false
+			continue
+		}
+		start := bytes.IndexByte(line, '[')
+		if start < 0 {
+			continue
+		}
+		state := line[start+1:]
+		if end := bytes.IndexAny(state, ",]"); end >= 0 {
+			state = state[:end]
+		}
+		if st := string(state); st == "running" || st == "runnable" {
+			return false
+		}
+	}
+	return true
+}
+
+// waitUntilIdle waits until all packets that arrived were read, and all go routines are blocked.
+// Then the peers can only make progress when the virtual time advances.
+func (s *simulator) waitUntilIdle() error {
+	start := time.Now()
+	for s.hasUnreadPackets() || !s.goroutinesBlocked() {
+		if time.Since(start) > 10*time.Second {
+			return errors.New("simulator: the peers didn't become idle")
+		}
+		runtime.Gosched()
+	}
+	return nil
+}
+
+// run advances the virtual time until done is closed.
+// It returns the virtual time that elapsed.
+func (s *simulator) run(done <-chan struct{}, timeout time.Duration) (time.Duration, error) {
+	deadline := s.start.Add(timeout)
+	for {
+		if err := s.waitUntilIdle(); err != nil {
+			return 0, err
+		}
+		select {
+		case <-done:
+			return s.clock.Now().Sub(s.start), nil
+		default:
+		}
+		next, ok := s.clock.NextDeadline()
+		if !ok {
+			return 0, errors.New("simulator: deadlock, no timer running")
+		}
+		if next.After(deadline) {
+			return 0, errors.New("simulator: timeout")
+		}
+		s.clock.Advance()
+	}
+}
+
+var _ = Describe("Simulator", func() {
+	// transfer sends data from the client to the server.
+	// It returns the virtual time needed to complete the transfer, and the statistics of the server's session after the transfer.
+	transfer := func(seed int64, dataLen int, link simLinkConfig) (time.Duration, *simConn, SessionStats) {
+		sim := newSimulator()
+		serverConn, clientConn := sim.newLink(seed, link, link)
+		ln, err := Listen(serverConn, testdata.GetTLSConfig(), sim.config(nil))
+		Expect(err).ToNot(HaveOccurred())
+
+		data := make([]byte, dataLen)
+		rand.New(rand.NewSource(seed)).Read(data)
+
+		var serverStats SessionStats
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			received, err := ioutil.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bytes.Equal(received, data)).To(BeTrue())
+			serverStats = sess.Stats()
+		}()
+
+		clientErr := make(chan error, 1)
+		clientSess := make(chan Session, 1)
+		go func() {
+			sess, err := Dial(clientConn, serverConn.LocalAddr(), "quic.clemente.io:443", &tls.Config{InsecureSkipVerify: true}, sim.config(nil))
+			if err != nil {
+				clientErr <- err
+				return
+			}
+			clientSess <- sess
+			// stream 3 doesn't contribute to connection-level flow control, so the data is sent on stream 5
+			if _, err := sess.OpenStreamSync(); err != nil {
+				clientErr <- err
+				return
+			}
+			str, err := sess.OpenStreamSync()
+			if err != nil {
+				clientErr <- err
+				return
+			}
+			if _, err := str.Write(data); err != nil {
+				clientErr <- err
+				return
+			}
+			clientErr <- str.Close()
+		}()
+
+		elapsed, err := sim.run(done, 10*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientErr).To(Receive(BeNil()))
+		// the sessions would never time out, since the virtual time doesn't advance any more
+		var sess Session
+		Expect(clientSess).To(Receive(&sess))
+		Expect(sess.Close(nil)).To(Succeed())
+		Expect(ln.Close()).To(Succeed())
+		Eventually(areSessionsRunning).Should(BeFalse())
+		return elapsed, clientConn, serverStats
+	}
+
+	It("advances the virtual time only when the peers are idle", func() {
+		start := time.Now()
+		elapsed, _, _ := transfer(1, 10000, simLinkConfig{Delay: time.Second})
+		// 2 seconds RTT: 1 RTT for the source address token, 1 RTT to become secure, 1 RTT to become forward-secure
+		// the data arrives 0.5 RTTs later
+		Expect(elapsed).To(And(
+			BeNumerically(">=", 7*time.Second),
+			BeNumerically("<", 8*time.Second),
+		))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("transfers data over a lossy link, a lot faster than real time", func() {
+		link := simLinkConfig{
+			Delay:     200 * time.Millisecond,
+			Bandwidth: 25 * 1000, // 25 kB/s
+			LossRate:  0.05,
+		}
+		start := time.Now()
+		elapsed, clientConn, _ := transfer(1, 1500*1000, link)
+		// 1.5 MB at 25 kB/s take at least 60 seconds
+		Expect(elapsed).To(BeNumerically(">", 60*time.Second))
+		Expect(clientConn.link.numLost).ToNot(BeZero())
+		Expect(time.Since(start)).To(BeNumerically("<", elapsed/10))
+	})
+
+	It("grows the flow control window on a link with a large bandwidth-delay product", func() {
+		link := simLinkConfig{
+			Delay:     150 * time.Millisecond,
+			Bandwidth: 10 * 1000 * 1000, // 10 MB/s
+		}
+		elapsed, _, stats := transfer(1, 4*1000*1000, link)
+		// with the initial flow control window of 32 kB per RTT, this would take more than 30 seconds
+		Expect(elapsed).To(BeNumerically("<", 5*time.Second))
+		Expect(stats.ReceiveConnectionWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindowServer))
+	})
+
+	It("sends messages in DATAGRAM frames", func() {
+		sim := newSimulator()
+		serverConn, clientConn := sim.newLink(1, simLinkConfig{Delay: 50 * time.Millisecond}, simLinkConfig{Delay: 50 * time.Millisecond})
+		ln, err := Listen(serverConn, testdata.GetTLSConfig(), sim.config(&Config{EnableDatagrams: true}))
+		Expect(err).ToNot(HaveOccurred())
+
+		const numMessages = 10
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < numMessages; i++ {
+				data, err := sess.ReceiveMessage()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(fmt.Sprintf("message %d", i)))
+			}
+		}()
+
+		clientSess := make(chan Session, 1)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := Dial(clientConn, serverConn.LocalAddr(), "quic.clemente.io:443", &tls.Config{InsecureSkipVerify: true}, sim.config(&Config{EnableDatagrams: true}))
+			Expect(err).ToNot(HaveOccurred())
+			clientSess <- sess
+			for i := 0; i < numMessages; i++ {
+				Expect(sess.SendMessage([]byte(fmt.Sprintf("message %d", i)))).To(Succeed())
+			}
+		}()
+
+		_, err = sim.run(done, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		var sess Session
+		Expect(clientSess).To(Receive(&sess))
+		Expect(sess.Close(nil)).To(Succeed())
+		Expect(ln.Close()).To(Succeed())
+		Eventually(areSessionsRunning).Should(BeFalse())
+	})
+
+	It("delivers application error codes to the peer", func() {
+		sim := newSimulator()
+		serverConn, clientConn := sim.newLink(1, simLinkConfig{Delay: 50 * time.Millisecond}, simLinkConfig{Delay: 50 * time.Millisecond})
+		ln, err := Listen(serverConn, testdata.GetTLSConfig(), sim.config(nil))
+		Expect(err).ToNot(HaveOccurred())
+
+		dataReceived := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadFull(str, make([]byte, 6))
+			Expect(err).ToNot(HaveOccurred())
+			close(dataReceived)
+			<-str.Context().Done()
+			_, err = str.Write([]byte("foobar"))
+			Expect(err).To(Equal(&ApplicationError{Code: 0x42, Remote: true}))
+			Expect(sess.CloseWithError(0x1337, "bye")).To(Succeed())
+		}()
+
+		// the client closes its net.PacketConn when the session is closed, so the server closes the session
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			sess, err := Dial(clientConn, serverConn.LocalAddr(), "quic.clemente.io:443", &tls.Config{InsecureSkipVerify: true}, sim.config(nil))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			<-dataReceived
+			str.Reset(0x42)
+			_, err = sess.AcceptStream()
+			Expect(err).To(Equal(&ApplicationError{Code: 0x1337, ReasonPhrase: "bye", Remote: true}))
+		}()
+
+		_, err = sim.run(done, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.Close()).To(Succeed())
+		Eventually(areSessionsRunning).Should(BeFalse())
+	})
+
+	It("is deterministic", func() {
+		link := simLinkConfig{
+			Delay:     50 * time.Millisecond,
+			Bandwidth: 100 * 1000, // 100 kB/s
+			LossRate:  0.05,
+		}
+		elapsed1, clientConn1, _ := transfer(42, 200*1000, link)
+		elapsed2, clientConn2, _ := transfer(42, 200*1000, link)
+		Expect(elapsed1).To(Equal(elapsed2))
+		Expect(clientConn1.link.numPackets).To(Equal(clientConn2.link.numPackets))
+		Expect(clientConn1.link.numLost).To(Equal(clientConn2.link.numLost))
+	})
+})
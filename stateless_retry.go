@@ -0,0 +1,124 @@
+package quic
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// statelessRetry describes the stateless retry that preceded the creation of a session.
+// The session continues where the stateless retry left off.
+type statelessRetry struct {
+	// the packet number of the packet containing the REJ
+	packetNumber protocol.PacketNumber
+	// the length of the CHLO that was answered with the REJ
+	cryptoReadOffset protocol.ByteCount
+	// the length of the REJ
+	cryptoWriteOffset protocol.ByteCount
+}
+
+// the packet number used for the packet containing the REJ of a stateless retry
+const statelessRetryPacketNumber protocol.PacketNumber = 1
+
+// nullAEADOpener opens unencrypted packets, before a session was created
+type nullAEADOpener struct {
+	aead crypto.AEAD
+}
+
+func (o *nullAEADOpener) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
+	data, err := o.aead.Open(dst, src, packetNumber, associatedData)
+	return data, protocol.EncryptionUnencrypted, err
+}
+
+// statelessRetryRequired says if new clients have to validate their address
+func (s *server) statelessRetryRequired(version protocol.VersionNumber) bool {
+	threshold := s.config.StatelessRetryThreshold
+	if threshold == 0 || version.UsesTLS() {
+		return false
+	}
+	return int(atomic.LoadInt32(&s.handshakesInProgress)) >= threshold
+}
+
+// validateAddress checks if the first packet of a new connection contains a CHLO with a valid source address token.
+// If it doesn't, a stateless retry is sent.
+// It returns false if no session should be created for this packet.
+// If the client validated its address using a stateless retry, it returns the statelessRetry needed to set up the session.
+func (s *server) validateAddress(
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	hdr *wire.PublicHeader,
+	data []byte,
+	rcvTime time.Time,
+) (bool, *statelessRetry, error) {
+	unpacker := &packetUnpacker{
+		version: hdr.VersionNumber,
+		aead:    &nullAEADOpener{aead: crypto.NewNullAEAD(protocol.PerspectiveServer, hdr.VersionNumber)},
+	}
+	packet, err := unpacker.Unpack(hdr.Raw, hdr, data)
+	if err != nil {
+		return false, nil, err
+	}
+	var frame *wire.StreamFrame
+	for _, f := range packet.frames {
+		if sf, ok := f.(*wire.StreamFrame); ok && sf.StreamID == 1 {
+			frame = sf
+			break
+		}
+	}
+	if frame == nil {
+		// Only packets containing a CHLO can create a new session.
+		return false, nil, nil
+	}
+	chlo, err := handshake.ParseHandshakeMessage(bytes.NewReader(frame.Data))
+	if err != nil || chlo.Tag != handshake.TagCHLO {
+		return false, nil, qerr.Error(qerr.InvalidCryptoMessageType, "expected a CHLO")
+	}
+
+	token := chlo.Data[handshake.TagSTK]
+	if s.scfg.AcceptToken(token, remoteAddr, s.config.AcceptCookie) {
+		if frame.Offset == 0 {
+			// The client already had a valid token, e.g. from a previous connection.
+			return true, nil, nil
+		}
+		return true, &statelessRetry{
+			packetNumber:      statelessRetryPacketNumber,
+			cryptoReadOffset:  frame.Offset,
+			cryptoWriteOffset: handshake.RetryMessageLen(token),
+		}, nil
+	}
+	if frame.Offset != 0 {
+		// This is not the first CHLO of this connection, but we don't know anything about this connection.
+		return false, nil, nil
+	}
+	return false, nil, s.sendStatelessRetry(pconn, remoteAddr, hdr, rcvTime)
+}
+
+// sendStatelessRetry sends a REJ containing a source address token.
+// The packet also acknowledges the packet containing the CHLO, such that the client doesn't retransmit the CHLO.
+func (s *server) sendStatelessRetry(pconn net.PacketConn, remoteAddr net.Addr, hdr *wire.PublicHeader, rcvTime time.Time) error {
+	rej, err := s.scfg.NewRetryMessage(remoteAddr)
+	if err != nil {
+		return err
+	}
+	utils.Debugf("Sending a stateless retry for connection %x", hdr.ConnectionID)
+	return s.sendUnencryptedPacket(pconn, remoteAddr, hdr, []wire.Frame{
+		&wire.AckFrame{
+			LargestAcked: hdr.PacketNumber,
+			LowestAcked:  hdr.PacketNumber,
+			DelayTime:    s.config.clock.Now().Sub(rcvTime),
+		},
+		&wire.StreamFrame{
+			StreamID:       1,
+			Data:           rej,
+			DataLenPresent: true,
+		},
+	})
+}
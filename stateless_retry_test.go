@@ -0,0 +1,206 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stateless Retries", func() {
+	var (
+		serv            *server
+		conn            *mockPacketConn
+		createdSessions []*statelessRetry
+	)
+	const connID = protocol.ConnectionID(0x1337)
+	version := protocol.Version37
+	remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+
+	// composeCHLOPacket composes an unencrypted packet containing a CHLO
+	composeCHLOPacket := func(pn protocol.PacketNumber, offset protocol.ByteCount, token []byte) []byte {
+		chloData := map[handshake.Tag][]byte{handshake.TagSNI: []byte("quic.clemente.io")}
+		if token != nil {
+			chloData[handshake.TagSTK] = token
+		}
+		chlo := &bytes.Buffer{}
+		handshake.HandshakeMessage{Tag: handshake.TagCHLO, Data: chloData}.Write(chlo)
+		hdr := &wire.PublicHeader{
+			VersionFlag:     true,
+			VersionNumber:   version,
+			ConnectionID:    connID,
+			PacketNumber:    pn,
+			PacketNumberLen: protocol.PacketNumberLen1,
+		}
+		b := &bytes.Buffer{}
+		Expect(hdr.Write(b, version, protocol.PerspectiveClient)).To(Succeed())
+		payloadStartIndex := b.Len()
+		frame := &wire.StreamFrame{StreamID: 1, Offset: offset, Data: chlo.Bytes()}
+		Expect(frame.Write(b, version)).To(Succeed())
+		raw := b.Bytes()
+		aead := crypto.NewNullAEAD(protocol.PerspectiveClient, version)
+		return append(raw[:payloadStartIndex], aead.Seal(nil, raw[payloadStartIndex:], pn, raw[:payloadStartIndex])...)
+	}
+
+	// parseRetry parses the packet sent by the server, and returns the frames it contains
+	parseRetry := func(data []byte) []wire.Frame {
+		r := bytes.NewReader(data)
+		hdr, err := wire.ParsePublicHeader(r, protocol.PerspectiveServer, version)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hdr.ConnectionID).To(Equal(connID))
+		Expect(hdr.PacketNumber).To(Equal(statelessRetryPacketNumber))
+		unpacker := &packetUnpacker{
+			version: version,
+			aead:    &nullAEADOpener{aead: crypto.NewNullAEAD(protocol.PerspectiveClient, version)},
+		}
+		packet, err := unpacker.Unpack(data[:len(data)-r.Len()], hdr, data[len(data)-r.Len():])
+		Expect(err).ToNot(HaveOccurred())
+		return packet.frames
+	}
+
+	// getToken handles a first packet, and returns the token sent in the stateless retry
+	getToken := func() []byte {
+		Expect(serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, nil))).To(Succeed())
+		frames := parseRetry(conn.dataWritten.Bytes())
+		conn.dataWritten.Reset()
+		msg, err := handshake.ParseHandshakeMessage(bytes.NewReader(frames[1].(*wire.StreamFrame).Data))
+		Expect(err).ToNot(HaveOccurred())
+		return msg.Data[handshake.TagSTK]
+	}
+
+	BeforeEach(func() {
+		createdSessions = nil
+		conn = &mockPacketConn{addr: &net.UDPAddr{}}
+		kex, err := crypto.NewCurve25519KEX()
+		Expect(err).ToNot(HaveOccurred())
+		scfg, err := handshake.NewServerConfig(kex, crypto.NewCertChain(testdata.GetTLSConfig()))
+		Expect(err).ToNot(HaveOccurred())
+		serv = &server{
+			sessions:     newSessionMap(),
+			conns:        []net.PacketConn{conn},
+			scfg:         scfg,
+			config:       populateServerConfig(&Config{Versions: []protocol.VersionNumber{version}, StatelessRetryThreshold: -1}),
+			sessionQueue: make(chan Session, 5),
+			errorChan:    make(chan struct{}),
+			newSession: func(c connection, v protocol.VersionNumber, connID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config, retry *statelessRetry) (packetHandler, <-chan handshakeEvent, error) {
+				createdSessions = append(createdSessions, retry)
+				return newMockSession(c, v, connID, sCfg, tlsConf, config, retry)
+			},
+		}
+	})
+
+	AfterEach(func() {
+		for _, sess := range serv.sessions.openSessions() {
+			sess.Close(nil)
+		}
+	})
+
+	It("sends a stateless retry for a CHLO without a token", func() {
+		err := serv.handlePacket(conn, remoteAddr, composeCHLOPacket(3, 0, nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serv.sessions.len()).To(BeZero())
+		Expect(conn.dataWrittenTo).To(Equal(remoteAddr))
+		frames := parseRetry(conn.dataWritten.Bytes())
+		Expect(frames).To(HaveLen(2))
+		// the packet containing the CHLO is acknowledged
+		Expect(frames[0]).To(BeAssignableToTypeOf(&wire.AckFrame{}))
+		Expect(frames[0].(*wire.AckFrame).LargestAcked).To(Equal(protocol.PacketNumber(3)))
+		Expect(frames[0].(*wire.AckFrame).LowestAcked).To(Equal(protocol.PacketNumber(3)))
+		streamFrame := frames[1].(*wire.StreamFrame)
+		Expect(streamFrame.StreamID).To(Equal(protocol.StreamID(1)))
+		Expect(streamFrame.Offset).To(BeZero())
+		msg, err := handshake.ParseHandshakeMessage(bytes.NewReader(streamFrame.Data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Tag).To(Equal(handshake.TagREJ))
+		Expect(msg.Data).To(HaveKey(handshake.TagSTK))
+	})
+
+	It("creates a session when the client sends back the token", func() {
+		token := getToken()
+		chloLen := protocol.ByteCount(1000)
+		err := serv.handlePacket(conn, remoteAddr, composeCHLOPacket(2, chloLen, token))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.dataWritten.Len()).To(BeZero())
+		Expect(getSession(serv.sessions, connID)).ToNot(BeNil())
+		Expect(createdSessions).To(Equal([]*statelessRetry{{
+			packetNumber:      statelessRetryPacketNumber,
+			cryptoReadOffset:  chloLen,
+			cryptoWriteOffset: handshake.RetryMessageLen(token),
+		}}))
+	})
+
+	It("creates a session if the first CHLO contains a valid token", func() {
+		token := getToken()
+		err := serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, token))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getSession(serv.sessions, connID)).ToNot(BeNil())
+		Expect(createdSessions).To(Equal([]*statelessRetry{nil}))
+	})
+
+	It("sends another stateless retry if the token is not accepted", func() {
+		token := getToken()
+		serv.config.AcceptCookie = func(net.Addr, *Cookie) bool { return false }
+		err := serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, token))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serv.sessions.len()).To(BeZero())
+		Expect(conn.dataWritten.Len()).ToNot(BeZero())
+	})
+
+	It("ignores later CHLOs without a valid token", func() {
+		err := serv.handlePacket(conn, remoteAddr, composeCHLOPacket(2, 1000, []byte("invalid token")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serv.sessions.len()).To(BeZero())
+		Expect(conn.dataWritten.Len()).To(BeZero())
+	})
+
+	Context("threshold", func() {
+		BeforeEach(func() {
+			serv.config.StatelessRetryThreshold = 2
+		})
+
+		It("only sends stateless retries once the number of handshakes reaches the threshold", func() {
+			Expect(serv.statelessRetryRequired(version)).To(BeFalse())
+			Expect(serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, nil))).To(Succeed())
+			Expect(serv.sessions.len()).To(Equal(1))
+			Expect(serv.statelessRetryRequired(version)).To(BeFalse())
+			serv.handshakesInProgress = 2
+			Expect(serv.statelessRetryRequired(version)).To(BeTrue())
+		})
+
+		It("counts the handshakes in progress", func() {
+			Expect(serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, nil))).To(Succeed())
+			Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeEquivalentTo(1))
+			sess := getSession(serv.sessions, connID).(*mockSession)
+			sess.handshakeChan <- handshakeEvent{encLevel: protocol.EncryptionForwardSecure}
+			Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeZero())
+		})
+
+		It("decreases the number of handshakes in progress when a handshake fails", func() {
+			Expect(serv.handlePacket(conn, remoteAddr, composeCHLOPacket(1, 0, nil))).To(Succeed())
+			Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeEquivalentTo(1))
+			sess := getSession(serv.sessions, connID).(*mockSession)
+			sess.handshakeChan <- handshakeEvent{err: errors.New("handshake failed")}
+			Eventually(func() int32 { return atomic.LoadInt32(&serv.handshakesInProgress) }).Should(BeZero())
+		})
+	})
+
+	It("never sends stateless retries if the threshold is 0", func() {
+		serv.config.StatelessRetryThreshold = 0
+		serv.handshakesInProgress = 1000
+		Expect(serv.statelessRetryRequired(version)).To(BeFalse())
+	})
+
+	It("doesn't send stateless retries for the TLS handshake", func() {
+		Expect(serv.statelessRetryRequired(protocol.VersionTLS)).To(BeFalse())
+	})
+})
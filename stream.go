@@ -26,7 +26,7 @@ type stream struct {
 	streamID protocol.StreamID
 	onData   func()
 	// onReset is a callback that should send a RST_STREAM
-	onReset func(protocol.StreamID, protocol.ByteCount)
+	onReset func(protocol.StreamID, protocol.ByteCount, protocol.ApplicationErrorCode)
 
 	readPosInFrame int
 	writeOffset    protocol.ByteCount
@@ -51,6 +51,12 @@ type stream struct {
 	readDeadline time.Time
 
 	dataForWriting []byte
+	// chunks of data read by ReadFrom, that are sent after dataForWriting
+	queuedDataForWriting    [][]byte
+	lenQueuedDataForWriting protocol.ByteCount
+	// sendBufferSize is the maximum number of bytes buffered in dataForWriting
+	// if it is 0, Write blocks until all data was sent
+	sendBufferSize protocol.ByteCount
 	finSent        utils.AtomicBool
 	rstSent        utils.AtomicBool
 	writeChan      chan struct{}
@@ -70,15 +76,18 @@ func (deadlineError) Timeout() bool   { return true }
 var errDeadline net.Error = &deadlineError{}
 
 // newStream creates a new Stream
+// If sendBufferSize is 0, writes are not buffered.
 func newStream(StreamID protocol.StreamID,
 	onData func(),
-	onReset func(protocol.StreamID, protocol.ByteCount),
-	flowControlManager flowcontrol.FlowControlManager) *stream {
+	onReset func(protocol.StreamID, protocol.ByteCount, protocol.ApplicationErrorCode),
+	flowControlManager flowcontrol.FlowControlManager,
+	sendBufferSize protocol.ByteCount) *stream {
 	s := &stream{
 		onData:             onData,
 		onReset:            onReset,
 		streamID:           StreamID,
 		flowControlManager: flowControlManager,
+		sendBufferSize:     sendBufferSize,
 		frameQueue:         newStreamFrameSorter(),
 		readChan:           make(chan struct{}, 1),
 		writeChan:          make(chan struct{}, 1),
@@ -87,6 +96,28 @@ func newStream(StreamID protocol.StreamID,
 	return s
 }
 
+// setInitialOffsets sets the offsets to start reading and writing at.
+// It is used for the crypto stream, if data was exchanged before the stream was created.
+// It must be called before any data is received or sent on the stream.
+func (s *stream) setInitialOffsets(readOffset, writeOffset protocol.ByteCount) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.flowControlManager.UpdateHighestReceived(s.streamID, readOffset); err != nil {
+		return err
+	}
+	if err := s.flowControlManager.AddBytesRead(s.streamID, readOffset); err != nil {
+		return err
+	}
+	if err := s.flowControlManager.AddBytesSent(s.streamID, writeOffset); err != nil {
+		return err
+	}
+	s.readOffset = readOffset
+	s.writeOffset = writeOffset
+	s.frameQueue.skipTo(readOffset)
+	return nil
+}
+
 // Read implements io.Reader. It is not thread safe!
 func (s *stream) Read(p []byte) (int, error) {
 	s.mutex.Lock()
@@ -108,38 +139,7 @@ func (s *stream) Read(p []byte) (int, error) {
 			s.mutex.Unlock()
 			return bytesRead, err
 		}
-
-		var err error
-		for {
-			// Stop waiting on errors
-			if s.resetLocally.Get() || s.cancelled.Get() {
-				err = s.err
-				break
-			}
-
-			deadline := s.readDeadline
-			if !deadline.IsZero() && !time.Now().Before(deadline) {
-				err = errDeadline
-				break
-			}
-
-			if frame != nil {
-				s.readPosInFrame = int(s.readOffset - frame.Offset)
-				break
-			}
-
-			s.mutex.Unlock()
-			if deadline.IsZero() {
-				<-s.readChan
-			} else {
-				select {
-				case <-s.readChan:
-				case <-time.After(deadline.Sub(time.Now())):
-				}
-			}
-			s.mutex.Lock()
-			frame = s.frameQueue.Head()
-		}
+		frame, err := s.waitForFrame()
 		s.mutex.Unlock()
 
 		if err != nil {
@@ -155,30 +155,113 @@ func (s *stream) Read(p []byte) (int, error) {
 			return bytesRead, fmt.Errorf("BUG: readPosInFrame (%d) > frame.DataLen (%d) in stream.Read", s.readPosInFrame, frame.DataLen())
 		}
 		copy(p[bytesRead:], frame.Data[s.readPosInFrame:])
-
-		s.readPosInFrame += m
 		bytesRead += m
-		s.readOffset += protocol.ByteCount(m)
 
-		// when a RST_STREAM was received, the was already informed about the final byteOffset for this stream
-		if !s.resetRemotely.Get() {
-			s.flowControlManager.AddBytesRead(s.streamID, protocol.ByteCount(m))
+		if fin := s.consumeFrameData(frame, m); fin {
+			return bytesRead, io.EOF
 		}
-		s.onData() // so that a possible WINDOW_UPDATE is sent
+	}
 
-		if s.readPosInFrame >= int(frame.DataLen()) {
-			fin := frame.FinBit
-			s.mutex.Lock()
-			s.frameQueue.Pop()
-			s.mutex.Unlock()
-			if fin {
-				s.finishedReading.Set(true)
-				return bytesRead, io.EOF
+	return bytesRead, nil
+}
+
+// WriteTo implements io.WriterTo.
+// It writes the data of the received StreamFrames directly to w, until the stream is finished or an error occurs.
+// The data is not copied to an intermediate buffer, and the buffers are returned to the buffer pool once the data was written.
+// It must not be used concurrently with Read.
+func (s *stream) WriteTo(w io.Writer) (int64, error) {
+	s.mutex.Lock()
+	err := s.err
+	s.mutex.Unlock()
+	if s.cancelled.Get() || s.resetLocally.Get() {
+		return 0, err
+	}
+	if s.finishedReading.Get() {
+		return 0, nil
+	}
+
+	var bytesWritten int64
+	for {
+		s.mutex.Lock()
+		frame, err := s.waitForFrame()
+		s.mutex.Unlock()
+		if err != nil {
+			return bytesWritten, err
+		}
+
+		var m int
+		if data := frame.Data[s.readPosInFrame:]; len(data) > 0 {
+			m, err = w.Write(data)
+			bytesWritten += int64(m)
+		}
+		if fin := s.consumeFrameData(frame, m); fin {
+			return bytesWritten, err
+		}
+		if err != nil {
+			return bytesWritten, err
+		}
+	}
+}
+
+// waitForFrame waits until data can be read from the frame queue, or an error occurs
+// s.mutex must be held when calling this function, it is held again when it returns
+func (s *stream) waitForFrame() (*wire.StreamFrame, error) {
+	frame := s.frameQueue.Head()
+	for {
+		// Stop waiting on errors
+		if s.resetLocally.Get() || s.cancelled.Get() {
+			return nil, s.err
+		}
+
+		deadline := s.readDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, errDeadline
+		}
+
+		if frame != nil {
+			s.readPosInFrame = int(s.readOffset - frame.Offset)
+			return frame, nil
+		}
+
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.readChan
+		} else {
+			select {
+			case <-s.readChan:
+			case <-time.After(deadline.Sub(time.Now())):
 			}
 		}
+		s.mutex.Lock()
+		frame = s.frameQueue.Head()
 	}
+}
 
-	return bytesRead, nil
+// consumeFrameData must be called after n bytes of the frame returned by waitForFrame were read
+// When the frame was read completely, it is removed from the frame queue, and its buffer is returned to the buffer pool.
+// It returns true if the frame was the last frame of the stream.
+func (s *stream) consumeFrameData(frame *wire.StreamFrame, n int) bool {
+	s.readPosInFrame += n
+	s.readOffset += protocol.ByteCount(n)
+
+	// when a RST_STREAM was received, the was already informed about the final byteOffset for this stream
+	if !s.resetRemotely.Get() {
+		s.flowControlManager.AddBytesRead(s.streamID, protocol.ByteCount(n))
+	}
+	s.onData() // so that a possible WINDOW_UPDATE is sent
+
+	if s.readPosInFrame < int(frame.DataLen()) {
+		return false
+	}
+	fin := frame.FinBit
+	s.mutex.Lock()
+	s.frameQueue.Pop()
+	s.mutex.Unlock()
+	frame.PutData()
+	if fin {
+		s.finishedReading.Set(true)
+	}
+	return fin
 }
 
 func (s *stream) Write(p []byte) (int, error) {
@@ -194,6 +277,9 @@ func (s *stream) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if s.sendBufferSize != 0 {
+		return s.writeBuffered(p)
+	}
 
 	s.dataForWriting = make([]byte, len(p))
 	copy(s.dataForWriting, p)
@@ -231,16 +317,124 @@ func (s *stream) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// writeBuffered copies p to the send buffer.
+// It only blocks if the buffer is full, until enough data was sent to make room for the rest of p.
+// Small writes are coalesced into larger StreamFrames, if they are written faster than the data can be sent.
+// s.mutex must be held.
+func (s *stream) writeBuffered(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		space, err := s.waitForSendBufferSpace()
+		if err != nil {
+			return n, err
+		}
+		m := utils.Min(space, len(p)-n)
+		if l := len(s.queuedDataForWriting); l > 0 {
+			s.queuedDataForWriting[l-1] = append(s.queuedDataForWriting[l-1], p[n:n+m]...)
+			s.lenQueuedDataForWriting += protocol.ByteCount(m)
+		} else {
+			s.dataForWriting = append(s.dataForWriting, p[n:n+m]...)
+		}
+		n += m
+		s.onData()
+	}
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom.
+// It reads from r directly into the send buffer, until r returns an io.EOF or an error occurs.
+// If the stream doesn't use a send buffer, the data is written using Write.
+func (s *stream) ReadFrom(r io.Reader) (int64, error) {
+	if s.sendBufferSize == 0 {
+		// hide the ReadFrom method, such that io.Copy doesn't call it again
+		return io.Copy(struct{ io.Writer }{s}, r)
+	}
+
+	var bytesRead int64
+	for {
+		s.mutex.Lock()
+		if s.resetLocally.Get() || s.err != nil {
+			s.mutex.Unlock()
+			return bytesRead, s.err
+		}
+		if s.finishedWriting.Get() {
+			s.mutex.Unlock()
+			return bytesRead, fmt.Errorf("write on closed stream %d", s.streamID)
+		}
+		space, err := s.waitForSendBufferSpace()
+		s.mutex.Unlock()
+		if err != nil {
+			return bytesRead, err
+		}
+
+		chunk := make([]byte, utils.Min(space, protocol.StreamReadFromChunkSize))
+		n, err := r.Read(chunk)
+		if n > 0 {
+			s.mutex.Lock()
+			if s.dataForWriting == nil {
+				s.dataForWriting = chunk[:n]
+			} else {
+				s.queuedDataForWriting = append(s.queuedDataForWriting, chunk[:n])
+				s.lenQueuedDataForWriting += protocol.ByteCount(n)
+			}
+			s.onData()
+			s.mutex.Unlock()
+			bytesRead += int64(n)
+		}
+		if err == io.EOF {
+			return bytesRead, nil
+		}
+		if err != nil {
+			return bytesRead, err
+		}
+	}
+}
+
+// waitForSendBufferSpace waits until there is space in the send buffer, or an error occurs
+// s.mutex must be held when calling this function, it is held again when it returns
+func (s *stream) waitForSendBufferSpace() (int, error) {
+	for {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if space := int(s.sendBufferSize) - len(s.dataForWriting) - int(s.lenQueuedDataForWriting); space > 0 {
+			return space, nil
+		}
+
+		deadline := s.writeDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, errDeadline
+		}
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.writeChan
+		} else {
+			select {
+			case <-s.writeChan:
+			case <-time.After(deadline.Sub(time.Now())):
+			}
+		}
+		s.mutex.Lock()
+	}
+}
+
 func (s *stream) lenOfDataForWriting() protocol.ByteCount {
 	s.mutex.Lock()
 	var l protocol.ByteCount
 	if s.err == nil {
-		l = protocol.ByteCount(len(s.dataForWriting))
+		l = protocol.ByteCount(len(s.dataForWriting)) + s.lenQueuedDataForWriting
 	}
 	s.mutex.Unlock()
 	return l
 }
 
+// lenOfBufferedData returns the number of bytes of received data that are buffered in the frame queue
+func (s *stream) lenOfBufferedData() protocol.ByteCount {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.frameQueue.queuedBytes
+}
+
 func (s *stream) getDataForWriting(maxBytes protocol.ByteCount) []byte {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -256,13 +450,20 @@ func (s *stream) getDataForWriting(maxBytes protocol.ByteCount) []byte {
 	} else {
 		ret = s.dataForWriting
 		s.dataForWriting = nil
-		s.signalWrite()
+		if len(s.queuedDataForWriting) > 0 {
+			s.dataForWriting = s.queuedDataForWriting[0]
+			s.queuedDataForWriting = s.queuedDataForWriting[1:]
+			s.lenQueuedDataForWriting -= protocol.ByteCount(len(s.dataForWriting))
+		}
 	}
+	// a buffered Write might be waiting for space in the send buffer
+	s.signalWrite()
 	s.writeOffset += protocol.ByteCount(len(ret))
 	return ret
 }
 
 // Close implements io.Closer
+// Data remaining in the send buffer is sent before the FIN.
 func (s *stream) Close() error {
 	s.finishedWriting.Set(true)
 	s.ctxCancel()
@@ -299,7 +500,9 @@ func (s *stream) AddStreamFrame(frame *wire.StreamFrame) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	err = s.frameQueue.Push(frame)
-	if err != nil && err != errDuplicateStreamData {
+	if err == errDuplicateStreamData {
+		frame.PutData()
+	} else if err != nil {
 		return err
 	}
 	s.signalRead()
@@ -372,7 +575,7 @@ func (s *stream) Cancel(err error) {
 }
 
 // resets the stream locally
-func (s *stream) Reset(err error) {
+func (s *stream) Reset(code ErrorCode) {
 	if s.resetLocally.Get() {
 		return
 	}
@@ -381,19 +584,20 @@ func (s *stream) Reset(err error) {
 	s.ctxCancel()
 	// errors must not be changed!
 	if s.err == nil {
-		s.err = err
+		s.err = &ApplicationError{Code: code}
 		s.signalRead()
 		s.signalWrite()
 	}
 	if s.shouldSendReset() {
-		s.onReset(s.streamID, s.writeOffset)
+		s.onReset(s.streamID, s.writeOffset, code)
 		s.rstSent.Set(true)
 	}
 	s.mutex.Unlock()
 }
 
 // resets the stream remotely
-func (s *stream) RegisterRemoteError(err error) {
+// The RST_STREAM sent in response carries the same error code.
+func (s *stream) RegisterRemoteError(code ErrorCode) {
 	if s.resetRemotely.Get() {
 		return
 	}
@@ -402,11 +606,11 @@ func (s *stream) RegisterRemoteError(err error) {
 	s.ctxCancel()
 	// errors must not be changed!
 	if s.err == nil {
-		s.err = err
+		s.err = &ApplicationError{Code: code, Remote: true}
 		s.signalWrite()
 	}
 	if s.shouldSendReset() {
-		s.onReset(s.streamID, s.writeOffset)
+		s.onReset(s.streamID, s.writeOffset, code)
 		s.rstSent.Set(true)
 	}
 	s.mutex.Unlock()
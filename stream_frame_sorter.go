@@ -12,6 +12,8 @@ type streamFrameSorter struct {
 	queuedFrames map[protocol.ByteCount]*wire.StreamFrame
 	readPosition protocol.ByteCount
 	gaps         *utils.ByteIntervalList
+	// the number of bytes held in queuedFrames
+	queuedBytes protocol.ByteCount
 }
 
 var (
@@ -29,6 +31,13 @@ func newStreamFrameSorter() *streamFrameSorter {
 	return &s
 }
 
+// skipTo starts the stream at the given offset.
+// It must be called before any frame is pushed.
+func (s *streamFrameSorter) skipTo(offset protocol.ByteCount) {
+	s.readPosition = offset
+	s.gaps.Front().Value.Start = offset
+}
+
 func (s *streamFrameSorter) Push(frame *wire.StreamFrame) error {
 	if frame.DataLen() == 0 {
 		if frame.FinBit {
@@ -89,7 +98,16 @@ func (s *streamFrameSorter) Push(frame *wire.StreamFrame) error {
 			break
 		}
 		// delete queued frames completely covered by the current frame
-		delete(s.queuedFrames, endGap.Value.End)
+		// the data between two gaps may consist of multiple consecutive frames
+		for offset := endGap.Value.End; offset < nextEndGap.Value.Start; {
+			coveredFrame, ok := s.queuedFrames[offset]
+			if !ok || coveredFrame.DataLen() == 0 {
+				break
+			}
+			s.queuedBytes -= coveredFrame.DataLen()
+			delete(s.queuedFrames, offset)
+			offset += coveredFrame.DataLen()
+		}
 		endGap = nextEndGap
 	}
 
@@ -136,10 +154,12 @@ func (s *streamFrameSorter) Push(frame *wire.StreamFrame) error {
 	if wasCut {
 		data := make([]byte, frame.DataLen())
 		copy(data, frame.Data)
+		frame.PutData()
 		frame.Data = data
 	}
 
 	s.queuedFrames[frame.Offset] = frame
+	s.queuedBytes += frame.DataLen()
 	return nil
 }
 
@@ -147,6 +167,7 @@ func (s *streamFrameSorter) Pop() *wire.StreamFrame {
 	frame := s.Head()
 	if frame != nil {
 		s.readPosition += frame.DataLen()
+		s.queuedBytes -= frame.DataLen()
 		delete(s.queuedFrames, frame.Offset)
 	}
 	return frame
@@ -30,6 +30,16 @@ var _ = Describe("StreamFrame sorter", func() {
 		Expect(s.Head()).To(BeNil())
 	})
 
+	It("skips to an offset", func() {
+		s.skipTo(10)
+		checkGaps([]utils.ByteInterval{{Start: 10, End: protocol.MaxByteCount}})
+		err := s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})
+		Expect(err).To(MatchError(errDuplicateStreamData))
+		f := &wire.StreamFrame{Offset: 10, Data: []byte("foobar")}
+		Expect(s.Push(f)).To(Succeed())
+		Expect(s.Head()).To(Equal(f))
+	})
+
 	Context("Push", func() {
 		It("inserts and pops a single frame", func() {
 			f := &wire.StreamFrame{
@@ -67,6 +77,31 @@ var _ = Describe("StreamFrame sorter", func() {
 			Expect(err).To(MatchError(errEmptyStreamData))
 		})
 
+		Context("counting queued bytes", func() {
+			It("counts the bytes of pushed and popped frames", func() {
+				Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+				Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("foobar2")})).To(Succeed())
+				Expect(s.queuedBytes).To(Equal(protocol.ByteCount(6 + 7)))
+				s.Pop()
+				Expect(s.queuedBytes).To(Equal(protocol.ByteCount(7)))
+			})
+
+			It("doesn't count duplicate data", func() {
+				Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+				Expect(s.Push(&wire.StreamFrame{Offset: 3, Data: []byte("barfoo")})).To(Succeed())
+				Expect(s.queuedBytes).To(Equal(protocol.ByteCount(9)))
+			})
+
+			It("removes all frames covered by a new frame", func() {
+				Expect(s.Push(&wire.StreamFrame{Offset: 5, Data: []byte("12345")})).To(Succeed())
+				Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("12345")})).To(Succeed())
+				Expect(s.Push(&wire.StreamFrame{Offset: 20, Data: []byte("12345")})).To(Succeed())
+				Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: bytes.Repeat([]byte{'f'}, 30)})).To(Succeed())
+				Expect(s.queuedFrames).To(HaveLen(1))
+				Expect(s.queuedBytes).To(Equal(protocol.ByteCount(30)))
+			})
+		})
+
 		Context("FinBit handling", func() {
 			It("saves a FinBit frame at offset 0", func() {
 				f := &wire.StreamFrame{
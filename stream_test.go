@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"runtime"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/mocks/mocks_fc"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
 	. "github.com/onsi/ginkgo"
@@ -29,6 +31,7 @@ var _ = Describe("Stream", func() {
 		resetCalled          bool
 		resetCalledForStream protocol.StreamID
 		resetCalledAtOffset  protocol.ByteCount
+		resetCalledWithCode  protocol.ApplicationErrorCode
 
 		mockFcm *mocks_fc.MockFlowControlManager
 	)
@@ -49,17 +52,18 @@ var _ = Describe("Stream", func() {
 		onDataCalled = true
 	}
 
-	onReset := func(id protocol.StreamID, offset protocol.ByteCount) {
+	onReset := func(id protocol.StreamID, offset protocol.ByteCount, code protocol.ApplicationErrorCode) {
 		resetCalled = true
 		resetCalledForStream = id
 		resetCalledAtOffset = offset
+		resetCalledWithCode = code
 	}
 
 	BeforeEach(func() {
 		onDataCalled = false
 		resetCalled = false
 		mockFcm = mocks_fc.NewMockFlowControlManager(mockCtrl)
-		str = newStream(streamID, onData, onReset, mockFcm)
+		str = newStream(streamID, onData, onReset, mockFcm, 0)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = struct {
@@ -75,6 +79,34 @@ var _ = Describe("Stream", func() {
 		Expect(str.StreamID()).To(Equal(protocol.StreamID(1337)))
 	})
 
+	Context("initial offsets", func() {
+		It("starts reading and writing at the initial offsets", func() {
+			mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(10))
+			mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(10))
+			mockFcm.EXPECT().AddBytesSent(streamID, protocol.ByteCount(6))
+			Expect(str.setInitialOffsets(10, 6)).To(Succeed())
+			Expect(str.writeOffset).To(Equal(protocol.ByteCount(6)))
+			mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(14))
+			mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(4))
+			err := str.AddStreamFrame(&wire.StreamFrame{
+				Offset: 10,
+				Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 4)
+			n, err := strWithTimeout.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(4))
+			Expect(b).To(Equal([]byte{0xDE, 0xAD, 0xBE, 0xEF}))
+		})
+
+		It("returns flow control errors", func() {
+			testErr := errors.New("flow control violation")
+			mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(10)).Return(testErr)
+			Expect(str.setInitialOffsets(10, 6)).To(MatchError(testErr))
+		})
+	})
+
 	Context("reading", func() {
 		It("reads a single StreamFrame", func() {
 			mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(4))
@@ -344,6 +376,79 @@ var _ = Describe("Stream", func() {
 			})
 		})
 
+		Context("using WriteTo", func() {
+			It("writes all data until the FIN", func() {
+				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(3))
+				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(6))
+				mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(3)).Times(2)
+				err := str.AddStreamFrame(&wire.StreamFrame{Data: []byte("foo")})
+				Expect(err).ToNot(HaveOccurred())
+				err = str.AddStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar"), FinBit: true})
+				Expect(err).ToNot(HaveOccurred())
+				buf := &bytes.Buffer{}
+				n, err := str.WriteTo(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(int64(6)))
+				Expect(buf.Bytes()).To(Equal([]byte("foobar")))
+				Expect(onDataCalled).To(BeTrue())
+				n, err = str.WriteTo(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeZero())
+			})
+
+			It("continues where Read stopped", func() {
+				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(6))
+				mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(2))
+				mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(4))
+				err := str.AddStreamFrame(&wire.StreamFrame{Data: []byte("foobar"), FinBit: true})
+				Expect(err).ToNot(HaveOccurred())
+				b := make([]byte, 2)
+				_, err = strWithTimeout.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				buf := &bytes.Buffer{}
+				n, err := str.WriteTo(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(int64(4)))
+				Expect(buf.Bytes()).To(Equal([]byte("obar")))
+			})
+
+			It("returns frame data to the buffer pool", func() {
+				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(3))
+				mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(3))
+				data := append(utils.GetPacketBuffer(), []byte("foo")...)
+				frame := &wire.StreamFrame{Data: data, FinBit: true}
+				err := str.AddStreamFrame(frame)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.WriteTo(&bytes.Buffer{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Data).To(BeNil())
+			})
+
+			It("returns errors of the writer", func() {
+				testErr := errors.New("test error")
+				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(3))
+				mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(0))
+				err := str.AddStreamFrame(&wire.StreamFrame{Data: []byte("foo")})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.WriteTo(&errorWriter{err: testErr})
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("returns when the deadline expires", func() {
+				str.SetReadDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+				n, err := str.WriteTo(&bytes.Buffer{})
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+			})
+
+			It("returns the error when the stream is cancelled", func() {
+				testErr := errors.New("test error")
+				str.Cancel(testErr)
+				_, err := str.WriteTo(&bytes.Buffer{})
+				Expect(err).To(MatchError(testErr))
+			})
+		})
+
 		Context("closing", func() {
 			Context("with FIN bit", func() {
 				It("returns EOFs", func() {
@@ -480,7 +585,9 @@ var _ = Describe("Stream", func() {
 	})
 
 	Context("resetting", func() {
-		testErr := errors.New("testErr")
+		const errorCode ErrorCode = 0x1337
+		localErr := &ApplicationError{Code: errorCode}
+		remoteErr := &ApplicationError{Code: errorCode, Remote: true}
 
 		Context("reset by the peer", func() {
 			It("continues reading after receiving a remote error", func() {
@@ -490,7 +597,7 @@ var _ = Describe("Stream", func() {
 					Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
 				}
 				str.AddStreamFrame(&frame)
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				b := make([]byte, 4)
 				n, err := strWithTimeout.Read(b)
 				Expect(err).ToNot(HaveOccurred())
@@ -499,7 +606,7 @@ var _ = Describe("Stream", func() {
 
 			It("reads a delayed StreamFrame that arrives after receiving a remote error", func() {
 				mockFcm.EXPECT().UpdateHighestReceived(streamID, protocol.ByteCount(4))
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				frame := wire.StreamFrame{
 					Offset: 0,
 					Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
@@ -519,11 +626,11 @@ var _ = Describe("Stream", func() {
 					Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
 				}
 				str.AddStreamFrame(&frame)
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				b := make([]byte, 10)
 				n, err := strWithTimeout.Read(b)
 				Expect(b[0:4]).To(Equal(frame.Data))
-				Expect(err).To(MatchError(testErr))
+				Expect(err).To(MatchError(remoteErr))
 				Expect(n).To(Equal(4))
 			})
 
@@ -535,7 +642,7 @@ var _ = Describe("Stream", func() {
 					FinBit: true,
 				}
 				str.AddStreamFrame(&frame)
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				b := make([]byte, 10)
 				n, err := strWithTimeout.Read(b)
 				Expect(b[:4]).To(Equal(frame.Data))
@@ -551,7 +658,7 @@ var _ = Describe("Stream", func() {
 					FinBit: true,
 				}
 				str.AddStreamFrame(&frame)
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				b := make([]byte, 3)
 				_, err := strWithTimeout.Read(b)
 				Expect(err).ToNot(HaveOccurred())
@@ -572,7 +679,7 @@ var _ = Describe("Stream", func() {
 					Data:     []byte{0xDE, 0xAD, 0xBE, 0xEF},
 				}
 				str.AddStreamFrame(&frame)
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				b := make([]byte, 3)
 				_, err := strWithTimeout.Read(b)
 				Expect(err).ToNot(HaveOccurred())
@@ -584,10 +691,10 @@ var _ = Describe("Stream", func() {
 					defer GinkgoRecover()
 					n, err := strWithTimeout.Write([]byte("foobar"))
 					Expect(n).To(BeZero())
-					Expect(err).To(MatchError(testErr))
+					Expect(err).To(MatchError(remoteErr))
 					close(done)
 				}()
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Eventually(done).Should(BeClosed())
 
 			})
@@ -597,13 +704,13 @@ var _ = Describe("Stream", func() {
 				go func() {
 					defer GinkgoRecover()
 					n, err := strWithTimeout.Write([]byte("foobar"))
-					Expect(err).To(MatchError(testErr))
+					Expect(err).To(MatchError(remoteErr))
 					Expect(n).To(Equal(4))
 					close(done)
 				}()
 
 				Eventually(func() []byte { return str.getDataForWriting(4) }).ShouldNot(BeEmpty())
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Eventually(done).Should(BeClosed())
 			})
 
@@ -614,33 +721,34 @@ var _ = Describe("Stream", func() {
 					_, _ = strWithTimeout.Write([]byte("foobar"))
 					close(done)
 				}()
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				Expect(resetCalledForStream).To(Equal(protocol.StreamID(1337)))
 				Expect(resetCalledAtOffset).To(Equal(protocol.ByteCount(0x1000)))
+				Expect(resetCalledWithCode).To(Equal(errorCode))
 				Eventually(done).Should(BeClosed())
 			})
 
 			It("doesn't call onReset if it already sent a FIN", func() {
 				str.Close()
 				str.sentFin()
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("doesn't call onReset if the stream was reset locally before", func() {
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				resetCalled = false
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("doesn't call onReset twice, when it gets two remote errors", func() {
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				resetCalled = false
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 		})
@@ -652,20 +760,20 @@ var _ = Describe("Stream", func() {
 					defer GinkgoRecover()
 					n, err := strWithTimeout.Write([]byte("foobar"))
 					Expect(n).To(BeZero())
-					Expect(err).To(MatchError(testErr))
+					Expect(err).To(MatchError(localErr))
 					close(done)
 				}()
 				Consistently(done).ShouldNot(BeClosed())
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(str.getDataForWriting(6)).To(BeNil())
 				Eventually(done).Should(BeClosed())
 			})
 
 			It("doesn't allow further writes", func() {
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				n, err := strWithTimeout.Write([]byte("foobar"))
 				Expect(n).To(BeZero())
-				Expect(err).To(MatchError(testErr))
+				Expect(err).To(MatchError(localErr))
 				Expect(str.getDataForWriting(6)).To(BeNil())
 			})
 
@@ -676,11 +784,11 @@ var _ = Describe("Stream", func() {
 					b := make([]byte, 4)
 					n, err := strWithTimeout.Read(b)
 					Expect(n).To(BeZero())
-					Expect(err).To(MatchError(testErr))
+					Expect(err).To(MatchError(localErr))
 					close(done)
 				}()
 				Consistently(done).ShouldNot(BeClosed())
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Eventually(done).Should(BeClosed())
 			})
 
@@ -689,47 +797,48 @@ var _ = Describe("Stream", func() {
 				str.AddStreamFrame(&wire.StreamFrame{
 					Data: []byte("foobar"),
 				})
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				b := make([]byte, 6)
 				n, err := strWithTimeout.Read(b)
 				Expect(n).To(BeZero())
-				Expect(err).To(MatchError(testErr))
+				Expect(err).To(MatchError(localErr))
 			})
 
 			It("calls onReset", func() {
 				str.writeOffset = 0x1000
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				Expect(resetCalledForStream).To(Equal(protocol.StreamID(1337)))
 				Expect(resetCalledAtOffset).To(Equal(protocol.ByteCount(0x1000)))
+				Expect(resetCalledWithCode).To(Equal(errorCode))
 			})
 
 			It("doesn't call onReset if it already sent a FIN", func() {
 				str.Close()
 				str.sentFin()
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("doesn't call onReset if the stream was reset remotely before", func() {
-				str.RegisterRemoteError(testErr)
+				str.RegisterRemoteError(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				resetCalled = false
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("doesn't call onReset twice", func() {
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeTrue())
 				resetCalled = false
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("cancels the context", func() {
 				Expect(str.Context().Done()).ToNot(BeClosed())
-				str.Reset(testErr)
+				str.Reset(errorCode)
 				Expect(str.Context().Done()).To(BeClosed())
 			})
 		})
@@ -760,6 +869,21 @@ var _ = Describe("Stream", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("uses Write for ReadFrom, if the stream doesn't use a send buffer", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(int64(6)))
+				close(done)
+			}()
+			Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).Should(Equal(protocol.ByteCount(6)))
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.getDataForWriting(1000)).To(Equal([]byte("foobar")))
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("writes and gets data in two turns", func() {
 			done := make(chan struct{})
 			go func() {
@@ -942,6 +1066,153 @@ var _ = Describe("Stream", func() {
 				Expect(str.lenOfDataForWriting()).To(BeZero())
 			})
 		})
+
+		Context("using a send buffer", func() {
+			BeforeEach(func() {
+				str.sendBufferSize = 10
+			})
+
+			It("returns immediately, if the data fits into the buffer", func() {
+				n, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(6))
+				Expect(onDataCalled).To(BeTrue())
+				Expect(str.lenOfDataForWriting()).To(Equal(protocol.ByteCount(6)))
+			})
+
+			It("copies the slice", func() {
+				s := []byte("foo")
+				_, err := strWithTimeout.Write(s)
+				Expect(err).ToNot(HaveOccurred())
+				s[0] = 'v'
+				Expect(str.getDataForWriting(3)).To(Equal([]byte("foo")))
+			})
+
+			It("coalesces multiple writes", func() {
+				_, err := strWithTimeout.Write([]byte("foo"))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = strWithTimeout.Write([]byte("bar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.getDataForWriting(1000)).To(Equal([]byte("foobar")))
+				Expect(str.writeOffset).To(Equal(protocol.ByteCount(6)))
+			})
+
+			It("doesn't modify data that was already dequeued", func() {
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				data := str.getDataForWriting(3)
+				_, err = strWithTimeout.Write([]byte("1234567"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foo")))
+				Expect(str.getDataForWriting(1000)).To(Equal([]byte("bar1234567")))
+			})
+
+			It("blocks while the buffer is full", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := strWithTimeout.Write([]byte("foobar1234567"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(13))
+					close(done)
+				}()
+				Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).Should(Equal(protocol.ByteCount(10)))
+				Consistently(done).ShouldNot(BeClosed())
+				Expect(str.getDataForWriting(4)).To(Equal([]byte("foob")))
+				Eventually(done).Should(BeClosed())
+				Expect(str.getDataForWriting(1000)).To(Equal([]byte("ar1234567")))
+			})
+
+			It("returns how much was written when the deadline expires", func() {
+				str.SetWriteDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+				n, err := strWithTimeout.Write([]byte("foobar1234567"))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(Equal(10))
+			})
+
+			It("returns how much was written when the stream is cancelled", func() {
+				testErr := errors.New("test")
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := strWithTimeout.Write([]byte("foobar1234567"))
+					Expect(err).To(MatchError(testErr))
+					Expect(n).To(Equal(10))
+					close(done)
+				}()
+				Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).Should(Equal(protocol.ByteCount(10)))
+				str.Cancel(testErr)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("sends the FIN after the buffered data", func() {
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+				Expect(str.shouldSendFin()).To(BeFalse())
+				Expect(str.getDataForWriting(1000)).To(Equal([]byte("foobar")))
+				Expect(str.shouldSendFin()).To(BeTrue())
+			})
+
+			Context("using ReadFrom", func() {
+				It("reads into the send buffer", func() {
+					n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(int64(6)))
+					Expect(onDataCalled).To(BeTrue())
+					Expect(str.getDataForWriting(1000)).To(Equal([]byte("foobar")))
+				})
+
+				It("queues data behind buffered writes", func() {
+					_, err := strWithTimeout.Write([]byte("foo"))
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.ReadFrom(bytes.NewReader([]byte("bar")))
+					Expect(err).ToNot(HaveOccurred())
+					_, err = strWithTimeout.Write([]byte("baz"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.lenOfDataForWriting()).To(Equal(protocol.ByteCount(9)))
+					Expect(str.getDataForWriting(1000)).To(Equal([]byte("foo")))
+					Expect(str.getDataForWriting(1000)).To(Equal([]byte("barbaz")))
+					Expect(str.lenOfDataForWriting()).To(BeZero())
+					Expect(str.writeOffset).To(Equal(protocol.ByteCount(9)))
+				})
+
+				It("blocks while the buffer is full", func() {
+					done := make(chan struct{})
+					go func() {
+						defer GinkgoRecover()
+						n, err := str.ReadFrom(bytes.NewReader([]byte("foobar1234567")))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(n).To(Equal(int64(13)))
+						close(done)
+					}()
+					Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).Should(Equal(protocol.ByteCount(10)))
+					Consistently(done).ShouldNot(BeClosed())
+					Expect(str.getDataForWriting(1000)).To(Equal([]byte("foobar1234")))
+					Eventually(done).Should(BeClosed())
+					Expect(str.getDataForWriting(1000)).To(Equal([]byte("567")))
+				})
+
+				It("returns errors of the reader", func() {
+					testErr := errors.New("test error")
+					_, err := str.ReadFrom(&errorReader{err: testErr})
+					Expect(err).To(MatchError(testErr))
+				})
+
+				It("errors when the stream was closed", func() {
+					Expect(str.Close()).To(Succeed())
+					_, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+					Expect(err).To(MatchError("write on closed stream 1337"))
+				})
+
+				It("returns how much was read when the deadline expires", func() {
+					str.SetWriteDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+					n, err := str.ReadFrom(bytes.NewReader([]byte("foobar1234567")))
+					Expect(err).To(MatchError(errDeadline))
+					Expect(n).To(Equal(int64(10)))
+				})
+			})
+		})
 	})
 
 	It("errors when a StreamFrames causes a flow control violation", func() {
@@ -956,6 +1227,7 @@ var _ = Describe("Stream", func() {
 	})
 
 	Context("closing", func() {
+		const errorCode ErrorCode = 0x42
 		testErr := errors.New("testErr")
 
 		finishReading := func() {
@@ -993,28 +1265,28 @@ var _ = Describe("Stream", func() {
 
 		It("is finished after receiving a RST and sending one", func() {
 			// this directly sends a rst
-			str.RegisterRemoteError(testErr)
+			str.RegisterRemoteError(errorCode)
 			Expect(str.rstSent.Get()).To(BeTrue())
 			Expect(str.finished()).To(BeTrue())
 		})
 
 		It("cancels the context after receiving a RST", func() {
 			Expect(str.Context().Done()).ToNot(BeClosed())
-			str.RegisterRemoteError(testErr)
+			str.RegisterRemoteError(errorCode)
 			Expect(str.Context().Done()).To(BeClosed())
 		})
 
 		It("is finished after being locally reset and receiving a RST in response", func() {
-			str.Reset(testErr)
+			str.Reset(errorCode)
 			Expect(str.finished()).To(BeFalse())
-			str.RegisterRemoteError(testErr)
+			str.RegisterRemoteError(errorCode)
 			Expect(str.finished()).To(BeTrue())
 		})
 
 		It("is finished after finishing writing and receiving a RST", func() {
 			str.Close()
 			str.sentFin()
-			str.RegisterRemoteError(testErr)
+			str.RegisterRemoteError(errorCode)
 			Expect(str.finished()).To(BeTrue())
 		})
 
@@ -1023,8 +1295,16 @@ var _ = Describe("Stream", func() {
 			mockFcm.EXPECT().AddBytesRead(streamID, protocol.ByteCount(0))
 			finishReading()
 			Expect(str.finished()).To(BeFalse())
-			str.Reset(testErr)
+			str.Reset(errorCode)
 			Expect(str.finished()).To(BeTrue())
 		})
 	})
 })
+
+type errorWriter struct{ err error }
+
+func (w *errorWriter) Write([]byte) (int, error) { return 0, w.err }
+
+type errorReader struct{ err error }
+
+func (r *errorReader) Read([]byte) (int, error) { return 0, r.err }
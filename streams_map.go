@@ -302,6 +302,23 @@ func (m *streamsMap) RoundRobinIterate(fn streamLambda) error {
 	return nil
 }
 
+// Iterate executes the streamLambda for every open stream, until the streamLambda returns false
+func (m *streamsMap) Iterate(fn streamLambda) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, streamID := range m.openStreams {
+		cont, err := m.iterateFunc(streamID, fn)
+		if err != nil {
+			return err
+		}
+		if !cont {
+			break
+		}
+	}
+	return nil
+}
+
 func (m *streamsMap) iterateFunc(streamID protocol.StreamID, fn streamLambda) (bool, error) {
 	str, ok := m.streams[streamID]
 	if !ok {
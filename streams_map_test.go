@@ -28,7 +28,7 @@ var _ = Describe("Streams Map", func() {
 		mockPn.EXPECT().GetMaxIncomingStreams().AnyTimes().Return(uint32(maxIncomingStreams))
 
 		newStream := func(id protocol.StreamID) *stream {
-			return newStream(id, func() {}, nil, nil)
+			return newStream(id, func() {}, nil, nil, 0)
 		}
 		removeStreamCallback := func(protocol.StreamID) {}
 		m = newStreamsMap(newStream, removeStreamCallback, p, mockPn)
@@ -535,6 +535,36 @@ var _ = Describe("Streams Map", func() {
 			})
 		})
 
+		Context("Iterate", func() {
+			BeforeEach(func() {
+				for i := 4; i <= 6; i++ {
+					err := m.putStream(&stream{streamID: protocol.StreamID(i)})
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+
+			It("executes the lambda for every stream, without changing the RoundRobinIndex", func() {
+				var ids []protocol.StreamID
+				err := m.Iterate(func(str *stream) (bool, error) {
+					ids = append(ids, str.StreamID())
+					return true, nil
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids).To(Equal([]protocol.StreamID{4, 5, 6}))
+				Expect(m.roundRobinIndex).To(BeZero())
+			})
+
+			It("stops when the lambda returns false", func() {
+				var ids []protocol.StreamID
+				err := m.Iterate(func(str *stream) (bool, error) {
+					ids = append(ids, str.StreamID())
+					return str.StreamID() != 5, nil
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids).To(Equal([]protocol.StreamID{4, 5}))
+			})
+		})
+
 		Context("RoundRobinIterate", func() {
 			// create 5 streams, ids 4 to 8
 			var lambdaCalledForStream []protocol.StreamID